@@ -10,8 +10,10 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/logs"
 	"github.com/grafana/agent/pkg/metrics"
 	"github.com/grafana/agent/pkg/metrics/instance"
@@ -24,6 +26,7 @@ import (
 
 	"github.com/grafana/agent/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rfratto/ckit/peer"
 	"github.com/weaveworks/common/signals"
 
 	"github.com/go-kit/log/level"
@@ -39,6 +42,7 @@ type Entrypoint struct {
 	cfg config.Config
 
 	srv          *server.Server
+	clusterNode  *cluster.GossipNode
 	promMetrics  *metrics.Agent
 	lokiLogs     *logs.Logs
 	tempoTraces  *traces.Traces
@@ -70,7 +74,16 @@ func NewEntrypoint(logger *server.Logger, cfg *config.Config, reloader Reloader)
 		return nil, err
 	}
 
-	ep.promMetrics, err = metrics.New(reg, cfg.Metrics, logger)
+	var clusterer cluster.Node
+	if cfg.Metrics.ClusterEnabled {
+		ep.clusterNode, err = ep.newClusterNode(&cfg.Metrics.ClusterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("building cluster node: %w", err)
+		}
+		clusterer = ep.clusterNode
+	}
+
+	ep.promMetrics, err = metrics.New(reg, cfg.Metrics, clusterer, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +150,48 @@ func (ep *Entrypoint) createIntegrationsGlobals(cfg *config.Config) (config.Inte
 	}, nil
 }
 
+// newClusterNode creates a cluster node which communicates with its peers over
+// the gRPC server. The node isn't started until the Entrypoint is started.
+func (ep *Entrypoint) newClusterNode(cfg *cluster.GossipConfig) (*cluster.GossipNode, error) {
+	var grpcPort int
+	if ta, ok := ep.srv.GRPCAddress().(*net.TCPAddr); ok {
+		grpcPort = ta.Port
+	}
+
+	if err := cfg.ApplyDefaults(grpcPort); err != nil {
+		return nil, err
+	}
+	return cluster.NewGossipNode(ep.log, ep.srv.GRPC, cfg)
+}
+
+// runClusterNode joins the cluster and participates in it until ctx is
+// canceled. Peers are given the opportunity to take over the work of the
+// node before it leaves.
+func (ep *Entrypoint) runClusterNode(ctx context.Context) error {
+	// The node can only be started once the gRPC server is reachable, which
+	// happens concurrently when the Entrypoint starts.
+	if err := ep.clusterNode.Start(); err != nil {
+		return fmt.Errorf("failed to join cluster: %w", err)
+	}
+	if err := ep.clusterNode.ChangeState(ctx, peer.StateParticipant); err != nil {
+		return fmt.Errorf("failed to become a cluster participant: %w", err)
+	}
+	level.Info(ep.log).Log("msg", "joined cluster", "peers", len(ep.clusterNode.Peers()))
+
+	<-ctx.Done()
+
+	leaveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ep.clusterNode.ChangeState(leaveCtx, peer.StateTerminating); err != nil {
+		level.Warn(ep.log).Log("msg", "failed to move node to terminating state", "err", err)
+	}
+	if err := ep.clusterNode.Stop(); err != nil {
+		level.Warn(ep.log).Log("msg", "failed to leave cluster", "err", err)
+	}
+	return nil
+}
+
 // ApplyConfig applies changes to the subsystems of the Agent.
 func (ep *Entrypoint) ApplyConfig(cfg config.Config) error {
 	ep.mut.Lock()
@@ -322,6 +377,17 @@ func (ep *Entrypoint) Start() error {
 		srvCancel()
 	})
 
+	if ep.clusterNode != nil {
+		clusterContext, clusterCancel := context.WithCancel(context.Background())
+		defer clusterCancel()
+
+		g.Add(func() error {
+			return ep.runClusterNode(clusterContext)
+		}, func(e error) {
+			clusterCancel()
+		})
+	}
+
 	ep.mut.Lock()
 	cfg := ep.cfg
 	ep.mut.Unlock()
@@ -9,13 +9,22 @@ import (
 	_ "net/http/pprof" // anonymous import to get the pprof handler registered
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log/level"
 	"github.com/gorilla/mux"
+	"github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/flow"
 	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rfratto/ckit/peer"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 
 	// Install components
 	_ "github.com/grafana/agent/component/all"
@@ -39,12 +48,23 @@ func run() error {
 		httpListenAddr = "127.0.0.1:12345"
 		configFile     string
 		storagePath    = "data-agent/"
+
+		snapshotExports bool
+
+		clusterEnabled bool
+		clusterConfig  = cluster.DefaultGossipConfig
 	)
 
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fs.StringVar(&httpListenAddr, "server.http-listen-addr", httpListenAddr, "address to listen for http traffic on")
 	fs.StringVar(&configFile, "config.file", configFile, "path to config file to load")
 	fs.StringVar(&storagePath, "storage.path", storagePath, "Base directory where Flow components can store data")
+	fs.BoolVar(&snapshotExports, "storage.snapshot-exports", snapshotExports, "Persist component exports under storage.path so they are available immediately after a restart")
+	fs.BoolVar(&clusterEnabled, "cluster.enabled", clusterEnabled, "Join other agents in a cluster to distribute work")
+	fs.StringVar(&clusterConfig.NodeName, "cluster.node-name", clusterConfig.NodeName, "Name of the node within the cluster; defaults to the hostname")
+	fs.StringVar(&clusterConfig.AdvertiseAddr, "cluster.advertise-address", clusterConfig.AdvertiseAddr, "Address other nodes use to connect to this node; defaults to an address of the node")
+	fs.Var(&clusterConfig.JoinPeers, "cluster.join-address", "Address of a node to join the cluster at; can be given multiple times")
+	fs.StringVar(&clusterConfig.DiscoverPeers, "cluster.discover-peers", clusterConfig.DiscoverPeers, "go-discover configuration used to find nodes to join the cluster at")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return fmt.Errorf("error parsing flags: %w", err)
@@ -60,10 +80,40 @@ func run() error {
 		return fmt.Errorf("building logger: %w", err)
 	}
 
-	f := flow.New(flow.Options{
-		Logger:   l,
-		DataPath: storagePath,
-	})
+	t, err := tracing.New(tracing.DefaultOptions)
+	if err != nil {
+		return fmt.Errorf("building tracer: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = t.Shutdown(ctx)
+	}()
+
+	// Cluster nodes communicate over gRPC, which is served on the same
+	// address as HTTP traffic.
+	grpcSrv := grpc.NewServer()
+
+	var clusterNode *cluster.GossipNode
+	if clusterEnabled {
+		clusterNode, err = newClusterNode(l, grpcSrv, &clusterConfig, httpListenAddr)
+		if err != nil {
+			return fmt.Errorf("building cluster node: %w", err)
+		}
+	}
+
+	opts := flow.Options{
+		Logger:         l,
+		Tracer:         t,
+		DataPath:       storagePath,
+		HTTPListenAddr: httpListenAddr,
+
+		SnapshotExports: snapshotExports,
+	}
+	if clusterNode != nil {
+		opts.Clusterer = clusterNode
+	}
+	f := flow.New(opts)
 
 	reload := func() error {
 		flowCfg, err := loadFlowFile(configFile)
@@ -92,6 +142,8 @@ func run() error {
 		r.Handle("/-/config", f.ConfigHandler())
 		r.Handle("/metrics", promhttp.Handler())
 		r.Handle("/debug/graph", f.GraphHandler())
+		r.PathPrefix("/component/").Handler(f.ComponentHandler())
+		r.Handle("/api/v0/component/{id}/logs", f.ComponentLogsHandler())
 		r.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
 
 		r.HandleFunc("/-/reload", func(w http.ResponseWriter, _ *http.Request) {
@@ -103,7 +155,7 @@ func run() error {
 			fmt.Fprintln(w, "config reloaded")
 		})
 
-		srv := &http.Server{Handler: r}
+		srv := &http.Server{Handler: h2c.NewHandler(grpcHandler(grpcSrv, r), &http2.Server{})}
 
 		wg.Add(1)
 		go func() {
@@ -119,10 +171,65 @@ func run() error {
 		defer func() { _ = srv.Shutdown(ctx) }()
 	}
 
+	if clusterNode != nil {
+		// The node can only be started once the gRPC server is reachable.
+		if err := clusterNode.Start(); err != nil {
+			return fmt.Errorf("failed to join cluster: %w", err)
+		}
+		defer leaveCluster(l, clusterNode)
+
+		if err := clusterNode.ChangeState(ctx, peer.StateParticipant); err != nil {
+			return fmt.Errorf("failed to become a cluster participant: %w", err)
+		}
+		level.Info(l).Log("msg", "joined cluster", "node", clusterConfig.NodeName, "peers", len(clusterNode.Peers()))
+	}
+
 	<-ctx.Done()
 	return f.Close()
 }
 
+func newClusterNode(l *logging.Logger, srv *grpc.Server, cfg *cluster.GossipConfig, httpListenAddr string) (*cluster.GossipNode, error) {
+	_, portStr, err := net.SplitHostPort(httpListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http listen address: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http listen port: %w", err)
+	}
+
+	if err := cfg.ApplyDefaults(port); err != nil {
+		return nil, err
+	}
+	return cluster.NewGossipNode(l, srv, cfg)
+}
+
+// leaveCluster moves n out of the cluster, giving other nodes an opportunity
+// to take over its work before it stops.
+func leaveCluster(l *logging.Logger, n *cluster.GossipNode) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := n.ChangeState(ctx, peer.StateTerminating); err != nil {
+		level.Warn(l).Log("msg", "failed to move node to terminating state", "err", err)
+	}
+	if err := n.Stop(); err != nil {
+		level.Warn(l).Log("msg", "failed to leave cluster", "err", err)
+	}
+}
+
+// grpcHandler routes gRPC requests to grpcSrv and all other requests to
+// next.
+func grpcHandler(grpcSrv *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func loadFlowFile(filename string) (*flow.File, error) {
 	bb, err := os.ReadFile(filename)
 	if err != nil {
@@ -2,9 +2,31 @@
 package all
 
 import (
-	_ "github.com/grafana/agent/component/local/file"          // Import local.file
-	_ "github.com/grafana/agent/component/metrics/mutate"      // Import metrics.mutate
-	_ "github.com/grafana/agent/component/metrics/remotewrite" // Import metrics.remotewrite
-	_ "github.com/grafana/agent/component/metrics/scrape"      // Import metrics.scrape
-	_ "github.com/grafana/agent/component/targets/mutate"      // Import targets.mutate
+	_ "github.com/grafana/agent/component/discovery/file"                     // Import discovery.file
+	_ "github.com/grafana/agent/component/discovery/http"                     // Import discovery.http
+	_ "github.com/grafana/agent/component/local/file"                         // Import local.file
+	_ "github.com/grafana/agent/component/logs/file"                          // Import logs.file
+	_ "github.com/grafana/agent/component/logs/lokiwrite"                     // Import logs.loki_write
+	_ "github.com/grafana/agent/component/logs/process"                       // Import logs.process
+	_ "github.com/grafana/agent/component/metrics/exporter/all"               // Import metrics.exporter_*
+	_ "github.com/grafana/agent/component/metrics/expose"                     // Import metrics.expose
+	_ "github.com/grafana/agent/component/metrics/mutate"                     // Import metrics.mutate
+	_ "github.com/grafana/agent/component/metrics/recordingrules"             // Import metrics.recording_rules
+	_ "github.com/grafana/agent/component/metrics/remotewrite"                // Import metrics.remotewrite
+	_ "github.com/grafana/agent/component/metrics/remotewritereceiver"        // Import metrics.remote_write_receiver
+	_ "github.com/grafana/agent/component/metrics/scrape"                     // Import metrics.scrape
+	_ "github.com/grafana/agent/component/otelcol/exporter/otlp"              // Import otelcol.exporter_otlp
+	_ "github.com/grafana/agent/component/otelcol/exporter/otlphttp"          // Import otelcol.exporter_otlphttp
+	_ "github.com/grafana/agent/component/otelcol/processor/attributes"       // Import otelcol.processor_attributes
+	_ "github.com/grafana/agent/component/otelcol/processor/automaticlogging" // Import otelcol.processor_automatic_logging
+	_ "github.com/grafana/agent/component/otelcol/processor/batch"            // Import otelcol.processor_batch
+	_ "github.com/grafana/agent/component/otelcol/processor/promsd"           // Import otelcol.processor_promsd
+	_ "github.com/grafana/agent/component/otelcol/processor/servicegraph"     // Import otelcol.processor_service_graph
+	_ "github.com/grafana/agent/component/otelcol/receiver/otlp"              // Import otelcol.receiver_otlp
+	_ "github.com/grafana/agent/component/remote/http"                        // Import remote.http
+	_ "github.com/grafana/agent/component/remote/kubernetes"                  // Import remote.kubernetes_secret and remote.kubernetes_configmap
+	_ "github.com/grafana/agent/component/remote/vault"                       // Import remote.vault
+	_ "github.com/grafana/agent/component/targets/filter"                     // Import targets.filter
+	_ "github.com/grafana/agent/component/targets/merge"                      // Import targets.merge
+	_ "github.com/grafana/agent/component/targets/mutate"                     // Import targets.mutate
 )
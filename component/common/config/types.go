@@ -0,0 +1,247 @@
+// Package config contains types from github.com/prometheus/common/config,
+// but modifiable for HCL and capable of being used by Flow components.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	common_config "github.com/prometheus/common/config"
+	"github.com/rfratto/gohcl"
+)
+
+const bearer string = "Bearer"
+
+// HTTPClientConfig mirrors the common_config.HTTPClientConfig struct.
+type HTTPClientConfig struct {
+	BasicAuth       *BasicAuth     `hcl:"basic_auth,block"`
+	Authorization   *Authorization `hcl:"authorization,block"`
+	OAuth2          *OAuth2Config  `hcl:"oauth2,block"`
+	BearerToken     string         `hcl:"bearer_token,optional"`
+	BearerTokenFile string         `hcl:"bearer_token_file,optional"`
+	ProxyURL        string         `hcl:"proxy_url,optional"`
+	TLSConfig       *TLSConfig     `hcl:"tls_config,block"`
+	FollowRedirects bool           `hcl:"follow_redirects,optional"`
+	EnableHTTP2     bool           `hcl:"enable_http_2,optional"`
+}
+
+// DefaultHTTPClientConfig for initializing objects.
+var DefaultHTTPClientConfig = HTTPClientConfig{
+	FollowRedirects: true,
+	EnableHTTP2:     true,
+}
+
+var _ gohcl.Decoder = (*HTTPClientConfig)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (h *HTTPClientConfig) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*h = DefaultHTTPClientConfig
+
+	type httpClientConfig HTTPClientConfig
+	return gohcl.DecodeBody(body, ctx, (*httpClientConfig)(h))
+}
+
+// Convert converts HTTPClientConfig to the native Prometheus type. The
+// resulting config is validated before being returned.
+func (h *HTTPClientConfig) Convert() (*common_config.HTTPClientConfig, error) {
+	if h == nil {
+		return nil, nil
+	}
+
+	var proxyURL *url.URL
+	if h.ProxyURL != "" {
+		u, err := url.Parse(h.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		proxyURL = u
+	}
+
+	res := &common_config.HTTPClientConfig{
+		BasicAuth:       h.BasicAuth.Convert(),
+		Authorization:   h.Authorization.Convert(),
+		BearerToken:     common_config.Secret(h.BearerToken),
+		BearerTokenFile: h.BearerTokenFile,
+		ProxyURL:        common_config.URL{URL: proxyURL},
+		TLSConfig:       *h.TLSConfig.Convert(),
+		FollowRedirects: h.FollowRedirects,
+		EnableHTTP2:     h.EnableHTTP2,
+	}
+
+	oauth2, err := h.OAuth2.Convert()
+	if err != nil {
+		return nil, err
+	}
+	res.OAuth2 = oauth2
+
+	if err := ValidateHTTPClientConfig(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// BasicAuth configures Basic HTTP authentication credentials.
+type BasicAuth struct {
+	Username     string `hcl:"username,optional"`
+	Password     string `hcl:"password,optional"`
+	PasswordFile string `hcl:"password_file,optional"`
+}
+
+// Convert converts our type to the native prometheus type.
+func (b *BasicAuth) Convert() *common_config.BasicAuth {
+	if b == nil {
+		return nil
+	}
+	return &common_config.BasicAuth{
+		Username:     b.Username,
+		Password:     common_config.Secret(b.Password),
+		PasswordFile: b.PasswordFile,
+	}
+}
+
+// Authorization sets up HTTP authorization credentials.
+type Authorization struct {
+	Type            string `hcl:"authorization_type,optional"`
+	Credential      string `hcl:"authorization_credential,optional"`
+	CredentialsFile string `hcl:"authorization_credentials_file,optional"`
+}
+
+// Convert converts our type to the native prometheus type.
+func (a *Authorization) Convert() *common_config.Authorization {
+	if a == nil {
+		return nil
+	}
+	return &common_config.Authorization{
+		Type:            a.Type,
+		Credentials:     common_config.Secret(a.Credential),
+		CredentialsFile: a.CredentialsFile,
+	}
+}
+
+// TLSConfig sets up options for TLS connections.
+type TLSConfig struct {
+	CAFile             string `hcl:"ca_file,optional"`
+	CertFile           string `hcl:"cert_file,optional"`
+	KeyFile            string `hcl:"key_file,optional"`
+	ServerName         string `hcl:"server_name,optional"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+}
+
+// Convert converts our type to the native prometheus type. A nil TLSConfig
+// converts to an empty native TLSConfig.
+func (t *TLSConfig) Convert() *common_config.TLSConfig {
+	if t == nil {
+		return &common_config.TLSConfig{}
+	}
+	return &common_config.TLSConfig{
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+}
+
+// OAuth2Config sets up the OAuth2 client.
+type OAuth2Config struct {
+	ClientID         string            `hcl:"client_id,optional"`
+	ClientSecret     string            `hcl:"client_secret,optional"`
+	ClientSecretFile string            `hcl:"client_secret_file,optional"`
+	Scopes           []string          `hcl:"scopes,optional"`
+	TokenURL         string            `hcl:"token_url,optional"`
+	EndpointParams   map[string]string `hcl:"endpoint_params,optional"`
+	ProxyURL         string            `hcl:"proxy_url,optional"`
+	TLSConfig        *TLSConfig        `hcl:"tls_config,block"`
+}
+
+// Convert converts our type to the native prometheus type.
+func (o *OAuth2Config) Convert() (*common_config.OAuth2, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	var proxyURL *url.URL
+	if o.ProxyURL != "" {
+		u, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oauth2 proxy_url: %w", err)
+		}
+		proxyURL = u
+	}
+
+	return &common_config.OAuth2{
+		ClientID:         o.ClientID,
+		ClientSecret:     common_config.Secret(o.ClientSecret),
+		ClientSecretFile: o.ClientSecretFile,
+		Scopes:           o.Scopes,
+		TokenURL:         o.TokenURL,
+		EndpointParams:   o.EndpointParams,
+		ProxyURL:         common_config.URL{URL: proxyURL},
+		TLSConfig:        *o.TLSConfig.Convert(),
+	}, nil
+}
+
+// ValidateHTTPClientConfig validates that c doesn't have conflicting settings.
+// Legacy bearer_token and bearer_token_file settings are converted into an
+// equivalent authorization section in c.
+func ValidateHTTPClientConfig(c *common_config.HTTPClientConfig) error {
+	// Backwards compatibility with the bearer_token field.
+	if len(c.BearerToken) > 0 && len(c.BearerTokenFile) > 0 {
+		return fmt.Errorf("at most one of bearer_token & bearer_token_file must be configured")
+	}
+	if (c.BasicAuth != nil || c.OAuth2 != nil) && (len(c.BearerToken) > 0 || len(c.BearerTokenFile) > 0) {
+		return fmt.Errorf("at most one of basic_auth, oauth2, bearer_token & bearer_token_file must be configured")
+	}
+	if c.BasicAuth != nil && (string(c.BasicAuth.Password) != "" && c.BasicAuth.PasswordFile != "") {
+		return fmt.Errorf("at most one of basic_auth password & password_file must be configured")
+	}
+	if c.Authorization != nil {
+		if len(c.BearerToken) > 0 || len(c.BearerTokenFile) > 0 {
+			return fmt.Errorf("authorization is not compatible with bearer_token & bearer_token_file")
+		}
+		if string(c.Authorization.Credentials) != "" && c.Authorization.CredentialsFile != "" {
+			return fmt.Errorf("at most one of authorization credentials & credentials_file must be configured")
+		}
+		c.Authorization.Type = strings.TrimSpace(c.Authorization.Type)
+		if len(c.Authorization.Type) == 0 {
+			c.Authorization.Type = bearer
+		}
+		if strings.ToLower(c.Authorization.Type) == "basic" {
+			return fmt.Errorf(`authorization type cannot be set to "basic", use "basic_auth" instead`)
+		}
+		if c.BasicAuth != nil || c.OAuth2 != nil {
+			return fmt.Errorf("at most one of basic_auth, oauth2 & authorization must be configured")
+		}
+	} else {
+		if len(c.BearerToken) > 0 {
+			c.Authorization = &common_config.Authorization{Credentials: c.BearerToken}
+			c.Authorization.Type = bearer
+			c.BearerToken = ""
+		}
+		if len(c.BearerTokenFile) > 0 {
+			c.Authorization = &common_config.Authorization{CredentialsFile: c.BearerTokenFile}
+			c.Authorization.Type = bearer
+			c.BearerTokenFile = ""
+		}
+	}
+	if c.OAuth2 != nil {
+		if c.BasicAuth != nil {
+			return fmt.Errorf("at most one of basic_auth, oauth2 & authorization must be configured")
+		}
+		if len(c.OAuth2.ClientID) == 0 {
+			return fmt.Errorf("oauth2 client_id must be configured")
+		}
+		if len(c.OAuth2.ClientSecret) == 0 && len(c.OAuth2.ClientSecretFile) == 0 {
+			return fmt.Errorf("either oauth2 client_secret or client_secret_file must be configured")
+		}
+		if len(c.OAuth2.TokenURL) == 0 {
+			return fmt.Errorf("oauth2 token_url must be configured")
+		}
+		if len(c.OAuth2.ClientSecret) > 0 && len(c.OAuth2.ClientSecretFile) > 0 {
+			return fmt.Errorf("at most one of oauth2 client_secret & client_secret_file must be configured")
+		}
+	}
+	return nil
+}
@@ -51,7 +51,10 @@
 // creating a new one.
 package component
 
-import "context"
+import (
+	"context"
+	"net/http"
+)
 
 // The Arguments contains the input fields for a specific component, which is
 // unmarshaled from HCL.
@@ -104,3 +107,17 @@ type DebugComponent interface {
 	// DebugInfo must be safe for calling concurrently.
 	DebugInfo() interface{}
 }
+
+// HTTPComponent is an extension interface for components which serve HTTP
+// endpoints.
+type HTTPComponent interface {
+	Component
+
+	// Handler returns an http.Handler for the component. Requests are routed
+	// to the handler with the component's HTTPPath (see Options) stripped
+	// from the URL path.
+	//
+	// Handler is invoked for every request and must be safe for calling
+	// concurrently.
+	Handler() http.Handler
+}
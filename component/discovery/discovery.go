@@ -0,0 +1,209 @@
+// Package discovery implements shared logic for service discovery components.
+// Service discovery components wrap an upstream Prometheus discoverer and
+// export the discovered targets so they can be passed to other components,
+// such as targets.mutate or metrics.scrape.
+package discovery
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// Target refers to a singular discovered endpoint found by a discovery
+// component.
+type Target map[string]string
+
+// Exports holds values which are exported by all discovery components.
+type Exports struct {
+	Targets []Target `hcl:"targets,attr"`
+}
+
+// Discoverer is an alias for Prometheus' Discoverer interface, so users of
+// this package don't need to import github.com/prometheus/prometheus/discovery
+// as well.
+type Discoverer discovery.Discoverer
+
+// Creator is a function provided by an implementation to create a concrete
+// Discoverer instance from a set of component arguments.
+type Creator func(component.Arguments) (Discoverer, error)
+
+// updateDelay is the minimum amount of time to wait between exporting new
+// targets. Discoverers may send many updates in a short period of time (e.g.,
+// one per file being watched); coalescing them prevents downstream
+// components from being re-evaluated for every single update.
+var updateDelay = 5 * time.Second
+
+// Component is a reusable component for any discovery implementation. It
+// handles the lifecycle of the underlying Discoverer and exports its
+// targets.
+type Component struct {
+	opts component.Options
+
+	discMut       sync.Mutex
+	latestDisc    Discoverer
+	newDiscoverer chan struct{}
+
+	creator Creator
+}
+
+// New creates a discovery component given arguments and a concrete Discovery
+// implementation function.
+func New(o component.Options, args component.Arguments, creator Creator) (*Component, error) {
+	c := &Component{
+		opts:    o,
+		creator: creator,
+
+		// buffered to avoid deadlock from the first immediate update
+		newDiscoverer: make(chan struct{}, 1),
+	}
+	return c, c.Update(args)
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	var cancel context.CancelFunc
+	for {
+		select {
+		case <-ctx.Done():
+			if cancel != nil {
+				cancel()
+			}
+			return nil
+		case <-c.newDiscoverer:
+			// cancel any previously running discovery
+			if cancel != nil {
+				cancel()
+			}
+			// create new context so we can cancel it if we get any future updates
+			// since it is derived from the main run context, it only needs to be
+			// canceled directly if we receive new updates
+			newCtx, cancelFunc := context.WithCancel(ctx)
+			cancel = cancelFunc
+
+			// finally run discovery
+			c.discMut.Lock()
+			disc := c.latestDisc
+			c.discMut.Unlock()
+			go c.runDiscovery(newCtx, disc)
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	disc, err := c.creator(args)
+	if err != nil {
+		return err
+	}
+
+	c.discMut.Lock()
+	c.latestDisc = disc
+	c.discMut.Unlock()
+
+	select {
+	case c.newDiscoverer <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// runDiscovery is a utility for consuming and forwarding target groups from a
+// discoverer. It will handle collating targets (and clearing), as well as
+// throttling updates.
+func (c *Component) runDiscovery(ctx context.Context, d Discoverer) {
+	// all targets we have seen so far, keyed by target group source
+	cache := map[string]*targetgroup.Group{}
+
+	ch := make(chan []*targetgroup.Group)
+	go d.Run(ctx, ch)
+
+	// function to convert and send targets in format scraper expects
+	send := func() {
+		c.opts.OnStateChange(Exports{Targets: groupsToTargets(cache)})
+	}
+
+	ticker := time.NewTicker(updateDelay)
+	defer ticker.Stop()
+
+	// Send the first set of targets as soon as they arrive; later updates are
+	// coalesced by the ticker.
+	var (
+		sentOnce bool
+		pending  bool
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			if pending {
+				send()
+				pending = false
+			}
+
+		case groups := <-ch:
+			for _, group := range groups {
+				// Discoverers send an empty group when a source is removed.
+				if group == nil {
+					continue
+				}
+				if len(group.Targets) == 0 {
+					delete(cache, group.Source)
+				} else {
+					cache[group.Source] = group
+				}
+			}
+			level.Debug(c.opts.Logger).Log("msg", "received target groups", "groups", len(groups), "sources", len(cache))
+
+			if !sentOnce {
+				send()
+				sentOnce = true
+				continue
+			}
+			pending = true
+		}
+	}
+}
+
+// groupsToTargets flattens a set of target groups into a list of Targets.
+// Labels of the target take precedence over the common labels of its group.
+// Targets are returned ordered by group source to keep exports stable between
+// updates.
+func groupsToTargets(cache map[string]*targetgroup.Group) []Target {
+	sources := make([]string, 0, len(cache))
+	for source := range cache {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var res []Target
+	for _, source := range sources {
+		group := cache[source]
+		for _, target := range group.Targets {
+			res = append(res, mergeLabelSets(group.Labels, target))
+		}
+	}
+	return res
+}
+
+func mergeLabelSets(common, target model.LabelSet) Target {
+	res := make(Target, len(common)+len(target))
+	for k, v := range common {
+		res[string(k)] = string(v)
+	}
+	for k, v := range target {
+		res[string(k)] = string(v)
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package file
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	prom_discovery "github.com/prometheus/prometheus/discovery/file"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "discovery.file",
+		Args:    Arguments{},
+		Exports: discovery.Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the discovery.file
+// component.
+type Arguments struct {
+	// Paths holds the list of file paths (or glob patterns) of file_sd files to
+	// read targets from.
+	Paths []string `hcl:"paths,attr"`
+	// RefreshInterval determines how frequently files are re-read as a fallback
+	// to filesystem events.
+	RefreshInterval time.Duration `hcl:"refresh_interval,optional"`
+}
+
+// DefaultArguments provides the default arguments for the discovery.file
+// component.
+var DefaultArguments = Arguments{
+	RefreshInterval: 5 * time.Minute,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (a *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*a = DefaultArguments
+
+	type arguments Arguments
+	return gohcl.DecodeBody(body, ctx, (*arguments)(a))
+}
+
+// Convert converts Arguments to the upstream Prometheus SD type.
+func (a Arguments) Convert() *prom_discovery.SDConfig {
+	return &prom_discovery.SDConfig{
+		Files:           a.Paths,
+		RefreshInterval: model.Duration(a.RefreshInterval),
+	}
+}
+
+// Validate returns an error if the arguments are invalid.
+func (a Arguments) Validate() error {
+	if len(a.Paths) == 0 {
+		return fmt.Errorf("at least one path must be provided")
+	}
+	if a.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval must be greater than 0")
+	}
+	return nil
+}
+
+// New returns a new instance of a discovery.file component.
+func New(opts component.Options, args Arguments) (*discovery.Component, error) {
+	return discovery.New(opts, args, func(args component.Arguments) (discovery.Discoverer, error) {
+		newArgs := args.(Arguments)
+		if err := newArgs.Validate(); err != nil {
+			return nil, err
+		}
+		return prom_discovery.NewDiscovery(newArgs.Convert(), opts.Logger), nil
+	})
+}
@@ -0,0 +1,51 @@
+package file_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/discovery/file"
+	"github.com/grafana/agent/pkg/flow/componenttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	sdFile := filepath.Join(dir, "targets.json")
+
+	require.NoError(t, os.WriteFile(sdFile, []byte(`[
+		{
+			"targets": ["localhost:9090", "localhost:9091"],
+			"labels": { "env": "prod" }
+		}
+	]`), 0664))
+
+	tc, err := componenttest.NewControllerFromID(nil, "discovery.file")
+	require.NoError(t, err)
+	go func() {
+		err := tc.Run(componenttest.TestContext(t), file.Arguments{
+			Paths:           []string{filepath.Join(dir, "*.json")},
+			RefreshInterval: time.Hour,
+		})
+		require.NoError(t, err)
+	}()
+
+	require.NoError(t, tc.WaitExports(5*time.Second))
+	require.Equal(t, discovery.Exports{
+		Targets: []discovery.Target{
+			{"__address__": "localhost:9090", "__meta_filepath": sdFile, "env": "prod"},
+			{"__address__": "localhost:9091", "__meta_filepath": sdFile, "env": "prod"},
+		},
+	}, tc.Exports())
+}
+
+func TestFile_Validate(t *testing.T) {
+	args := file.DefaultArguments
+	require.Error(t, args.Validate(), "expected empty paths to be rejected")
+
+	args.Paths = []string{"/tmp/*.json"}
+	require.NoError(t, args.Validate())
+}
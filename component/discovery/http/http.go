@@ -0,0 +1,106 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	prom_discovery "github.com/prometheus/prometheus/discovery/http"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "discovery.http",
+		Args:    Arguments{},
+		Exports: discovery.Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the discovery.http
+// component.
+type Arguments struct {
+	// URL of the HTTP SD endpoint. The endpoint must return a list of target
+	// groups in the same format as file_sd files.
+	URL string `hcl:"url,attr"`
+	// RefreshInterval determines how frequently the URL is polled.
+	RefreshInterval time.Duration `hcl:"refresh_interval,optional"`
+
+	HTTPClientConfig *config.HTTPClientConfig `hcl:"http_client_config,block"`
+}
+
+// DefaultArguments provides the default arguments for the discovery.http
+// component.
+var DefaultArguments = Arguments{
+	RefreshInterval: time.Minute,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (a *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*a = DefaultArguments
+
+	type arguments Arguments
+	return gohcl.DecodeBody(body, ctx, (*arguments)(a))
+}
+
+// Convert converts Arguments to the upstream Prometheus SD type.
+func (a Arguments) Convert() (*prom_discovery.SDConfig, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+
+	clientConfig := config.DefaultHTTPClientConfig
+	if a.HTTPClientConfig != nil {
+		clientConfig = *a.HTTPClientConfig
+	}
+	httpClientConfig, err := clientConfig.Convert()
+	if err != nil {
+		return nil, fmt.Errorf("invalid http_client_config: %w", err)
+	}
+
+	return &prom_discovery.SDConfig{
+		URL:              a.URL,
+		RefreshInterval:  model.Duration(a.RefreshInterval),
+		HTTPClientConfig: *httpClientConfig,
+	}, nil
+}
+
+// Validate returns an error if the arguments are invalid.
+func (a Arguments) Validate() error {
+	parsedURL, err := url.Parse(a.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https")
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("host is missing in url")
+	}
+	if a.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval must be greater than 0")
+	}
+	return nil
+}
+
+// New returns a new instance of a discovery.http component.
+func New(opts component.Options, args Arguments) (*discovery.Component, error) {
+	return discovery.New(opts, args, func(args component.Arguments) (discovery.Discoverer, error) {
+		sdConfig, err := args.(Arguments).Convert()
+		if err != nil {
+			return nil, err
+		}
+		return prom_discovery.NewDiscovery(sdConfig, opts.Logger, nil)
+	})
+}
@@ -0,0 +1,83 @@
+package http_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/discovery"
+	discovery_http "github.com/grafana/agent/component/discovery/http"
+	"github.com/grafana/agent/pkg/flow/componenttest"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"targets": ["localhost:9090"], "labels": {"env": "prod"}}]`)
+	}))
+	defer srv.Close()
+
+	tc, err := componenttest.NewControllerFromID(nil, "discovery.http")
+	require.NoError(t, err)
+	go func() {
+		err := tc.Run(componenttest.TestContext(t), discovery_http.Arguments{
+			URL:             srv.URL,
+			RefreshInterval: time.Hour,
+		})
+		require.NoError(t, err)
+	}()
+
+	require.NoError(t, tc.WaitExports(5*time.Second))
+	require.Equal(t, discovery.Exports{
+		Targets: []discovery.Target{
+			{"__address__": "localhost:9090", "__meta_url": srv.URL, "env": "prod"},
+		},
+	}, tc.Exports())
+}
+
+func TestArguments_DecodeHCL(t *testing.T) {
+	t.Run("without http_client_config", func(t *testing.T) {
+		var args discovery_http.Arguments
+		require.NoError(t, decodeArguments(`url = "http://localhost:8080/sd"`, &args))
+		require.Equal(t, time.Minute, args.RefreshInterval)
+		require.Nil(t, args.HTTPClientConfig)
+
+		sdConfig, err := args.Convert()
+		require.NoError(t, err)
+		require.True(t, sdConfig.HTTPClientConfig.FollowRedirects)
+	})
+
+	t.Run("with http_client_config", func(t *testing.T) {
+		var args discovery_http.Arguments
+		require.NoError(t, decodeArguments(`
+			url = "http://localhost:8080/sd"
+
+			http_client_config {
+				proxy_url = "http://proxy:3128"
+			}
+		`, &args))
+
+		sdConfig, err := args.Convert()
+		require.NoError(t, err)
+		require.Equal(t, "http://proxy:3128", sdConfig.HTTPClientConfig.ProxyURL.String())
+		require.True(t, sdConfig.HTTPClientConfig.FollowRedirects, "defaults should be applied to the block")
+	})
+}
+
+func decodeArguments(in string, args *discovery_http.Arguments) error {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(in), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	diags = gohcl.DecodeBody(file.Body, nil, args)
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
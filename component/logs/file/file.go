@@ -0,0 +1,250 @@
+// Package file implements the logs.file component.
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	"github.com/rfratto/gohcl"
+)
+
+// Labels used to configure the targets which are tailed.
+const (
+	pathLabel     = "__path__"
+	filenameLabel = "filename"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "logs.file",
+		Args:    Arguments{},
+		Exports: nil,
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the logs.file
+// component.
+type Arguments struct {
+	// Targets to tail. The __path__ label of each target holds the path or
+	// glob pattern of the files to tail.
+	Targets []discovery.Target `hcl:"targets"`
+
+	// Where the tailed log entries should be forwarded to.
+	ForwardTo []*logs.Receiver `hcl:"forward_to"`
+
+	// How often to re-evaluate glob patterns to find new files.
+	SyncPeriod time.Duration `hcl:"sync_period,optional"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	SyncPeriod: 10 * time.Second,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.SyncPeriod <= 0 {
+		return fmt.Errorf("sync_period must be greater than 0")
+	}
+	for i, t := range args.Targets {
+		if t[pathLabel] == "" {
+			return fmt.Errorf("target %d is missing the %s label", i, pathLabel)
+		}
+	}
+	return nil
+}
+
+// Component implements the logs.file component.
+type Component struct {
+	opts      component.Options
+	positions positions.Positions
+
+	mut  sync.RWMutex
+	args Arguments
+
+	tailers map[string]*tailer // Only accessed from Run.
+	update  chan struct{}      // Written to when args change.
+}
+
+var _ component.Component = (*Component)(nil)
+
+// New creates a new logs.file component. Read positions are stored in the
+// component's data directory.
+func New(o component.Options, args Arguments) (*Component, error) {
+	if err := os.MkdirAll(o.DataPath, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	pos, err := positions.New(o.Logger, positions.Config{
+		SyncPeriod:    10 * time.Second,
+		PositionsFile: filepath.Join(o.DataPath, "positions.yml"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load positions file: %w", err)
+	}
+
+	c := &Component{
+		opts:      o,
+		positions: pos,
+
+		tailers: make(map[string]*tailer),
+		update:  make(chan struct{}, 1),
+	}
+	if err := c.Update(args); err != nil {
+		pos.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		for _, t := range c.tailers {
+			t.stop()
+		}
+		c.positions.Stop()
+	}()
+
+	c.sync()
+
+	c.mut.RLock()
+	ticker := time.NewTicker(c.args.SyncPeriod)
+	c.mut.RUnlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.sync()
+		case <-c.update:
+			c.mut.RLock()
+			ticker.Reset(c.args.SyncPeriod)
+			c.mut.RUnlock()
+			c.sync()
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	c.args = newArgs
+	c.mut.Unlock()
+
+	select {
+	case c.update <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// sync starts tailing files which match the current set of targets and stops
+// tailing files which no longer match.
+func (c *Component) sync() {
+	c.mut.RLock()
+	targets := c.args.Targets
+	c.mut.RUnlock()
+
+	wanted := make(map[string]model.LabelSet)
+	for _, t := range targets {
+		matches, err := doublestar.Glob(t[pathLabel])
+		if err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to expand path", "path", t[pathLabel], "err", err)
+			continue
+		}
+		for _, m := range matches {
+			path, err := filepath.Abs(m)
+			if err != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to get absolute path", "path", m, "err", err)
+				continue
+			}
+			if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+				continue
+			}
+			wanted[path] = entryLabels(t, path)
+		}
+	}
+
+	for path, t := range c.tailers {
+		labels, ok := wanted[path]
+		if ok && t.running() && labels.Equal(t.labels) {
+			continue
+		}
+
+		t.stop()
+		delete(c.tailers, path)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			c.positions.Remove(path)
+		}
+	}
+
+	for path, labels := range wanted {
+		if _, ok := c.tailers[path]; ok {
+			continue
+		}
+
+		t, err := newTailer(c.opts.Logger, c.positions, path, labels, c.receive)
+		if err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to tail file", "path", path, "err", err)
+			continue
+		}
+		level.Debug(c.opts.Logger).Log("msg", "tailing new file", "path", path)
+		c.tailers[path] = t
+	}
+}
+
+func (c *Component) receive(e logs.Entry) {
+	c.mut.RLock()
+	receivers := c.args.ForwardTo
+	c.mut.RUnlock()
+
+	logs.Fanout(receivers, []logs.Entry{e})
+}
+
+// entryLabels returns the labels to attach to entries read from path. Labels
+// of t starting with a double underscore are dropped.
+func entryLabels(t discovery.Target, path string) model.LabelSet {
+	ls := make(model.LabelSet, len(t)+1)
+	for k, v := range t {
+		if strings.HasPrefix(k, model.ReservedLabelPrefix) {
+			continue
+		}
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	ls[filenameLabel] = model.LabelValue(path)
+	return ls
+}
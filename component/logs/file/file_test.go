@@ -0,0 +1,84 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/logs"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("hello\n"), 0644))
+
+	received := make(chan logs.Entry, 10)
+	receiver := &logs.Receiver{Receive: func(entries []logs.Entry) {
+		for _, e := range entries {
+			received <- e
+		}
+	}}
+
+	c, err := New(component.Options{
+		ID:            "logs.file.test",
+		Logger:        log.NewNopLogger(),
+		DataPath:      filepath.Join(dir, "data"),
+		OnStateChange: func(e component.Exports) {},
+	}, Arguments{
+		Targets: []discovery.Target{
+			{"__path__": filepath.Join(dir, "*.log"), "job": "app"},
+		},
+		ForwardTo:  []*logs.Receiver{receiver},
+		SyncPeriod: time.Second,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+
+	e := waitEntry(t, received)
+	require.Equal(t, "hello", e.Line)
+	require.Equal(t, model.LabelSet{"job": "app", "filename": model.LabelValue(logPath)}, e.Labels)
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("world\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	e = waitEntry(t, received)
+	require.Equal(t, "world", e.Line)
+
+	cancel()
+	<-done
+
+	// The final read position must have been stored so tailing resumes after
+	// the last line.
+	data, err := os.ReadFile(filepath.Join(dir, "data", "positions.yml"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), logPath)
+}
+
+func waitEntry(t *testing.T, ch chan logs.Entry) logs.Entry {
+	t.Helper()
+
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for log entry")
+		return logs.Entry{}
+	}
+}
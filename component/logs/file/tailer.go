@@ -0,0 +1,151 @@
+package file
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/loki/clients/pkg/promtail/positions"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/util"
+	"github.com/hpcloud/tail"
+	"github.com/prometheus/common/model"
+)
+
+// tailer reads lines from a single file and forwards them as log entries.
+// The read offset is periodically stored in positions so that tailing can
+// resume where it left off after a restart.
+type tailer struct {
+	log       log.Logger
+	positions positions.Positions
+	path      string
+	labels    model.LabelSet
+	receive   func(logs.Entry)
+
+	tail *tail.Tail
+
+	stopOnce sync.Once
+	posquit  chan struct{}
+	posdone  chan struct{}
+	done     chan struct{}
+}
+
+func newTailer(l log.Logger, pos positions.Positions, path string, labels model.LabelSet, receive func(logs.Entry)) (*tailer, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := pos.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	// The file was truncated since we last read it; start over.
+	if fi.Size() < offset {
+		pos.Remove(path)
+		offset = 0
+	}
+
+	t, err := tail.TailFile(path, tail.Config{
+		Follow:    true,
+		Poll:      true,
+		ReOpen:    true,
+		MustExist: true,
+		Location:  &tail.SeekInfo{Offset: offset, Whence: 0},
+		Logger:    util.NewLogAdapter(l),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tl := &tailer{
+		log:       log.With(l, "path", path),
+		positions: pos,
+		path:      path,
+		labels:    labels,
+		receive:   receive,
+
+		tail: t,
+
+		posquit: make(chan struct{}),
+		posdone: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go tl.readLines()
+	go tl.updatePositions()
+	return tl, nil
+}
+
+// readLines runs until the underlying tail is stopped.
+func (t *tailer) readLines() {
+	defer close(t.done)
+
+	for line := range t.tail.Lines {
+		if line.Err != nil {
+			level.Error(t.log).Log("msg", "error reading line", "err", line.Err)
+			continue
+		}
+		t.receive(logs.Entry{
+			Labels: t.labels.Clone(),
+			Entry: logproto.Entry{
+				Timestamp: line.Time,
+				Line:      line.Text,
+			},
+		})
+	}
+}
+
+func (t *tailer) updatePositions() {
+	defer close(t.posdone)
+
+	ticker := time.NewTicker(t.positions.SyncPeriod())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.posquit:
+			return
+		case <-ticker.C:
+			if err := t.markPosition(); err != nil {
+				level.Error(t.log).Log("msg", "failed to store file position", "err", err)
+			}
+		}
+	}
+}
+
+func (t *tailer) markPosition() error {
+	offset, err := t.tail.Tell()
+	if err != nil {
+		return err
+	}
+	t.positions.Put(t.path, offset)
+	return nil
+}
+
+// running returns true if the tailer hasn't stopped reading lines.
+func (t *tailer) running() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop stops the tailer, storing its final position.
+func (t *tailer) stop() {
+	t.stopOnce.Do(func() {
+		close(t.posquit)
+		<-t.posdone
+
+		if err := t.markPosition(); err != nil {
+			level.Error(t.log).Log("msg", "failed to store file position", "err", err)
+		}
+		if err := t.tail.Stop(); err != nil {
+			level.Error(t.log).Log("msg", "failed to stop tailing file", "err", err)
+		}
+		<-t.done
+	})
+}
@@ -0,0 +1,31 @@
+// Package logs holds types shared by Flow logs components.
+package logs
+
+import (
+	"github.com/grafana/agent/component"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+)
+
+func init() {
+	component.RegisterGoStruct("LogsReceiver", Receiver{})
+}
+
+// Entry is a single log line along with its timestamp and labels.
+type Entry = api.Entry
+
+// Receiver is used to pass an array of log entries to another component.
+type Receiver struct {
+	// entries should be considered immutable
+	Receive func(entries []Entry)
+}
+
+// Fanout sends entries to every receiver in receivers. Receivers which do
+// not have a Receive func are skipped.
+func Fanout(receivers []*Receiver, entries []Entry) {
+	for _, r := range receivers {
+		if r == nil || r.Receive == nil {
+			continue
+		}
+		r.Receive(entries)
+	}
+}
@@ -0,0 +1,321 @@
+// Package lokiwrite implements the logs.loki_write component.
+package lokiwrite
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/loki/clients/pkg/promtail/client"
+	lokiflag "github.com/grafana/loki/pkg/util/flagext"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "logs.loki_write",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the logs.loki_write
+// component.
+type Arguments struct {
+	Endpoints      []EndpointOptions `hcl:"endpoint,block"`
+	ExternalLabels map[string]string `hcl:"external_labels,optional"`
+}
+
+// EndpointOptions describes an individual location to send logs to.
+type EndpointOptions struct {
+	Name      string        `hcl:"name,optional"`
+	URL       string        `hcl:"url"`
+	BatchWait time.Duration `hcl:"batch_wait,optional"`
+	BatchSize int           `hcl:"batch_size,optional"`
+	Timeout   time.Duration `hcl:"remote_timeout,optional"`
+	TenantID  string        `hcl:"tenant_id,optional"`
+
+	MinBackoff time.Duration `hcl:"min_backoff_period,optional"`
+	MaxBackoff time.Duration `hcl:"max_backoff_period,optional"`
+	MaxRetries int           `hcl:"max_backoff_retries,optional"`
+
+	HTTPClientConfig *config.HTTPClientConfig `hcl:"http_client_config,block"`
+}
+
+// DefaultEndpointOptions holds default values for EndpointOptions.
+var DefaultEndpointOptions = EndpointOptions{
+	BatchWait:  client.BatchWait,
+	BatchSize:  client.BatchSize,
+	Timeout:    client.Timeout,
+	MinBackoff: client.MinBackoff,
+	MaxBackoff: client.MaxBackoff,
+	MaxRetries: client.MaxRetries,
+}
+
+var _ gohcl.Decoder = (*EndpointOptions)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (o *EndpointOptions) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*o = DefaultEndpointOptions
+
+	type endpointOptions EndpointOptions
+	if err := gohcl.DecodeBody(body, ctx, (*endpointOptions)(o)); err != nil {
+		return err
+	}
+	return o.Validate()
+}
+
+// Validate returns an error if the endpoint options are invalid.
+func (o *EndpointOptions) Validate() error {
+	if _, err := parseURL(o.URL); err != nil {
+		return err
+	}
+	if o.BatchWait <= 0 {
+		return fmt.Errorf("batch_wait must be greater than 0")
+	}
+	if o.BatchSize <= 0 {
+		return fmt.Errorf("batch_size must be greater than 0")
+	}
+	if o.MinBackoff > o.MaxBackoff {
+		return fmt.Errorf("min_backoff_period must not be greater than max_backoff_period")
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the logs.loki_write component.
+type Exports struct {
+	Receiver *logs.Receiver `hcl:"receiver"`
+}
+
+// Component implements the logs.loki_write component.
+type Component struct {
+	opts     component.Options
+	receiver *logs.Receiver
+
+	// entries passes received entries to Run, which is the only goroutine
+	// which sends to or stops clients. done is closed when Run exits.
+	entries chan logs.Entry
+	done    chan struct{}
+
+	// pending holds a client created by Update which Run hasn't switched to
+	// yet. clientUpdated is signaled when pending changes.
+	mut           sync.Mutex
+	pending       client.Client
+	hasPending    bool
+	clientUpdated chan struct{}
+}
+
+var _ component.Component = (*Component)(nil)
+
+// New creates a new logs.loki_write component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:          o,
+		entries:       make(chan logs.Entry),
+		done:          make(chan struct{}),
+		clientUpdated: make(chan struct{}, 1),
+	}
+	c.receiver = &logs.Receiver{Receive: c.Receive}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	var (
+		current client.Client
+		stopWg  sync.WaitGroup
+	)
+	defer func() {
+		// Release blocked receivers before flushing, which waits for retries
+		// when an endpoint is down.
+		close(c.done)
+
+		// Stopping a client flushes any entries it has batched.
+		if current != nil {
+			current.Stop()
+		}
+		if pending, ok := c.takePending(); ok && pending != nil {
+			pending.Stop()
+		}
+		stopWg.Wait()
+	}()
+
+	// stop stops a client in the background, so a client which is retrying
+	// requests to an unavailable endpoint doesn't hold back new entries.
+	stop := func(cl client.Client) {
+		if cl == nil {
+			return
+		}
+		stopWg.Add(1)
+		go func() {
+			defer stopWg.Done()
+			cl.Stop()
+		}()
+	}
+
+	switchClient := func() {
+		if pending, ok := c.takePending(); ok {
+			stop(current)
+			current = pending
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-c.clientUpdated:
+			switchClient()
+
+		case e := <-c.entries:
+			// Entries received after an Update must go to the new client, even
+			// if select picked this case first.
+			select {
+			case <-c.clientUpdated:
+				switchClient()
+			default:
+			}
+			if current == nil {
+				continue
+			}
+			select {
+			case current.Chan() <- e:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (c *Component) takePending() (client.Client, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	pending, ok := c.pending, c.hasPending
+	c.pending, c.hasPending = nil, false
+	return pending, ok
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	cfgs, err := newArgs.clientConfigs()
+	if err != nil {
+		return err
+	}
+
+	var newClient client.Client
+	if len(cfgs) > 0 {
+		// Client metrics aren't exposed yet; a nil registerer keeps them from
+		// conflicting with other instances of this component.
+		newClient, err = client.NewMulti(client.NewMetrics(nil, nil), nil, c.opts.Logger, cfgs...)
+		if err != nil {
+			return fmt.Errorf("failed to create Loki client: %w", err)
+		}
+	}
+
+	// Run switches to the new client. A pending client which Run never
+	// switched to was never sent entries, so it can be stopped here.
+	c.mut.Lock()
+	oldPending, hadPending := c.pending, c.hasPending
+	c.pending, c.hasPending = newClient, true
+	c.mut.Unlock()
+
+	if hadPending && oldPending != nil {
+		oldPending.Stop()
+	}
+
+	select {
+	case c.clientUpdated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Receive queues entries to be sent to every configured endpoint. Receive
+// blocks while the endpoints can't keep up, and returns early once the
+// component has stopped.
+func (c *Component) Receive(entries []logs.Entry) {
+	for _, e := range entries {
+		select {
+		case c.entries <- e:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (args Arguments) clientConfigs() ([]client.Config, error) {
+	externalLabels := make(model.LabelSet, len(args.ExternalLabels))
+	for k, v := range args.ExternalLabels {
+		externalLabels[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	cfgs := make([]client.Config, 0, len(args.Endpoints))
+	for _, ep := range args.Endpoints {
+		u, err := parseURL(ep.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		httpClientConfig := config.DefaultHTTPClientConfig
+		if ep.HTTPClientConfig != nil {
+			httpClientConfig = *ep.HTTPClientConfig
+		}
+		promHTTPClientConfig, err := httpClientConfig.Convert()
+		if err != nil {
+			return nil, fmt.Errorf("invalid http_client_config for endpoint %q: %w", ep.URL, err)
+		}
+
+		cfgs = append(cfgs, client.Config{
+			Name:      ep.Name,
+			URL:       flagext.URLValue{URL: u},
+			BatchWait: ep.BatchWait,
+			BatchSize: ep.BatchSize,
+			Client:    *promHTTPClientConfig,
+			BackoffConfig: backoff.Config{
+				MinBackoff: ep.MinBackoff,
+				MaxBackoff: ep.MaxBackoff,
+				MaxRetries: ep.MaxRetries,
+			},
+			ExternalLabels: lokiflag.LabelSet{LabelSet: externalLabels},
+			Timeout:        ep.Timeout,
+			TenantID:       ep.TenantID,
+		})
+	}
+	return cfgs, nil
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("url %q: scheme must be http or https", rawURL)
+	}
+	return u, nil
+}
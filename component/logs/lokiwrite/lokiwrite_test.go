@@ -0,0 +1,144 @@
+package lokiwrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiWrite(t *testing.T) {
+	type request struct {
+		tenant string
+		push   logproto.PushRequest
+	}
+	requests := make(chan request, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		buf, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		var req request
+		require.NoError(t, req.push.Unmarshal(buf))
+		req.tenant = r.Header.Get("X-Scope-OrgID")
+		requests <- req
+	}))
+	defer srv.Close()
+
+	endpoint := DefaultEndpointOptions
+	endpoint.URL = srv.URL + "/loki/api/v1/push"
+	endpoint.BatchWait = 10 * time.Millisecond
+	endpoint.TenantID = "tenant-a"
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "logs.loki_write.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, Arguments{
+		Endpoints:      []EndpointOptions{endpoint},
+		ExternalLabels: map[string]string{"cluster": "dev"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, exports.Receiver)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	exports.Receiver.Receive([]logs.Entry{{
+		Labels: model.LabelSet{"job": "app"},
+		Entry:  logproto.Entry{Timestamp: time.Unix(100, 0), Line: "hello"},
+	}})
+
+	select {
+	case req := <-requests:
+		require.Equal(t, "tenant-a", req.tenant)
+		require.Len(t, req.push.Streams, 1)
+		require.Equal(t, `{cluster="dev", job="app"}`, req.push.Streams[0].Labels)
+		require.Len(t, req.push.Streams[0].Entries, 1)
+		require.Equal(t, "hello", req.push.Streams[0].Entries[0].Line)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for push request")
+	}
+}
+
+func TestEndpointOptions_Validate(t *testing.T) {
+	endpoint := DefaultEndpointOptions
+	endpoint.URL = "localhost:3100"
+	require.EqualError(t, endpoint.Validate(), `url "localhost:3100": scheme must be http or https`)
+
+	endpoint.URL = "http://localhost:3100/loki/api/v1/push"
+	require.NoError(t, endpoint.Validate())
+
+	endpoint.MinBackoff = time.Hour
+	require.EqualError(t, endpoint.Validate(), "min_backoff_period must not be greater than max_backoff_period")
+}
+
+func TestLokiWrite_UnavailableEndpoint(t *testing.T) {
+	// The endpoint doesn't respond until the test ends, so the client stops
+	// accepting entries once its batch is being sent.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	endpoint := DefaultEndpointOptions
+	endpoint.URL = srv.URL + "/loki/api/v1/push"
+	endpoint.BatchWait = 10 * time.Millisecond
+	args := Arguments{Endpoints: []EndpointOptions{endpoint}}
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "logs.loki_write.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = c.Run(ctx) }()
+
+	receiveDone := make(chan struct{})
+	go func() {
+		defer close(receiveDone)
+		for i := 0; i < 1000; i++ {
+			exports.Receiver.Receive([]logs.Entry{{
+				Labels: model.LabelSet{"job": "app"},
+				Entry:  logproto.Entry{Timestamp: time.Unix(int64(i), 0), Line: "hello"},
+			}})
+		}
+	}()
+
+	// Update must not wait for blocked receivers.
+	updateDone := make(chan error)
+	go func() { updateDone <- c.Update(args) }()
+	select {
+	case err := <-updateDone:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Update blocked on an unavailable endpoint")
+	}
+
+	// Blocked receivers return once the component stops.
+	cancel()
+	select {
+	case <-receiveDone:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Receive blocked after the component stopped")
+	}
+}
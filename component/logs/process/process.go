@@ -0,0 +1,252 @@
+// Package process implements the logs.process component.
+package process
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/loki/clients/pkg/logentry/stages"
+	"github.com/grafana/loki/clients/pkg/promtail/api"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "logs.process",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the logs.process
+// component.
+type Arguments struct {
+	// Where processed log entries should be forwarded to.
+	ForwardTo []*logs.Receiver `hcl:"forward_to"`
+
+	// Stages to run over each log entry, in order.
+	Stages []StageConfig `hcl:"stage,block"`
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	_, err := toPipelineStages(args.Stages)
+	return err
+}
+
+// Exports holds values which are exported by the logs.process component.
+type Exports struct {
+	Receiver *logs.Receiver `hcl:"receiver"`
+}
+
+// Component implements the logs.process component.
+type Component struct {
+	opts     component.Options
+	receiver *logs.Receiver
+
+	// input passes received entries to Run, which is the only goroutine which
+	// sends to or stops pipelines. output receives processed entries and is
+	// drained by Run. done is closed when Run exits.
+	input  chan logs.Entry
+	output chan logs.Entry
+	done   chan struct{}
+
+	// receiversMut is separate from mut so forwarding entries never waits on
+	// an Update.
+	receiversMut sync.RWMutex
+	receivers    []*logs.Receiver
+
+	// pending holds a pipeline created by Update which Run hasn't switched to
+	// yet. handlerUpdated is signaled when pending changes.
+	mut            sync.Mutex
+	pending        api.EntryHandler
+	handlerUpdated chan struct{}
+}
+
+var _ component.Component = (*Component)(nil)
+
+// New creates a new logs.process component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:           o,
+		input:          make(chan logs.Entry),
+		output:         make(chan logs.Entry),
+		done:           make(chan struct{}),
+		handlerUpdated: make(chan struct{}, 1),
+	}
+	c.receiver = &logs.Receiver{Receive: c.Receive}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	var handler api.EntryHandler // Input of the current pipeline.
+	defer func() {
+		close(c.done)
+
+		c.stop(handler)
+		c.stop(c.takePending())
+	}()
+
+	switchHandler := func() {
+		if pending := c.takePending(); pending != nil {
+			c.stop(handler)
+			handler = pending
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-c.handlerUpdated:
+			switchHandler()
+
+		case e := <-c.output:
+			c.forward(e)
+
+		case e := <-c.input:
+			// Entries received after an Update must go to the new pipeline, even
+			// if select picked this case first.
+			select {
+			case <-c.handlerUpdated:
+				switchHandler()
+			default:
+			}
+			if handler == nil {
+				continue
+			}
+
+			// The pipeline may be blocked writing a processed entry, so keep
+			// draining output while waiting for it to accept e.
+			for sent := false; !sent; {
+				select {
+				case <-ctx.Done():
+					return nil
+				case handler.Chan() <- e:
+					sent = true
+				case out := <-c.output:
+					c.forward(out)
+				}
+			}
+		}
+	}
+}
+
+// stop stops a pipeline, forwarding any entries it flushes while stopping.
+func (c *Component) stop(handler api.EntryHandler) {
+	if handler == nil {
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		handler.Stop()
+	}()
+	for {
+		select {
+		case <-stopped:
+			return
+		case e := <-c.output:
+			c.forward(e)
+		}
+	}
+}
+
+func (c *Component) takePending() api.EntryHandler {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	pending := c.pending
+	c.pending = nil
+	return pending
+}
+
+func (c *Component) forward(e logs.Entry) {
+	c.receiversMut.RLock()
+	receivers := c.receivers
+	c.receiversMut.RUnlock()
+
+	logs.Fanout(receivers, []logs.Entry{e})
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	ps, err := toPipelineStages(newArgs.Stages)
+	if err != nil {
+		return err
+	}
+	// Pipeline metrics aren't exposed yet, so register them against a
+	// throwaway registry to avoid duplicate registrations across updates.
+	pipeline, err := stages.NewPipeline(c.opts.Logger, ps, nil, prometheus.NewRegistry())
+	if err != nil {
+		return fmt.Errorf("failed to build pipeline: %w", err)
+	}
+	handler := pipeline.Wrap(api.NewEntryHandler(c.output, func() {}))
+
+	c.receiversMut.Lock()
+	c.receivers = newArgs.ForwardTo
+	c.receiversMut.Unlock()
+
+	// Run switches to the new pipeline. A pending pipeline which Run never
+	// switched to was never sent entries, so stopping it can't block on
+	// output.
+	c.mut.Lock()
+	oldPending := c.pending
+	c.pending = handler
+	c.mut.Unlock()
+
+	if oldPending != nil {
+		oldPending.Stop()
+	}
+
+	select {
+	case c.handlerUpdated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Receive sends entries through the processing pipeline. Receive blocks while
+// the pipeline is busy, and returns early once the component has stopped.
+func (c *Component) Receive(entries []logs.Entry) {
+	for _, e := range entries {
+		select {
+		case c.input <- e:
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package process
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/logs"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/prometheus/common/model"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	received := make(chan logs.Entry, 10)
+	receiver := &logs.Receiver{Receive: func(entries []logs.Entry) {
+		for _, e := range entries {
+			received <- e
+		}
+	}}
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "logs.process.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, Arguments{
+		ForwardTo: []*logs.Receiver{receiver},
+		Stages: []StageConfig{
+			{Regex: &RegexConfig{Expression: `^level=(?P<level>\w+) `}},
+			{Labels: &LabelsConfig{Values: map[string]string{"level": ""}}},
+			{Drop: &DropConfig{Source: "level", Value: "debug"}},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, exports.Receiver)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	now := time.Now()
+	exports.Receiver.Receive([]logs.Entry{
+		{Labels: model.LabelSet{"job": "app"}, Entry: logproto.Entry{Timestamp: now, Line: "level=debug msg=ignored"}},
+		{Labels: model.LabelSet{"job": "app"}, Entry: logproto.Entry{Timestamp: now, Line: "level=info msg=hello"}},
+	})
+
+	select {
+	case e := <-received:
+		require.Equal(t, "level=info msg=hello", e.Line)
+		require.Equal(t, model.LabelSet{"job": "app", "level": "info"}, e.Labels)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for log entry")
+	}
+
+	select {
+	case e := <-received:
+		require.FailNow(t, "unexpected log entry", "line: %s", e.Line)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestArguments_Stages(t *testing.T) {
+	cfg := `
+		forward_to = []
+
+		stage {
+			json {
+				expressions = { level = "" }
+			}
+		}
+		stage {
+			labels {
+				values = { level = "" }
+			}
+		}
+	`
+	var args Arguments
+	require.NoError(t, decode(cfg, &args))
+	require.Len(t, args.Stages, 2)
+	require.NotNil(t, args.Stages[0].JSON)
+	require.NotNil(t, args.Stages[1].Labels)
+
+	invalid := `
+		forward_to = []
+
+		stage {
+			json {
+				expressions = { level = "" }
+			}
+			labels {
+				values = { level = "" }
+			}
+		}
+	`
+	err := decode(invalid, &args)
+	require.ErrorContains(t, err, "stage 0: exactly one stage type must be set, found 2")
+}
+
+func decode(cfg string, args *Arguments) error {
+	file, diags := hclparse.NewParser().ParseHCL([]byte(cfg), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	if diags := gohcl.DecodeBody(file.Body, nil, args); diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+func TestProcess_BlockedDownstream(t *testing.T) {
+	release := make(chan struct{})
+	receiver := &logs.Receiver{Receive: func([]logs.Entry) { <-release }}
+
+	args := Arguments{ForwardTo: []*logs.Receiver{receiver}}
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "logs.process.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		_ = c.Run(ctx)
+	}()
+
+	receiveDone := make(chan struct{})
+	go func() {
+		defer close(receiveDone)
+		for i := 0; i < 10; i++ {
+			exports.Receiver.Receive([]logs.Entry{{
+				Labels: model.LabelSet{"job": "app"},
+				Entry:  logproto.Entry{Timestamp: time.Now(), Line: "hello"},
+			}})
+		}
+	}()
+
+	// Update must not wait for the blocked pipeline.
+	updateDone := make(chan error)
+	go func() { updateDone <- c.Update(args) }()
+	select {
+	case err := <-updateDone:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Update blocked on a blocked pipeline")
+	}
+
+	// Once downstream recovers, shutting down must complete.
+	close(release)
+	cancel()
+	for name, ch := range map[string]chan struct{}{"Run": runDone, "Receive": receiveDone} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for "+name+" to return")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/loki/clients/pkg/logentry/stages"
+)
+
+// StageConfig defines a single processing stage. Exactly one of its blocks
+// must be set.
+type StageConfig struct {
+	Regex     *RegexConfig     `hcl:"regex,block"`
+	JSON      *JSONConfig      `hcl:"json,block"`
+	Labels    *LabelsConfig    `hcl:"labels,block"`
+	Drop      *DropConfig      `hcl:"drop,block"`
+	Multiline *MultilineConfig `hcl:"multiline,block"`
+	Timestamp *TimestampConfig `hcl:"timestamp,block"`
+}
+
+// RegexConfig configures a stage which extracts values from a log line
+// using named capture groups of a regular expression.
+type RegexConfig struct {
+	Expression string `hcl:"expression"`
+	Source     string `hcl:"source,optional"`
+}
+
+// JSONConfig configures a stage which extracts values from a JSON log line
+// using JMESPath expressions.
+type JSONConfig struct {
+	Expressions map[string]string `hcl:"expressions"`
+	Source      string            `hcl:"source,optional"`
+}
+
+// LabelsConfig configures a stage which sets labels from extracted values.
+// An empty value uses the extracted value with the same name as the label.
+type LabelsConfig struct {
+	Values map[string]string `hcl:"values"`
+}
+
+// DropConfig configures a stage which drops log lines matching some criteria.
+type DropConfig struct {
+	Source     string        `hcl:"source,optional"`
+	Expression string        `hcl:"expression,optional"`
+	Value      string        `hcl:"value,optional"`
+	OlderThan  time.Duration `hcl:"older_than,optional"`
+	LongerThan string        `hcl:"longer_than,optional"`
+	DropReason string        `hcl:"drop_counter_reason,optional"`
+}
+
+// MultilineConfig configures a stage which merges multiple lines into a
+// single log entry.
+type MultilineConfig struct {
+	FirstLine   string        `hcl:"firstline"`
+	MaxLines    uint64        `hcl:"max_lines,optional"`
+	MaxWaitTime time.Duration `hcl:"max_wait_time,optional"`
+}
+
+// TimestampConfig configures a stage which sets the timestamp of a log entry
+// from an extracted value.
+type TimestampConfig struct {
+	Source          string   `hcl:"source"`
+	Format          string   `hcl:"format"`
+	FallbackFormats []string `hcl:"fallback_formats,optional"`
+	Location        string   `hcl:"location,optional"`
+	ActionOnFailure string   `hcl:"action_on_failure,optional"`
+}
+
+// toPipelineStages converts stage blocks into the equivalent Promtail
+// pipeline stages.
+func toPipelineStages(cfgs []StageConfig) (stages.PipelineStages, error) {
+	res := make(stages.PipelineStages, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		ps, err := cfg.toPipelineStage()
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		res = append(res, ps)
+	}
+	return res, nil
+}
+
+func (cfg StageConfig) toPipelineStage() (stages.PipelineStage, error) {
+	var (
+		set int
+		ps  = stages.PipelineStage{}
+	)
+
+	if c := cfg.Regex; c != nil {
+		set++
+		ps[stages.StageTypeRegex] = stages.RegexConfig{
+			Expression: c.Expression,
+			Source:     optionalString(c.Source),
+		}
+	}
+	if c := cfg.JSON; c != nil {
+		set++
+		ps[stages.StageTypeJSON] = stages.JSONConfig{
+			Expressions: c.Expressions,
+			Source:      optionalString(c.Source),
+		}
+	}
+	if c := cfg.Labels; c != nil {
+		set++
+		labels := make(stages.LabelsConfig, len(c.Values))
+		for name, source := range c.Values {
+			labels[name] = optionalString(source)
+		}
+		ps[stages.StageTypeLabel] = labels
+	}
+	if c := cfg.Drop; c != nil {
+		set++
+		dc := stages.DropConfig{
+			DropReason: optionalString(c.DropReason),
+			Source:     optionalString(c.Source),
+			Value:      optionalString(c.Value),
+			Expression: optionalString(c.Expression),
+			LongerThan: optionalString(c.LongerThan),
+		}
+		if c.OlderThan > 0 {
+			dc.OlderThan = optionalString(c.OlderThan.String())
+		}
+		ps[stages.StageTypeDrop] = dc
+	}
+	if c := cfg.Multiline; c != nil {
+		set++
+		mc := stages.MultilineConfig{Expression: optionalString(c.FirstLine)}
+		if c.MaxLines > 0 {
+			maxLines := c.MaxLines
+			mc.MaxLines = &maxLines
+		}
+		if c.MaxWaitTime > 0 {
+			mc.MaxWaitTime = optionalString(c.MaxWaitTime.String())
+		}
+		ps[stages.StageTypeMultiline] = mc
+	}
+	if c := cfg.Timestamp; c != nil {
+		set++
+		ps[stages.StageTypeTimestamp] = stages.TimestampConfig{
+			Source:          c.Source,
+			Format:          c.Format,
+			FallbackFormats: c.FallbackFormats,
+			Location:        optionalString(c.Location),
+			ActionOnFailure: optionalString(c.ActionOnFailure),
+		}
+	}
+
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one stage type must be set, found %d", set)
+	}
+	return ps, nil
+}
+
+// optionalString returns a pointer to s, or nil if s is empty.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,17 @@
+// Package all registers every static mode integration as an exporter
+// component.
+package all
+
+import (
+	"github.com/grafana/agent/component/metrics/exporter"
+	"github.com/grafana/agent/pkg/integrations"
+
+	// Register integrations
+	_ "github.com/grafana/agent/pkg/integrations/install"
+)
+
+func init() {
+	for _, cfg := range integrations.RegisteredIntegrations() {
+		exporter.Register(cfg)
+	}
+}
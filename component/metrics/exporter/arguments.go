@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/grafana/agent/pkg/integrations"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v2"
+)
+
+// Arguments holds the settings for an exporter component.
+//
+// Apart from instance, every attribute is passed through to the
+// integration's static mode config, using the same names as its YAML keys.
+// Nested YAML objects are written as HCL objects.
+type Arguments struct {
+	// Instance overrides the instance label of exported targets. When empty,
+	// the integration determines the instance label.
+	Instance string
+
+	// settings holds the YAML-encoded integration settings.
+	settings string
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = Arguments{}
+
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	settings := make(map[string]interface{}, len(attrs))
+	for name, attr := range attrs {
+		val, valDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			continue
+		}
+
+		if name == "instance" {
+			if !val.Type().Equals(cty.String) || val.IsNull() {
+				return fmt.Errorf("instance must be a string")
+			}
+			args.Instance = val.AsString()
+			continue
+		}
+
+		goVal, err := ctyToYAML(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		settings[name] = goVal
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	bb, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	args.settings = string(bb)
+	return nil
+}
+
+// integrationConfig decodes the settings into a new instance of the config
+// type of template.
+func (args *Arguments) integrationConfig(template integrations.Config) (integrations.Config, error) {
+	cfg := reflect.New(reflect.TypeOf(template).Elem()).Interface().(integrations.Config)
+	if err := yaml.UnmarshalStrict([]byte(args.settings), cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s settings: %w", template.Name(), err)
+	}
+	return cfg, nil
+}
+
+// ctyToYAML converts a cty.Value into a plain Go value which can be encoded
+// as YAML. Secrets are converted into their plain string values so they can
+// be passed to integrations.
+func ctyToYAML(val cty.Value) (interface{}, error) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	if !val.IsKnown() {
+		return nil, fmt.Errorf("value is not known")
+	}
+
+	ty := val.Type()
+	switch {
+	case ty.Equals(cty.String):
+		return val.AsString(), nil
+	case ty.Equals(cty.Bool):
+		return val.True(), nil
+	case ty.Equals(cty.Number):
+		bf := val.AsBigFloat()
+		if bf.IsInt() {
+			i, _ := bf.Int64()
+			return i, nil
+		}
+		f, _ := bf.Float64()
+		return f, nil
+
+	case ty.IsCapsuleType():
+		switch v := val.EncapsulatedValue().(type) {
+		case *hcltypes.Secret:
+			return string(*v), nil
+		case *hcltypes.OptionalSecret:
+			return v.Value, nil
+		default:
+			return nil, fmt.Errorf("unsupported type %s", ty.FriendlyName())
+		}
+
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		res := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			goElem, err := ctyToYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, goElem)
+		}
+		return res, nil
+
+	case ty.IsMapType() || ty.IsObjectType():
+		res := make(map[string]interface{}, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			goElem, err := ctyToYAML(elem)
+			if err != nil {
+				return nil, err
+			}
+			res[key.AsString()] = goElem
+		}
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", ty.FriendlyName())
+}
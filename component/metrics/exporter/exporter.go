@@ -0,0 +1,270 @@
+// Package exporter adapts static mode integrations into Flow components.
+//
+// Each integration passed to Register becomes a component named
+// metrics.exporter_<name>, where <name> is the integration name with any
+// "_exporter" suffix removed (e.g., redis_exporter becomes
+// metrics.exporter_redis). Component names can only have two identifiers, so
+// the integration name is joined to "exporter" the same way as otelcol
+// components are named. The
+// integration runs in-process and its metrics are served from the
+// component's HTTP handler. The component exports a list of targets which can
+// be passed to metrics.scrape to collect them.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/pkg/integrations"
+	"github.com/grafana/agent/pkg/metrics/instance"
+	"github.com/prometheus/common/model"
+)
+
+// Register registers an integration as a Flow component. Register panics if
+// the integration cannot be registered as a component.
+func Register(cfg integrations.Config) {
+	name := ComponentName(cfg.Name())
+
+	component.Register(component.Registration{
+		Name:    name,
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments), cfg)
+		},
+	})
+}
+
+// ComponentName returns the name of the Flow component for the integration
+// with the given name.
+func ComponentName(integrationName string) string {
+	return "metrics.exporter_" + strings.TrimSuffix(integrationName, "_exporter")
+}
+
+// Exports holds values which are exported by exporter components.
+type Exports struct {
+	Targets []discovery.Target `hcl:"targets,attr"`
+}
+
+// Component implements an exporter component for a single integration.
+type Component struct {
+	opts     component.Options
+	template integrations.Config
+
+	mut         sync.RWMutex
+	integration integrations.Integration
+	handler     http.Handler
+
+	newIntegration chan struct{} // Written to when integration changes.
+}
+
+var (
+	_ component.Component     = (*Component)(nil)
+	_ component.HTTPComponent = (*Component)(nil)
+)
+
+// New creates a new exporter component. template is used to create new
+// instances of the integration's config and is never modified.
+func New(opts component.Options, args Arguments, template integrations.Config) (*Component, error) {
+	c := &Component{
+		opts:     opts,
+		template: template,
+
+		newIntegration: make(chan struct{}, 1),
+	}
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component. The integration is restarted whenever
+// the component's arguments change.
+func (c *Component) Run(ctx context.Context) error {
+	var (
+		running bool
+		cancel  context.CancelFunc = func() {}
+		exited                     = make(chan error, 1)
+	)
+	defer func() { cancel() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err := <-exited:
+			return err
+
+		case <-c.newIntegration:
+			if running {
+				cancel()
+				// Wait for the previous integration to exit; any error it
+				// returns is a result of being stopped.
+				<-exited
+			}
+
+			c.mut.RLock()
+			integration := c.integration
+			c.mut.RUnlock()
+
+			runCtx, runCancel := context.WithCancel(ctx)
+			cancel, running = runCancel, true
+
+			go func() {
+				err := integration.Run(runCtx)
+				if runCtx.Err() != nil {
+					// Integrations may return the context error when they're
+					// stopped, which isn't a failure.
+					err = nil
+				} else if err == nil {
+					err = errors.New("integration exited unexpectedly")
+				}
+				exited <- err
+			}()
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	cfg, err := newArgs.integrationConfig(c.template)
+	if err != nil {
+		return err
+	}
+	integration, err := cfg.NewIntegration(c.opts.Logger)
+	if err != nil {
+		return fmt.Errorf("creating integration: %w", err)
+	}
+	handler, err := integration.MetricsHandler()
+	if err != nil {
+		return fmt.Errorf("creating metrics handler: %w", err)
+	}
+	targets, err := c.buildTargets(newArgs, cfg, integration)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.integration = integration
+	c.handler = handler
+	c.mut.Unlock()
+
+	select {
+	case c.newIntegration <- struct{}{}:
+	default:
+	}
+
+	c.opts.OnStateChange(Exports{Targets: targets})
+	return nil
+}
+
+// buildTargets returns the list of targets which scrape the integration
+// through the component's HTTP handler.
+func (c *Component) buildTargets(args Arguments, cfg integrations.Config, i integrations.Integration) ([]discovery.Target, error) {
+	instanceKey := args.Instance
+	if instanceKey == "" {
+		agentKey, err := c.agentKey()
+		if err != nil {
+			return nil, err
+		}
+		instanceKey, err = cfg.InstanceKey(agentKey)
+		if err != nil {
+			return nil, fmt.Errorf("getting instance key: %w", err)
+		}
+	}
+
+	var targets []discovery.Target
+	for _, sc := range i.ScrapeConfigs() {
+		t := discovery.Target{
+			model.AddressLabel:     c.targetAddress(),
+			model.MetricsPathLabel: path.Join(c.opts.HTTPPath, sc.MetricsPath),
+			model.JobLabel:         "integrations/" + sc.JobName,
+			model.InstanceLabel:    instanceKey,
+		}
+		for name, values := range sc.QueryParams {
+			if len(values) > 0 {
+				t[model.ParamLabelPrefix+name] = values[0]
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// targetAddress returns the address targets use to reach the Flow HTTP
+// server. The listen address can't be used directly when it doesn't specify
+// a host, such as ":12345" or "0.0.0.0:12345"; the address advertised to
+// cluster peers is used instead, falling back to a loopback address.
+func (c *Component) targetAddress() string {
+	host, port, err := net.SplitHostPort(c.opts.HTTPListenAddr)
+	if err != nil || !isWildcardHost(host) {
+		return c.opts.HTTPListenAddr
+	}
+
+	if c.opts.Clusterer != nil {
+		for _, p := range c.opts.Clusterer.Peers() {
+			if !p.Self {
+				continue
+			}
+			if selfHost, _, err := net.SplitHostPort(p.Addr); err == nil && !isWildcardHost(selfHost) {
+				return net.JoinHostPort(selfHost, port)
+			}
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return net.JoinHostPort(net.IPv6loopback.String(), port)
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// isWildcardHost returns true if host listens on all interfaces.
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// agentKey returns the key identifying this process, which integrations may
+// use to build their instance key. It matches the key used in static mode.
+func (c *Component) agentKey() (string, error) {
+	hostname, err := instance.Hostname()
+	if err != nil {
+		return "", err
+	}
+	_, port, err := net.SplitHostPort(c.opts.HTTPListenAddr)
+	if err != nil {
+		return hostname, nil
+	}
+	return net.JoinHostPort(hostname, port), nil
+}
+
+// Handler implements component.HTTPComponent, serving the metrics of the
+// running integration.
+func (c *Component) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mut.RLock()
+		handler := c.handler
+		c.mut.RUnlock()
+
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
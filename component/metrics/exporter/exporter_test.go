@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/pkg/cluster"
+	"github.com/grafana/agent/pkg/integrations"
+	"github.com/grafana/agent/pkg/integrations/config"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponentName(t *testing.T) {
+	require.Equal(t, "metrics.exporter_redis", ComponentName("redis_exporter"))
+	require.Equal(t, "metrics.exporter_cadvisor", ComponentName("cadvisor"))
+}
+
+func TestComponent(t *testing.T) {
+	args := decodeArguments(t, `
+		address = "localhost:1234"
+		labels  = { team = "a" }
+	`)
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:             "metrics.exporter_test.default",
+		Logger:         log.NewNopLogger(),
+		HTTPListenAddr: "127.0.0.1:12345",
+		HTTPPath:       "/component/metrics.exporter_test.default/",
+		OnStateChange:  func(e component.Exports) { exports = e.(Exports) },
+	}, args, &testConfig{})
+	require.NoError(t, err)
+
+	require.Equal(t, []discovery.Target{{
+		"__address__":      "127.0.0.1:12345",
+		"__metrics_path__": "/component/metrics.exporter_test.default/metrics",
+		"__param_module":   "default",
+		"job":              "integrations/test",
+		"instance":         "localhost:1234",
+	}}, exports.Targets)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, "address=localhost:1234 team=a\n", rec.Body.String())
+}
+
+func TestComponent_Instance(t *testing.T) {
+	args := decodeArguments(t, `
+		address  = "localhost:1234"
+		instance = "override"
+	`)
+
+	var exports Exports
+	_, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args, &testConfig{})
+	require.NoError(t, err)
+	require.Len(t, exports.Targets, 1)
+	require.Equal(t, "override", exports.Targets[0]["instance"])
+}
+
+func TestComponent_TargetAddress(t *testing.T) {
+	tt := []struct {
+		listenAddr string
+		clusterer  cluster.Node
+		expect     string
+	}{
+		{listenAddr: "127.0.0.1:12345", expect: "127.0.0.1:12345"},
+		{listenAddr: "agent.example:12345", expect: "agent.example:12345"},
+		{listenAddr: ":12345", expect: "127.0.0.1:12345"},
+		{listenAddr: "0.0.0.0:12345", expect: "127.0.0.1:12345"},
+		{listenAddr: "[::]:12345", expect: "[::1]:12345"},
+		{listenAddr: ":12345", clusterer: cluster.NewLocalNode(":12345"), expect: "127.0.0.1:12345"},
+		{listenAddr: ":12345", clusterer: cluster.NewLocalNode("10.0.0.1:8080"), expect: "10.0.0.1:12345"},
+		{listenAddr: "127.0.0.1:12345", clusterer: cluster.NewLocalNode("10.0.0.1:8080"), expect: "127.0.0.1:12345"},
+	}
+
+	for _, tc := range tt {
+		c := &Component{opts: component.Options{
+			HTTPListenAddr: tc.listenAddr,
+			Clusterer:      tc.clusterer,
+		}}
+		require.Equal(t, tc.expect, c.targetAddress(), "listen address %s", tc.listenAddr)
+	}
+}
+
+func TestComponent_UnknownSetting(t *testing.T) {
+	args := decodeArguments(t, `
+		address = "localhost:1234"
+		bogus   = true
+	`)
+
+	_, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args, &testConfig{})
+	require.Error(t, err)
+}
+
+func decodeArguments(t *testing.T, in string) Arguments {
+	t.Helper()
+
+	file, diags := hclsyntax.ParseConfig([]byte(in), t.Name(), hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	var args Arguments
+	diags = gohcl.DecodeBody(file.Body, nil, &args)
+	require.False(t, diags.HasErrors(), diags.Error())
+	return args
+}
+
+type testConfig struct {
+	Address string            `yaml:"address"`
+	Labels  map[string]string `yaml:"labels,omitempty"`
+}
+
+func (c *testConfig) Name() string { return "test_exporter" }
+
+func (c *testConfig) InstanceKey(agentKey string) (string, error) { return c.Address, nil }
+
+func (c *testConfig) NewIntegration(l log.Logger) (integrations.Integration, error) {
+	return &testIntegration{cfg: *c}, nil
+}
+
+type testIntegration struct{ cfg testConfig }
+
+func (i *testIntegration) MetricsHandler() (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "address=%s team=%s\n", i.cfg.Address, i.cfg.Labels["team"])
+	}), nil
+}
+
+func (i *testIntegration) ScrapeConfigs() []config.ScrapeConfig {
+	return []config.ScrapeConfig{{
+		JobName:     "test",
+		MetricsPath: "/metrics",
+		QueryParams: url.Values{"module": []string{"default"}},
+	}}
+}
+
+func (i *testIntegration) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
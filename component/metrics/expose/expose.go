@@ -0,0 +1,281 @@
+// Package expose implements the metrics.expose component.
+package expose
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/hashicorp/hcl/v2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "metrics.expose",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the metrics.expose
+// component.
+type Arguments struct {
+	// SeriesTTL is how long a series is exposed after its last sample was
+	// received. Must be greater than zero.
+	SeriesTTL time.Duration `hcl:"series_ttl,optional"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	SeriesTTL: 5 * time.Minute,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	if args.SeriesTTL <= 0 {
+		return fmt.Errorf("series_ttl must be greater than 0")
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the metrics.expose component.
+type Exports struct {
+	Receiver *metrics.Receiver `hcl:"receiver"`
+}
+
+// Component implements the metrics.expose component.
+type Component struct {
+	opts     component.Options
+	receiver *metrics.Receiver
+
+	mut    sync.RWMutex
+	ttl    time.Duration
+	series map[uint64]*sample // Latest sample per global ref ID.
+
+	now func() time.Time // Overridable for tests.
+}
+
+type sample struct {
+	labels    labels.Labels
+	timestamp int64
+	value     float64
+	received  time.Time // Wall clock time the sample was received.
+}
+
+// gcInterval is how often expired series are removed from memory. Expired
+// series are never exposed, even before they're removed.
+const gcInterval = time.Minute
+
+var (
+	_ component.Component     = (*Component)(nil)
+	_ component.HTTPComponent = (*Component)(nil)
+)
+
+// New creates a new metrics.expose component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:   o,
+		series: make(map[uint64]*sample),
+		now:    time.Now,
+	}
+	c.receiver = &metrics.Receiver{Receive: c.Receive}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component. Series which haven't received a sample
+// within the configured TTL are periodically removed.
+func (c *Component) Run(ctx context.Context) error {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.gc()
+		}
+	}
+}
+
+// gc removes expired series.
+func (c *Component) gc() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := c.now()
+	for ref, s := range c.series {
+		if c.expired(s, now) {
+			delete(c.series, ref)
+		}
+	}
+}
+
+// expired returns true if s hasn't been updated within the TTL. c.mut must be
+// held when calling expired.
+func (c *Component) expired(s *sample, now time.Time) bool {
+	return now.Sub(s.received) > c.ttl
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	c.ttl = newArgs.SeriesTTL
+	c.mut.Unlock()
+
+	c.opts.OnStateChange(Exports{Receiver: c.receiver})
+	return nil
+}
+
+// Receive implements the receiver.Receive func that allows an array of metrics
+// to be passed around. Only the newest sample of each series is kept, and
+// series are dropped once a stale marker is received for them or once they
+// expire.
+func (c *Component) Receive(ts int64, metricArr []*metrics.FlowMetric) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := c.now()
+
+	for _, m := range metricArr {
+		if value.IsStaleNaN(m.Value) {
+			delete(c.series, m.GlobalRefID)
+			continue
+		}
+
+		if prev, ok := c.series[m.GlobalRefID]; ok && prev.timestamp > ts {
+			continue
+		}
+		c.series[m.GlobalRefID] = &sample{
+			labels:    m.Labels,
+			timestamp: ts,
+			value:     m.Value,
+			received:  now,
+		}
+	}
+}
+
+// Handler implements component.HTTPComponent. It serves the latest received
+// samples on /metrics in the Prometheus text or OpenMetrics format.
+func (c *Component) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.serveMetrics)
+	return mux
+}
+
+func (c *Component) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+
+	enc := expfmt.NewEncoder(w, format)
+	for _, mf := range c.metricFamilies() {
+		if err := enc.Encode(mf); err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to encode metrics", "err", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to encode metrics", "err", err)
+		}
+	}
+}
+
+// metricFamilies converts the stored unexpired samples into untyped metric
+// families, sorted by name.
+func (c *Component) metricFamilies() []*dto.MetricFamily {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	now := c.now()
+
+	families := make(map[string]*dto.MetricFamily)
+	for _, s := range c.series {
+		if c.expired(s, now) {
+			continue
+		}
+
+		name := s.labels.Get(labels.MetricName)
+		if name == "" {
+			continue
+		}
+
+		mf, ok := families[name]
+		if !ok {
+			mf = &dto.MetricFamily{
+				Name: proto.String(name),
+				Type: dto.MetricType_UNTYPED.Enum(),
+			}
+			families[name] = mf
+		}
+
+		m := &dto.Metric{
+			Untyped:     &dto.Untyped{Value: proto.Float64(s.value)},
+			TimestampMs: proto.Int64(s.timestamp),
+		}
+		for _, l := range s.labels {
+			if l.Name == labels.MetricName {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{
+				Name:  proto.String(l.Name),
+				Value: proto.String(l.Value),
+			})
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	res := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelPairsLess(mf.Metric[i].Label, mf.Metric[j].Label)
+		})
+		res = append(res, mf)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].GetName() < res[j].GetName()
+	})
+	return res
+}
+
+func labelPairsLess(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,153 @@
+package expose
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpose(t *testing.T) {
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "metrics.expose.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, DefaultArguments)
+	require.NoError(t, err)
+	require.NotNil(t, exports.Receiver)
+
+	var (
+		upA  = labels.FromStrings("__name__", "up", "job", "a")
+		upB  = labels.FromStrings("__name__", "up", "job", "b")
+		reqs = labels.FromStrings("__name__", "requests_total", "code", "200")
+	)
+
+	exports.Receiver.Receive(1000, []*metrics.FlowMetric{
+		{GlobalRefID: 1, Labels: upA, Value: 1},
+		{GlobalRefID: 2, Labels: upB, Value: 0},
+		{GlobalRefID: 3, Labels: reqs, Value: 10},
+	})
+	exports.Receiver.Receive(2000, []*metrics.FlowMetric{
+		{GlobalRefID: 2, Labels: upB, Value: math.Float64frombits(value.StaleNaN)},
+		{GlobalRefID: 3, Labels: reqs, Value: 15},
+	})
+	// Out-of-order samples must not replace newer ones.
+	exports.Receiver.Receive(1500, []*metrics.FlowMetric{
+		{GlobalRefID: 3, Labels: reqs, Value: 12},
+	})
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	expect := `# TYPE requests_total untyped
+requests_total{code="200"} 15 2000
+# TYPE up untyped
+up{job="a"} 1 1000
+`
+	require.Equal(t, expect, rec.Body.String())
+}
+
+func TestExpose_OpenMetrics(t *testing.T) {
+	var exports Exports
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, DefaultArguments)
+	require.NoError(t, err)
+
+	exports.Receiver.Receive(1000, []*metrics.FlowMetric{
+		{GlobalRefID: 1, Labels: labels.FromStrings("__name__", "up"), Value: 1},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", expfmt.OpenMetricsType+`;version=`+expfmt.OpenMetricsVersion)
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, req)
+
+	expect := `# TYPE up unknown
+up 1.0 1.0
+# EOF
+`
+	require.Equal(t, expect, rec.Body.String())
+}
+
+func TestExpose_SeriesTTL(t *testing.T) {
+	var exports Exports
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, Arguments{SeriesTTL: time.Minute})
+	require.NoError(t, err)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	var (
+		upA = labels.FromStrings("__name__", "up", "job", "a")
+		upB = labels.FromStrings("__name__", "up", "job", "b")
+	)
+	exports.Receiver.Receive(1000, []*metrics.FlowMetric{
+		{GlobalRefID: 1, Labels: upA, Value: 1},
+		{GlobalRefID: 2, Labels: upB, Value: 1},
+	})
+
+	now = now.Add(45 * time.Second)
+	exports.Receiver.Receive(2000, []*metrics.FlowMetric{
+		{GlobalRefID: 2, Labels: upB, Value: 0},
+	})
+
+	// upA expires before it's garbage collected, and must no longer be
+	// exposed.
+	now = now.Add(30 * time.Second)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expect := `# TYPE up untyped
+up{job="b"} 0 2000
+`
+	require.Equal(t, expect, rec.Body.String())
+
+	c.gc()
+	require.Len(t, c.series, 1)
+	require.Contains(t, c.series, uint64(2))
+}
+
+func TestArguments_DecodeHCL(t *testing.T) {
+	var args Arguments
+	require.NoError(t, decodeArguments(``, &args))
+	require.Equal(t, DefaultArguments, args)
+
+	require.NoError(t, decodeArguments(`series_ttl = "30s"`, &args))
+	require.Equal(t, 30*time.Second, args.SeriesTTL)
+
+	// Series must always expire, otherwise they would be exposed forever.
+	require.Error(t, decodeArguments(`series_ttl = "0s"`, &args))
+	require.Error(t, decodeArguments(`series_ttl = "-1m"`, &args))
+}
+
+func decodeArguments(in string, args *Arguments) error {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(in), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	diags = gohcl.DecodeBody(file.Body, nil, args)
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
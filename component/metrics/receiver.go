@@ -1,9 +1,14 @@
 package metrics
 
 import (
+	"github.com/grafana/agent/component"
 	"github.com/prometheus/prometheus/model/labels"
 )
 
+func init() {
+	component.RegisterGoStruct("MetricsReceiver", Receiver{})
+}
+
 // Receiver is used to pass an array of metrics to another receiver
 type Receiver struct {
 	// metrics should be considered immutable
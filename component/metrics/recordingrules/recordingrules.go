@@ -0,0 +1,412 @@
+// Package recordingrules implements the metrics.recording_rules component.
+package recordingrules
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	fa "github.com/grafana/agent/component/common/appendable"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "metrics.recording_rules",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// metrics.recording_rules component.
+type Arguments struct {
+	// Where the results of rules (and source samples, unless dropped) are
+	// forwarded to.
+	ForwardTo []*metrics.Receiver `hcl:"forward_to"`
+
+	Rules           []Rule `hcl:"rule,block"`
+	RuleFileContent string `hcl:"rule_file_content,optional"`
+
+	EvaluationInterval time.Duration `hcl:"evaluation_interval,optional"`
+	Window             time.Duration `hcl:"window,optional"`
+	DropSourceSeries   bool          `hcl:"drop_source_series,optional"`
+}
+
+// Rule is a single recording rule.
+type Rule struct {
+	Record string            `hcl:"record"`
+	Expr   string            `hcl:"expr"`
+	Labels map[string]string `hcl:"labels,optional"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	EvaluationInterval: time.Minute,
+	Window:             10 * time.Minute,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.EvaluationInterval <= 0 {
+		return fmt.Errorf("evaluation_interval must be greater than 0")
+	}
+	if args.Window < args.EvaluationInterval {
+		return fmt.Errorf("window must not be shorter than evaluation_interval")
+	}
+	if len(args.Rules) == 0 && args.RuleFileContent == "" {
+		return fmt.Errorf("at least one rule block or rule_file_content must be set")
+	}
+	return nil
+}
+
+// buildRules returns the rules defined by the arguments. Rules from rule
+// blocks come before rules from rule_file_content.
+func (args *Arguments) buildRules() ([]*rules.RecordingRule, error) {
+	var res []*rules.RecordingRule
+
+	for _, r := range args.Rules {
+		rule, err := newRecordingRule(r.Record, r.Expr, r.Labels)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rule)
+	}
+
+	if args.RuleFileContent != "" {
+		groups, errs := rulefmt.Parse([]byte(args.RuleFileContent))
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("invalid rule_file_content: %w", errs[0])
+		}
+		for _, g := range groups.Groups {
+			for _, r := range g.Rules {
+				if r.Alert.Value != "" {
+					return nil, fmt.Errorf("group %q: alerting rule %q is not supported", g.Name, r.Alert.Value)
+				}
+				rule, err := newRecordingRule(r.Record.Value, r.Expr.Value, r.Labels)
+				if err != nil {
+					return nil, fmt.Errorf("group %q: %w", g.Name, err)
+				}
+				res = append(res, rule)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func newRecordingRule(record, expr string, lbls map[string]string) (*rules.RecordingRule, error) {
+	if !model.IsValidMetricName(model.LabelValue(record)) {
+		return nil, fmt.Errorf("invalid record name %q", record)
+	}
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: invalid expr: %w", record, err)
+	}
+	return rules.NewRecordingRule(record, parsed, labels.FromMap(lbls)), nil
+}
+
+// Exports holds values which are exported by the metrics.recording_rules
+// component.
+type Exports struct {
+	Receiver *metrics.Receiver `hcl:"receiver"`
+}
+
+// Component implements the metrics.recording_rules component.
+type Component struct {
+	opts     component.Options
+	clock    clock.Clock
+	receiver *metrics.Receiver
+	storage  *memStorage
+	engine   *promql.Engine
+
+	updated chan struct{} // Written to when the evaluation interval may have changed.
+
+	mut        sync.RWMutex
+	args       Arguments
+	rules      []*rules.RecordingRule
+	appendable fa.FlowAppendable
+
+	// Series written by the previous evaluation. Only accessed by evaluate.
+	lastSeries map[uint64]labels.Labels
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ component.Component       = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+	_ component.DebugComponent  = (*Component)(nil)
+)
+
+// New creates a new metrics.recording_rules component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	clk := o.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	c := &Component{
+		opts:    o,
+		clock:   clk,
+		storage: newMemStorage(),
+		engine: promql.NewEngine(promql.EngineOpts{
+			Logger:     o.Logger,
+			MaxSamples: 50000000,
+			Timeout:    2 * time.Minute,
+		}),
+		updated: make(chan struct{}, 1),
+
+		health: component.Health{
+			Health:     component.HealthTypeUnknown,
+			Message:    "component started",
+			UpdateTime: time.Now(),
+		},
+	}
+	c.receiver = &metrics.Receiver{Receive: c.Receive}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	// The receiver remains the same for the component lifetime, so it is only
+	// exported once.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	c.mut.RLock()
+	ticker := c.clock.Ticker(c.args.EvaluationInterval)
+	c.mut.RUnlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.updated:
+			c.mut.RLock()
+			ticker.Reset(c.args.EvaluationInterval)
+			c.mut.RUnlock()
+		case <-ticker.C:
+			c.evaluate(ctx, c.clock.Now())
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	newRules, err := newArgs.buildRules()
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.args = newArgs
+	c.rules = newRules
+	c.appendable = fa.NewFlowAppendable(newArgs.ForwardTo...)
+
+	select {
+	case c.updated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Receive implements the receiver.Receive func that allows an array of metrics
+// to be passed around. Samples are stored for rule evaluation and forwarded
+// unless drop_source_series is set.
+func (c *Component) Receive(ts int64, metricArr []*metrics.FlowMetric) {
+	for _, m := range metricArr {
+		c.storage.append(m.Labels, ts, m.Value)
+	}
+
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.args.DropSourceSeries {
+		return
+	}
+
+	app := c.appendable.Appender(context.Background())
+	for _, m := range metricArr {
+		if _, err := app.Append(storage.SeriesRef(m.GlobalRefID), m.Labels, ts, m.Value); err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to forward sample", "err", err)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to commit source samples", "err", err)
+	}
+}
+
+// evaluate evaluates all rules at ts and forwards the results. Rules are
+// evaluated in order, so a rule can use the results of the rules before it.
+//
+// The rules are evaluated without holding mut so that Receive isn't blocked
+// by slow queries or downstream components; the storage handles concurrent
+// appends and queries itself.
+func (c *Component) evaluate(ctx context.Context, ts time.Time) {
+	c.mut.RLock()
+	var (
+		window     = c.args.Window
+		ruleSet    = c.rules
+		appendable = c.appendable
+	)
+	c.mut.RUnlock()
+
+	c.storage.truncate(timestamp.FromTime(ts.Add(-window)))
+
+	var (
+		t          = timestamp.FromTime(ts)
+		queryFunc  = rules.EngineQueryFunc(c.engine, c.storage)
+		app        = appendable.Appender(ctx)
+		seen       = make(map[uint64]labels.Labels)
+		lastErr    error
+		numFailed  int
+		numSamples int
+	)
+
+	for _, rule := range ruleSet {
+		start := time.Now()
+		vector, err := rule.Eval(ctx, ts, queryFunc, nil, 0)
+		rule.SetEvaluationTimestamp(ts)
+		rule.SetEvaluationDuration(time.Since(start))
+		rule.SetLastError(err)
+		if err != nil {
+			rule.SetHealth(rules.HealthBad)
+			level.Warn(c.opts.Logger).Log("msg", "failed to evaluate rule", "rule", rule.Name(), "err", err)
+			lastErr = err
+			numFailed++
+			continue
+		}
+		rule.SetHealth(rules.HealthGood)
+
+		for _, s := range vector {
+			// Store results so rules evaluated later can refer to them.
+			c.storage.append(s.Metric, t, s.V)
+			seen[s.Metric.Hash()] = s.Metric
+
+			if _, err := app.Append(0, s.Metric, t, s.V); err != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to forward rule result", "rule", rule.Name(), "err", err)
+			}
+			numSamples++
+		}
+	}
+
+	// Mark series which are no longer produced by any rule as stale.
+	for hash, lset := range c.lastSeries {
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		if _, err := app.Append(0, lset, t, math.Float64frombits(value.StaleNaN)); err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to forward stale marker", "err", err)
+		}
+	}
+	c.lastSeries = seen
+
+	if err := app.Commit(); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to commit rule results", "err", err)
+	}
+
+	if lastErr != nil {
+		c.setHealth(component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    fmt.Sprintf("%d of %d rules failed to evaluate; last error: %s", numFailed, len(ruleSet), lastErr),
+			UpdateTime: time.Now(),
+		})
+		return
+	}
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeHealthy,
+		Message:    fmt.Sprintf("evaluated %d rules producing %d series", len(ruleSet), numSamples),
+		UpdateTime: time.Now(),
+	})
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *Component) CurrentHealth() component.Health {
+	c.healthMut.RLock()
+	defer c.healthMut.RUnlock()
+	return c.health
+}
+
+func (c *Component) setHealth(h component.Health) {
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	c.health = h
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	info := debugInfo{InMemorySeries: c.storage.numSeries()}
+	for _, rule := range c.rules {
+		var lastError string
+		if err := rule.LastError(); err != nil {
+			lastError = err.Error()
+		}
+		info.Rules = append(info.Rules, ruleInfo{
+			Record:             rule.Name(),
+			Expr:               rule.Query().String(),
+			Health:             string(rule.Health()),
+			LastError:          lastError,
+			LastEvaluation:     rule.GetEvaluationTimestamp(),
+			EvaluationDuration: rule.GetEvaluationDuration(),
+		})
+	}
+	return info
+}
+
+type debugInfo struct {
+	InMemorySeries int        `hcl:"in_memory_series"`
+	Rules          []ruleInfo `hcl:"rule,block"`
+}
+
+type ruleInfo struct {
+	Record             string        `hcl:"record"`
+	Expr               string        `hcl:"expr"`
+	Health             string        `hcl:"health"`
+	LastError          string        `hcl:"last_error,optional"`
+	LastEvaluation     time.Time     `hcl:"last_evaluation"`
+	EvaluationDuration time.Duration `hcl:"evaluation_duration"`
+}
@@ -0,0 +1,248 @@
+package recordingrules
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	_ "github.com/grafana/agent/component/metrics/scrape" // Registers the MetricsReceiver type for decoding.
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingRules(t *testing.T) {
+	out := &collector{}
+	args := DefaultArguments
+	args.ForwardTo = []*metrics.Receiver{{Receive: out.Receive}}
+	args.Rules = []Rule{
+		{Record: "deployment:cpu:sum", Expr: `sum by (deployment) (pod_cpu)`},
+		{Record: "cluster:cpu:sum", Expr: `sum(deployment:cpu:sum)`, Labels: map[string]string{"source": "rules"}},
+	}
+
+	var exports Exports
+	c, err := New(component.Options{
+		ID:            "metrics.recording_rules.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args)
+	require.NoError(t, err)
+	require.NotNil(t, exports.Receiver)
+
+	now := time.Now()
+	ts := timestamp.FromTime(now.Add(-time.Second))
+	exports.Receiver.Receive(ts, []*metrics.FlowMetric{
+		{Labels: labels.FromStrings("__name__", "pod_cpu", "deployment", "a", "pod", "a-1"), Value: 1},
+		{Labels: labels.FromStrings("__name__", "pod_cpu", "deployment", "a", "pod", "a-2"), Value: 2},
+		{Labels: labels.FromStrings("__name__", "pod_cpu", "deployment", "b", "pod", "b-1"), Value: 4},
+	})
+	require.Len(t, out.samples(), 3, "source samples should be forwarded")
+
+	out.reset()
+	c.evaluate(context.Background(), now)
+
+	expect := map[string]float64{
+		`{__name__="deployment:cpu:sum", deployment="a"}`: 3,
+		`{__name__="deployment:cpu:sum", deployment="b"}`: 4,
+		`{__name__="cluster:cpu:sum", source="rules"}`:    7,
+	}
+	require.Equal(t, expect, out.samples())
+	require.Equal(t, component.HealthTypeHealthy, c.CurrentHealth().Health)
+
+	// Series no longer produced by a rule should be marked as stale.
+	require.NoError(t, c.Update(Arguments{
+		ForwardTo:          args.ForwardTo,
+		Rules:              args.Rules[:1],
+		EvaluationInterval: args.EvaluationInterval,
+		Window:             args.Window,
+	}))
+	out.reset()
+	c.evaluate(context.Background(), now.Add(time.Second))
+
+	res := out.samples()
+	require.Len(t, res, 3)
+	require.True(t, value.IsStaleNaN(res[`{__name__="cluster:cpu:sum", source="rules"}`]))
+}
+
+func TestRecordingRules_DropSourceSeries(t *testing.T) {
+	out := &collector{}
+	args := DefaultArguments
+	args.ForwardTo = []*metrics.Receiver{{Receive: out.Receive}}
+	args.Rules = []Rule{{Record: "total", Expr: `sum(input)`}}
+	args.DropSourceSeries = true
+
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	now := time.Now()
+	c.Receive(timestamp.FromTime(now), []*metrics.FlowMetric{
+		{Labels: labels.FromStrings("__name__", "input", "instance", "a"), Value: 5},
+	})
+	require.Empty(t, out.samples())
+
+	c.evaluate(context.Background(), now)
+	require.Equal(t, map[string]float64{`{__name__="total"}`: 5}, out.samples())
+}
+
+func TestRecordingRules_ReceiveDuringEvaluation(t *testing.T) {
+	var (
+		forwarding = make(chan struct{})
+		release    = make(chan struct{})
+	)
+	args := DefaultArguments
+	args.ForwardTo = []*metrics.Receiver{{Receive: func(int64, []*metrics.FlowMetric) {
+		forwarding <- struct{}{}
+		<-release
+	}}}
+	args.Rules = []Rule{{Record: "total", Expr: `sum(input)`}}
+	args.DropSourceSeries = true
+
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	now := time.Now()
+	c.Receive(timestamp.FromTime(now), []*metrics.FlowMetric{
+		{Labels: labels.FromStrings("__name__", "input", "instance", "a"), Value: 5},
+	})
+
+	evaluated := make(chan struct{})
+	go func() {
+		defer close(evaluated)
+		c.evaluate(context.Background(), now)
+	}()
+	<-forwarding
+
+	// Samples must still be received while rule results are being forwarded
+	// to a slow downstream component.
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		c.Receive(timestamp.FromTime(now), []*metrics.FlowMetric{
+			{Labels: labels.FromStrings("__name__", "input", "instance", "b"), Value: 1},
+		})
+	}()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Receive blocked during evaluation")
+	}
+
+	close(release)
+	<-evaluated
+}
+
+func TestArguments(t *testing.T) {
+	t.Run("rule file content", func(t *testing.T) {
+		args := Arguments{RuleFileContent: `
+groups:
+  - name: example
+    rules:
+      - record: job:up:sum
+        expr: sum by (job) (up)
+        labels:
+          team: a
+`}
+		rules, err := args.buildRules()
+		require.NoError(t, err)
+		require.Len(t, rules, 1)
+		require.Equal(t, "job:up:sum", rules[0].Name())
+		require.Equal(t, labels.FromStrings("team", "a"), rules[0].Labels())
+	})
+
+	t.Run("alerting rules are rejected", func(t *testing.T) {
+		args := Arguments{RuleFileContent: `
+groups:
+  - name: example
+    rules:
+      - alert: Down
+        expr: up == 0
+`}
+		_, err := args.buildRules()
+		require.EqualError(t, err, `group "example": alerting rule "Down" is not supported`)
+	})
+
+	t.Run("invalid expressions are rejected", func(t *testing.T) {
+		args := Arguments{Rules: []Rule{{Record: "bad", Expr: "sum("}}}
+		_, err := args.buildRules()
+		require.ErrorContains(t, err, `rule "bad": invalid expr`)
+	})
+
+	t.Run("defaults are applied", func(t *testing.T) {
+		var args Arguments
+		err := decode(`
+			forward_to = []
+			rule {
+				record = "total"
+				expr   = "sum(input)"
+			}
+		`, &args)
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, args.EvaluationInterval)
+		require.Equal(t, 10*time.Minute, args.Window)
+	})
+
+	t.Run("rules are required", func(t *testing.T) {
+		var args Arguments
+		err := decode(`forward_to = []`, &args)
+		require.ErrorContains(t, err, "at least one rule block or rule_file_content must be set")
+	})
+}
+
+func decode(cfg string, args *Arguments) error {
+	file, diags := hclparse.NewParser().ParseHCL([]byte(cfg), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	if diags := gohcl.DecodeBody(file.Body, nil, args); diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+// collector records the latest value of every series it receives.
+type collector struct {
+	mut    sync.Mutex
+	series map[string]float64
+}
+
+func (c *collector) Receive(_ int64, metricArr []*metrics.FlowMetric) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.series == nil {
+		c.series = make(map[string]float64)
+	}
+	for _, m := range metricArr {
+		c.series[m.Labels.String()] = m.Value
+	}
+}
+
+func (c *collector) samples() map[string]float64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	res := make(map[string]float64, len(c.series))
+	for k, v := range c.series {
+		res[k] = v
+	}
+	return res
+}
+
+func (c *collector) reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.series = nil
+}
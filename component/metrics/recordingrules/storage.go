@@ -0,0 +1,186 @@
+package recordingrules
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+)
+
+// memStorage is an in-memory storage.Queryable holding recent samples for
+// rules to be evaluated against. Samples are kept until they are removed
+// by a call to truncate.
+type memStorage struct {
+	mut    sync.RWMutex
+	series map[uint64]*memSeries // Series by hash of their labels.
+}
+
+var _ storage.Queryable = (*memStorage)(nil)
+
+type memSeries struct {
+	labels  labels.Labels
+	samples []sample // Sorted by timestamp.
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func (s sample) T() int64   { return s.t }
+func (s sample) V() float64 { return s.v }
+
+func newMemStorage() *memStorage {
+	return &memStorage{series: make(map[uint64]*memSeries)}
+}
+
+// append adds a sample for the series identified by lset. Samples older than
+// the latest sample of the series are dropped.
+func (ms *memStorage) append(lset labels.Labels, t int64, v float64) {
+	ms.mut.Lock()
+	defer ms.mut.Unlock()
+
+	hash := lset.Hash()
+	s, ok := ms.series[hash]
+	if !ok {
+		s = &memSeries{labels: lset.Copy()}
+		ms.series[hash] = s
+	}
+	if n := len(s.samples); n > 0 && s.samples[n-1].t >= t {
+		return
+	}
+	s.samples = append(s.samples, sample{t: t, v: v})
+}
+
+// truncate removes samples older than mint. Series without any samples left
+// are removed.
+func (ms *memStorage) truncate(mint int64) {
+	ms.mut.Lock()
+	defer ms.mut.Unlock()
+
+	for hash, s := range ms.series {
+		i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t >= mint })
+		if i == len(s.samples) {
+			delete(ms.series, hash)
+			continue
+		}
+		// Copy the remaining samples so the dropped ones can be freed.
+		s.samples = append([]sample(nil), s.samples[i:]...)
+	}
+}
+
+// numSeries returns the number of series currently held in memory.
+func (ms *memStorage) numSeries() int {
+	ms.mut.RLock()
+	defer ms.mut.RUnlock()
+	return len(ms.series)
+}
+
+// Querier implements storage.Queryable.
+func (ms *memStorage) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &memQuerier{ms: ms, mint: mint, maxt: maxt}, nil
+}
+
+type memQuerier struct {
+	ms         *memStorage
+	mint, maxt int64
+}
+
+var _ storage.Querier = (*memQuerier)(nil)
+
+func (q *memQuerier) Select(sortSeries bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	q.ms.mut.RLock()
+	defer q.ms.mut.RUnlock()
+
+	var res []storage.Series
+	for _, s := range q.ms.matching(matchers) {
+		var samples []tsdbutil.Sample
+		for _, smpl := range s.samples {
+			if smpl.t >= q.mint && smpl.t <= q.maxt {
+				samples = append(samples, smpl)
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		res = append(res, storage.NewListSeries(s.labels, samples))
+	}
+
+	if sortSeries {
+		sort.Slice(res, func(i, j int) bool {
+			return labels.Compare(res[i].Labels(), res[j].Labels()) < 0
+		})
+	}
+	return &seriesSet{series: res, idx: -1}
+}
+
+func (q *memQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.ms.mut.RLock()
+	defer q.ms.mut.RUnlock()
+
+	set := make(map[string]struct{})
+	for _, s := range q.ms.matching(matchers) {
+		if v := s.labels.Get(name); v != "" {
+			set[v] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil, nil
+}
+
+func (q *memQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.ms.mut.RLock()
+	defer q.ms.mut.RUnlock()
+
+	set := make(map[string]struct{})
+	for _, s := range q.ms.matching(matchers) {
+		for _, l := range s.labels {
+			set[l.Name] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil, nil
+}
+
+func (q *memQuerier) Close() error { return nil }
+
+// matching returns all series which match every matcher. mut must be held
+// when calling.
+func (ms *memStorage) matching(matchers []*labels.Matcher) []*memSeries {
+	var res []*memSeries
+Outer:
+	for _, s := range ms.series {
+		for _, m := range matchers {
+			if !m.Matches(s.labels.Get(m.Name)) {
+				continue Outer
+			}
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	res := make([]string, 0, len(set))
+	for k := range set {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// seriesSet implements storage.SeriesSet over a slice of series.
+type seriesSet struct {
+	series []storage.Series
+	idx    int
+}
+
+func (ss *seriesSet) Next() bool {
+	ss.idx++
+	return ss.idx < len(ss.series)
+}
+
+func (ss *seriesSet) At() storage.Series         { return ss.series[ss.idx] }
+func (ss *seriesSet) Err() error                 { return nil }
+func (ss *seriesSet) Warnings() storage.Warnings { return nil }
@@ -0,0 +1,263 @@
+// Package remotewritereceiver implements the metrics.remote_write_receiver
+// component.
+package remotewritereceiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	fa "github.com/grafana/agent/component/common/appendable"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "metrics.remote_write_receiver",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// metrics.remote_write_receiver component.
+type Arguments struct {
+	// Address the HTTP server listens on.
+	ListenAddress string `hcl:"listen_address"`
+	// Path the remote-write endpoint is served on.
+	Path string `hcl:"path,optional"`
+
+	// Where the received metrics should be forwarded to.
+	ForwardTo []*metrics.Receiver `hcl:"forward_to"`
+
+	// TenantHeader is the request header which identifies the tenant sending
+	// the request.
+	TenantHeader string `hcl:"tenant_header,optional"`
+	// TenantLabel, when set, is the label that received series are tagged with
+	// to propagate the value of TenantHeader.
+	TenantLabel string `hcl:"tenant_label,optional"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	Path:         "/api/v1/write",
+	TenantHeader: "X-Scope-OrgID",
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.ListenAddress == "" {
+		return fmt.Errorf("listen_address must not be empty")
+	}
+	if !strings.HasPrefix(args.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if args.TenantLabel != "" {
+		if args.TenantHeader == "" {
+			return fmt.Errorf("tenant_header must be set when tenant_label is set")
+		}
+		if !model.LabelName(args.TenantLabel).IsValid() {
+			return fmt.Errorf("invalid tenant_label %q", args.TenantLabel)
+		}
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the
+// metrics.remote_write_receiver component.
+type Exports struct{}
+
+// Component implements the metrics.remote_write_receiver component.
+type Component struct {
+	opts component.Options
+
+	mut        sync.RWMutex
+	args       Arguments
+	appendable fa.FlowAppendable
+	serving    *listenSettings // Settings of the running HTTP server, if any.
+
+	reload chan struct{} // Written to when the HTTP server must be restarted.
+}
+
+// listenSettings are the arguments which require the HTTP server to be
+// restarted when changed.
+type listenSettings struct {
+	address string
+	path    string
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+	_ http.Handler        = (*Component)(nil)
+)
+
+// New creates a new metrics.remote_write_receiver component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:   o,
+		reload: make(chan struct{}, 1),
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component. The HTTP server is restarted whenever
+// the listen address or path changes.
+func (c *Component) Run(ctx context.Context) error {
+	for {
+		// Record the settings being served under the same lock they're read
+		// with, so Update only signals a reload for settings which differ
+		// from the running server.
+		c.mut.Lock()
+		settings := listenSettings{address: c.args.ListenAddress, path: c.args.Path}
+		c.serving = &settings
+		c.mut.Unlock()
+
+		lis, err := net.Listen("tcp", settings.address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", settings.address, err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(settings.path, c)
+		srv := &http.Server{Handler: mux}
+
+		serveErr := make(chan error, 1)
+		go func() { serveErr <- srv.Serve(lis) }()
+
+		level.Info(c.opts.Logger).Log("msg", "accepting remote_write requests", "addr", lis.Addr(), "path", settings.path)
+
+		select {
+		case <-ctx.Done():
+			shutdownServer(srv)
+			return nil
+		case err := <-serveErr:
+			if !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		case <-c.reload:
+			shutdownServer(srv)
+		}
+	}
+}
+
+func shutdownServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	restart := c.serving != nil && *c.serving != listenSettings{address: newArgs.ListenAddress, path: newArgs.Path}
+	c.args = newArgs
+	c.appendable = fa.NewFlowAppendable(newArgs.ForwardTo...)
+	c.mut.Unlock()
+
+	if restart {
+		select {
+		case c.reload <- struct{}{}:
+		default:
+		}
+	}
+
+	c.opts.OnStateChange(Exports{})
+	return nil
+}
+
+// ServeHTTP implements http.Handler, accepting snappy-compressed
+// prompb.WriteRequest bodies and forwarding every sample to the configured
+// receivers.
+func (c *Component) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := remote.DecodeWriteRequest(r.Body)
+	if err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to decode remote_write request", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mut.RLock()
+	var (
+		app          = c.appendable.Appender(r.Context())
+		tenantHeader = c.args.TenantHeader
+		tenantLabel  = c.args.TenantLabel
+	)
+	c.mut.RUnlock()
+
+	var tenant string
+	if tenantLabel != "" {
+		tenant = r.Header.Get(tenantHeader)
+	}
+
+	for _, ts := range req.Timeseries {
+		lbls := toLabels(ts.Labels, tenantLabel, tenant)
+		for _, s := range ts.Samples {
+			// A zero ref makes the appender look up the global ref ID for the
+			// series, so pushed series share IDs with scraped ones.
+			if _, err := app.Append(0, lbls, s.Timestamp, s.Value); err != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to forward sample from metrics.remote_write_receiver component", "err", err)
+				_ = app.Rollback()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := app.Commit(); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to commit received metrics", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toLabels converts a set of protobuf labels into labels.Labels. If both
+// tenantLabel and tenant are non-empty, tenantLabel is set to tenant,
+// overriding any existing value.
+func toLabels(in []prompb.Label, tenantLabel, tenant string) labels.Labels {
+	b := labels.NewBuilder(nil)
+	for _, l := range in {
+		b.Set(l.Name, l.Value)
+	}
+	if tenantLabel != "" && tenant != "" {
+		b.Set(tenantLabel, tenant)
+	}
+	return b.Labels()
+}
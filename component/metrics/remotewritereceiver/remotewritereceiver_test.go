@@ -0,0 +1,121 @@
+package remotewritereceiver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHTTP(t *testing.T) {
+	var (
+		received   []*metrics.FlowMetric
+		receivedTS []int64
+	)
+	receiver := &metrics.Receiver{
+		Receive: func(ts int64, m []*metrics.FlowMetric) {
+			receivedTS = append(receivedTS, ts)
+			received = append(received, m...)
+		},
+	}
+
+	args := DefaultArguments
+	args.ListenAddress = "127.0.0.1:0"
+	args.ForwardTo = []*metrics.Receiver{receiver}
+	args.TenantLabel = "tenant"
+	require.NoError(t, args.Validate())
+
+	c, err := New(component.Options{
+		ID:            "metrics.remote_write_receiver.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	body := encodeWriteRequest(t, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "up"},
+				{Name: "job", Value: "batch"},
+			},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	req.Header.Set("X-Scope-OrgID", "team-a")
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, []int64{1000}, receivedTS)
+	require.Len(t, received, 1)
+
+	expectLabels := labels.FromStrings("__name__", "up", "job", "batch", "tenant", "team-a")
+	require.Equal(t, expectLabels, received[0].Labels)
+	require.Equal(t, 1.0, received[0].Value)
+	require.Equal(t, metrics.GlobalRefMapping.GetOrAddGlobalRefID(expectLabels), received[0].GlobalRefID)
+}
+
+func TestServeHTTP_InvalidBody(t *testing.T) {
+	args := DefaultArguments
+	args.ListenAddress = "127.0.0.1:0"
+
+	c, err := New(component.Options{
+		ID:            "metrics.remote_write_receiver.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("not snappy")))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpdate_Reload(t *testing.T) {
+	args := DefaultArguments
+	args.ListenAddress = "127.0.0.1:0"
+
+	c, err := New(component.Options{
+		ID:            "metrics.remote_write_receiver.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+	require.Len(t, c.reload, 0, "creating the component should not queue a reload")
+
+	// Changes made before the server is running are picked up when it starts.
+	args.Path = "/push"
+	require.NoError(t, c.Update(args))
+	require.Len(t, c.reload, 0)
+
+	c.serving = &listenSettings{address: args.ListenAddress, path: args.Path}
+
+	args.TenantLabel = "tenant"
+	require.NoError(t, c.Update(args))
+	require.Len(t, c.reload, 0, "changing non-listen settings should not queue a reload")
+
+	args.Path = "/api/v1/push"
+	require.NoError(t, c.Update(args))
+	require.Len(t, c.reload, 1, "changing listen settings should queue a reload")
+}
+
+func encodeWriteRequest(t *testing.T, req *prompb.WriteRequest) []byte {
+	t.Helper()
+
+	buf, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return snappy.Encode(nil, buf)
+}
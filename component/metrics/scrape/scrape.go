@@ -3,6 +3,7 @@ package scrape
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,6 +16,9 @@ import (
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/scrape"
+	"github.com/rfratto/ckit"
+	"github.com/rfratto/ckit/peer"
+	"github.com/rfratto/ckit/shard"
 )
 
 func init() {
@@ -28,7 +32,6 @@ func init() {
 			return New(opts, args.(Arguments))
 		},
 	})
-	component.RegisterGoStruct("MetricsReceiver", metrics.Receiver{})
 }
 
 // Arguments holds values which are used to configure the metrics.scrape
@@ -42,6 +45,16 @@ type Arguments struct {
 	// Scrape Options
 	ExtraMetrics bool `hcl:"extra_metrics,optional"`
 	// TODO(@tpaschalis) enable HTTPClientOptions []config_util.HTTPClientOption
+
+	Clustering *Clustering `hcl:"clustering,block"`
+}
+
+// Clustering holds values which configure how targets are distributed
+// between agents in a cluster.
+type Clustering struct {
+	// Enabled distributes targets between agents in the cluster so that each
+	// target is only scraped by a single agent.
+	Enabled bool `hcl:"enabled"`
 }
 
 // Target refers to a singular HTTP or HTTPS endpoint that will be used for
@@ -93,6 +106,19 @@ func (c *Component) Run(ctx context.Context) error {
 
 	targetSetsChan := make(chan map[string][]*targetgroup.Group)
 
+	// Targets owned by the local agent may change whenever the set of peers
+	// changes, so they are recalculated every time the cluster changes. The
+	// observer deregisters itself once the component exits.
+	if c.opts.Clusterer != nil {
+		c.opts.Clusterer.Observe(ckit.FuncObserver(func(_ []peer.Peer) (reregister bool) {
+			select {
+			case c.reloadTargets <- struct{}{}:
+			default:
+			}
+			return ctx.Err() == nil
+		}))
+	}
+
 	go func() {
 		err := c.scraper.Run(targetSetsChan)
 		level.Info(c.opts.Logger).Log("msg", "scrape manager stopped")
@@ -108,7 +134,11 @@ func (c *Component) Run(ctx context.Context) error {
 		case <-c.reloadTargets:
 			c.mut.RLock()
 			tgs := c.args.Targets
+			clustered := c.args.Clustering != nil && c.args.Clustering.Enabled
 			c.mut.RUnlock()
+			if clustered {
+				tgs = c.ownedTargets(tgs)
+			}
 			promTargets := c.hclTargetsToProm(tgs)
 
 			select {
@@ -194,6 +224,37 @@ func (c *Component) DebugInfo() interface{} {
 	return ScraperStatus{TargetStatus: res}
 }
 
+// ownedTargets returns the subset of tgs which the local agent is responsible
+// for scraping. Targets whose owner can't be determined are kept so they
+// continue to be scraped.
+func (c *Component) ownedTargets(tgs []Target) []Target {
+	if c.opts.Clusterer == nil {
+		return tgs
+	}
+
+	var (
+		res     = make([]Target, 0, len(tgs))
+		lastErr error
+	)
+	for _, tg := range tgs {
+		peers, err := c.opts.Clusterer.Lookup(tg.shardKey(), 1, shard.OpReadWrite)
+		if err != nil {
+			lastErr = err
+			res = append(res, tg)
+			continue
+		}
+		if len(peers) == 0 || peers[0].Self {
+			res = append(res, tg)
+		}
+	}
+
+	if lastErr != nil {
+		level.Warn(c.opts.Logger).Log("msg", "failed to look up owner of targets, scraping them locally", "err", lastErr)
+	}
+	level.Debug(c.opts.Logger).Log("msg", "determined owned targets", "owned", len(res), "total", len(tgs))
+	return res
+}
+
 func (c *Component) hclTargetsToProm(tgs []Target) map[string][]*targetgroup.Group {
 	promGroup := &targetgroup.Group{Source: c.opts.ID}
 	for _, tg := range tgs {
@@ -210,3 +271,22 @@ func convertLabelSet(tg Target) model.LabelSet {
 	}
 	return lset
 }
+
+// shardKey returns the key used to determine which agent in a cluster owns t.
+// Targets with the same set of labels always produce the same key.
+func (t Target) shardKey() shard.Key {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	kb := shard.NewKeyBuilder()
+	for _, name := range names {
+		_, _ = kb.Write([]byte(name))
+		_, _ = kb.Write([]byte{0xff})
+		_, _ = kb.Write([]byte(t[name]))
+		_, _ = kb.Write([]byte{0xff})
+	}
+	return kb.Key()
+}
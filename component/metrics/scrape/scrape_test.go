@@ -0,0 +1,75 @@
+package scrape
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/cluster"
+	"github.com/rfratto/ckit"
+	"github.com/rfratto/ckit/peer"
+	"github.com/rfratto/ckit/shard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnedTargets(t *testing.T) {
+	var tgs []Target
+	for i := 0; i < 100; i++ {
+		tgs = append(tgs, Target{"__address__": fmt.Sprintf("host-%d:9090", i)})
+	}
+
+	t.Run("local node owns every target", func(t *testing.T) {
+		c := &Component{opts: component.Options{
+			Logger:    log.NewNopLogger(),
+			Clusterer: cluster.NewLocalNode("localhost:12345"),
+		}}
+		require.Equal(t, tgs, c.ownedTargets(tgs))
+	})
+
+	t.Run("targets are split between nodes", func(t *testing.T) {
+		var (
+			a = &Component{opts: component.Options{Logger: log.NewNopLogger(), Clusterer: &modNode{self: 0, count: 2}}}
+			b = &Component{opts: component.Options{Logger: log.NewNopLogger(), Clusterer: &modNode{self: 1, count: 2}}}
+		)
+
+		ownedA, ownedB := a.ownedTargets(tgs), b.ownedTargets(tgs)
+		require.NotEmpty(t, ownedA)
+		require.NotEmpty(t, ownedB)
+		require.ElementsMatch(t, tgs, append(ownedA, ownedB...))
+	})
+
+	t.Run("targets are kept when lookups fail", func(t *testing.T) {
+		c := &Component{opts: component.Options{Logger: log.NewNopLogger(), Clusterer: &modNode{count: 0}}}
+		require.Equal(t, tgs, c.ownedTargets(tgs))
+	})
+}
+
+func TestTarget_shardKey(t *testing.T) {
+	a := Target{"__address__": "localhost:9090", "job": "a"}
+	b := Target{"job": "a", "__address__": "localhost:9090"}
+	require.Equal(t, a.shardKey(), b.shardKey())
+
+	// Concatenated names and values must not collide.
+	c := Target{"ab": "c"}
+	d := Target{"a": "bc"}
+	require.NotEqual(t, c.shardKey(), d.shardKey())
+}
+
+// modNode is a cluster.Node where each of count nodes owns the keys whose
+// value modulo count is its index.
+type modNode struct {
+	self, count int
+}
+
+func (n *modNode) Lookup(key shard.Key, _ int, _ shard.Op) ([]peer.Peer, error) {
+	if n.count == 0 {
+		return nil, fmt.Errorf("no peers")
+	}
+	owner := int(uint64(key) % uint64(n.count))
+	return []peer.Peer{{Name: fmt.Sprintf("node-%d", owner), Self: owner == n.self}}, nil
+}
+
+func (n *modNode) Observe(ckit.Observer) {}
+
+func (n *modNode) Peers() []peer.Peer { return nil }
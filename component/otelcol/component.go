@@ -0,0 +1,261 @@
+package otelcol
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/build"
+	"github.com/grafana/agent/pkg/traces/contextkeys"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	otelconfig "go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/otel/metric/nonrecording"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Arguments is implemented by the arguments of every otelcol component.
+type Arguments interface {
+	component.Arguments
+
+	// NextConsumers returns where the component sends traces to. Exporters
+	// return nil.
+	NextConsumers() *ConsumerArguments
+
+	// Build creates the OpenTelemetry Collector component to run. next is
+	// where the built component should send traces to, and is nil for
+	// exporters.
+	Build(set Settings, next consumer.Traces) (otelcomponent.Component, error)
+}
+
+// Settings are passed to Arguments.Build when creating an OpenTelemetry
+// Collector component.
+type Settings struct {
+	TelemetrySettings otelcomponent.TelemetrySettings
+	BuildInfo         otelcomponent.BuildInfo
+}
+
+// Receiver returns settings for creating a receiver.
+func (s Settings) Receiver() otelcomponent.ReceiverCreateSettings {
+	return otelcomponent.ReceiverCreateSettings{TelemetrySettings: s.TelemetrySettings, BuildInfo: s.BuildInfo}
+}
+
+// Processor returns settings for creating a processor.
+func (s Settings) Processor() otelcomponent.ProcessorCreateSettings {
+	return otelcomponent.ProcessorCreateSettings{TelemetrySettings: s.TelemetrySettings, BuildInfo: s.BuildInfo}
+}
+
+// Exporter returns settings for creating an exporter.
+func (s Settings) Exporter() otelcomponent.ExporterCreateSettings {
+	return otelcomponent.ExporterCreateSettings{TelemetrySettings: s.TelemetrySettings, BuildInfo: s.BuildInfo}
+}
+
+// Component runs a single OpenTelemetry Collector component, rebuilding it
+// whenever its arguments change. Metrics registered by the running component
+// are served over HTTP at /metrics.
+type Component struct {
+	opts     component.Options
+	settings Settings
+	host     *host
+
+	output *Fanout       // Where the running component sends traces.
+	input  *lazyConsumer // Exported input which forwards to the running component.
+
+	mut      sync.Mutex
+	args     Arguments // Arguments of the running component.
+	running  otelcomponent.Component
+	registry *prometheus.Registry // Registry of the running component.
+}
+
+var (
+	_ component.Component     = (*Component)(nil)
+	_ component.HTTPComponent = (*Component)(nil)
+)
+
+// NewReceiver creates a component which runs an OpenTelemetry Collector
+// receiver. Receivers do not have any exports.
+func NewReceiver(opts component.Options, args Arguments) (*Component, error) {
+	return newComponent(opts, args, false)
+}
+
+// NewProcessor creates a component which runs an OpenTelemetry Collector
+// processor. ConsumerExports are exported immediately.
+func NewProcessor(opts component.Options, args Arguments) (*Component, error) {
+	return newComponent(opts, args, true)
+}
+
+// NewExporter creates a component which runs an OpenTelemetry Collector
+// exporter. ConsumerExports are exported immediately.
+func NewExporter(opts component.Options, args Arguments) (*Component, error) {
+	return newComponent(opts, args, true)
+}
+
+func newComponent(opts component.Options, args Arguments, exportInput bool) (*Component, error) {
+	c := &Component{
+		opts: opts,
+		settings: Settings{
+			TelemetrySettings: otelcomponent.TelemetrySettings{
+				Logger:         newLogger(opts.Logger),
+				TracerProvider: trace.NewNoopTracerProvider(),
+				MeterProvider:  nonrecording.NewNoopMeterProvider(),
+			},
+			BuildInfo: otelcomponent.BuildInfo{
+				Command:     "agent",
+				Description: "agent",
+				Version:     build.Version,
+			},
+		},
+		host:     &host{opts: opts},
+		registry: prometheus.NewRegistry(),
+
+		output: &Fanout{},
+		input:  &lazyConsumer{},
+	}
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	if exportInput {
+		// The input remains the same for the component lifetime, so it is only
+		// exported once.
+		opts.OnStateChange(ConsumerExports{Input: &Consumer{Traces: c.input}})
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	<-ctx.Done()
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.stop()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	built, err := c.build(newArgs)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	// The old component must be stopped first, as the new one may want to
+	// listen on the same address.
+	c.stop()
+
+	if err := c.startLocked(newArgs, built); err != nil {
+		// Go back to running the old component, so a bad update doesn't leave
+		// nothing running.
+		if c.args != nil {
+			if restoreErr := c.restoreLocked(); restoreErr != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to restart component with previous arguments", "err", restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	c.args = newArgs
+	return nil
+}
+
+func (c *Component) build(args Arguments) (otelcomponent.Component, error) {
+	var next consumer.Traces
+	if args.NextConsumers() != nil {
+		next = c.output
+	}
+	return args.Build(c.settings, next)
+}
+
+// restoreLocked rebuilds and starts the component from the arguments of the
+// last component which started successfully. c.mut must be held when
+// calling.
+func (c *Component) restoreLocked() error {
+	built, err := c.build(c.args)
+	if err != nil {
+		return err
+	}
+	return c.startLocked(c.args, built)
+}
+
+// startLocked starts built, which was built from args. Each component gets
+// its own registry, so metrics which a component fails to unregister can't
+// conflict with the next one. c.mut must be held when calling.
+func (c *Component) startLocked(args Arguments, built otelcomponent.Component) error {
+	if out := args.NextConsumers(); out != nil {
+		c.output.SetConsumers(out.Traces)
+	}
+
+	// Processors from pkg/traces look for a Prometheus registerer in the
+	// context to register their metrics.
+	registry := prometheus.NewRegistry()
+	startCtx := context.WithValue(context.Background(), contextkeys.PrometheusRegisterer, prometheus.Registerer(registry))
+	if err := built.Start(startCtx, c.host); err != nil {
+		// Release anything the component started before failing.
+		_ = built.Shutdown(context.Background())
+		return err
+	}
+	c.running = built
+	c.registry = registry
+
+	if traces, ok := built.(consumer.Traces); ok {
+		c.input.set(traces)
+	}
+	return nil
+}
+
+// stop shuts down the running component. c.mut must be held when calling.
+func (c *Component) stop() {
+	if c.running == nil {
+		return
+	}
+	if err := c.running.Shutdown(context.Background()); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to shut down component", "err", err)
+	}
+	c.running = nil
+	c.input.set(nil)
+}
+
+// Handler implements component.HTTPComponent.
+func (c *Component) Handler() http.Handler {
+	mux := http.NewServeMux()
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		c.mut.Lock()
+		registry := c.registry
+		c.mut.Unlock()
+		return registry.Gather()
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// host implements otelcomponent.Host. Flow components are wired together
+// through arguments and exports, so lookups of other collector components
+// always return nothing.
+type host struct {
+	opts component.Options
+}
+
+var _ otelcomponent.Host = (*host)(nil)
+
+func (h *host) ReportFatalError(err error) {
+	level.Error(h.opts.Logger).Log("msg", "fatal error reported by component", "err", err)
+}
+
+func (h *host) GetFactory(otelcomponent.Kind, otelconfig.Type) otelcomponent.Factory { return nil }
+
+func (h *host) GetExtensions() map[otelconfig.ComponentID]otelcomponent.Extension { return nil }
+
+func (h *host) GetExporters() map[otelconfig.DataType]map[otelconfig.ComponentID]otelcomponent.Exporter {
+	return nil
+}
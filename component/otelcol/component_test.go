@@ -0,0 +1,60 @@
+package otelcol
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/stretchr/testify/require"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func TestComponent_UpdateStartFailure(t *testing.T) {
+	var started []string
+
+	c, err := NewExporter(component.Options{
+		ID:            "otelcol.exporter_fake.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(component.Exports) {},
+	}, fakeArguments{name: "a", started: &started})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, started)
+
+	err = c.Update(fakeArguments{name: "b", failStart: true, started: &started})
+	require.EqualError(t, err, "failed to start: start failed")
+
+	// The component from the last successful update is started again.
+	require.Equal(t, []string{"a", "a"}, started)
+	require.NotNil(t, c.running)
+	require.NotNil(t, c.input.traces)
+}
+
+type fakeArguments struct {
+	name      string
+	failStart bool
+	started   *[]string
+}
+
+func (args fakeArguments) NextConsumers() *ConsumerArguments { return nil }
+
+func (args fakeArguments) Build(Settings, consumer.Traces) (otelcomponent.Component, error) {
+	return &fakeComponent{args: args}, nil
+}
+
+type fakeComponent struct {
+	consumer.Traces
+	args fakeArguments
+}
+
+func (c *fakeComponent) Start(context.Context, otelcomponent.Host) error {
+	if c.args.failStart {
+		return errors.New("start failed")
+	}
+	*c.args.started = append(*c.args.started, c.args.name)
+	return nil
+}
+
+func (c *fakeComponent) Shutdown(context.Context) error { return nil }
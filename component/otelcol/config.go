@@ -0,0 +1,146 @@
+package otelcol
+
+import (
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+)
+
+// TLSServerArguments configures TLS for a server.
+type TLSServerArguments struct {
+	CAFile       string `hcl:"ca_file,optional"`
+	CertFile     string `hcl:"cert_file,optional"`
+	KeyFile      string `hcl:"key_file,optional"`
+	MinVersion   string `hcl:"min_version,optional"`
+	MaxVersion   string `hcl:"max_version,optional"`
+	ClientCAFile string `hcl:"client_ca_file,optional"`
+}
+
+// Convert converts args into the upstream type. A nil args converts to nil.
+func (args *TLSServerArguments) Convert() *configtls.TLSServerSetting {
+	if args == nil {
+		return nil
+	}
+	return &configtls.TLSServerSetting{
+		TLSSetting: configtls.TLSSetting{
+			CAFile:     args.CAFile,
+			CertFile:   args.CertFile,
+			KeyFile:    args.KeyFile,
+			MinVersion: args.MinVersion,
+			MaxVersion: args.MaxVersion,
+		},
+		ClientCAFile: args.ClientCAFile,
+	}
+}
+
+// TLSClientArguments configures TLS for a client.
+type TLSClientArguments struct {
+	CAFile             string `hcl:"ca_file,optional"`
+	CertFile           string `hcl:"cert_file,optional"`
+	KeyFile            string `hcl:"key_file,optional"`
+	MinVersion         string `hcl:"min_version,optional"`
+	MaxVersion         string `hcl:"max_version,optional"`
+	Insecure           bool   `hcl:"insecure,optional"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+	ServerName         string `hcl:"server_name,optional"`
+}
+
+// Convert converts args into the upstream type. A nil args converts to the
+// default client settings.
+func (args *TLSClientArguments) Convert() configtls.TLSClientSetting {
+	if args == nil {
+		return configtls.TLSClientSetting{}
+	}
+	return configtls.TLSClientSetting{
+		TLSSetting: configtls.TLSSetting{
+			CAFile:     args.CAFile,
+			CertFile:   args.CertFile,
+			KeyFile:    args.KeyFile,
+			MinVersion: args.MinVersion,
+			MaxVersion: args.MaxVersion,
+		},
+		Insecure:           args.Insecure,
+		InsecureSkipVerify: args.InsecureSkipVerify,
+		ServerName:         args.ServerName,
+	}
+}
+
+// QueueArguments configures the in-memory queue of an exporter.
+type QueueArguments struct {
+	Enabled      bool `hcl:"enabled,optional"`
+	NumConsumers int  `hcl:"num_consumers,optional"`
+	QueueSize    int  `hcl:"queue_size,optional"`
+}
+
+// DefaultQueueArguments holds default settings for QueueArguments.
+var DefaultQueueArguments = QueueArguments{
+	Enabled:      true,
+	NumConsumers: 10,
+	QueueSize:    5000,
+}
+
+var _ gohcl.Decoder = (*QueueArguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *QueueArguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultQueueArguments
+
+	type queueArguments QueueArguments
+	return gohcl.DecodeBody(body, ctx, (*queueArguments)(args))
+}
+
+// Convert converts args into the upstream type. A nil args converts to the
+// default settings.
+func (args *QueueArguments) Convert() exporterhelper.QueueSettings {
+	if args == nil {
+		args = &DefaultQueueArguments
+	}
+	return exporterhelper.QueueSettings{
+		Enabled:      args.Enabled,
+		NumConsumers: args.NumConsumers,
+		QueueSize:    args.QueueSize,
+	}
+}
+
+// RetryArguments configures how an exporter retries failed requests.
+type RetryArguments struct {
+	Enabled         bool          `hcl:"enabled,optional"`
+	InitialInterval time.Duration `hcl:"initial_interval,optional"`
+	MaxInterval     time.Duration `hcl:"max_interval,optional"`
+	MaxElapsedTime  time.Duration `hcl:"max_elapsed_time,optional"`
+}
+
+// DefaultRetryArguments holds default settings for RetryArguments.
+var DefaultRetryArguments = RetryArguments{
+	Enabled:         true,
+	InitialInterval: 5 * time.Second,
+	MaxInterval:     30 * time.Second,
+	MaxElapsedTime:  5 * time.Minute,
+}
+
+var _ gohcl.Decoder = (*RetryArguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *RetryArguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultRetryArguments
+
+	type retryArguments RetryArguments
+	return gohcl.DecodeBody(body, ctx, (*retryArguments)(args))
+}
+
+// Convert converts args into the upstream type. A nil args converts to the
+// default settings.
+func (args *RetryArguments) Convert() exporterhelper.RetrySettings {
+	if args == nil {
+		args = &DefaultRetryArguments
+	}
+	return exporterhelper.RetrySettings{
+		Enabled:         args.Enabled,
+		InitialInterval: args.InitialInterval,
+		MaxInterval:     args.MaxInterval,
+		MaxElapsedTime:  args.MaxElapsedTime,
+	}
+}
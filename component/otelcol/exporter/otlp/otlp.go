@@ -0,0 +1,101 @@
+// Package otlp implements the otelcol.exporter_otlp component.
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.exporter_otlp",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewExporter(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.exporter_otlp component.
+type Arguments struct {
+	Endpoint     string            `hcl:"endpoint"`
+	Compression  string            `hcl:"compression,optional"`
+	Headers      map[string]string `hcl:"headers,optional"`
+	Timeout      time.Duration     `hcl:"timeout,optional"`
+	BalancerName string            `hcl:"balancer_name,optional"`
+	WaitForReady bool              `hcl:"wait_for_ready,optional"`
+
+	TLS   *otelcol.TLSClientArguments `hcl:"tls,block"`
+	Queue *otelcol.QueueArguments     `hcl:"sending_queue,block"`
+	Retry *otelcol.RetryArguments     `hcl:"retry_on_failure,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	Compression: string(configcompression.Gzip),
+	Timeout:     5 * time.Second,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.Endpoint == "" {
+		return fmt.Errorf("endpoint must not be empty")
+	}
+	if args.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+	return nil
+}
+
+// NextConsumers implements otelcol.Arguments. Exporters don't send traces to
+// other components.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return nil }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, _ consumer.Traces) (otelcomponent.Component, error) {
+	factory := otlpexporter.NewFactory()
+
+	cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
+	cfg.Endpoint = args.Endpoint
+	cfg.Compression = configcompression.CompressionType(args.Compression)
+	cfg.BalancerName = args.BalancerName
+	cfg.WaitForReady = args.WaitForReady
+	cfg.TLSSetting = args.TLS.Convert()
+	cfg.Timeout = args.Timeout
+	cfg.QueueSettings = args.Queue.Convert()
+	cfg.RetrySettings = args.Retry.Convert()
+	if args.Headers != nil {
+		cfg.Headers = args.Headers
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return factory.CreateTracesExporter(context.Background(), set.Exporter(), cfg)
+}
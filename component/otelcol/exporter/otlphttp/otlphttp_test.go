@@ -0,0 +1,61 @@
+package otlphttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestExporter(t *testing.T) {
+	received := make(chan ptrace.Traces, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "secret", r.Header.Get("X-Token"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		td, err := ptrace.NewProtoUnmarshaler().UnmarshalTraces(body)
+		require.NoError(t, err)
+		received <- td
+	}))
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Endpoint = srv.URL
+	args.Compression = "none"
+	args.Headers = map[string]string{"X-Token": "secret"}
+	require.NoError(t, args.Validate())
+
+	var exports otelcol.ConsumerExports
+	c, err := otelcol.NewExporter(component.Options{
+		ID:            "otelcol.exporter_otlphttp.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(otelcol.ConsumerExports) },
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	td := ptrace.NewTraces()
+	td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("test-span")
+	require.NoError(t, exports.Input.Traces.ConsumeTraces(context.Background(), td))
+
+	select {
+	case td := <-received:
+		require.Equal(t, 1, td.SpanCount())
+		require.Equal(t, "test-span", td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for traces")
+	}
+}
@@ -0,0 +1,97 @@
+package otelcol
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/multierr"
+)
+
+// Fanout is a consumer.Traces which sends traces to a changing set of
+// consumers.
+type Fanout struct {
+	mut       sync.RWMutex
+	consumers []*Consumer
+}
+
+var _ consumer.Traces = (*Fanout)(nil)
+
+// SetConsumers changes the set of consumers traces are sent to.
+func (f *Fanout) SetConsumers(consumers []*Consumer) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.consumers = consumers
+}
+
+// Capabilities implements consumer.Traces. Traces are copied before being
+// sent to all but the last consumer, so the fanout never mutates data itself.
+func (f *Fanout) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (f *Fanout) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	f.mut.RLock()
+	consumers := make([]consumer.Traces, 0, len(f.consumers))
+	for _, c := range f.consumers {
+		if c == nil || c.Traces == nil {
+			continue
+		}
+		consumers = append(consumers, c.Traces)
+	}
+	f.mut.RUnlock()
+
+	var errs error
+	for i, c := range consumers {
+		// Consumers may mutate the traces they're given, so every consumer except
+		// the last gets its own copy.
+		data := td
+		if i < len(consumers)-1 {
+			data = td.Clone()
+		}
+		errs = multierr.Append(errs, c.ConsumeTraces(ctx, data))
+	}
+	return errs
+}
+
+// lazyConsumer is a consumer.Traces which forwards to the currently running
+// OpenTelemetry Collector component. It allows a component to export a
+// stable input across updates.
+type lazyConsumer struct {
+	mut    sync.RWMutex
+	traces consumer.Traces
+}
+
+var _ consumer.Traces = (*lazyConsumer)(nil)
+
+func (lc *lazyConsumer) set(traces consumer.Traces) {
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	lc.traces = traces
+}
+
+// Capabilities implements consumer.Traces.
+func (lc *lazyConsumer) Capabilities() consumer.Capabilities {
+	lc.mut.RLock()
+	defer lc.mut.RUnlock()
+
+	if lc.traces == nil {
+		return consumer.Capabilities{}
+	}
+	return lc.traces.Capabilities()
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (lc *lazyConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	lc.mut.RLock()
+	traces := lc.traces
+	lc.mut.RUnlock()
+
+	if traces == nil {
+		return fmt.Errorf("component is not running")
+	}
+	return traces.ConsumeTraces(ctx, td)
+}
@@ -0,0 +1,72 @@
+package otelcol
+
+import (
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newLogger returns a zap.Logger which writes to l. Level filtering is left
+// to l.
+func newLogger(l log.Logger) *zap.Logger {
+	return zap.New(&loggerCore{logger: l})
+}
+
+// loggerCore implements zapcore.Core on top of a go-kit logger.
+type loggerCore struct {
+	logger log.Logger
+	fields []zapcore.Field
+}
+
+var _ zapcore.Core = (*loggerCore)(nil)
+
+func (lc *loggerCore) Enabled(zapcore.Level) bool { return true }
+
+func (lc *loggerCore) With(fields []zapcore.Field) zapcore.Core {
+	newFields := make([]zapcore.Field, 0, len(lc.fields)+len(fields))
+	newFields = append(newFields, lc.fields...)
+	newFields = append(newFields, fields...)
+	return &loggerCore{logger: lc.logger, fields: newFields}
+}
+
+func (lc *loggerCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(e, lc)
+}
+
+func (lc *loggerCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range lc.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvps := make([]interface{}, 0, 2+2*len(keys))
+	kvps = append(kvps, "msg", e.Message)
+	for _, k := range keys {
+		kvps = append(kvps, k, enc.Fields[k])
+	}
+
+	switch {
+	case e.Level >= zapcore.ErrorLevel:
+		return level.Error(lc.logger).Log(kvps...)
+	case e.Level == zapcore.WarnLevel:
+		return level.Warn(lc.logger).Log(kvps...)
+	case e.Level == zapcore.InfoLevel:
+		return level.Info(lc.logger).Log(kvps...)
+	default:
+		return level.Debug(lc.logger).Log(kvps...)
+	}
+}
+
+func (lc *loggerCore) Sync() error { return nil }
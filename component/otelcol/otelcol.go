@@ -0,0 +1,31 @@
+// Package otelcol holds types shared by Flow components which wrap
+// OpenTelemetry Collector receivers, processors, and exporters.
+package otelcol
+
+import (
+	"github.com/grafana/agent/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func init() {
+	component.RegisterGoStruct("OtelcolConsumer", Consumer{})
+}
+
+// Consumer is a handle to a component which accepts traces. Consumers are
+// exported by processor and exporter components so other components can send
+// traces to them.
+type Consumer struct {
+	Traces consumer.Traces
+}
+
+// ConsumerArguments holds the set of consumers a component sends its traces
+// to. It is used as the output block of receiver and processor components.
+type ConsumerArguments struct {
+	Traces []*Consumer `hcl:"traces,optional"`
+}
+
+// ConsumerExports holds values which are exported by processor and exporter
+// components.
+type ConsumerExports struct {
+	Input *Consumer `hcl:"input"`
+}
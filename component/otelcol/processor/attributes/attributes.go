@@ -0,0 +1,202 @@
+// Package attributes implements the otelcol.processor_attributes component.
+package attributes
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/attributesprocessor"
+	"github.com/rfratto/gohcl"
+	"github.com/zclconf/go-cty/cty"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	otelconfig "go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.processor_attributes",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewProcessor(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.processor_attributes component.
+type Arguments struct {
+	Actions []ActionArguments `hcl:"action,block"`
+	Include *MatchArguments   `hcl:"include,block"`
+	Exclude *MatchArguments   `hcl:"exclude,block"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+// ActionArguments describes a single action to perform on span attributes.
+type ActionArguments struct {
+	Key           string    `hcl:"key"`
+	Action        string    `hcl:"action"`
+	Value         cty.Value `hcl:"value,optional"`
+	Pattern       string    `hcl:"pattern,optional"`
+	FromAttribute string    `hcl:"from_attribute,optional"`
+	FromContext   string    `hcl:"from_context,optional"`
+	ConvertedType string    `hcl:"converted_type,optional"`
+}
+
+// MatchArguments selects which spans actions are applied to.
+type MatchArguments struct {
+	MatchType  string               `hcl:"match_type"`
+	Services   []string             `hcl:"services,optional"`
+	SpanNames  []string             `hcl:"span_names,optional"`
+	Attributes []AttributeArguments `hcl:"attribute,block"`
+}
+
+// AttributeArguments matches a span attribute by key and, optionally,
+// value.
+type AttributeArguments struct {
+	Key   string    `hcl:"key"`
+	Value cty.Value `hcl:"value,optional"`
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if len(args.Actions) == 0 {
+		return fmt.Errorf("at least one action block must be set")
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	_, err := args.convert()
+	return err
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	factory := attributesprocessor.NewFactory()
+
+	m, err := args.convert()
+	if err != nil {
+		return nil, err
+	}
+	// The attributes processor config is built from internal upstream types,
+	// so it is populated the same way a collector config file would be.
+	cfg := factory.CreateDefaultConfig()
+	if err := otelconfig.UnmarshalProcessor(confmap.NewFromStringMap(m), cfg); err != nil {
+		return nil, err
+	}
+
+	return factory.CreateTracesProcessor(context.Background(), set.Processor(), cfg, next)
+}
+
+// convert converts args into the map form of the upstream config.
+func (args Arguments) convert() (map[string]interface{}, error) {
+	actions := make([]interface{}, 0, len(args.Actions))
+	for _, a := range args.Actions {
+		action := map[string]interface{}{
+			"key":            a.Key,
+			"action":         a.Action,
+			"pattern":        a.Pattern,
+			"from_attribute": a.FromAttribute,
+			"from_context":   a.FromContext,
+			"converted_type": a.ConvertedType,
+		}
+		v, err := goValue(a.Value)
+		if err != nil {
+			return nil, fmt.Errorf("action %q: %w", a.Key, err)
+		}
+		if v != nil {
+			action["value"] = v
+		}
+		actions = append(actions, action)
+	}
+
+	res := map[string]interface{}{"actions": actions}
+	if args.Include != nil {
+		include, err := args.Include.convert()
+		if err != nil {
+			return nil, fmt.Errorf("include: %w", err)
+		}
+		res["include"] = include
+	}
+	if args.Exclude != nil {
+		exclude, err := args.Exclude.convert()
+		if err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+		res["exclude"] = exclude
+	}
+	return res, nil
+}
+
+func (args *MatchArguments) convert() (map[string]interface{}, error) {
+	attributes := make([]interface{}, 0, len(args.Attributes))
+	for _, a := range args.Attributes {
+		attr := map[string]interface{}{"key": a.Key}
+		v, err := goValue(a.Value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", a.Key, err)
+		}
+		if v != nil {
+			attr["value"] = v
+		}
+		attributes = append(attributes, attr)
+	}
+
+	return map[string]interface{}{
+		"match_type": args.MatchType,
+		"services":   args.Services,
+		"span_names": args.SpanNames,
+		"attributes": attributes,
+	}, nil
+}
+
+// goValue converts a primitive cty.Value into its Go equivalent. Null values
+// convert to nil.
+func goValue(v cty.Value) (interface{}, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	if !v.IsKnown() {
+		return nil, fmt.Errorf("value is not known")
+	}
+
+	switch v.Type() {
+	case cty.String:
+		return v.AsString(), nil
+	case cty.Bool:
+		return v.True(), nil
+	case cty.Number:
+		bf := v.AsBigFloat()
+		if bf.IsInt() {
+			if i, acc := bf.Int64(); acc == big.Exact {
+				return i, nil
+			}
+		}
+		f, _ := bf.Float64()
+		return f, nil
+	default:
+		return nil, fmt.Errorf("value must be a string, number, or bool, got %s", v.Type().FriendlyName())
+	}
+}
@@ -0,0 +1,79 @@
+package attributes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestAttributes(t *testing.T) {
+	cfg := `
+		action {
+			key    = "env"
+			value  = "prod"
+			action = "insert"
+		}
+		action {
+			key    = "retries"
+			value  = 3
+			action = "upsert"
+		}
+		action {
+			key    = "password"
+			action = "delete"
+		}
+
+		output {}
+	`
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(cfg), "agent-config.flow")
+	require.False(t, diags.HasErrors())
+
+	var args Arguments
+	diags = gohcl.DecodeBody(file.Body, nil, &args)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	sink := &consumertest.TracesSink{}
+	args.Output.Traces = []*otelcol.Consumer{{Traces: sink}}
+
+	var exports otelcol.ConsumerExports
+	c, err := otelcol.NewProcessor(component.Options{
+		ID:            "otelcol.processor_attributes.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(otelcol.ConsumerExports) },
+	}, args)
+	require.NoError(t, err)
+	require.NotNil(t, exports.Input)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	td := ptrace.NewTraces()
+	span := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("test-span")
+	span.Attributes().InsertString("password", "hunter2")
+	require.NoError(t, exports.Input.Traces.ConsumeTraces(context.Background(), td))
+
+	require.Equal(t, 1, sink.SpanCount())
+	attrs := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Attributes()
+
+	env, ok := attrs.Get("env")
+	require.True(t, ok)
+	require.Equal(t, "prod", env.StringVal())
+
+	retries, ok := attrs.Get("retries")
+	require.True(t, ok)
+	require.Equal(t, int64(3), retries.IntVal())
+
+	_, ok = attrs.Get("password")
+	require.False(t, ok)
+}
@@ -0,0 +1,113 @@
+// Package automaticlogging implements the
+// otelcol.processor_automatic_logging component.
+package automaticlogging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/pkg/traces/automaticloggingprocessor"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.processor_automatic_logging",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewProcessor(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.processor_automatic_logging component.
+//
+// Logs are always written to stdout; sending them to a static mode logs
+// instance is not supported in Flow.
+type Arguments struct {
+	Spans             bool               `hcl:"spans,optional"`
+	Roots             bool               `hcl:"roots,optional"`
+	Processes         bool               `hcl:"processes,optional"`
+	SpanAttributes    []string           `hcl:"span_attributes,optional"`
+	ProcessAttributes []string           `hcl:"process_attributes,optional"`
+	Labels            []string           `hcl:"labels,optional"`
+	Timeout           time.Duration      `hcl:"timeout,optional"`
+	Overrides         *OverrideArguments `hcl:"overrides,block"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+// OverrideArguments overrides the keys used in generated log lines.
+type OverrideArguments struct {
+	LogsTag     string `hcl:"logs_instance_tag,optional"`
+	ServiceKey  string `hcl:"service_key,optional"`
+	SpanNameKey string `hcl:"span_name_key,optional"`
+	StatusKey   string `hcl:"status_key,optional"`
+	DurationKey string `hcl:"duration_key,optional"`
+	TraceIDKey  string `hcl:"trace_id_key,optional"`
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if !args.Spans && !args.Roots && !args.Processes {
+		return fmt.Errorf("at least one of spans, roots, or processes must be enabled")
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	return nil
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	factory := automaticloggingprocessor.NewFactory()
+
+	loggingConfig := &automaticloggingprocessor.AutomaticLoggingConfig{
+		Backend:           automaticloggingprocessor.BackendStdout,
+		Spans:             args.Spans,
+		Roots:             args.Roots,
+		Processes:         args.Processes,
+		SpanAttributes:    args.SpanAttributes,
+		ProcessAttributes: args.ProcessAttributes,
+		Labels:            args.Labels,
+		Timeout:           args.Timeout,
+	}
+	if o := args.Overrides; o != nil {
+		loggingConfig.Overrides = automaticloggingprocessor.OverrideConfig{
+			LogsTag:     o.LogsTag,
+			ServiceKey:  o.ServiceKey,
+			SpanNameKey: o.SpanNameKey,
+			StatusKey:   o.StatusKey,
+			DurationKey: o.DurationKey,
+			TraceIDKey:  o.TraceIDKey,
+		}
+	}
+
+	cfg := factory.CreateDefaultConfig().(*automaticloggingprocessor.Config)
+	cfg.LoggingConfig = loggingConfig
+
+	return factory.CreateTracesProcessor(context.Background(), set.Processor(), cfg, next)
+}
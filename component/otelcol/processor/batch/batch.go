@@ -0,0 +1,83 @@
+// Package batch implements the otelcol.processor_batch component.
+package batch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/processor/batchprocessor"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.processor_batch",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewProcessor(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.processor_batch component.
+type Arguments struct {
+	Timeout          time.Duration `hcl:"timeout,optional"`
+	SendBatchSize    uint32        `hcl:"send_batch_size,optional"`
+	SendBatchMaxSize uint32        `hcl:"send_batch_max_size,optional"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	Timeout:       200 * time.Millisecond,
+	SendBatchSize: 8192,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.SendBatchMaxSize > 0 && args.SendBatchMaxSize < args.SendBatchSize {
+		return fmt.Errorf("send_batch_max_size must be greater or equal to send_batch_size")
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	return nil
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	factory := batchprocessor.NewFactory()
+
+	cfg := factory.CreateDefaultConfig().(*batchprocessor.Config)
+	cfg.Timeout = args.Timeout
+	cfg.SendBatchSize = args.SendBatchSize
+	cfg.SendBatchMaxSize = args.SendBatchMaxSize
+
+	return factory.CreateTracesProcessor(context.Background(), set.Processor(), cfg, next)
+}
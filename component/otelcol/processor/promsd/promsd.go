@@ -0,0 +1,94 @@
+// Package promsd implements the otelcol.processor_promsd component.
+package promsd
+
+import (
+	"fmt"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/pkg/traces/promsdprocessor"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/prometheus/common/model"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.processor_promsd",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewProcessor(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.processor_promsd component.
+type Arguments struct {
+	// Targets whose labels are added to spans. Targets are matched to spans by
+	// the host of their __address__ label.
+	Targets         []discovery.Target `hcl:"targets"`
+	OperationType   string             `hcl:"operation_type,optional"`
+	PodAssociations []string           `hcl:"pod_associations,optional"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	OperationType: promsdprocessor.OperationTypeUpsert,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	switch args.OperationType {
+	case promsdprocessor.OperationTypeInsert, promsdprocessor.OperationTypeUpdate, promsdprocessor.OperationTypeUpsert:
+	default:
+		return fmt.Errorf("unknown operation_type %q", args.OperationType)
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	return nil
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(_ otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	p, err := promsdprocessor.NewTargetsProcessor(next, args.OperationType, args.PodAssociations)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]model.LabelSet, 0, len(args.Targets))
+	for _, t := range args.Targets {
+		ls := make(model.LabelSet, len(t))
+		for k, v := range t {
+			ls[model.LabelName(k)] = model.LabelValue(v)
+		}
+		targets = append(targets, ls)
+	}
+	p.SetTargets(targets)
+
+	return p, nil
+}
@@ -0,0 +1,61 @@
+package promsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestPromSD(t *testing.T) {
+	sink := &consumertest.TracesSink{}
+
+	args := DefaultArguments
+	args.Targets = []discovery.Target{
+		{"__address__": "10.0.0.1:8080", "namespace": "prod", "pod": "app-0", "__meta_secret": "hidden"},
+		{"__address__": "10.0.0.2:8080", "namespace": "dev", "pod": "app-1"},
+	}
+	args.PodAssociations = []string{"ip"}
+	args.Output = &otelcol.ConsumerArguments{
+		Traces: []*otelcol.Consumer{{Traces: sink}},
+	}
+	require.NoError(t, args.Validate())
+
+	var exports otelcol.ConsumerExports
+	c, err := otelcol.NewProcessor(component.Options{
+		ID:            "otelcol.processor_promsd.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(otelcol.ConsumerExports) },
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InsertString("ip", "10.0.0.1")
+	rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("test-span")
+	require.NoError(t, exports.Input.Traces.ConsumeTraces(context.Background(), td))
+
+	require.Equal(t, 1, sink.SpanCount())
+	attrs := sink.AllTraces()[0].ResourceSpans().At(0).Resource().Attributes()
+
+	ns, ok := attrs.Get("namespace")
+	require.True(t, ok)
+	require.Equal(t, "prod", ns.StringVal())
+
+	pod, ok := attrs.Get("pod")
+	require.True(t, ok)
+	require.Equal(t, "app-0", pod.StringVal())
+
+	_, ok = attrs.Get("__meta_secret")
+	require.False(t, ok)
+}
@@ -0,0 +1,91 @@
+// Package servicegraph implements the otelcol.processor_service_graph
+// component.
+package servicegraph
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/pkg/traces/servicegraphprocessor"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.processor_service_graph",
+		Args:    Arguments{},
+		Exports: otelcol.ConsumerExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewProcessor(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.processor_service_graph component.
+type Arguments struct {
+	Wait     time.Duration `hcl:"wait,optional"`
+	MaxItems int           `hcl:"max_items,optional"`
+	Workers  int           `hcl:"workers,optional"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	Wait:     servicegraphprocessor.DefaultWait,
+	MaxItems: servicegraphprocessor.DefaultMaxItems,
+	Workers:  servicegraphprocessor.DefaultWorkers,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.Wait <= 0 {
+		return fmt.Errorf("wait must be greater than 0")
+	}
+	if args.MaxItems <= 0 {
+		return fmt.Errorf("max_items must be greater than 0")
+	}
+	if args.Workers <= 0 {
+		return fmt.Errorf("workers must be greater than 0")
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	return nil
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	factory := servicegraphprocessor.NewFactory()
+
+	cfg := factory.CreateDefaultConfig().(*servicegraphprocessor.Config)
+	cfg.Wait = args.Wait
+	cfg.MaxItems = args.MaxItems
+	cfg.Workers = args.Workers
+
+	return factory.CreateTracesProcessor(context.Background(), set.Processor(), cfg, next)
+}
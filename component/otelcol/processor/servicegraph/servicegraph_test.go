@@ -0,0 +1,29 @@
+package servicegraph
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceGraph_Update(t *testing.T) {
+	args := DefaultArguments
+	args.Output = &otelcol.ConsumerArguments{}
+
+	c, err := otelcol.NewProcessor(component.Options{
+		ID:            "otelcol.processor_service_graph.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	// Each update rebuilds the processor, which must not conflict with the
+	// metrics of the processor it replaces.
+	for i := 0; i < 3; i++ {
+		args.MaxItems++
+		require.NoError(t, c.Update(args))
+	}
+}
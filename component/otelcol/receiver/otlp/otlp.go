@@ -0,0 +1,172 @@
+// Package otlp implements the otelcol.receiver_otlp component.
+package otlp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/receiver/otlpreceiver"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "otelcol.receiver_otlp",
+		Args:    Arguments{},
+		Exports: nil,
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return otelcol.NewReceiver(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// otelcol.receiver_otlp component.
+type Arguments struct {
+	GRPC *GRPCServerArguments `hcl:"grpc,block"`
+	HTTP *HTTPServerArguments `hcl:"http,block"`
+
+	Output *otelcol.ConsumerArguments `hcl:"output,block"`
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.GRPC == nil && args.HTTP == nil {
+		return fmt.Errorf("at least one of the grpc or http blocks must be set")
+	}
+	if args.Output == nil {
+		return fmt.Errorf("output block must be set")
+	}
+	return nil
+}
+
+// GRPCServerArguments configures the gRPC server of the receiver.
+type GRPCServerArguments struct {
+	Endpoint             string                      `hcl:"endpoint,optional"`
+	Transport            string                      `hcl:"transport,optional"`
+	TLS                  *otelcol.TLSServerArguments `hcl:"tls,block"`
+	MaxRecvMsgSizeMiB    uint64                      `hcl:"max_recv_msg_size_mib,optional"`
+	MaxConcurrentStreams uint32                      `hcl:"max_concurrent_streams,optional"`
+	IncludeMetadata      bool                        `hcl:"include_metadata,optional"`
+}
+
+// DefaultGRPCServerArguments holds default settings for GRPCServerArguments.
+var DefaultGRPCServerArguments = GRPCServerArguments{
+	Endpoint:  "0.0.0.0:4317",
+	Transport: "tcp",
+}
+
+var _ gohcl.Decoder = (*GRPCServerArguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *GRPCServerArguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultGRPCServerArguments
+
+	type grpcServerArguments GRPCServerArguments
+	return gohcl.DecodeBody(body, ctx, (*grpcServerArguments)(args))
+}
+
+// HTTPServerArguments configures the HTTP server of the receiver.
+type HTTPServerArguments struct {
+	Endpoint           string                      `hcl:"endpoint,optional"`
+	TLS                *otelcol.TLSServerArguments `hcl:"tls,block"`
+	CORS               *CORSArguments              `hcl:"cors,block"`
+	MaxRequestBodySize int64                       `hcl:"max_request_body_size,optional"`
+	IncludeMetadata    bool                        `hcl:"include_metadata,optional"`
+}
+
+// DefaultHTTPServerArguments holds default settings for HTTPServerArguments.
+var DefaultHTTPServerArguments = HTTPServerArguments{
+	Endpoint: "0.0.0.0:4318",
+}
+
+var _ gohcl.Decoder = (*HTTPServerArguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *HTTPServerArguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultHTTPServerArguments
+
+	type httpServerArguments HTTPServerArguments
+	return gohcl.DecodeBody(body, ctx, (*httpServerArguments)(args))
+}
+
+// CORSArguments configures CORS for the HTTP server.
+type CORSArguments struct {
+	AllowedOrigins []string `hcl:"allowed_origins,optional"`
+	AllowedHeaders []string `hcl:"allowed_headers,optional"`
+	MaxAge         int      `hcl:"max_age,optional"`
+}
+
+// NextConsumers implements otelcol.Arguments.
+func (args Arguments) NextConsumers() *otelcol.ConsumerArguments { return args.Output }
+
+// Build implements otelcol.Arguments.
+func (args Arguments) Build(set otelcol.Settings, next consumer.Traces) (otelcomponent.Component, error) {
+	factory := otlpreceiver.NewFactory()
+
+	cfg := factory.CreateDefaultConfig().(*otlpreceiver.Config)
+	cfg.GRPC = args.GRPC.Convert()
+	cfg.HTTP = args.HTTP.Convert()
+
+	return factory.CreateTracesReceiver(context.Background(), set.Receiver(), cfg, next)
+}
+
+// Convert converts args into the upstream type. A nil args converts to nil,
+// disabling the gRPC server.
+func (args *GRPCServerArguments) Convert() *configgrpc.GRPCServerSettings {
+	if args == nil {
+		return nil
+	}
+
+	// Start from the upstream defaults to keep settings which aren't exposed.
+	res := otlpreceiver.NewFactory().CreateDefaultConfig().(*otlpreceiver.Config).GRPC
+	res.NetAddr.Endpoint = args.Endpoint
+	res.NetAddr.Transport = args.Transport
+	res.TLSSetting = args.TLS.Convert()
+	res.MaxRecvMsgSizeMiB = args.MaxRecvMsgSizeMiB
+	res.MaxConcurrentStreams = args.MaxConcurrentStreams
+	res.IncludeMetadata = args.IncludeMetadata
+	return res
+}
+
+// Convert converts args into the upstream type. A nil args converts to nil,
+// disabling the HTTP server.
+func (args *HTTPServerArguments) Convert() *confighttp.HTTPServerSettings {
+	if args == nil {
+		return nil
+	}
+
+	res := &confighttp.HTTPServerSettings{
+		Endpoint:           args.Endpoint,
+		TLSSetting:         args.TLS.Convert(),
+		MaxRequestBodySize: args.MaxRequestBodySize,
+		IncludeMetadata:    args.IncludeMetadata,
+	}
+	if args.CORS != nil {
+		res.CORS = &confighttp.CORSSettings{
+			AllowedOrigins: args.CORS.AllowedOrigins,
+			AllowedHeaders: args.CORS.AllowedHeaders,
+			MaxAge:         args.CORS.MaxAge,
+		}
+	}
+	return res
+}
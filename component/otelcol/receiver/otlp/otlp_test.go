@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestReceiver_HTTP(t *testing.T) {
+	sink := &consumertest.TracesSink{}
+
+	httpArgs := DefaultHTTPServerArguments
+	httpArgs.Endpoint = freeAddress(t)
+	args := Arguments{
+		HTTP: &httpArgs,
+		Output: &otelcol.ConsumerArguments{
+			Traces: []*otelcol.Consumer{{Traces: sink}},
+		},
+	}
+	require.NoError(t, args.Validate())
+
+	c, err := otelcol.NewReceiver(component.Options{
+		ID:            "otelcol.receiver_otlp.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	td := ptrace.NewTraces()
+	span := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("test-span")
+
+	body, err := ptrace.NewProtoMarshaler().MarshalTraces(td)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Post(fmt.Sprintf("http://%s/v1/traces", httpArgs.Endpoint), "application/x-protobuf", bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Equal(t, 1, sink.SpanCount())
+	received := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	require.Equal(t, "test-span", received.Name())
+}
+
+func TestArguments_Validate(t *testing.T) {
+	args := Arguments{Output: &otelcol.ConsumerArguments{}}
+	require.EqualError(t, args.Validate(), "at least one of the grpc or http blocks must be set")
+}
+
+// freeAddress returns a local address which is free to listen on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
@@ -5,7 +5,9 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/benbjohnson/clock"
 	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/regexp"
 	"github.com/hashicorp/hcl/v2"
 )
@@ -50,6 +52,25 @@ type Options struct {
 	// by the component; a component must use the same Exports type for its
 	// lifetime.
 	OnStateChange func(e Exports)
+
+	// HTTPListenAddr is the address the Flow HTTP server is listening on.
+	// Components which implement HTTPComponent can use it alongside HTTPPath
+	// to build URLs which refer back to themselves.
+	HTTPListenAddr string
+
+	// HTTPPath is the base path which requests to the component's HTTP
+	// handler are served from. The path always ends in a trailing slash.
+	HTTPPath string
+
+	// Clusterer is the cluster the process is a part of. Components may use it
+	// to distribute work between agents. When clustering is disabled,
+	// Clusterer is a single-node cluster which only contains the local agent.
+	Clusterer cluster.Node
+
+	// Clock is the source of time for the component. Components should use
+	// Clock rather than the time package for timers and tickers so they can be
+	// driven by tests with a mock clock.
+	Clock clock.Clock
 }
 
 // Registration describes a single component.
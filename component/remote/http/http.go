@@ -0,0 +1,332 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/pkg/build"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/hashicorp/hcl/v2"
+	common_config "github.com/prometheus/common/config"
+	"github.com/rfratto/gohcl"
+)
+
+var userAgent = fmt.Sprintf("GrafanaAgent/%s", build.Version)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "remote.http",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments control the remote.http component.
+type Arguments struct {
+	// URL to poll.
+	URL string `hcl:"url,attr"`
+	// PollFrequency determines how often the URL is polled when the last
+	// request succeeded.
+	PollFrequency time.Duration `hcl:"poll_frequency,optional"`
+	// PollTimeout is the timeout for a single request to the URL.
+	PollTimeout time.Duration `hcl:"poll_timeout,optional"`
+	// MaxBackoffPeriod caps how long to wait between requests after
+	// consecutive failures.
+	MaxBackoffPeriod time.Duration `hcl:"max_backoff_period,optional"`
+	// IsSecret marks the response body as holding a secret value which should
+	// not be displayed to the user.
+	IsSecret bool `hcl:"is_secret,optional"`
+
+	Method  string            `hcl:"method,optional"`
+	Headers map[string]string `hcl:"headers,optional"`
+	Body    string            `hcl:"body,optional"`
+
+	Client *config.HTTPClientConfig `hcl:"client,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	PollFrequency:    1 * time.Minute,
+	PollTimeout:      10 * time.Second,
+	MaxBackoffPeriod: 5 * time.Minute,
+	Method:           http.MethodGet,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.PollFrequency <= 0 {
+		return fmt.Errorf("poll_frequency must be greater than 0")
+	}
+	if args.PollTimeout <= 0 {
+		return fmt.Errorf("poll_timeout must be greater than 0")
+	}
+	if args.PollTimeout >= args.PollFrequency {
+		return fmt.Errorf("poll_timeout must be less than poll_frequency")
+	}
+	if args.MaxBackoffPeriod < args.PollFrequency {
+		return fmt.Errorf("max_backoff_period must be greater than or equal to poll_frequency")
+	}
+
+	switch strings.ToUpper(args.Method) {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodHead, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		return fmt.Errorf("unsupported method %q", args.Method)
+	}
+
+	return nil
+}
+
+// Exports holds settings exported by remote.http.
+type Exports struct {
+	// Content of the response body.
+	Content *hcltypes.OptionalSecret `hcl:"content,attr"`
+}
+
+// Component implements the remote.http component.
+type Component struct {
+	opts component.Options
+
+	mut          sync.Mutex
+	args         Arguments
+	cli          *http.Client
+	generation   int // Incremented on every Update.
+	lastPoll     time.Time
+	failures     int
+	updateTicker chan struct{} // Written to when the poll schedule must be recomputed.
+
+	// exportsMut serializes calls to OnStateChange, ensuring that the
+	// response of a poll never overrides the response of a poll made with
+	// newer arguments.
+	exportsMut         sync.Mutex
+	exportedGeneration int
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ component.Component       = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+)
+
+// New returns a new, unstarted, remote.http component.
+func New(opts component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts: opts,
+
+		updateTicker: make(chan struct{}, 1),
+
+		health: component.Health{
+			Health:     component.HealthTypeUnknown,
+			Message:    "component started",
+			UpdateTime: time.Now(),
+		},
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run starts the remote.http component.
+func (c *Component) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.nextPoll()):
+			_ = c.poll(ctx)
+		case <-c.updateTicker:
+			// Arguments changed; recompute when the next poll should happen.
+		}
+	}
+}
+
+// nextPoll returns how long to wait until the next poll. The delay doubles for
+// every consecutive failed poll, up to MaxBackoffPeriod.
+func (c *Component) nextPoll() time.Duration {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	wait := c.args.PollFrequency
+	for i := 0; i < c.failures && wait < c.args.MaxBackoffPeriod; i++ {
+		wait *= 2
+	}
+	if wait > c.args.MaxBackoffPeriod {
+		wait = c.args.MaxBackoffPeriod
+	}
+
+	return time.Until(c.lastPoll.Add(wait))
+}
+
+// poll performs an HTTP request against the configured URL and updates the
+// exports and health of the component. The request is bounded by the
+// configured poll timeout and is made without holding mut. Results of polls
+// made with arguments that have since been updated are discarded.
+func (c *Component) poll(ctx context.Context) error {
+	c.mut.Lock()
+	var (
+		args       = c.args
+		cli        = c.cli
+		generation = c.generation
+	)
+	c.lastPoll = time.Now()
+	c.mut.Unlock()
+
+	content, err := doPoll(ctx, args, cli)
+
+	c.mut.Lock()
+	if generation != c.generation {
+		c.mut.Unlock()
+		return err
+	}
+	if err != nil {
+		c.failures++
+		level.Error(c.opts.Logger).Log("msg", "failed to poll url", "url", args.URL, "consecutive_failures", c.failures, "err", err)
+		c.setHealth(component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    err.Error(),
+			UpdateTime: time.Now(),
+		})
+		c.mut.Unlock()
+		return err
+	}
+	c.failures = 0
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeHealthy,
+		Message:    "polled url",
+		UpdateTime: time.Now(),
+	})
+	c.mut.Unlock()
+
+	c.exportsMut.Lock()
+	defer c.exportsMut.Unlock()
+	if generation < c.exportedGeneration {
+		return nil
+	}
+	c.exportedGeneration = generation
+	c.opts.OnStateChange(Exports{
+		Content: &hcltypes.OptionalSecret{
+			IsSecret: args.IsSecret,
+			Value:    content,
+		},
+	})
+	return nil
+}
+
+// doPoll performs the HTTP request described by args and returns the
+// response body.
+func doPoll(ctx context.Context, args Arguments, cli *http.Client) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, args.PollTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if args.Body != "" {
+		body = strings.NewReader(args.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(args.Method), args.URL, body)
+	if err != nil {
+		return "", fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for name, value := range args.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status code %s", resp.Status)
+	}
+	return string(bb), nil
+}
+
+// Update updates the remote.http component. The URL is polled immediately
+// with the new settings to report any potential errors early; the poll is
+// bounded by poll_timeout.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	if err := newArgs.Validate(); err != nil {
+		return err
+	}
+
+	clientConfig := config.DefaultHTTPClientConfig
+	if newArgs.Client != nil {
+		clientConfig = *newArgs.Client
+	}
+	httpClientConfig, err := clientConfig.Convert()
+	if err != nil {
+		return fmt.Errorf("invalid client block: %w", err)
+	}
+	cli, err := common_config.NewClientFromConfig(*httpClientConfig, c.opts.ID)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.args = newArgs
+	c.cli = cli
+	c.generation++
+	c.failures = 0
+	c.mut.Unlock()
+
+	// Inform Run that the poll schedule changed, even if the poll below fails.
+	select {
+	case c.updateTicker <- struct{}{}:
+	default:
+	}
+
+	if err := c.poll(context.Background()); err != nil {
+		return fmt.Errorf("failed to poll url: %w", err)
+	}
+	return nil
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *Component) CurrentHealth() component.Health {
+	c.healthMut.RLock()
+	defer c.healthMut.RUnlock()
+	return c.health
+}
+
+func (c *Component) setHealth(h component.Health) {
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	c.health = h
+}
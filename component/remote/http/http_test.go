@@ -0,0 +1,225 @@
+package http_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	remote_http "github.com/grafana/agent/component/remote/http"
+	"github.com/grafana/agent/pkg/flow/componenttest"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func Test(t *testing.T) {
+	var (
+		mut        sync.Mutex
+		statusCode = http.StatusOK
+		response   = "Hello, world!"
+	)
+	setResponse := func(code int, text string) {
+		mut.Lock()
+		defer mut.Unlock()
+		statusCode, response = code, text
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+
+		if r.Method != http.MethodPost || r.Header.Get("X-Test") != "yes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, response)
+	}))
+	defer srv.Close()
+
+	args := remote_http.DefaultArguments
+	args.URL = srv.URL
+	args.Method = http.MethodPost
+	args.Headers = map[string]string{"X-Test": "yes"}
+	args.PollFrequency = 50 * time.Millisecond
+	args.PollTimeout = 25 * time.Millisecond
+	args.MaxBackoffPeriod = 100 * time.Millisecond
+
+	var (
+		exportsMut sync.Mutex
+		exports    remote_http.Exports
+	)
+	getContent := func() string {
+		exportsMut.Lock()
+		defer exportsMut.Unlock()
+		return exports.Content.Value
+	}
+
+	c, err := remote_http.New(component.Options{
+		ID:     "remote.http.test",
+		Logger: log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {
+			exportsMut.Lock()
+			defer exportsMut.Unlock()
+			exports = e.(remote_http.Exports)
+		},
+	}, args)
+	require.NoError(t, err)
+
+	// The initial content should be available immediately after construction.
+	require.Equal(t, remote_http.Exports{
+		Content: &hcltypes.OptionalSecret{Value: "Hello, world!"},
+	}, exports)
+	require.Equal(t, component.HealthTypeHealthy, c.CurrentHealth().Health)
+
+	ctx := componenttest.TestContext(t)
+	go func() { _ = c.Run(ctx) }()
+
+	// Changes to the response should be picked up on the next poll.
+	setResponse(http.StatusOK, "New content!")
+	require.Eventually(t, func() bool { return getContent() == "New content!" }, time.Second, 10*time.Millisecond)
+
+	// A failed request should mark the component as unhealthy and keep the last
+	// known content.
+	setResponse(http.StatusInternalServerError, "broken")
+	require.Eventually(t, func() bool {
+		return c.CurrentHealth().Health == component.HealthTypeUnhealthy
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "New content!", getContent())
+
+	// Recovering should mark the component healthy again.
+	setResponse(http.StatusOK, "Recovered!")
+	require.Eventually(t, func() bool {
+		return c.CurrentHealth().Health == component.HealthTypeHealthy && getContent() == "Recovered!"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestInitialPollFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	args := remote_http.DefaultArguments
+	args.URL = srv.URL
+
+	_, err := remote_http.New(component.Options{
+		ID:            "remote.http.test",
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.Error(t, err)
+}
+
+// TestSlowPoll ensures that a slow request doesn't block updates and that its
+// response doesn't override the response of a newer poll.
+func TestSlowPoll(t *testing.T) {
+	var (
+		requested = make(chan struct{}, 1)
+		release   = make(chan struct{})
+		slow      = false
+	)
+	slowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow {
+			requested <- struct{}{}
+			<-release
+			fmt.Fprint(w, "Stale content")
+			return
+		}
+		fmt.Fprint(w, "Initial content")
+	}))
+	defer slowSrv.Close()
+	defer close(release)
+
+	fastSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "New content")
+	}))
+	defer fastSrv.Close()
+
+	var (
+		exportsMut sync.Mutex
+		exports    remote_http.Exports
+	)
+	getContent := func() string {
+		exportsMut.Lock()
+		defer exportsMut.Unlock()
+		return exports.Content.Value
+	}
+
+	args := remote_http.DefaultArguments
+	args.URL = slowSrv.URL
+
+	c, err := remote_http.New(component.Options{
+		ID:     "remote.http.test",
+		Logger: log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {
+			exportsMut.Lock()
+			defer exportsMut.Unlock()
+			exports = e.(remote_http.Exports)
+		},
+	}, args)
+	require.NoError(t, err)
+	require.Equal(t, "Initial content", getContent())
+
+	slow = true
+	slowUpdate := make(chan error, 1)
+	go func() { slowUpdate <- c.Update(args) }()
+	<-requested
+
+	args.URL = fastSrv.URL
+	require.NoError(t, c.Update(args))
+	require.Equal(t, "New content", getContent())
+
+	release <- struct{}{}
+	require.NoError(t, <-slowUpdate)
+	require.Equal(t, "New content", getContent())
+}
+
+func TestArguments_DecodeHCL(t *testing.T) {
+	var args remote_http.Arguments
+	require.NoError(t, decodeArguments(`url = "http://localhost:8080/secret"`, &args))
+	require.Nil(t, args.Client)
+	require.Equal(t, remote_http.DefaultArguments.PollFrequency, args.PollFrequency)
+
+	require.NoError(t, decodeArguments(`
+		url = "http://localhost:8080/secret"
+
+		client {
+			proxy_url = "http://proxy:3128"
+		}
+	`, &args))
+	require.NotNil(t, args.Client)
+	require.Equal(t, "http://proxy:3128", args.Client.ProxyURL)
+}
+
+func TestArguments_Validate(t *testing.T) {
+	args := remote_http.DefaultArguments
+	args.PollTimeout = args.PollFrequency
+	require.Error(t, args.Validate())
+
+	args = remote_http.DefaultArguments
+	args.Method = "FETCH"
+	require.Error(t, args.Validate())
+
+	args = remote_http.DefaultArguments
+	require.NoError(t, args.Validate())
+}
+
+func decodeArguments(in string, args *remote_http.Arguments) error {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(in), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	diags = gohcl.DecodeBody(file.Body, nil, args)
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
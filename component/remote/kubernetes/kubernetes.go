@@ -0,0 +1,387 @@
+// Package kubernetes implements the remote.kubernetes_secret and
+// remote.kubernetes_configmap components.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// retryPeriod is how long to wait before retrying after a failed watch.
+const retryPeriod = 5 * time.Second
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "remote.kubernetes_secret",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments), KindSecret)
+		},
+	})
+
+	component.Register(component.Registration{
+		Name:    "remote.kubernetes_configmap",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments), KindConfigMap)
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// remote.kubernetes_secret and remote.kubernetes_configmap components.
+type Arguments struct {
+	// Namespace and name of the object to watch.
+	Namespace string `hcl:"namespace,attr"`
+	Name      string `hcl:"name,attr"`
+
+	// KubeconfigFile to use to connect to Kubernetes. When empty, the
+	// in-cluster config is used.
+	KubeconfigFile string `hcl:"kubeconfig_file,optional"`
+}
+
+// Exports holds values which are exported by the remote.kubernetes_secret
+// and remote.kubernetes_configmap components.
+type Exports struct {
+	// Data holds the value of every key in the object. Values from Secrets are
+	// always marked as secret.
+	Data map[string]*hcltypes.OptionalSecret `hcl:"data,attr"`
+}
+
+// Kind is the kind of Kubernetes object to watch.
+type Kind string
+
+// Supported kinds of Kubernetes objects.
+const (
+	KindSecret    Kind = "Secret"
+	KindConfigMap Kind = "ConfigMap"
+)
+
+// get retrieves the data of the object identified by args.
+func (k Kind) get(ctx context.Context, cli clientset.Interface, args Arguments) (map[string]*hcltypes.OptionalSecret, error) {
+	var obj runtime.Object
+	var err error
+
+	switch k {
+	case KindSecret:
+		obj, err = cli.CoreV1().Secrets(args.Namespace).Get(ctx, args.Name, metav1.GetOptions{})
+	case KindConfigMap:
+		obj, err = cli.CoreV1().ConfigMaps(args.Namespace).Get(ctx, args.Name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k.data(obj), nil
+}
+
+// watch starts watching for changes to the object identified by args.
+func (k Kind) watch(ctx context.Context, cli clientset.Interface, args Arguments) (watch.Interface, error) {
+	opts := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", args.Name).String(),
+	}
+
+	switch k {
+	case KindSecret:
+		return cli.CoreV1().Secrets(args.Namespace).Watch(ctx, opts)
+	case KindConfigMap:
+		return cli.CoreV1().ConfigMaps(args.Namespace).Watch(ctx, opts)
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", k)
+	}
+}
+
+// data converts obj into exported data. Objects which aren't of kind k
+// return nil.
+func (k Kind) data(obj runtime.Object) map[string]*hcltypes.OptionalSecret {
+	switch obj := obj.(type) {
+	case *corev1.Secret:
+		if k != KindSecret {
+			return nil
+		}
+		res := make(map[string]*hcltypes.OptionalSecret, len(obj.Data))
+		for key, value := range obj.Data {
+			res[key] = &hcltypes.OptionalSecret{IsSecret: true, Value: string(value)}
+		}
+		return res
+
+	case *corev1.ConfigMap:
+		if k != KindConfigMap {
+			return nil
+		}
+		res := make(map[string]*hcltypes.OptionalSecret, len(obj.Data)+len(obj.BinaryData))
+		for key, value := range obj.Data {
+			res[key] = &hcltypes.OptionalSecret{Value: value}
+		}
+		for key, value := range obj.BinaryData {
+			res[key] = &hcltypes.OptionalSecret{Value: string(value)}
+		}
+		return res
+
+	default:
+		return nil
+	}
+}
+
+// objectName returns the name of obj, or an empty string if obj doesn't
+// have metadata.
+func objectName(obj runtime.Object) string {
+	if m, ok := obj.(metav1.Object); ok {
+		return m.GetName()
+	}
+	return ""
+}
+
+// Component implements the remote.kubernetes_secret and
+// remote.kubernetes_configmap components.
+type Component struct {
+	opts      component.Options
+	kind      Kind
+	newClient func(kubeconfigFile string) (clientset.Interface, error)
+
+	mut         sync.Mutex
+	args        Arguments
+	client      clientset.Interface
+	lastData    map[string]*hcltypes.OptionalSecret
+	argsChanged chan struct{} // Written to when the watch must be restarted.
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ component.Component       = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+)
+
+// New creates a new component which watches an object of the given kind.
+func New(opts component.Options, args Arguments, kind Kind) (*Component, error) {
+	return newComponent(opts, args, kind, newClient)
+}
+
+func newComponent(opts component.Options, args Arguments, kind Kind, newClient func(string) (clientset.Interface, error)) (*Component, error) {
+	c := &Component{
+		opts:      opts,
+		kind:      kind,
+		newClient: newClient,
+
+		argsChanged: make(chan struct{}, 1),
+
+		health: component.Health{
+			Health:     component.HealthTypeUnknown,
+			Message:    "component started",
+			UpdateTime: time.Now(),
+		},
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(kubeconfigFile string) (clientset.Interface, error) {
+	// BuildConfigFromFlags falls back to the in-cluster config when no
+	// kubeconfig is given.
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("building Kubernetes config: %w", err)
+	}
+	return clientset.NewForConfig(cfg)
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	for {
+		watchCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.watch(watchCtx)
+		}()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return nil
+		case <-c.argsChanged:
+			// Restart the watch with the new arguments.
+			cancel()
+			<-done
+		}
+	}
+}
+
+// watch watches for changes to the object until ctx is canceled. The object
+// is re-read every time the watch is (re-)established so changes made while
+// not watching aren't missed.
+func (c *Component) watch(ctx context.Context) {
+	c.mut.Lock()
+	var (
+		args = c.args
+		cli  = c.client
+	)
+	c.mut.Unlock()
+
+	for {
+		if err := c.refresh(ctx); err == nil {
+			c.watchOnce(ctx, cli, args)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryPeriod):
+		}
+	}
+}
+
+// watchOnce processes events from a single watch until it closes.
+func (c *Component) watchOnce(ctx context.Context, cli clientset.Interface, args Arguments) {
+	w, err := c.kind.watch(ctx, cli, args)
+	if err != nil {
+		c.reportError(fmt.Errorf("failed to watch %s: %w", c.kind, err))
+		return
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				if objectName(ev.Object) != args.Name {
+					continue
+				}
+				if data := c.kind.data(ev.Object); data != nil {
+					c.export(data)
+				}
+			case watch.Deleted:
+				if objectName(ev.Object) != args.Name {
+					continue
+				}
+				// Keep exporting the last known data; the object may be recreated.
+				c.reportError(fmt.Errorf("%s %s/%s was deleted", c.kind, args.Namespace, args.Name))
+			case watch.Error:
+				c.reportError(fmt.Errorf("watch failed: %v", ev.Object))
+				return
+			}
+		}
+	}
+}
+
+// refresh reads the current state of the object and exports it.
+func (c *Component) refresh(ctx context.Context) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.refreshLocked(ctx)
+}
+
+// refreshLocked reads the current state of the object and exports it. mut
+// must be held when calling.
+func (c *Component) refreshLocked(ctx context.Context) error {
+	data, err := c.kind.get(ctx, c.client, c.args)
+	if err != nil {
+		err = fmt.Errorf("failed to get %s %s/%s: %w", c.kind, c.args.Namespace, c.args.Name, err)
+		c.reportError(err)
+		return err
+	}
+	c.exportLocked(data)
+	return nil
+}
+
+func (c *Component) export(data map[string]*hcltypes.OptionalSecret) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.exportLocked(data)
+}
+
+// exportLocked exports data if it changed since the last export. mut must be
+// held when calling.
+func (c *Component) exportLocked(data map[string]*hcltypes.OptionalSecret) {
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeHealthy,
+		Message:    fmt.Sprintf("read %s", c.kind),
+		UpdateTime: time.Now(),
+	})
+
+	if c.lastData != nil && reflect.DeepEqual(c.lastData, data) {
+		return
+	}
+	c.lastData = data
+	c.opts.OnStateChange(Exports{Data: data})
+}
+
+func (c *Component) reportError(err error) {
+	level.Error(c.opts.Logger).Log("msg", "failed to read object", "err", err)
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    err.Error(),
+		UpdateTime: time.Now(),
+	})
+}
+
+// Update implements component.Component. The object is read immediately
+// with the new settings to report any potential errors early.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.client == nil || newArgs.KubeconfigFile != c.args.KubeconfigFile {
+		cli, err := c.newClient(newArgs.KubeconfigFile)
+		if err != nil {
+			return err
+		}
+		c.client = cli
+	}
+	c.args = newArgs
+
+	select {
+	case c.argsChanged <- struct{}{}:
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return c.refreshLocked(ctx)
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *Component) CurrentHealth() component.Health {
+	c.healthMut.RLock()
+	defer c.healthMut.RUnlock()
+	return c.health
+}
+
+func (c *Component) setHealth(h component.Health) {
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	c.health = h
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecret(t *testing.T) {
+	cli := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "creds"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	})
+
+	var exports exportsRecorder
+	c, err := newComponent(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, Arguments{Namespace: "default", Name: "creds"}, KindSecret, fakeClient(cli))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]*hcltypes.OptionalSecret{
+		"password": {IsSecret: true, Value: "hunter2"},
+	}, exports.get().Data)
+	require.Equal(t, component.HealthTypeHealthy, c.CurrentHealth().Health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	// Wait for the watch to be established before changing the secret.
+	require.Eventually(t, func() bool { return len(cli.Actions()) >= 2 }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = cli.CoreV1().Secrets("default").Update(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "creds"},
+		Data:       map[string][]byte{"password": []byte("correct-horse")},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return exports.get().Data["password"].Value == "correct-horse"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigMap(t *testing.T) {
+	cli := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "settings"},
+		Data:       map[string]string{"url": "http://example.com"},
+		BinaryData: map[string][]byte{"blob": []byte("raw")},
+	})
+
+	var exports exportsRecorder
+	_, err := newComponent(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, Arguments{Namespace: "default", Name: "settings"}, KindConfigMap, fakeClient(cli))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]*hcltypes.OptionalSecret{
+		"url":  {Value: "http://example.com"},
+		"blob": {Value: "raw"},
+	}, exports.get().Data)
+}
+
+func TestMissingObject(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+
+	_, err := newComponent(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, Arguments{Namespace: "default", Name: "missing"}, KindSecret, fakeClient(cli))
+	require.ErrorContains(t, err, "failed to get Secret default/missing")
+}
+
+func fakeClient(cli clientset.Interface) func(string) (clientset.Interface, error) {
+	return func(string) (clientset.Interface, error) { return cli, nil }
+}
+
+type exportsRecorder struct {
+	mut     sync.Mutex
+	exports Exports
+}
+
+func (r *exportsRecorder) set(e component.Exports) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.exports = e.(Exports)
+}
+
+func (r *exportsRecorder) get() Exports {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.exports
+}
@@ -0,0 +1,502 @@
+// Package vault implements the remote.vault component.
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/pkg/build"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/hashicorp/hcl/v2"
+	common_config "github.com/prometheus/common/config"
+	"github.com/rfratto/gohcl"
+)
+
+var userAgent = fmt.Sprintf("GrafanaAgent/%s", build.Version)
+
+// retryPeriod is how long to wait before retrying a failed token renewal.
+const retryPeriod = 10 * time.Second
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "remote.vault",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments control the remote.vault component.
+type Arguments struct {
+	// Server is the address of the Vault server, e.g. https://vault:8200.
+	Server string `hcl:"server,attr"`
+	// Mount is the path the KV secrets engine is mounted at.
+	Mount string `hcl:"mount,attr"`
+	// Path of the secret to read, relative to Mount.
+	Path string `hcl:"path,attr"`
+	// Token used to authenticate against Vault.
+	Token hcltypes.Secret `hcl:"token,attr"`
+	// Namespace to send with requests, for Vault Enterprise.
+	Namespace string `hcl:"namespace,optional"`
+	// KVVersion is the version of the KV secrets engine, either 1 or 2.
+	KVVersion int `hcl:"kv_version,optional"`
+	// RefreshInterval determines how often the secret is re-read. Secrets with
+	// a shorter lease are re-read at half of their lease duration.
+	RefreshInterval time.Duration `hcl:"refresh_interval,optional"`
+	// Timeout for a single request to Vault.
+	Timeout time.Duration `hcl:"timeout,optional"`
+
+	Client *config.HTTPClientConfig `hcl:"client,block"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	KVVersion:       2,
+	RefreshInterval: 1 * time.Minute,
+	Timeout:         10 * time.Second,
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	if err := gohcl.DecodeBody(body, ctx, (*arguments)(args)); err != nil {
+		return err
+	}
+	return args.Validate()
+}
+
+// Validate returns an error if the arguments are invalid.
+func (args *Arguments) Validate() error {
+	if args.Server == "" {
+		return fmt.Errorf("server must not be empty")
+	}
+	if args.Mount == "" || args.Path == "" {
+		return fmt.Errorf("mount and path must not be empty")
+	}
+	if args.KVVersion != 1 && args.KVVersion != 2 {
+		return fmt.Errorf("kv_version must be 1 or 2, got %d", args.KVVersion)
+	}
+	if args.RefreshInterval <= 0 {
+		return fmt.Errorf("refresh_interval must be greater than 0")
+	}
+	if args.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+	return nil
+}
+
+// secretURL returns the API URL used to read the secret.
+func (args *Arguments) secretURL() string {
+	var (
+		server = strings.TrimSuffix(args.Server, "/")
+		mount  = strings.Trim(args.Mount, "/")
+		path   = strings.Trim(args.Path, "/")
+	)
+	if args.KVVersion == 2 {
+		return fmt.Sprintf("%s/v1/%s/data/%s", server, mount, path)
+	}
+	return fmt.Sprintf("%s/v1/%s/%s", server, mount, path)
+}
+
+// Exports holds settings exported by remote.vault.
+type Exports struct {
+	// Data holds every key of the secret. Values are always marked as secret.
+	Data map[string]*hcltypes.OptionalSecret `hcl:"data,attr"`
+}
+
+// Component implements the remote.vault component.
+type Component struct {
+	opts component.Options
+
+	mut        sync.Mutex
+	args       Arguments
+	cli        *http.Client
+	generation int // Incremented on every Update.
+	nextRead   time.Time
+	renewAt    time.Time     // Zero if the token should not be renewed.
+	updateCh   chan struct{} // Written to when the schedule must be recomputed.
+
+	// exportsMut serializes calls to OnStateChange, ensuring that a secret
+	// read with old arguments never overrides a secret read with newer ones.
+	exportsMut         sync.Mutex
+	exportedGeneration int
+	lastData           map[string]*hcltypes.OptionalSecret
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ component.Component       = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+)
+
+// New returns a new, unstarted, remote.vault component.
+func New(opts component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts: opts,
+
+		updateCh: make(chan struct{}, 1),
+
+		health: component.Health{
+			Health:     component.HealthTypeUnknown,
+			Message:    "component started",
+			UpdateTime: time.Now(),
+		},
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run starts the remote.vault component.
+func (c *Component) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.nextWake()):
+			c.tick(ctx)
+		case <-c.updateCh:
+			// Arguments changed; recompute the schedule.
+		}
+	}
+}
+
+// nextWake returns how long to wait until the secret must be re-read or the
+// token must be renewed, whichever comes first.
+func (c *Component) nextWake() time.Duration {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	next := c.nextRead
+	if !c.renewAt.IsZero() && c.renewAt.Before(next) {
+		next = c.renewAt
+	}
+	return time.Until(next)
+}
+
+// tick renews the token and re-reads the secret if they are due. A failed
+// renewal doesn't prevent the secret from being read, since the token may
+// still be valid.
+//
+// Requests to Vault are made without holding mut; mut is only held to apply
+// their results. Results of requests made with arguments that have since been
+// updated are discarded.
+func (c *Component) tick(ctx context.Context) {
+	c.mut.Lock()
+	var (
+		now        = time.Now()
+		cli        = vaultClient{args: c.args, cli: c.cli}
+		generation = c.generation
+		renewDue   = !c.renewAt.IsZero() && !now.Before(c.renewAt)
+		readDue    = !now.Before(c.nextRead)
+	)
+	// Schedule the next read now so a failed read is retried at the regular
+	// interval.
+	if readDue {
+		c.nextRead = now.Add(c.args.RefreshInterval)
+	}
+	c.mut.Unlock()
+
+	var renewErr error
+	if renewDue {
+		renewable, ttl, err := cli.renewToken(ctx)
+
+		c.mut.Lock()
+		if generation == c.generation {
+			if err != nil {
+				renewErr = fmt.Errorf("failed to renew token: %w", err)
+				c.reportError(renewErr)
+				c.renewAt = time.Now().Add(retryPeriod)
+			} else {
+				level.Debug(c.opts.Logger).Log("msg", "renewed token", "lease_duration", ttl)
+				c.scheduleRenewalLocked(renewable, ttl)
+			}
+		}
+		c.mut.Unlock()
+	}
+	if readDue {
+		if err := c.read(ctx, cli, generation); err != nil {
+			return
+		}
+	}
+
+	// Keep reporting the renewal error even if the secret was read
+	// successfully.
+	if renewErr != nil {
+		c.mut.Lock()
+		if generation == c.generation {
+			c.reportError(renewErr)
+		}
+		c.mut.Unlock()
+	}
+}
+
+// read reads the secret using cli, exports it if it changed, and reports the
+// outcome as the health of the component. generation is the generation of
+// the arguments cli was built from; if the arguments have since changed, the
+// result is discarded.
+func (c *Component) read(ctx context.Context, cli vaultClient, generation int) error {
+	data, leaseDuration, err := cli.readSecret(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	c.mut.Lock()
+	if generation != c.generation {
+		c.mut.Unlock()
+		return err
+	}
+	if err != nil {
+		c.reportError(err)
+		c.mut.Unlock()
+		return err
+	}
+	if leaseDuration > 0 && leaseDuration/2 < c.args.RefreshInterval {
+		c.nextRead = time.Now().Add(leaseDuration / 2)
+	}
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeHealthy,
+		Message:    "read secret",
+		UpdateTime: time.Now(),
+	})
+	c.mut.Unlock()
+
+	c.exportsMut.Lock()
+	defer c.exportsMut.Unlock()
+	if generation < c.exportedGeneration {
+		return nil
+	}
+	c.exportedGeneration = generation
+
+	if c.lastData != nil && reflect.DeepEqual(c.lastData, data) {
+		return nil
+	}
+	c.lastData = data
+	c.opts.OnStateChange(Exports{Data: data})
+	return nil
+}
+
+// scheduleRenewalLocked schedules the token to be renewed at half of its TTL.
+// Tokens which aren't renewable or never expire are not renewed. mut must be
+// held when calling.
+func (c *Component) scheduleRenewalLocked(renewable bool, ttlSeconds int) {
+	if !renewable || ttlSeconds <= 0 {
+		c.renewAt = time.Time{}
+		return
+	}
+	c.renewAt = time.Now().Add(time.Duration(ttlSeconds) * time.Second / 2)
+}
+
+func (c *Component) reportError(err error) {
+	level.Error(c.opts.Logger).Log("msg", "vault request failed", "err", err)
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    err.Error(),
+		UpdateTime: time.Now(),
+	})
+}
+
+// Update updates the remote.vault component. The token is looked up and the
+// secret is read immediately with the new settings to report any potential
+// errors early. Each request is bounded by the configured timeout and is
+// made without holding mut.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	if err := newArgs.Validate(); err != nil {
+		return err
+	}
+
+	clientConfig := config.DefaultHTTPClientConfig
+	if newArgs.Client != nil {
+		clientConfig = *newArgs.Client
+	}
+	httpClientConfig, err := clientConfig.Convert()
+	if err != nil {
+		return fmt.Errorf("invalid client block: %w", err)
+	}
+	httpClient, err := common_config.NewClientFromConfig(*httpClientConfig, c.opts.ID)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.args = newArgs
+	c.cli = httpClient
+	c.generation++
+	generation := c.generation
+	c.nextRead = time.Now().Add(newArgs.RefreshInterval)
+	c.renewAt = time.Time{}
+	c.mut.Unlock()
+
+	// Inform Run that the schedule changed, even if the requests below fail.
+	select {
+	case c.updateCh <- struct{}{}:
+	default:
+	}
+
+	cli := vaultClient{args: newArgs, cli: httpClient}
+
+	// Tokens aren't always allowed to look themselves up; the secret can still
+	// be read, but the token won't be renewed.
+	renewable, ttl, err := cli.lookupToken(context.Background())
+	c.mut.Lock()
+	if generation == c.generation {
+		if err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "failed to look up token, token will not be renewed", "err", err)
+		} else {
+			c.scheduleRenewalLocked(renewable, ttl)
+		}
+	}
+	c.mut.Unlock()
+
+	return c.read(context.Background(), cli, generation)
+}
+
+// vaultClient performs requests against Vault with a fixed set of arguments.
+type vaultClient struct {
+	args Arguments
+	cli  *http.Client
+}
+
+type secretResponse struct {
+	LeaseDuration int             `json:"lease_duration"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// readSecret reads the secret from Vault, returning its data and its lease
+// duration.
+func (vc vaultClient) readSecret(ctx context.Context) (map[string]*hcltypes.OptionalSecret, time.Duration, error) {
+	var resp secretResponse
+	if err := vc.do(ctx, http.MethodGet, vc.args.secretURL(), &resp); err != nil {
+		return nil, 0, err
+	}
+
+	// KV v2 nests the secret data alongside its metadata.
+	raw := resp.Data
+	if vc.args.KVVersion == 2 {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &v2); err != nil {
+			return nil, 0, fmt.Errorf("decoding KV v2 data: %w", err)
+		}
+		raw = v2.Data
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, 0, fmt.Errorf("decoding secret data: %w", err)
+	}
+
+	data := make(map[string]*hcltypes.OptionalSecret, len(values))
+	for key, value := range values {
+		// Strings are exported as-is; everything else is exported as JSON.
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		data[key] = &hcltypes.OptionalSecret{IsSecret: true, Value: s}
+	}
+	return data, time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// lookupToken looks up the configured token, returning whether it's
+// renewable and its TTL in seconds.
+func (vc vaultClient) lookupToken(ctx context.Context) (renewable bool, ttlSeconds int, err error) {
+	var resp struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	url := strings.TrimSuffix(vc.args.Server, "/") + "/v1/auth/token/lookup-self"
+	if err := vc.do(ctx, http.MethodGet, url, &resp); err != nil {
+		return false, 0, err
+	}
+	return resp.Data.Renewable, resp.Data.TTL, nil
+}
+
+// renewToken renews the configured token, returning whether it's still
+// renewable and its new TTL in seconds.
+func (vc vaultClient) renewToken(ctx context.Context) (renewable bool, ttlSeconds int, err error) {
+	var resp struct {
+		Auth struct {
+			LeaseDuration int  `json:"lease_duration"`
+			Renewable     bool `json:"renewable"`
+		} `json:"auth"`
+	}
+	url := strings.TrimSuffix(vc.args.Server, "/") + "/v1/auth/token/renew-self"
+	if err := vc.do(ctx, http.MethodPost, url, &resp); err != nil {
+		return false, 0, err
+	}
+	return resp.Auth.Renewable, resp.Auth.LeaseDuration, nil
+}
+
+// do performs a request against Vault and decodes the JSON response into
+// out. The request is bounded by the configured timeout.
+func (vc vaultClient) do(ctx context.Context, method, url string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, vc.args.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Vault-Token", string(vc.args.Token))
+	if vc.args.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.args.Namespace)
+	}
+
+	resp, err := vc.cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bb, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %s", resp.Status)
+	}
+	if err := json.Unmarshal(bb, out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *Component) CurrentHealth() component.Health {
+	c.healthMut.RLock()
+	defer c.healthMut.RUnlock()
+	return c.health
+}
+
+func (c *Component) setHealth(h component.Health) {
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	c.health = h
+}
@@ -0,0 +1,300 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Server = srv.URL
+	args.Mount = "secret"
+	args.Path = "app"
+	args.Token = "root-token"
+	args.Namespace = "team-a"
+	args.RefreshInterval = 50 * time.Millisecond
+
+	var exports exportsRecorder
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, args)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]*hcltypes.OptionalSecret{
+		"password": {IsSecret: true, Value: "hunter2"},
+		"port":     {IsSecret: true, Value: "5432"},
+	}, exports.get().Data)
+	require.Equal(t, component.HealthTypeHealthy, c.CurrentHealth().Health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	srv.setPassword("correct-horse")
+	require.Eventually(t, func() bool {
+		return exports.get().Data["password"].Value == "correct-horse"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The token has a TTL of 1s, so it should be renewed every 500ms.
+	require.Eventually(t, func() bool { return srv.renewals() >= 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestVault_KVv1(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Server = srv.URL
+	args.Mount = "kv"
+	args.Path = "app"
+	args.Token = "root-token"
+	args.Namespace = "team-a"
+	args.KVVersion = 1
+
+	var exports exportsRecorder
+	_, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, args)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]*hcltypes.OptionalSecret{
+		"password": {IsSecret: true, Value: "hunter2"},
+		"tags":     {IsSecret: true, Value: `["a","b"]`},
+	}, exports.get().Data)
+}
+
+func TestVault_BadToken(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Server = srv.URL
+	args.Mount = "secret"
+	args.Path = "app"
+	args.Token = "wrong-token"
+
+	_, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.EqualError(t, err, "failed to read secret: unexpected status code 403 Forbidden")
+}
+
+func TestVault_RenewalFailure(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Server = srv.URL
+	args.Mount = "secret"
+	args.Path = "app"
+	args.Token = "root-token"
+	args.Namespace = "team-a"
+
+	var exports exportsRecorder
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, args)
+	require.NoError(t, err)
+
+	srv.setRenewFails(true)
+	srv.setPassword("correct-horse")
+
+	// Make both the renewal and the read due. The secret should still be read
+	// even though the renewal fails.
+	c.mut.Lock()
+	c.renewAt = time.Now().Add(-time.Second)
+	c.nextRead = time.Now().Add(-time.Second)
+	c.mut.Unlock()
+	c.tick(context.Background())
+
+	require.Equal(t, "correct-horse", exports.get().Data["password"].Value)
+
+	health := c.CurrentHealth()
+	require.Equal(t, component.HealthTypeUnhealthy, health.Health)
+	require.Contains(t, health.Message, "failed to renew token")
+}
+
+func TestArguments_DecodeHCL(t *testing.T) {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(`
+		server = "https://vault:8200"
+		mount  = "secret"
+		path   = "app"
+		token  = "root-token"
+	`), "agent-config.flow")
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	var args Arguments
+	diags = gohcl.DecodeBody(file.Body, nil, &args)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Nil(t, args.Client)
+	require.Equal(t, DefaultArguments.Timeout, args.Timeout)
+}
+
+// TestVault_SlowRead ensures that a slow request to Vault doesn't block
+// updates, and that its result doesn't override the result of a newer read.
+func TestVault_SlowRead(t *testing.T) {
+	srv := newFakeVault(t)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.Server = srv.URL
+	args.Mount = "secret"
+	args.Path = "app"
+	args.Token = "root-token"
+	args.Namespace = "team-a"
+
+	var exports exportsRecorder
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: exports.set,
+	}, args)
+	require.NoError(t, err)
+
+	release := srv.blockReads()
+	srv.setPassword("stale")
+
+	slowUpdate := make(chan error, 1)
+	go func() { slowUpdate <- c.Update(args) }()
+	<-srv.blocked
+
+	newArgs := args
+	newArgs.Mount = "kv"
+	newArgs.KVVersion = 1
+	require.NoError(t, c.Update(newArgs))
+
+	release()
+	require.NoError(t, <-slowUpdate)
+	require.Equal(t, map[string]*hcltypes.OptionalSecret{
+		"password": {IsSecret: true, Value: "hunter2"},
+		"tags":     {IsSecret: true, Value: `["a","b"]`},
+	}, exports.get().Data)
+}
+
+// fakeVault is a minimal stand-in for the Vault HTTP API.
+type fakeVault struct {
+	*httptest.Server
+
+	mut          sync.Mutex
+	password     string
+	renewalCount int
+	renewFails   bool
+	block        chan struct{} // If non-nil, secret reads wait for it to be closed.
+	blocked      chan struct{} // Written to when a secret read starts waiting.
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	fv := &fakeVault{password: "hunter2", blocked: make(chan struct{}, 1)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/token/lookup-self", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"ttl": 1, "renewable": true}}`)
+	})
+	mux.HandleFunc("/v1/auth/token/renew-self", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+
+		fv.mut.Lock()
+		defer fv.mut.Unlock()
+		if fv.renewFails {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fv.renewalCount++
+		fmt.Fprint(w, `{"auth": {"lease_duration": 1, "renewable": true}}`)
+	})
+	mux.HandleFunc("/v1/secret/data/app", func(w http.ResponseWriter, r *http.Request) {
+		fv.mut.Lock()
+		block := fv.block
+		fv.mut.Unlock()
+		if block != nil {
+			fv.blocked <- struct{}{}
+			<-block
+		}
+
+		fv.mut.Lock()
+		defer fv.mut.Unlock()
+		fmt.Fprintf(w, `{"data": {"data": {"password": %q, "port": 5432}, "metadata": {"version": 1}}}`, fv.password)
+	})
+	mux.HandleFunc("/v1/kv/app", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"lease_duration": 2764800, "data": {"password": "hunter2", "tags": ["a","b"]}}`)
+	})
+
+	fv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		require.Equal(t, "team-a", r.Header.Get("X-Vault-Namespace"))
+		mux.ServeHTTP(w, r)
+	}))
+	return fv
+}
+
+func (fv *fakeVault) setPassword(p string) {
+	fv.mut.Lock()
+	defer fv.mut.Unlock()
+	fv.password = p
+}
+
+func (fv *fakeVault) setRenewFails(fails bool) {
+	fv.mut.Lock()
+	defer fv.mut.Unlock()
+	fv.renewFails = fails
+}
+
+// blockReads makes secret reads wait until the returned function is called.
+func (fv *fakeVault) blockReads() (release func()) {
+	fv.mut.Lock()
+	defer fv.mut.Unlock()
+
+	block := make(chan struct{})
+	fv.block = block
+	return func() {
+		fv.mut.Lock()
+		fv.block = nil
+		fv.mut.Unlock()
+		close(block)
+	}
+}
+
+func (fv *fakeVault) renewals() int {
+	fv.mut.Lock()
+	defer fv.mut.Unlock()
+	return fv.renewalCount
+}
+
+type exportsRecorder struct {
+	mut     sync.Mutex
+	exports Exports
+}
+
+func (r *exportsRecorder) set(e component.Exports) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.exports = e.(Exports)
+}
+
+func (r *exportsRecorder) get() Exports {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.exports
+}
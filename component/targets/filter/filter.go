@@ -0,0 +1,229 @@
+// Package filter implements the targets.filter component.
+package filter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "targets.filter",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the targets.filter
+// component.
+type Arguments struct {
+	// Targets to filter.
+	Targets []discovery.Target `hcl:"targets"`
+
+	// Predicate evaluated against the labels of each target. Targets are kept
+	// only if it evaluates to true.
+	Expression string `hcl:"expression"`
+}
+
+// Exports holds values which are exported by the targets.filter component.
+type Exports struct {
+	Output []discovery.Target `hcl:"output,attr"`
+}
+
+// Component implements the targets.filter component.
+type Component struct {
+	opts component.Options
+
+	mut       sync.RWMutex
+	debugInfo debugInfo
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ component.Component       = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+	_ component.DebugComponent  = (*Component)(nil)
+)
+
+// New creates a new targets.filter component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{opts: o}
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	pred, err := parsePredicate(newArgs.Expression)
+	if err != nil {
+		return err
+	}
+
+	var (
+		output  []discovery.Target
+		info    = debugInfo{InputTargets: len(newArgs.Targets)}
+		lastErr error
+	)
+	for _, t := range newArgs.Targets {
+		keep, err := pred.Match(t)
+		switch {
+		case err != nil:
+			info.FailedTargets++
+			lastErr = err
+		case keep:
+			output = append(output, t)
+		default:
+			info.DroppedTargets++
+		}
+	}
+	info.OutputTargets = len(output)
+
+	c.mut.Lock()
+	c.debugInfo = info
+	c.mut.Unlock()
+
+	if lastErr != nil {
+		c.setHealth(component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    fmt.Sprintf("expression failed for %d of %d targets; last error: %s", info.FailedTargets, info.InputTargets, lastErr),
+			UpdateTime: time.Now(),
+		})
+	} else {
+		c.setHealth(component.Health{
+			Health:     component.HealthTypeHealthy,
+			Message:    fmt.Sprintf("kept %d of %d targets", info.OutputTargets, info.InputTargets),
+			UpdateTime: time.Now(),
+		})
+	}
+
+	c.opts.OnStateChange(Exports{Output: output})
+	return nil
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *Component) CurrentHealth() component.Health {
+	c.healthMut.RLock()
+	defer c.healthMut.RUnlock()
+	return c.health
+}
+
+func (c *Component) setHealth(h component.Health) {
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	c.health = h
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.debugInfo
+}
+
+type debugInfo struct {
+	InputTargets   int `hcl:"input_targets"`
+	DroppedTargets int `hcl:"dropped_targets"`
+	FailedTargets  int `hcl:"failed_targets"`
+	OutputTargets  int `hcl:"output_targets"`
+}
+
+// labelsVar is the variable holding the labels of the target being evaluated.
+const labelsVar = "labels"
+
+// predicate is a parsed filter expression.
+type predicate struct {
+	expr      hclsyntax.Expression
+	functions map[string]function.Function
+}
+
+// parsePredicate parses an expression. The expression may only refer to the
+// labels variable.
+func parsePredicate(expr string) (*predicate, error) {
+	parsed, diags := hclsyntax.ParseExpression([]byte(expr), "expression", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid expression: %w", diags)
+	}
+
+	for _, traversal := range parsed.Variables() {
+		if name := traversal.RootName(); name != labelsVar {
+			return nil, fmt.Errorf("invalid expression: unknown variable %q; only %q may be used", name, labelsVar)
+		}
+	}
+
+	functions := newFunctions()
+
+	// Check function names in advance so an unknown function is reported
+	// once rather than for every target.
+	diags = hclsyntax.VisitAll(parsed, func(n hclsyntax.Node) hcl.Diagnostics {
+		call, ok := n.(*hclsyntax.FunctionCallExpr)
+		if !ok {
+			return nil
+		}
+		if _, ok := functions[call.Name]; !ok {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("unknown function %q", call.Name),
+				Subject:  call.NameRange.Ptr(),
+			}}
+		}
+		return nil
+	})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid expression: %w", diags)
+	}
+
+	return &predicate{expr: parsed, functions: functions}, nil
+}
+
+// Match evaluates the predicate against the labels of t.
+func (p *predicate) Match(t discovery.Target) (bool, error) {
+	labels := cty.MapValEmpty(cty.String)
+	if len(t) > 0 {
+		vals := make(map[string]cty.Value, len(t))
+		for k, v := range t {
+			vals[k] = cty.StringVal(v)
+		}
+		labels = cty.MapVal(vals)
+	}
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{labelsVar: labels},
+		Functions: p.functions,
+	}
+
+	val, diags := p.expr.Value(ectx)
+	if diags.HasErrors() {
+		return false, diags
+	}
+	if !val.Type().Equals(cty.Bool) {
+		return false, fmt.Errorf("expression must evaluate to a bool, got %s", val.Type().FriendlyName())
+	} else if val.IsNull() {
+		return false, fmt.Errorf("expression evaluated to null")
+	}
+	return val.True(), nil
+}
@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	hclArguments := `
+targets = [
+  { "__address__" = "10.0.0.1:80", "app" = "backend",  "env" = "prod" },
+  { "__address__" = "10.0.0.2:80", "app" = "backend",  "env" = "dev"  },
+  { "__address__" = "10.0.0.3:80", "app" = "frontend", "env" = "prod" },
+  { "__address__" = "10.0.0.4:80", "app" = "database" },
+]
+
+expression = "labels.app != \"frontend\" && lookup(labels, \"env\", \"prod\") == \"prod\""
+`
+	var args Arguments
+	require.False(t, decodeArguments(hclArguments, &args).HasErrors())
+
+	var exports Exports
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args)
+	require.NoError(t, err)
+
+	require.Equal(t, []discovery.Target{
+		{"__address__": "10.0.0.1:80", "app": "backend", "env": "prod"},
+		{"__address__": "10.0.0.4:80", "app": "database"},
+	}, exports.Output)
+	require.Equal(t, debugInfo{InputTargets: 4, DroppedTargets: 2, OutputTargets: 2}, c.DebugInfo())
+	require.Equal(t, component.HealthTypeHealthy, c.CurrentHealth().Health)
+}
+
+func TestFilter_EvaluationErrors(t *testing.T) {
+	args := Arguments{
+		Targets: []discovery.Target{
+			{"__address__": "10.0.0.1:80", "env": "prod"},
+			{"__address__": "10.0.0.2:80"},
+		},
+		// Referring to a missing label fails; the target is dropped.
+		Expression: `labels.env == "prod"`,
+	}
+
+	var exports Exports
+	c, err := New(component.Options{
+		Logger:        log.NewNopLogger(),
+		OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+	}, args)
+	require.NoError(t, err)
+
+	require.Equal(t, []discovery.Target{{"__address__": "10.0.0.1:80", "env": "prod"}}, exports.Output)
+	require.Equal(t, debugInfo{InputTargets: 2, FailedTargets: 1, OutputTargets: 1}, c.DebugInfo())
+	require.Equal(t, component.HealthTypeUnhealthy, c.CurrentHealth().Health)
+}
+
+func TestPredicate(t *testing.T) {
+	target := discovery.Target{
+		"__address__": "10.0.0.1:8080",
+		"job":         "api",
+		"replicas":    "3",
+	}
+
+	tt := []struct {
+		expr   string
+		expect bool
+	}{
+		{expr: `true`, expect: true},
+		{expr: `labels.job == "api"`, expect: true},
+		{expr: `labels["__address__"] == "10.0.0.1:8080"`, expect: true},
+		{expr: `contains(keys(labels), "env")`, expect: false},
+		{expr: `lookup(labels, "env", "") == ""`, expect: true},
+		{expr: `regex_match("10\\.0\\..*", labels.__address__)`, expect: true},
+		{expr: `regex_match("0\\.1", labels.__address__)`, expect: false},
+		{expr: `parse_int(labels.replicas, 10) > 2`, expect: true},
+		{expr: `upper(labels.job) == "API" && trim_suffix(labels.__address__, ":8080") == "10.0.0.1"`, expect: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.expr, func(t *testing.T) {
+			p, err := parsePredicate(tc.expr)
+			require.NoError(t, err)
+
+			actual, err := p.Match(target)
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+func TestPredicate_RegexMatchCache(t *testing.T) {
+	// The pattern comes from the target, so every target compiles and caches
+	// a different pattern with the same predicate.
+	p, err := parsePredicate(`regex_match(labels.pattern, labels.job)`)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		pattern string
+		expect  bool
+	}{
+		{pattern: "api", expect: true},
+		{pattern: "web", expect: false},
+		{pattern: "api", expect: true},
+		{pattern: "a.*", expect: true},
+	} {
+		actual, err := p.Match(discovery.Target{"pattern": tc.pattern, "job": "api"})
+		require.NoError(t, err)
+		require.Equal(t, tc.expect, actual, "pattern %q", tc.pattern)
+	}
+}
+
+func TestPredicate_Invalid(t *testing.T) {
+	tt := []struct {
+		expr        string
+		parseErr    string
+		evaluateErr string
+	}{
+		{expr: `labels.job ==`, parseErr: "invalid expression"},
+		{expr: `target.job == "api"`, parseErr: `unknown variable "target"`},
+		{expr: `env("HOME") == ""`, parseErr: `unknown function "env"`},
+		{expr: `labels.job`, evaluateErr: "expression must evaluate to a bool, got string"},
+		{expr: `labels.missing == "x"`, evaluateErr: "Missing map element"},
+		{expr: `regex_match("(", labels.job)`, evaluateErr: "missing closing )"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.expr, func(t *testing.T) {
+			p, err := parsePredicate(tc.expr)
+			if tc.parseErr != "" {
+				require.ErrorContains(t, err, tc.parseErr)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = p.Match(discovery.Target{"job": "api"})
+			require.ErrorContains(t, err, tc.evaluateErr)
+		})
+	}
+}
+
+func decodeArguments(in string, args *Arguments) hcl.Diagnostics {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(in), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	return gohcl.DecodeBody(file.Body, nil, args)
+}
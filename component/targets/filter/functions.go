@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// newFunctions returns the functions available to a filter expression.
+// Functions which keep state, such as the compiled patterns of regex_match,
+// are scoped to the returned map so state isn't shared between expressions.
+func newFunctions() map[string]function.Function {
+	return map[string]function.Function{
+		"contains":    stdlib.ContainsFunc,
+		"keys":        stdlib.KeysFunc,
+		"lookup":      stdlib.LookupFunc,
+		"lower":       stdlib.LowerFunc,
+		"upper":       stdlib.UpperFunc,
+		"trim_prefix": stdlib.TrimPrefixFunc,
+		"trim_suffix": stdlib.TrimSuffixFunc,
+		"parse_int":   stdlib.ParseIntFunc,
+		"regex_match": newRegexMatchFunc(),
+	}
+}
+
+// newRegexMatchFunc returns a function which returns true if a string fully
+// matches an RE2 regular expression, the same way relabel rules match.
+// Patterns are compiled once and cached for the lifetime of the function, so
+// evaluating an expression against many targets doesn't recompile them.
+func newRegexMatchFunc() function.Function {
+	var (
+		mut   sync.Mutex
+		cache = make(map[string]*regexp.Regexp)
+	)
+
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		mut.Lock()
+		defer mut.Unlock()
+
+		if re, ok := cache[pattern]; ok {
+			return re, nil
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		cache[pattern] = re
+		return re, nil
+	}
+
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "pattern", Type: cty.String},
+			{Name: "str", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			re, err := compile(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, function.NewArgError(0, err)
+			}
+			return cty.BoolVal(re.MatchString(args[1].AsString())), nil
+		},
+	})
+}
@@ -0,0 +1,142 @@
+// Package merge implements the targets.merge component.
+package merge
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "targets.merge",
+		Args:    Arguments{},
+		Exports: Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the targets.merge
+// component.
+type Arguments struct {
+	// Lists of targets to concatenate, in order.
+	Targets [][]discovery.Target `hcl:"targets"`
+
+	// Labels which identify a target. Only the first target with a given
+	// combination of values for these labels is kept. Deduplication is
+	// disabled if empty.
+	DedupBy []string `hcl:"dedup_by,optional"`
+}
+
+// DefaultArguments holds default settings for Arguments.
+var DefaultArguments = Arguments{
+	DedupBy: []string{"__address__"},
+}
+
+var _ gohcl.Decoder = (*Arguments)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (args *Arguments) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*args = DefaultArguments
+
+	type arguments Arguments
+	return gohcl.DecodeBody(body, ctx, (*arguments)(args))
+}
+
+// Exports holds values which are exported by the targets.merge component.
+type Exports struct {
+	Output []discovery.Target `hcl:"output,attr"`
+}
+
+// Component implements the targets.merge component.
+type Component struct {
+	opts component.Options
+
+	mut       sync.RWMutex
+	debugInfo debugInfo
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
+
+// New creates a new targets.merge component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{opts: o}
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	var (
+		output []discovery.Target
+		seen   = make(map[string]struct{})
+		info   debugInfo
+	)
+	for _, targets := range newArgs.Targets {
+		info.InputTargets += len(targets)
+
+		for _, t := range targets {
+			if len(newArgs.DedupBy) > 0 {
+				key := dedupKey(t, newArgs.DedupBy)
+				if _, dup := seen[key]; dup {
+					info.DuplicateTargets++
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			output = append(output, t)
+		}
+	}
+	info.OutputTargets = len(output)
+
+	c.mut.Lock()
+	c.debugInfo = info
+	c.mut.Unlock()
+
+	c.opts.OnStateChange(Exports{Output: output})
+	return nil
+}
+
+// dedupKey returns a key identifying t by the values of labels.
+func dedupKey(t discovery.Target, labels []string) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(t[l])
+		sb.WriteByte(0xff) // Not valid UTF-8, so it can't appear in label values.
+	}
+	return sb.String()
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.debugInfo
+}
+
+type debugInfo struct {
+	InputTargets     int `hcl:"input_targets"`
+	DuplicateTargets int `hcl:"duplicate_targets"`
+	OutputTargets    int `hcl:"output_targets"`
+}
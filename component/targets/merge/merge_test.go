@@ -0,0 +1,99 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/rfratto/gohcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	var (
+		first = []discovery.Target{
+			{"__address__": "10.0.0.1:80", "source": "first"},
+			{"__address__": "10.0.0.2:80", "source": "first"},
+		}
+		second = []discovery.Target{
+			{"__address__": "10.0.0.2:80", "source": "second"},
+			{"__address__": "10.0.0.3:80", "source": "second"},
+		}
+	)
+
+	tt := []struct {
+		name      string
+		args      Arguments
+		expect    []discovery.Target
+		debugInfo debugInfo
+	}{
+		{
+			name: "deduplicate by address",
+			args: Arguments{Targets: [][]discovery.Target{first, second}, DedupBy: []string{"__address__"}},
+			expect: []discovery.Target{
+				{"__address__": "10.0.0.1:80", "source": "first"},
+				{"__address__": "10.0.0.2:80", "source": "first"},
+				{"__address__": "10.0.0.3:80", "source": "second"},
+			},
+			debugInfo: debugInfo{InputTargets: 4, DuplicateTargets: 1, OutputTargets: 3},
+		},
+		{
+			name:      "deduplicate by multiple labels",
+			args:      Arguments{Targets: [][]discovery.Target{first, second}, DedupBy: []string{"__address__", "source"}},
+			expect:    append(append([]discovery.Target{}, first...), second...),
+			debugInfo: debugInfo{InputTargets: 4, OutputTargets: 4},
+		},
+		{
+			name:      "deduplication disabled",
+			args:      Arguments{Targets: [][]discovery.Target{first, first}},
+			expect:    append(append([]discovery.Target{}, first...), first...),
+			debugInfo: debugInfo{InputTargets: 4, OutputTargets: 4},
+		},
+		{
+			name:      "no targets",
+			args:      Arguments{DedupBy: []string{"__address__"}},
+			expect:    nil,
+			debugInfo: debugInfo{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var exports Exports
+			c, err := New(component.Options{
+				Logger:        log.NewNopLogger(),
+				OnStateChange: func(e component.Exports) { exports = e.(Exports) },
+			}, tc.args)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expect, exports.Output)
+			require.Equal(t, tc.debugInfo, c.DebugInfo())
+		})
+	}
+}
+
+func TestArguments_Defaults(t *testing.T) {
+	var args Arguments
+	diags := decodeArguments(`targets = [[{ "__address__" = "localhost:80" }]]`, &args)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Equal(t, []string{"__address__"}, args.DedupBy)
+
+	diags = decodeArguments(`
+targets  = [[{ "__address__" = "localhost:80" }]]
+dedup_by = []
+`, &args)
+	require.False(t, diags.HasErrors(), diags.Error())
+	require.Empty(t, args.DedupBy)
+}
+
+func decodeArguments(in string, args *Arguments) hcl.Diagnostics {
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCL([]byte(in), "agent-config.flow")
+	if diags.HasErrors() {
+		return diags
+	}
+	return gohcl.DecodeBody(file.Body, nil, args)
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/component"
 )
@@ -126,6 +127,7 @@ func (c *Controller) buildComponent(dataPath string, args component.Arguments) (
 		Logger:        c.log,
 		DataPath:      dataPath,
 		OnStateChange: c.onStateChange,
+		Clock:         clock.New(),
 	}
 
 	inner, err := c.reg.Build(opts, args)
@@ -3,6 +3,7 @@ package flow
 import (
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/tracing"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/rfratto/gohcl"
@@ -14,6 +15,7 @@ type File struct {
 	HCL  *hcl.File // Raw HCL file.
 
 	Logging logging.Options
+	Tracing tracing.Options
 
 	// Components holds the list of raw HCL blocks describing components. The
 	// Flow controller can interpret this block.
@@ -46,17 +48,23 @@ func ReadFile(name string, bb []byte) (*File, hcl.Diagnostics) {
 		defaults := logging.DefaultOptions
 		root.Logger = &defaults
 	}
+	if root.Tracing == nil {
+		defaults := tracing.DefaultOptions
+		root.Tracing = &defaults
+	}
 
 	return &File{
 		Name:       name,
 		HCL:        file,
 		Logging:    *root.Logger,
+		Tracing:    *root.Tracing,
 		Components: content.Blocks,
 	}, nil
 }
 
 type rootBlock struct {
-	Logger *logging.Options `hcl:"logging,block"`
+	Logger  *logging.Options `hcl:"logging,block"`
+	Tracing *tracing.Options `hcl:"tracing,block"`
 
 	// TODO(rfratto): server block for TLS settings
 
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/grafana/agent/pkg/flow"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/tracing"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/stretchr/testify/require"
 
@@ -38,6 +40,46 @@ func TestReadFile_Defaults(t *testing.T) {
 	requireNoDiagErrors(t, f, diags)
 
 	require.Len(t, f.Components, 0)
+	require.Equal(t, tracing.DefaultOptions, f.Tracing)
+}
+
+func TestReadFile_LoggingOverrides(t *testing.T) {
+	content := `
+		logging {
+			level = "warn"
+
+			component "testcomponents.tick.ticker-a" {
+				level = "debug"
+			}
+		}
+	`
+
+	f, diags := flow.ReadFile(t.Name(), []byte(content))
+	require.NotNil(t, f)
+	requireNoDiagErrors(t, f, diags)
+
+	require.Equal(t, logging.LevelWarn, f.Logging.Level)
+	require.Equal(t, []logging.ComponentOptions{
+		{ID: "testcomponents.tick.ticker-a", Level: logging.LevelDebug},
+	}, f.Logging.Components)
+}
+
+func TestReadFile_Tracing(t *testing.T) {
+	content := `
+		tracing {
+			endpoint = "tempo:4317"
+			insecure = true
+		}
+	`
+
+	f, diags := flow.ReadFile(t.Name(), []byte(content))
+	require.NotNil(t, f)
+	requireNoDiagErrors(t, f, diags)
+
+	expect := tracing.DefaultOptions
+	expect.Endpoint = "tempo:4317"
+	expect.Insecure = true
+	require.Equal(t, expect, f.Tracing)
 }
 
 func TestReadFile_InvalidComponent(t *testing.T) {
@@ -49,11 +49,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/go-kit/log/level"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
 	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/tracing"
 	"github.com/hashicorp/hcl/v2"
 )
 
@@ -63,15 +69,51 @@ type Options struct {
 	// nil.
 	Logger *logging.Logger
 
+	// Tracer used to trace component evaluations. A Tracer will be created if
+	// this is nil. The Tracer is re-configured with the tracing options of
+	// every loaded File.
+	Tracer *tracing.Tracer
+
 	// Directory where components can write data. Components will create
 	// subdirectories for component-specific data.
 	DataPath string
+
+	// HTTPListenAddr is the address the Flow HTTP server is listening on.
+	// Components use it to build URLs which refer to their own HTTP handlers;
+	// see ComponentHandler.
+	HTTPListenAddr string
+
+	// Clusterer is the cluster the process is a part of, which components can
+	// use to distribute work. A single-node cluster will be created if this is
+	// nil.
+	Clusterer cluster.Node
+
+	// Clock is the source of time for components. The system clock will be
+	// used if this is nil.
+	Clock clock.Clock
+
+	// SnapshotExports enables writing the exports of components to disk under
+	// DataPath. After a restart, components start with their last known
+	// exports until they report new ones, so downstream components don't have
+	// to wait for them to refetch.
+	//
+	// Secrets are never written. Exports holding capsule values other than
+	// OptionalSecret, such as receivers, are never snapshotted, and exports
+	// holding an OptionalSecret are only written while none of them is marked
+	// as secret.
+	SnapshotExports bool
 }
 
+// exportsSnapshotDir is the directory within Options.DataPath where exports
+// snapshots are stored.
+const exportsSnapshotDir = "exports-snapshot"
+
 // Flow is the Flow system.
 type Flow struct {
-	log  *logging.Logger
-	opts Options
+	log       *logging.Logger
+	tracer    *tracing.Tracer
+	ownTracer bool // True if tracer was created by Flow and must be shut down.
+	opts      Options
 
 	updateQueue *controller.Queue
 	sched       *controller.Scheduler
@@ -106,6 +148,32 @@ func newFlow(o Options) (*Flow, context.Context) {
 		}
 	}
 
+	tracer, ownTracer := o.Tracer, false
+	if tracer == nil {
+		var err error
+		tracer, err = tracing.New(tracing.DefaultOptions)
+		if err != nil {
+			// This shouldn't happen unless there's a bug
+			panic(err)
+		}
+		ownTracer = true
+	}
+
+	clusterer := o.Clusterer
+	if clusterer == nil {
+		clusterer = cluster.NewLocalNode(o.HTTPListenAddr)
+	}
+
+	clk := o.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	var snapshotPath string
+	if o.SnapshotExports {
+		snapshotPath = filepath.Join(o.DataPath, exportsSnapshotDir)
+	}
+
 	var (
 		queue  = controller.NewQueue()
 		sched  = controller.NewScheduler()
@@ -116,12 +184,19 @@ func newFlow(o Options) (*Flow, context.Context) {
 				// Changed components should be queued for reevaluation.
 				queue.Enqueue(cn)
 			},
+			HTTPListenAddr: o.HTTPListenAddr,
+			Clusterer:      clusterer,
+			TraceProvider:  tracer,
+			Clock:          clk,
+			SnapshotPath:   snapshotPath,
 		})
 	)
 
 	return &Flow{
-		log:  log,
-		opts: o,
+		log:       log,
+		tracer:    tracer,
+		ownTracer: ownTracer,
+		opts:      o,
 
 		updateQueue: queue,
 		sched:       sched,
@@ -149,7 +224,7 @@ func (c *Flow) run(ctx context.Context) {
 			updated := c.updateQueue.TryDequeue()
 			if updated != nil {
 				level.Debug(c.log).Log("msg", "handling component with updated state", "node_id", updated.NodeID())
-				c.loader.EvaluateDependencies(rootEvalContext, updated)
+				c.loader.EvaluateDependencies(ctx, rootEvalContext, updated)
 			}
 
 		case <-c.loadFinished:
@@ -185,8 +260,11 @@ func (c *Flow) LoadFile(f *File) error {
 	if err != nil {
 		return fmt.Errorf("error updating logger: %w", err)
 	}
+	if err := c.tracer.Update(f.Tracing); err != nil {
+		return fmt.Errorf("error updating tracer: %w", err)
+	}
 
-	diags := c.loader.Apply(rootEvalContext, f.Components)
+	diags := c.loader.Apply(context.Background(), rootEvalContext, f.Components)
 	if !c.loadedOnce && diags.HasErrors() {
 		// The first call to Load should not run any components if there were
 		// errors in the coniguration file.
@@ -194,6 +272,14 @@ func (c *Flow) LoadFile(f *File) error {
 	}
 	c.loadedOnce = true
 
+	// Drop the log lines of components which were removed.
+	components := c.loader.Components()
+	componentIDs := make([]string, 0, len(components))
+	for _, cn := range components {
+		componentIDs = append(componentIDs, cn.NodeID())
+	}
+	c.log.Prune(componentIDs)
+
 	select {
 	case c.loadFinished <- struct{}{}:
 	default:
@@ -202,6 +288,41 @@ func (c *Flow) LoadFile(f *File) error {
 	return diagsOrNil(diags)
 }
 
+// ComponentInfo holds the current state of a component.
+type ComponentInfo struct {
+	ID        string
+	Exports   component.Exports
+	Health    component.Health
+	DebugInfo interface{} // Nil if the component doesn't expose debug info.
+
+	// ExportsStale is true if Exports were restored from a snapshot and the
+	// component hasn't reported its own exports yet.
+	ExportsStale bool
+
+	// Running is true if the component has been started and hasn't exited.
+	Running bool
+}
+
+// ComponentInfo returns the current state of the component with the given
+// ID. ok is false if no such component is loaded.
+func (c *Flow) ComponentInfo(id string) (info ComponentInfo, ok bool) {
+	for _, cn := range c.loader.Components() {
+		if cn.NodeID() != id {
+			continue
+		}
+		return ComponentInfo{
+			ID:        id,
+			Exports:   cn.Exports(),
+			Health:    cn.CurrentHealth(),
+			DebugInfo: cn.DebugInfo(),
+
+			ExportsStale: cn.ExportsStale(),
+			Running:      cn.Running(),
+		}, true
+	}
+	return ComponentInfo{}, false
+}
+
 func diagsOrNil(d hcl.Diagnostics) error {
 	if len(d) > 0 {
 		return d
@@ -213,5 +334,12 @@ func diagsOrNil(d hcl.Diagnostics) error {
 func (c *Flow) Close() error {
 	c.cancel()
 	<-c.exited
-	return c.sched.Close()
+	err := c.sched.Close()
+
+	if c.ownTracer {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = c.tracer.Shutdown(ctx)
+	}
+	return err
 }
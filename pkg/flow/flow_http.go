@@ -2,14 +2,18 @@ package flow
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
 	"github.com/grafana/agent/pkg/flow/internal/dag"
 	"github.com/grafana/agent/pkg/flow/internal/graphviz"
+	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/rfratto/gohcl/hclfmt"
@@ -43,6 +47,150 @@ func (f *Flow) ConfigHandler() http.HandlerFunc {
 	}
 }
 
+// ComponentHandler returns an http.HandlerFunc which routes requests to
+// components implementing component.HTTPComponent. Requests to
+// /component/{id}/{path} are forwarded to the handler of component {id} with
+// the /component/{id} prefix removed.
+func (f *Flow) ComponentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/component/")
+		if idx := strings.IndexByte(id, '/'); idx >= 0 {
+			id = id[:idx]
+		}
+
+		for _, cn := range f.loader.Components() {
+			if cn.NodeID() != id {
+				continue
+			}
+			handler, ok := cn.HTTPHandler()
+			if !ok {
+				break
+			}
+
+			prefix := strings.TrimSuffix(controller.ComponentHTTPPath(id), "/")
+			http.StripPrefix(prefix, handler).ServeHTTP(w, r)
+			return
+		}
+
+		http.NotFound(w, r)
+	}
+}
+
+// ComponentLogsHandler returns an http.HandlerFunc which serves recent log
+// lines of a component for requests to /api/v0/component/{id}/logs.
+//
+// The level query parameter filters out log lines below the given level.
+// When the follow query parameter is true, buffered log lines are followed by
+// new log lines as a stream of server-sent events until the client
+// disconnects.
+func (f *Flow) ComponentLogsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/api/v0/component/")
+		id := strings.TrimSuffix(rest, "/logs")
+		if id == rest || !f.hasComponent(id) {
+			http.NotFound(w, r)
+			return
+		}
+
+		minLevel := logging.LevelDebug
+		if q := r.URL.Query().Get("level"); q != "" {
+			if err := minLevel.UnmarshalText([]byte(q)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var follow bool
+		if q := r.URL.Query().Get("follow"); q != "" {
+			var err error
+			if follow, err = strconv.ParseBool(q); err != nil {
+				http.Error(w, fmt.Sprintf("invalid follow parameter: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if follow {
+			f.streamLogs(w, r, id, minLevel)
+			return
+		}
+
+		entries := f.log.Entries(id, minLevel)
+		if entries == nil {
+			entries = []logging.Entry{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			level.Error(f.log).Log("msg", "failed to write component logs", "err", err)
+		}
+	}
+}
+
+// streamLogs writes log lines of a component as server-sent events until the
+// request is canceled.
+func (f *Flow) streamLogs(w http.ResponseWriter, r *http.Request, id string, minLevel logging.Level) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading buffered lines so no lines are missed in
+	// between.
+	live, unsubscribe := f.log.Subscribe(id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(e logging.Entry) error {
+		bb, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", bb)
+		return err
+	}
+
+	var last logging.Entry
+	for _, e := range f.log.Entries(id, minLevel) {
+		if err := writeEvent(e); err != nil {
+			return
+		}
+		last = e
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-live:
+			if !ok {
+				// The component was removed.
+				return
+			}
+			// Skip lines which were already sent from the buffer.
+			if e.Seq <= last.Seq || !minLevel.Enabled(e.Level) {
+				continue
+			}
+			if err := writeEvent(e); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (f *Flow) hasComponent(id string) bool {
+	for _, cn := range f.loader.Components() {
+		if cn.NodeID() == id {
+			return true
+		}
+	}
+	return false
+}
+
 // configBytes dumps the current state of the flow config as HCL.
 func (f *Flow) configBytes(w io.Writer, debugInfo bool) (n int64, err error) {
 	file := hclwrite.NewFile()
@@ -1,10 +1,19 @@
 package flow
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	_ "github.com/grafana/agent/pkg/flow/internal/testcomponents" // Import testcomponents
+	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/stretchr/testify/require"
 )
 
@@ -53,3 +62,94 @@ testcomponents "passthrough" "static" {
 
 	require.Equal(t, expect, actual)
 }
+
+func TestComponentLogsHandler(t *testing.T) {
+	configFile := `
+		testcomponents "passthrough" "static" {
+			input = "hello, world!"
+		}
+	`
+
+	file, diags := ReadFile(t.Name(), []byte(configFile))
+	require.NotNil(t, file)
+	require.False(t, diags.HasErrors(), "Found errors when loading file")
+
+	f, _ := newFlow(testOptions(t))
+	require.NoError(t, f.LoadFile(file))
+
+	cl := log.With(f.log, "component", "testcomponents.passthrough.static")
+	level.Info(cl).Log("msg", "first")
+	level.Warn(cl).Log("msg", "second")
+
+	handler := f.ComponentLogsHandler()
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	t.Run("all lines", func(t *testing.T) {
+		rec := get("/api/v0/component/testcomponents.passthrough.static/logs")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var entries []logging.Entry
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		// The component itself logs when evaluated, so only check the most recent
+		// lines.
+		require.GreaterOrEqual(t, len(entries), 2)
+		require.Contains(t, entries[len(entries)-2].Line, "msg=first")
+		require.Contains(t, entries[len(entries)-1].Line, "msg=second")
+	})
+
+	t.Run("filtered by level", func(t *testing.T) {
+		rec := get("/api/v0/component/testcomponents.passthrough.static/logs?level=warn")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var entries []logging.Entry
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		require.Len(t, entries, 1)
+		require.Contains(t, entries[0].Line, "msg=second")
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		rec := get("/api/v0/component/testcomponents.passthrough.static/logs?level=loud")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unknown component", func(t *testing.T) {
+		rec := get("/api/v0/component/testcomponents.passthrough.missing/logs")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v0/component/testcomponents.passthrough.static/logs?follow=true&level=warn", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// Lines logged in quick succession may share a timestamp, but must all
+		// be streamed.
+		level.Warn(cl).Log("msg", "third")
+		level.Warn(cl).Log("msg", "fourth")
+
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() && len(lines) < 3 {
+			if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+				lines = append(lines, data)
+			}
+		}
+		require.Len(t, lines, 3)
+		require.Contains(t, lines[0], "msg=second")
+		require.Contains(t, lines[1], "msg=third")
+		require.Contains(t, lines[2], "msg=fourth")
+	})
+}
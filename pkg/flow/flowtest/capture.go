@@ -0,0 +1,160 @@
+package flowtest
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "flowtest.metrics_capture",
+		Args:    CaptureArguments{},
+		Exports: CaptureExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return newCapture(opts, args.(CaptureArguments)), nil
+		},
+	})
+}
+
+// CaptureArguments holds values which are used to configure the
+// flowtest.metrics_capture component.
+type CaptureArguments struct {
+	// Where received samples are forwarded to after being captured, which
+	// allows capturing samples in the middle of a pipeline.
+	ForwardTo []*metrics.Receiver `hcl:"forward_to,optional"`
+}
+
+// CaptureExports holds values which are exported by the
+// flowtest.metrics_capture component.
+type CaptureExports struct {
+	Receiver *metrics.Receiver `hcl:"receiver"`
+}
+
+// capture implements the flowtest.metrics_capture component, which records
+// the latest value of every series it receives.
+type capture struct {
+	mut       sync.Mutex
+	forwardTo []*metrics.Receiver
+	series    map[string]float64 // Formatted series -> latest value.
+}
+
+var (
+	_ component.Component      = (*capture)(nil)
+	_ component.DebugComponent = (*capture)(nil)
+)
+
+func newCapture(o component.Options, args CaptureArguments) *capture {
+	c := &capture{
+		forwardTo: args.ForwardTo,
+		series:    make(map[string]float64),
+	}
+	o.OnStateChange(CaptureExports{
+		Receiver: &metrics.Receiver{Receive: c.Receive},
+	})
+	return c
+}
+
+// Run implements component.Component.
+func (c *capture) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *capture) Update(args component.Arguments) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.forwardTo = args.(CaptureArguments).ForwardTo
+	return nil
+}
+
+// Receive records the received samples and forwards them. Stale markers
+// remove the series.
+func (c *capture) Receive(ts int64, metricArr []*metrics.FlowMetric) {
+	c.mut.Lock()
+	for _, m := range metricArr {
+		key := formatSeries(m.Labels)
+		if value.IsStaleNaN(m.Value) {
+			delete(c.series, key)
+			continue
+		}
+		c.series[key] = m.Value
+	}
+	forwardTo := c.forwardTo
+	c.mut.Unlock()
+
+	for _, recv := range forwardTo {
+		recv.Receive(ts, metricArr)
+	}
+}
+
+// Series returns the captured series in the form "<series> <value>", sorted
+// by series.
+func (c *capture) Series() []string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	res := make([]string, 0, len(c.series))
+	for s, v := range c.series {
+		res = append(res, s+" "+formatValue(v))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *capture) DebugInfo() interface{} {
+	return captureDebugInfo{Series: c.Series()}
+}
+
+type captureDebugInfo struct {
+	Series []string `hcl:"series"`
+}
+
+// formatSeries formats lset the way it would be written in PromQL, such as
+// `up{job="agent"}`.
+func formatSeries(lset labels.Labels) string {
+	var sb strings.Builder
+	sb.WriteString(lset.Get(labels.MetricName))
+
+	i := 0
+	for _, l := range lset {
+		if l.Name == labels.MetricName {
+			continue
+		}
+		if i == 0 {
+			sb.WriteByte('{')
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(l.Name)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(l.Value))
+		i++
+	}
+	if i > 0 {
+		sb.WriteByte('}')
+	}
+	return sb.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,60 @@
+package flowtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// mockClock is a clock.Mock which tracks the channels returned by After, so
+// a Scenario can tell when components are waiting on the clock again after
+// it was advanced.
+type mockClock struct {
+	*clock.Mock
+
+	mut    sync.Mutex
+	afters []time.Time // Deadlines of After channels which haven't fired.
+}
+
+func newMockClock() *mockClock {
+	return &mockClock{Mock: clock.NewMock()}
+}
+
+// After implements clock.Clock.
+func (c *mockClock) After(d time.Duration) <-chan time.Time {
+	c.mut.Lock()
+	c.afters = append(c.afters, c.Mock.Now().Add(d))
+	c.mut.Unlock()
+
+	return c.Mock.After(d)
+}
+
+// advance moves the clock forward by d. It returns the number of After
+// channels which are expected to be pending once every component which was
+// woken up by the advance waits on the clock again.
+func (c *mockClock) advance(d time.Duration) int {
+	now := c.Mock.Now().Add(d)
+
+	c.mut.Lock()
+	pending := c.afters[:0]
+	for _, deadline := range c.afters {
+		if deadline.After(now) {
+			pending = append(pending, deadline)
+		}
+	}
+	fired := len(c.afters) - len(pending)
+	c.afters = pending
+	expect := len(pending) + fired
+	c.mut.Unlock()
+
+	c.Mock.Add(d)
+	return expect
+}
+
+// pendingAfters returns the number of After channels which haven't fired.
+func (c *mockClock) pendingAfters() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return len(c.afters)
+}
@@ -0,0 +1,280 @@
+// Package flowtest provides a harness for testing entire Flow pipelines.
+//
+// A Scenario loads a Flow file into a real controller whose components use a
+// mock clock. Tests send synthetic samples into the receivers of components,
+// advance time, and assert the exports, health, and captured outputs of
+// components.
+//
+// Outputs are captured with the flowtest.metrics_capture component, which
+// records the latest value of every series sent to its exported receiver:
+//
+//	metrics "mutate" "default" {
+//	  forward_to = [flowtest.metrics_capture.out.receiver]
+//	}
+//
+//	flowtest "metrics_capture" "out" {}
+//
+// Packages for the components used by a Flow file must be imported by the
+// test so they are registered.
+package flowtest
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/metrics"
+	"github.com/grafana/agent/pkg/flow"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+// waitTimeout is how long assertions wait for a condition to become true.
+const waitTimeout = 5 * time.Second
+
+// Scenario is a running Flow controller used for testing a pipeline.
+type Scenario struct {
+	t     testing.TB
+	clock *mockClock
+	flow  *flow.Flow
+}
+
+// New creates a new Scenario which runs the given Flow file. The Scenario is
+// stopped when the test finishes.
+//
+// The mock clock starts at the Unix epoch.
+func New(t testing.TB, config string) *Scenario {
+	t.Helper()
+
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	s := &Scenario{t: t, clock: newMockClock()}
+	s.flow = flow.New(flow.Options{
+		Logger:   l,
+		DataPath: t.TempDir(),
+		Clock:    s.clock,
+	})
+	t.Cleanup(func() { require.NoError(t, s.flow.Close()) })
+
+	f, diags := flow.ReadFile(t.Name()+".flow", []byte(config))
+	require.False(t, diags.HasErrors(), "failed to read config: %s", diags)
+	require.NoError(t, s.flow.LoadFile(f))
+
+	// Wait for every component to be started so that timers created when
+	// components start running are registered with the mock clock.
+	for _, b := range f.Components {
+		id := strings.Join(append([]string{b.Type}, b.Labels...), ".")
+		ok := eventually(func() bool {
+			info, ok := s.flow.ComponentInfo(id)
+			return ok && info.Running
+		})
+		require.True(t, ok, "component %q was never started", id)
+	}
+	return s
+}
+
+// Clock returns the mock clock used by components in the Scenario.
+func (s *Scenario) Clock() *clock.Mock { return s.clock.Mock }
+
+// Flow returns the controller running the Scenario.
+func (s *Scenario) Flow() *flow.Flow { return s.flow }
+
+// Advance moves the mock clock forward by d, firing any timers and tickers
+// which expire along the way.
+//
+// Components commonly wait on clock.After in a loop. Advance waits for
+// components to call clock.After again for every channel which fired, so
+// that the next call to Advance isn't missed by a component still handling
+// the previous one.
+func (s *Scenario) Advance(d time.Duration) {
+	s.t.Helper()
+
+	expect := s.clock.advance(d)
+	ok := eventually(func() bool { return s.clock.pendingAfters() >= expect })
+	require.True(s.t, ok, "components did not wait on the clock again after advancing it")
+}
+
+// Send sends samples to the receiver exported by the component with the
+// given ID. Each sample is written in the form "<series> <value>", such as
+// `up{job="agent"} 1`. Samples are timestamped with the current time of the
+// mock clock.
+func (s *Scenario) Send(componentID string, samples ...string) {
+	s.t.Helper()
+
+	recv, err := s.receiver(componentID)
+	require.NoError(s.t, err)
+
+	metricArr := make([]*metrics.FlowMetric, 0, len(samples))
+	for _, sample := range samples {
+		m, err := parseSample(sample)
+		require.NoError(s.t, err)
+		metricArr = append(metricArr, m)
+	}
+	recv.Receive(timestamp.FromTime(s.clock.Now()), metricArr)
+}
+
+// receiver returns the *metrics.Receiver exported by a component.
+func (s *Scenario) receiver(componentID string) (*metrics.Receiver, error) {
+	info, ok := s.flow.ComponentInfo(componentID)
+	if !ok {
+		return nil, fmt.Errorf("component %q does not exist", componentID)
+	}
+
+	rv := reflect.ValueOf(info.Exports)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		for i := 0; i < rv.NumField(); i++ {
+			if recv, ok := rv.Field(i).Interface().(*metrics.Receiver); ok && recv != nil {
+				return recv, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("component %q does not export a metrics receiver", componentID)
+}
+
+// Series returns the series captured by the flowtest.metrics_capture
+// component with the given ID, in the form "<series> <value>" and sorted by
+// series.
+func (s *Scenario) Series(captureID string) []string {
+	s.t.Helper()
+
+	info, ok := s.flow.ComponentInfo(captureID)
+	require.True(s.t, ok, "component %q does not exist", captureID)
+
+	di, ok := info.DebugInfo.(captureDebugInfo)
+	require.True(s.t, ok, "component %q is not a flowtest.metrics_capture component", captureID)
+	return di.Series
+}
+
+// RequireSeries asserts that the component with the given ID eventually
+// captures exactly the expected series.
+func (s *Scenario) RequireSeries(captureID string, expect ...string) {
+	s.t.Helper()
+
+	if expect == nil {
+		expect = []string{}
+	}
+	var last []string
+	ok := eventually(func() bool {
+		last = s.Series(captureID)
+		return reflect.DeepEqual(expect, last)
+	})
+	require.True(s.t, ok, "series of %q did not match\nexpected: %q\nactual:   %q", captureID, expect, last)
+}
+
+// RequireHealth asserts that the component with the given ID eventually
+// reports the expected health.
+func (s *Scenario) RequireHealth(componentID string, expect component.HealthType) {
+	s.t.Helper()
+
+	var last component.Health
+	ok := eventually(func() bool {
+		info, ok := s.flow.ComponentInfo(componentID)
+		if !ok {
+			return false
+		}
+		last = info.Health
+		return last.Health == expect
+	})
+	require.True(s.t, ok, "component %q has health %s (%q), expected %s", componentID, last.Health, last.Message, expect)
+}
+
+// RequireExports asserts that the component with the given ID eventually
+// exports a value equal to expect.
+func (s *Scenario) RequireExports(componentID string, expect component.Exports) {
+	s.t.Helper()
+
+	var last component.Exports
+	ok := eventually(func() bool {
+		info, ok := s.flow.ComponentInfo(componentID)
+		if !ok {
+			return false
+		}
+		last = info.Exports
+		return reflect.DeepEqual(expect, last)
+	})
+	require.True(s.t, ok, "exports of %q did not match\nexpected: %#v\nactual:   %#v", componentID, expect, last)
+}
+
+// RequireExport asserts that the exported field named by its HCL tag
+// eventually formats (using fmt.Sprint) as expect.
+func (s *Scenario) RequireExport(componentID, field, expect string) {
+	s.t.Helper()
+
+	var (
+		last string
+		err  error
+	)
+	ok := eventually(func() bool {
+		last, err = s.exportField(componentID, field)
+		return err == nil && last == expect
+	})
+	require.NoError(s.t, err)
+	require.True(s.t, ok, "export %q of %q is %q, expected %q", field, componentID, last, expect)
+}
+
+func (s *Scenario) exportField(componentID, field string) (string, error) {
+	info, ok := s.flow.ComponentInfo(componentID)
+	if !ok {
+		return "", fmt.Errorf("component %q does not exist", componentID)
+	}
+
+	rv := reflect.ValueOf(info.Exports)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return "", fmt.Errorf("component %q has no exports", componentID)
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		tag := rv.Type().Field(i).Tag.Get("hcl")
+		if name := strings.SplitN(tag, ",", 2)[0]; name == field {
+			return fmt.Sprint(rv.Field(i).Interface()), nil
+		}
+	}
+	return "", fmt.Errorf("component %q does not export %q", componentID, field)
+}
+
+// eventually polls cond until it returns true or waitTimeout elapses.
+func eventually(cond func() bool) bool {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		if cond() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// parseSample parses a sample in the form "<series> <value>".
+func parseSample(sample string) (*metrics.FlowMetric, error) {
+	sample = strings.TrimSpace(sample)
+	sep := strings.LastIndexAny(sample, " \t")
+	if sep == -1 {
+		return nil, fmt.Errorf("sample %q must be in the form \"<series> <value>\"", sample)
+	}
+
+	lset, err := parser.ParseMetric(strings.TrimSpace(sample[:sep]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid series in sample %q: %w", sample, err)
+	}
+	val, err := strconv.ParseFloat(sample[sep+1:], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value in sample %q: %w", sample, err)
+	}
+	return &metrics.FlowMetric{Labels: lset, Value: val}, nil
+}
@@ -0,0 +1,126 @@
+package flowtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/flowtest"
+	"github.com/grafana/agent/pkg/flow/internal/testcomponents"
+
+	_ "github.com/grafana/agent/component/metrics/mutate"
+	_ "github.com/grafana/agent/component/metrics/recordingrules"
+)
+
+func TestScenario(t *testing.T) {
+	tt := []struct {
+		name   string
+		config string
+		run    func(s *flowtest.Scenario)
+	}{
+		{
+			name: "exports",
+			config: `
+				testcomponents "passthrough" "static" {
+					input = "hello, world!"
+				}
+
+				testcomponents "passthrough" "forwarded" {
+					input = testcomponents.passthrough.static.output
+				}
+			`,
+			run: func(s *flowtest.Scenario) {
+				s.RequireExports("testcomponents.passthrough.forwarded", testcomponents.PassthroughExports{
+					Output: "hello, world!",
+				})
+				s.RequireExport("testcomponents.passthrough.forwarded", "output", "hello, world!")
+			},
+		},
+		{
+			name: "mock clock",
+			config: `
+				testcomponents "tick" "ticker" {
+					frequency = "1m"
+				}
+			`,
+			run: func(s *flowtest.Scenario) {
+				start := s.Clock().Now()
+
+				s.Advance(time.Minute)
+				s.RequireExports("testcomponents.tick.ticker", testcomponents.TickExports{
+					Time: start.Add(time.Minute),
+				})
+
+				s.Advance(time.Minute)
+				s.RequireExports("testcomponents.tick.ticker", testcomponents.TickExports{
+					Time: start.Add(2 * time.Minute),
+				})
+			},
+		},
+		{
+			name: "capture",
+			config: `
+				metrics "mutate" "default" {
+					forward_to = [flowtest.metrics_capture.out.receiver]
+
+					metric_relabel_config {
+						target_label = "env"
+						replacement  = "test"
+					}
+				}
+
+				flowtest "metrics_capture" "out" {}
+			`,
+			run: func(s *flowtest.Scenario) {
+				s.Send("metrics.mutate.default",
+					`up{job="a"} 1`,
+					`up{job="b"} 0`,
+				)
+				s.RequireSeries("flowtest.metrics_capture.out",
+					`up{env="test", job="a"} 1`,
+					`up{env="test", job="b"} 0`,
+				)
+
+				// Only the latest value of a series is kept.
+				s.Send("metrics.mutate.default", `up{job="a"} 0`)
+				s.RequireSeries("flowtest.metrics_capture.out",
+					`up{env="test", job="a"} 0`,
+					`up{env="test", job="b"} 0`,
+				)
+			},
+		},
+		{
+			name: "health",
+			config: `
+				metrics "recording_rules" "default" {
+					forward_to          = [flowtest.metrics_capture.out.receiver]
+					evaluation_interval = "1m"
+
+					rule {
+						record = "job:up:sum"
+						expr   = "sum by (job) (up)"
+					}
+				}
+
+				flowtest "metrics_capture" "out" {}
+			`,
+			run: func(s *flowtest.Scenario) {
+				s.RequireHealth("metrics.recording_rules.default", component.HealthTypeUnknown)
+
+				s.Advance(time.Minute)
+				s.RequireHealth("metrics.recording_rules.default", component.HealthTypeHealthy)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(flowtest.New(t, tc.config))
+		})
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	flowtest.RunFiles(t, "testdata/*.txtar")
+}
@@ -0,0 +1,188 @@
+package flowtest
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/txtar"
+)
+
+var update = flag.Bool("flowtest.update", false, "rewrite the expected outputs of txtar scenarios")
+
+// Files in a txtar scenario.
+const (
+	configFile   = "config.flow"
+	stepsFile    = "steps"
+	outputPrefix = "output/"
+)
+
+// RunFiles runs every txtar scenario matching pattern as a subtest named
+// after the file.
+//
+// A txtar scenario holds the following files:
+//
+//   - config.flow: the Flow file to load.
+//   - steps: optional steps to run after loading, one per line.
+//   - output/<component ID>: the series expected to be captured by a
+//     flowtest.metrics_capture component after running all steps, one per
+//     line.
+//
+// Steps are one of:
+//
+//	send <component ID> <series> <value>
+//	advance <duration>
+//	health <component ID> <healthy|unhealthy|unknown|exited>
+//	export <component ID> <field> <value>
+//
+// Blank lines and lines starting with # are ignored.
+//
+// Running tests with -flowtest.update rewrites the expected outputs of
+// scenarios with the captured series.
+func RunFiles(t *testing.T, pattern string) {
+	t.Helper()
+
+	paths, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	require.NotEmpty(t, paths, "no files match %q", pattern)
+
+	for _, path := range paths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		t.Run(name, func(t *testing.T) { RunFile(t, path) })
+	}
+}
+
+// RunFile runs the txtar scenario at path. See RunFiles for the format of
+// scenarios.
+func RunFile(t *testing.T, path string) {
+	t.Helper()
+
+	ar, err := txtar.ParseFile(path)
+	require.NoError(t, err)
+
+	var (
+		config  []byte
+		steps   []byte
+		outputs = make(map[string]int) // Capture ID -> index in ar.Files.
+	)
+	for i, f := range ar.Files {
+		switch {
+		case f.Name == configFile:
+			config = f.Data
+		case f.Name == stepsFile:
+			steps = f.Data
+		case strings.HasPrefix(f.Name, outputPrefix):
+			outputs[strings.TrimPrefix(f.Name, outputPrefix)] = i
+		default:
+			t.Fatalf("%s: unexpected file %q", path, f.Name)
+		}
+	}
+	require.NotNil(t, config, "%s: missing %s", path, configFile)
+
+	s := New(t, string(config))
+	s.runSteps(path, steps)
+
+	if *update {
+		for id, idx := range outputs {
+			ar.Files[idx].Data = []byte(joinLines(s.Series(id)))
+		}
+		require.NoError(t, os.WriteFile(path, txtar.Format(ar), 0644))
+		return
+	}
+
+	for id, idx := range outputs {
+		s.RequireSeries(id, splitLines(ar.Files[idx].Data)...)
+	}
+}
+
+func (s *Scenario) runSteps(path string, steps []byte) {
+	s.t.Helper()
+
+	sc := bufio.NewScanner(bytes.NewReader(steps))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := s.runStep(text); err != nil {
+			s.t.Fatalf("%s:%s:%d: %s", path, stepsFile, line, err)
+		}
+	}
+	require.NoError(s.t, sc.Err())
+}
+
+func (s *Scenario) runStep(step string) error {
+	s.t.Helper()
+
+	cmd, rest := cutField(step)
+	switch cmd {
+	case "send":
+		id, sample := cutField(rest)
+		if id == "" || sample == "" {
+			return fmt.Errorf("usage: send <component ID> <series> <value>")
+		}
+		s.Send(id, sample)
+
+	case "advance":
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return fmt.Errorf("usage: advance <duration>: %w", err)
+		}
+		s.Advance(d)
+
+	case "health":
+		id, health := cutField(rest)
+		var ht component.HealthType
+		if err := ht.UnmarshalText([]byte(health)); err != nil || id == "" {
+			return fmt.Errorf("usage: health <component ID> <healthy|unhealthy|unknown|exited>")
+		}
+		s.RequireHealth(id, ht)
+
+	case "export":
+		id, rest := cutField(rest)
+		field, value := cutField(rest)
+		if id == "" || field == "" {
+			return fmt.Errorf("usage: export <component ID> <field> <value>")
+		}
+		s.RequireExport(id, field, value)
+
+	default:
+		return fmt.Errorf("unknown step %q", cmd)
+	}
+	return nil
+}
+
+// cutField splits s around the first run of whitespace.
+func cutField(s string) (field, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i != -1 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+func splitLines(data []byte) []string {
+	var res []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
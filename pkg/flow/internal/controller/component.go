@@ -4,18 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/flow/internal/dag"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/rfratto/gohcl"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/atomic"
 )
 
@@ -56,6 +63,23 @@ type ComponentGlobals struct {
 	Logger          log.Logger              // Logger shared between all managed components.
 	DataPath        string                  // Shared directory where component data may be stored
 	OnExportsChange func(cn *ComponentNode) // Invoked when the managed component updated its exports
+	HTTPListenAddr  string                  // Address the Flow HTTP server listens on
+	Clusterer       cluster.Node            // Cluster the process is a part of
+	TraceProvider   trace.TracerProvider    // Provider used to trace component evaluations
+	Clock           clock.Clock             // Source of time for managed components
+	SnapshotPath    string                  // Directory for exports snapshots; empty disables snapshots
+}
+
+// tracerName is the name of the tracer used for spans created by the
+// controller.
+const tracerName = "github.com/grafana/agent/pkg/flow"
+
+// tracer returns the tracer to use for spans created by the controller.
+func (g ComponentGlobals) tracer() trace.Tracer {
+	if g.TraceProvider == nil {
+		return trace.NewNoopTracerProvider().Tracer(tracerName)
+	}
+	return g.TraceProvider.Tracer(tracerName)
 }
 
 // ComponentNode is a controller node which manages a user-defined component.
@@ -70,6 +94,9 @@ type ComponentNode struct {
 	managedOpts     component.Options
 	exportsType     reflect.Type
 	onExportsChange func(cn *ComponentNode) // Informs controller that we changed our exports
+	tracer          trace.Tracer
+	log             log.Logger
+	snapshotPath    string // Path of the exports snapshot; empty if exports aren't snapshotted.
 
 	mut     sync.RWMutex
 	block   *hcl.Block          // Current HCL block to derive args from
@@ -86,8 +113,11 @@ type ComponentNode struct {
 	evalHealth component.Health // Health of the last evaluate
 	runHealth  component.Health // Health of running the component
 
-	exportsMut sync.RWMutex
-	exports    component.Exports // Evaluated exports for the managed component
+	exportsMut   sync.RWMutex
+	exports      component.Exports // Evaluated exports for the managed component
+	exportsStale bool              // True if exports were restored from a snapshot and not yet reported by the managed component
+
+	snapshotMut sync.Mutex // Serializes writes to the exports snapshot
 }
 
 var (
@@ -122,6 +152,8 @@ func NewComponentNode(globals ComponentGlobals, b *hcl.Block) *ComponentNode {
 		reg:             reg,
 		exportsType:     getExportsType(reg),
 		onExportsChange: globals.OnExportsChange,
+		tracer:          globals.tracer(),
+		log:             globals.Logger,
 
 		block: b,
 
@@ -134,9 +166,31 @@ func NewComponentNode(globals ComponentGlobals, b *hcl.Block) *ComponentNode {
 	}
 	cn.managedOpts = getManagedOptions(globals, cn)
 
+	if globals.SnapshotPath != "" && snapshotSupported(reg.Exports) {
+		cn.snapshotPath = snapshotFile(globals.SnapshotPath, nodeID)
+		cn.restoreExports()
+	}
+
 	return cn
 }
 
+// restoreExports seeds the exports of cn from its snapshot, if one exists.
+// Restored exports are marked as stale until the managed component reports
+// its own exports.
+func (cn *ComponentNode) restoreExports() {
+	exports, err := readExportsSnapshot(cn.snapshotPath, cn.exportsType)
+	switch {
+	case os.IsNotExist(err):
+		return
+	case err != nil:
+		level.Warn(cn.log).Log("msg", "failed to restore exports snapshot", "component", cn.nodeID, "err", err)
+		return
+	}
+
+	cn.exports = exports
+	cn.exportsStale = true
+}
+
 func getRegistration(id ComponentID) (component.Registration, bool) {
 	// id is the fully qualified name of the component, including the custom user
 	// identifier, if supported by the component. We don't know if the component
@@ -158,9 +212,21 @@ func getManagedOptions(globals ComponentGlobals, cn *ComponentNode) component.Op
 		Logger:        log.With(globals.Logger, "component", cn.nodeID),
 		DataPath:      filepath.Join(globals.DataPath, cn.nodeID),
 		OnStateChange: cn.setExports,
+
+		HTTPListenAddr: globals.HTTPListenAddr,
+		HTTPPath:       ComponentHTTPPath(cn.nodeID),
+
+		Clusterer: globals.Clusterer,
+		Clock:     globals.Clock,
 	}
 }
 
+// ComponentHTTPPath returns the base HTTP path used to route requests to the
+// component with the given node ID.
+func ComponentHTTPPath(nodeID string) string {
+	return "/component/" + nodeID + "/"
+}
+
 func getExportsType(reg component.Registration) reflect.Type {
 	if reg.Exports != nil {
 		return reflect.TypeOf(reg.Exports)
@@ -198,8 +264,15 @@ func (cn *ComponentNode) UpdateBlock(b *hcl.Block) {
 //
 // Evaluate will return an error if the HCL block cannot be evaluated or if
 // decoding to arguments fails.
-func (cn *ComponentNode) Evaluate(ectx *hcl.EvalContext) error {
-	err := cn.evaluate(ectx)
+//
+// A span tracing the evaluation is created as a child of any span in ctx.
+func (cn *ComponentNode) Evaluate(ctx context.Context, ectx *hcl.EvalContext) error {
+	ctx, span := cn.tracer.Start(ctx, "EvaluateComponent", trace.WithAttributes(
+		attribute.String("component_id", cn.nodeID),
+	))
+	defer span.End()
+
+	err := cn.evaluate(ctx, ectx)
 
 	switch err {
 	case nil:
@@ -207,12 +280,15 @@ func (cn *ComponentNode) Evaluate(ectx *hcl.EvalContext) error {
 	default:
 		msg := fmt.Sprintf("component evaluation failed: %s", err)
 		cn.setEvalHealth(component.HealthTypeUnhealthy, msg)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
 
 	return err
 }
 
-func (cn *ComponentNode) evaluate(ectx *hcl.EvalContext) error {
+func (cn *ComponentNode) evaluate(ctx context.Context, ectx *hcl.EvalContext) error {
 	cn.mut.Lock()
 	defer cn.mut.Unlock()
 
@@ -231,7 +307,11 @@ func (cn *ComponentNode) evaluate(ectx *hcl.EvalContext) error {
 
 	if cn.managed == nil {
 		// We haven't built the managed component successfully yet.
+		_, span := cn.tracer.Start(ctx, "BuildComponent", trace.WithAttributes(
+			attribute.String("component_id", cn.nodeID),
+		))
 		managed, err := cn.reg.Build(cn.managedOpts, argsCopy)
+		span.End()
 		if err != nil {
 			return fmt.Errorf("building component: %w", err)
 		}
@@ -249,7 +329,12 @@ func (cn *ComponentNode) evaluate(ectx *hcl.EvalContext) error {
 	}
 
 	// Update the existing managed component
-	if err := cn.managed.Update(argsCopy); err != nil {
+	_, span := cn.tracer.Start(ctx, "UpdateComponent", trace.WithAttributes(
+		attribute.String("component_id", cn.nodeID),
+	))
+	err := cn.managed.Update(argsCopy)
+	span.End()
+	if err != nil {
 		return fmt.Errorf("updating component: %w", err)
 	}
 
@@ -308,6 +393,14 @@ func (cn *ComponentNode) Exports() component.Exports {
 	return cn.exports
 }
 
+// ExportsStale returns true if the current exports were restored from a
+// snapshot and the managed component hasn't reported its own exports yet.
+func (cn *ComponentNode) ExportsStale() bool {
+	cn.exportsMut.RLock()
+	defer cn.exportsMut.RUnlock()
+	return cn.exportsStale
+}
+
 // setExports is called whenever the managed component updates. e must be the
 // same type as the registered exports type of the managed component.
 func (cn *ComponentNode) setExports(e component.Exports) {
@@ -332,8 +425,13 @@ func (cn *ComponentNode) setExports(e component.Exports) {
 		changed = true
 		cn.exports = e
 	}
+	cn.exportsStale = false
 	cn.exportsMut.Unlock()
 
+	if changed && cn.snapshotPath != "" {
+		cn.writeSnapshot()
+	}
+
 	if cn.doingEval.Load() {
 		// Optimization edge case: some components supply exports when they're
 		// being evaluated.
@@ -350,6 +448,18 @@ func (cn *ComponentNode) setExports(e component.Exports) {
 	}
 }
 
+// writeSnapshot writes the current exports to the exports snapshot.
+func (cn *ComponentNode) writeSnapshot() {
+	cn.snapshotMut.Lock()
+	defer cn.snapshotMut.Unlock()
+
+	// Exports are retrieved while holding snapshotMut so that concurrent
+	// calls always leave the latest exports on disk.
+	if err := writeExportsSnapshot(cn.snapshotPath, cn.Exports()); err != nil {
+		level.Warn(cn.log).Log("msg", "failed to write exports snapshot", "component", cn.nodeID, "err", err)
+	}
+}
+
 // CurrentHealth returns the current health of the ComponentNode.
 //
 // The health of a ComponentNode is tracked from three parts, in descending
@@ -401,6 +511,19 @@ func (cn *ComponentNode) DebugInfo() interface{} {
 	return nil
 }
 
+// HTTPHandler returns the HTTP handler of the managed component. ok is false
+// if the managed component hasn't been built or doesn't implement
+// component.HTTPComponent.
+func (cn *ComponentNode) HTTPHandler() (h http.Handler, ok bool) {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+
+	if hc, ok := cn.managed.(component.HTTPComponent); ok {
+		return hc.Handler(), true
+	}
+	return nil, false
+}
+
 // setEvalHealth sets the internal health from a call to Evaluate. See Health
 // for information on how overall health is calculated.
 func (cn *ComponentNode) setEvalHealth(t component.HealthType, msg string) {
@@ -414,6 +537,14 @@ func (cn *ComponentNode) setEvalHealth(t component.HealthType, msg string) {
 	}
 }
 
+// Running returns true if Run has been called for the managed component and
+// hasn't returned yet.
+func (cn *ComponentNode) Running() bool {
+	cn.healthMut.RLock()
+	defer cn.healthMut.RUnlock()
+	return cn.runHealth.Health == component.HealthTypeHealthy
+}
+
 // setRunHealth sets the internal health from a call to Run. See Health for
 // information on how overall health is calculated.
 func (cn *ComponentNode) setRunHealth(t component.HealthType, msg string) {
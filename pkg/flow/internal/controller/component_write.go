@@ -27,9 +27,13 @@ func WriteComponent(cn *ComponentNode, debugInfo bool) *hclwrite.Block {
 	// We ignore zero value exports since the zero values for fields don't get
 	// written back out to the user.
 	if exports := cn.Exports(); exports != nil && !exportsZeroValue(exports) {
+		comment := "// Exported fields:\n"
+		if cn.ExportsStale() {
+			comment = "// Exported fields (restored from snapshot; stale):\n"
+		}
 		b.Body().AppendUnstructuredTokens(hclwrite.Tokens{
 			{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
-			{Type: hclsyntax.TokenComment, Bytes: []byte("// Exported fields:\n")},
+			{Type: hclsyntax.TokenComment, Bytes: []byte(comment)},
 		})
 		gohcl.EncodeIntoBody(exports, b.Body())
 	}
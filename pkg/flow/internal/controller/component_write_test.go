@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -31,7 +32,7 @@ func TestWriteComponent(t *testing.T) {
 	}, blocks[0])
 
 	// Evaluate the component so we're sure it's built
-	err := cn.Evaluate(nil)
+	err := cn.Evaluate(context.Background(), nil)
 	require.NoError(t, err)
 
 	outBlock := WriteComponent(cn, false)
@@ -68,7 +69,7 @@ func TestWriteComponent_DebugInfo(t *testing.T) {
 	}, blocks[0])
 
 	// Evaluate the component so we're sure it's built
-	err := cn.Evaluate(nil)
+	err := cn.Evaluate(context.Background(), nil)
 	require.NoError(t, err)
 
 	outBlock := WriteComponent(cn, true)
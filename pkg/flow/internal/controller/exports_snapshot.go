@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/rfratto/gohcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// snapshotExt is the file extension of exports snapshots.
+const snapshotExt = ".hcl"
+
+// snapshotFile returns the path of the exports snapshot for the component
+// with the given node ID.
+func snapshotFile(dir, nodeID string) string {
+	return filepath.Join(dir, nodeID+snapshotExt)
+}
+
+// optionalSecretType is the Go type of OptionalSecret, the only capsule type
+// which can be snapshotted.
+var optionalSecretType = reflect.TypeOf(hcltypes.OptionalSecret{})
+
+// snapshotSupported returns true if exports can be snapshotted. Exports which
+// hold capsule values, such as receivers or secrets, can't be restored from
+// disk and are never snapshotted.
+//
+// OptionalSecret values are the exception: ones which don't hold a secret are
+// written as plain strings, while exports holding a secret at the time of a
+// write are skipped by writeExportsSnapshot.
+func snapshotSupported(exports component.Exports) bool {
+	if exports == nil {
+		return false
+	}
+	ty, err := gohcl.ImpliedType(exports)
+	if err != nil {
+		return false
+	}
+	return !containsUnsupportedCapsule(ty)
+}
+
+// containsUnsupportedCapsule is like gohcl.ContainsCapsule, but ignores
+// OptionalSecret capsules.
+func containsUnsupportedCapsule(ty cty.Type) bool {
+	switch {
+	case ty.IsCapsuleType():
+		return ty.EncapsulatedType() != optionalSecretType
+	case ty.IsCollectionType():
+		return containsUnsupportedCapsule(ty.ElementType())
+	case ty.IsObjectType():
+		for _, aty := range ty.AttributeTypes() {
+			if containsUnsupportedCapsule(aty) {
+				return true
+			}
+		}
+	case ty.IsTupleType():
+		for _, ety := range ty.TupleElementTypes() {
+			if containsUnsupportedCapsule(ety) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsSecret returns true if v holds an OptionalSecret marked as secret.
+func containsSecret(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil() && containsSecret(v.Elem())
+	case reflect.Struct:
+		if v.Type() == optionalSecretType {
+			return v.Interface().(hcltypes.OptionalSecret).IsSecret
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && containsSecret(v.Field(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if containsSecret(iter.Value()) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if containsSecret(v.Index(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeExportsSnapshot writes exports as HCL to path. The file is replaced
+// atomically so a crash never leaves a partially written snapshot behind.
+//
+// Secrets are never written to disk. If exports hold a secret, any existing
+// snapshot at path is removed instead, so a stale value isn't restored later.
+func writeExportsSnapshot(path string, exports component.Exports) error {
+	if containsSecret(reflect.ValueOf(exports)) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	f := hclwrite.NewEmptyFile()
+	gohcl.EncodeIntoBody(exports, f.Body())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, f.Bytes(), 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readExportsSnapshot reads a snapshot written by writeExportsSnapshot,
+// decoding it into a value of type ty.
+func readExportsSnapshot(path string, ty reflect.Type) (component.Exports, error) {
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(bb, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	exports := reflect.New(ty)
+	if diags := gohcl.DecodeBody(file.Body, nil, exports.Interface()); diags.HasErrors() {
+		return nil, diags
+	}
+	return exports.Elem().Interface(), nil
+}
+
+// pruneExportsSnapshots removes snapshots in dir for components which aren't
+// in keep.
+func pruneExportsSnapshots(dir string, keep []ComponentID) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keepSet := make(map[string]struct{}, len(keep))
+	for _, id := range keep {
+		keepSet[id.String()+snapshotExt] = struct{}{}
+	}
+
+	var firstErr error
+	for _, ent := range entries {
+		if ent.IsDir() || !strings.HasSuffix(ent.Name(), snapshotExt) {
+			continue
+		}
+		if _, ok := keepSet[ent.Name()]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, ent.Name())); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("removing snapshot %s: %w", ent.Name(), err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/metrics"
+	remote_http "github.com/grafana/agent/component/remote/http"
+	remote_vault "github.com/grafana/agent/component/remote/vault"
+	"github.com/grafana/agent/pkg/flow/hcltypes"
+	"github.com/grafana/agent/pkg/flow/internal/testcomponents"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportsSnapshot(t *testing.T) {
+	type targetsExports struct {
+		Targets []map[string]string `hcl:"targets,attr"`
+	}
+
+	tt := []struct {
+		name    string
+		exports interface{}
+	}{
+		{
+			name:    "string",
+			exports: testcomponents.PassthroughExports{Output: "hello, world!"},
+		},
+		{
+			name:    "time",
+			exports: testcomponents.TickExports{Time: time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "targets",
+			exports: targetsExports{Targets: []map[string]string{
+				{"__address__": "10.0.0.1:80", "job": "a"},
+				{"__address__": "10.0.0.2:80", "job": "a"},
+			}},
+		},
+		{
+			name: "remote.http",
+			exports: remote_http.Exports{
+				Content: &hcltypes.OptionalSecret{Value: "hello, world!"},
+			},
+		},
+		{
+			name: "remote.vault without secrets",
+			exports: remote_vault.Exports{Data: map[string]*hcltypes.OptionalSecret{
+				"username": {Value: "admin"},
+			}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "component.hcl")
+			require.NoError(t, writeExportsSnapshot(path, tc.exports))
+
+			actual, err := readExportsSnapshot(path, reflect.TypeOf(tc.exports))
+			require.NoError(t, err)
+			require.Equal(t, tc.exports, actual)
+		})
+	}
+}
+
+func TestExportsSnapshot_Unsupported(t *testing.T) {
+	type receiverExports struct {
+		Receiver *metrics.Receiver `hcl:"receiver"`
+	}
+	type secretExports struct {
+		Password hcltypes.Secret `hcl:"password,attr"`
+	}
+
+	require.True(t, snapshotSupported(testcomponents.PassthroughExports{}))
+	require.True(t, snapshotSupported(remote_http.Exports{}))
+	require.True(t, snapshotSupported(remote_vault.Exports{}))
+	require.False(t, snapshotSupported(nil))
+	require.False(t, snapshotSupported(receiverExports{}))
+	require.False(t, snapshotSupported(secretExports{}))
+}
+
+func TestExportsSnapshot_Secrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "component.hcl")
+
+	plain := remote_http.Exports{Content: &hcltypes.OptionalSecret{Value: "hello"}}
+	require.NoError(t, writeExportsSnapshot(path, plain))
+	require.FileExists(t, path)
+
+	// Exports holding a secret must never be written, and must remove the
+	// previous snapshot so a stale value isn't restored.
+	secret := remote_http.Exports{Content: &hcltypes.OptionalSecret{IsSecret: true, Value: "hunter2"}}
+	require.NoError(t, writeExportsSnapshot(path, secret))
+	require.NoFileExists(t, path)
+
+	data := remote_vault.Exports{Data: map[string]*hcltypes.OptionalSecret{
+		"username": {Value: "admin"},
+		"password": {IsSecret: true, Value: "hunter2"},
+	}}
+	require.NoError(t, writeExportsSnapshot(path, data))
+	require.NoFileExists(t, path)
+}
+
+func TestPruneExportsSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.b.keep.hcl", "a.b.remove.hcl", "unrelated.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0660))
+	}
+
+	require.NoError(t, pruneExportsSnapshots(dir, []ComponentID{{"a", "b", "keep"}}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, ent := range entries {
+		names = append(names, ent.Name())
+	}
+	require.Equal(t, []string{"a.b.keep.hcl", "unrelated.txt"}, names)
+
+	// A missing directory is not an error.
+	require.NoError(t, pruneExportsSnapshots(filepath.Join(dir, "missing"), nil))
+}
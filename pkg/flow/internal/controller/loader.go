@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/go-kit/log"
@@ -10,6 +12,9 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	_ "github.com/grafana/agent/pkg/flow/internal/testcomponents" // Include test components
 )
@@ -17,6 +22,7 @@ import (
 // The Loader builds and evaluates ComponentNodes from HCL blocks.
 type Loader struct {
 	log     log.Logger
+	tracer  trace.Tracer
 	globals ComponentGlobals
 
 	mut        sync.RWMutex
@@ -31,6 +37,7 @@ type Loader struct {
 func NewLoader(globals ComponentGlobals) *Loader {
 	return &Loader{
 		log:     globals.Logger,
+		tracer:  globals.tracer(),
 		globals: globals,
 
 		graph: &dag.Graph{},
@@ -49,14 +56,23 @@ func NewLoader(globals ComponentGlobals) *Loader {
 // The provided parentContext can be used to provide global variables and
 // functions to components. A child context will be constructed from the parent
 // to expose values of other components.
-func (l *Loader) Apply(parentContext *hcl.EvalContext, blocks hcl.Blocks) hcl.Diagnostics {
+//
+// A span tracing the load is created as a child of any span in ctx.
+func (l *Loader) Apply(ctx context.Context, parentContext *hcl.EvalContext, blocks hcl.Blocks) (diags hcl.Diagnostics) {
+	ctx, span := l.tracer.Start(ctx, "Apply", trace.WithAttributes(
+		attribute.Int("component_count", len(blocks)),
+	))
+	defer func() {
+		if diags.HasErrors() {
+			span.SetStatus(codes.Error, diags.Error())
+		}
+		span.End()
+	}()
+
 	l.mut.Lock()
 	defer l.mut.Unlock()
 
-	var (
-		diags    hcl.Diagnostics
-		newGraph dag.Graph
-	)
+	var newGraph dag.Graph
 
 	populateDiags := l.populateGraph(&newGraph, blocks)
 	diags = diags.Extend(populateDiags)
@@ -86,10 +102,15 @@ func (l *Loader) Apply(parentContext *hcl.EvalContext, blocks hcl.Blocks) hcl.Di
 		components = append(components, c)
 		componentIDs = append(componentIDs, c.ID())
 
+		span.AddEvent("evaluating component", trace.WithAttributes(
+			attribute.String("component_id", c.NodeID()),
+			attribute.StringSlice("dependencies", nodeIDs(newGraph.Dependencies(c))),
+		))
+
 		// We cache both arguments and exports during an initial load in case the
 		// component is new; we want to make sure that all fields are available
 		// before the component updates its exports for the first time.
-		if err := l.evaluate(parentContext, n.(*ComponentNode), true, true); err != nil {
+		if err := l.evaluate(ctx, parentContext, c, true, true); err != nil {
 			diags = diags.Append(&hcl.Diagnostic{
 				Severity: hcl.DiagError,
 				Summary:  "Failed to build component",
@@ -104,6 +125,12 @@ func (l *Loader) Apply(parentContext *hcl.EvalContext, blocks hcl.Blocks) hcl.Di
 	l.graph = &newGraph
 	l.cache.SyncIDs(componentIDs)
 	l.blocks = blocks
+
+	if l.globals.SnapshotPath != "" {
+		if err := pruneExportsSnapshots(l.globals.SnapshotPath, componentIDs); err != nil {
+			level.Warn(l.log).Log("msg", "failed to remove exports snapshots of deleted components", "err", err)
+		}
+	}
 	return diags
 }
 
@@ -203,13 +230,28 @@ func (l *Loader) WriteBlocks(debugInfo bool) []*hclwrite.Block {
 // The provided parentContext can be used to provide global variables and
 // functions to components. A child context will be constructed from the parent
 // to expose values of other components.
-func (l *Loader) EvaluateDependencies(parentContext *hcl.EvalContext, c *ComponentNode) {
+//
+// A span tracing the evaluations is created as a child of any span in ctx.
+// The span records the chain of dependencies which caused each component to
+// be re-evaluated.
+func (l *Loader) EvaluateDependencies(ctx context.Context, parentContext *hcl.EvalContext, c *ComponentNode) {
+	ctx, span := l.tracer.Start(ctx, "EvaluateDependencies", trace.WithAttributes(
+		attribute.String("originator_id", c.NodeID()),
+	))
+	defer span.End()
+
 	l.mut.RLock()
 	defer l.mut.RUnlock()
 
 	// Make sure we're in-sync with the current exports of c.
 	l.cache.CacheExports(c.ID(), c.Exports())
 
+	var (
+		// chains holds the chain of component IDs from c to every visited node.
+		chains    = map[dag.Node][]string{c: {c.NodeID()}}
+		evaluated []string
+	)
+
 	_ = dag.WalkReverse(l.graph, []dag.Node{c}, func(n dag.Node) error {
 		if n == c {
 			// Skip over the starting component; the starting component passed to
@@ -217,16 +259,34 @@ func (l *Loader) EvaluateDependencies(parentContext *hcl.EvalContext, c *Compone
 			// arguments will need re-evaluation.
 			return nil
 		}
-		_ = l.evaluate(parentContext, n.(*ComponentNode), true, false)
+
+		// n was reached through at least one of its dependencies which has
+		// already been visited.
+		for _, dep := range l.graph.Dependencies(n) {
+			if chain, ok := chains[dep]; ok {
+				chains[n] = append(append([]string{}, chain...), n.NodeID())
+				break
+			}
+		}
+
+		span.AddEvent("evaluating component", trace.WithAttributes(
+			attribute.String("component_id", n.NodeID()),
+			attribute.StringSlice("dependency_chain", chains[n]),
+		))
+		evaluated = append(evaluated, n.NodeID())
+
+		_ = l.evaluate(ctx, parentContext, n.(*ComponentNode), true, false)
 		return nil
 	})
+
+	span.SetAttributes(attribute.StringSlice("evaluated_ids", evaluated))
 }
 
 // evaluate constructs the final context for c and evalutes it. mut must be
 // held when calling evaluate.
-func (l *Loader) evaluate(parent *hcl.EvalContext, c *ComponentNode, cacheArgs, cacheExports bool) error {
+func (l *Loader) evaluate(ctx context.Context, parent *hcl.EvalContext, c *ComponentNode, cacheArgs, cacheExports bool) error {
 	ectx := l.cache.BuildContext(parent)
-	if err := c.Evaluate(ectx); err != nil {
+	if err := c.Evaluate(ctx, ectx); err != nil {
 		level.Error(l.log).Log("msg", "failed to evaluate component", "component", c.NodeID(), "err", err)
 		return err
 	}
@@ -239,6 +299,16 @@ func (l *Loader) evaluate(parent *hcl.EvalContext, c *ComponentNode, cacheArgs,
 	return nil
 }
 
+// nodeIDs returns the sorted IDs of nodes.
+func nodeIDs(nodes []dag.Node) []string {
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.NodeID())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func multierrToDiags(errors error) hcl.Diagnostics {
 	var diags hcl.Diagnostics
 	for _, err := range errors.(*multierror.Error).Errors {
@@ -1,15 +1,22 @@
 package controller_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
 	"github.com/grafana/agent/pkg/flow/internal/dag"
+	"github.com/grafana/agent/pkg/flow/internal/testcomponents"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/stretchr/testify/require"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestLoader(t *testing.T) {
@@ -136,6 +143,100 @@ func TestLoader(t *testing.T) {
 		diags := applyFromContent(t, l, []byte(invalidFile))
 		require.True(t, diags.HasErrors())
 	})
+
+	t.Run("Exports are restored from snapshots", func(t *testing.T) {
+		snapshotGlobals := globals
+		snapshotGlobals.SnapshotPath = t.TempDir()
+
+		writeSnapshot := func(nodeID, content string) {
+			path := filepath.Join(snapshotGlobals.SnapshotPath, nodeID+".hcl")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0660))
+		}
+		writeSnapshot("testcomponents.tick.ticker", `tick_time = "2022-07-01T12:00:00Z"`)
+		writeSnapshot("testcomponents.tick.deleted", `tick_time = "2022-07-01T12:00:00Z"`)
+
+		l := controller.NewLoader(snapshotGlobals)
+		diags := applyFromContent(t, l, []byte(testFile))
+		require.False(t, diags.HasErrors())
+
+		// The ticker doesn't export anything until it runs, so its exports are
+		// the ones from the snapshot and are used by downstream components.
+		ticker := l.Graph().GetByID("testcomponents.tick.ticker").(*controller.ComponentNode)
+		require.Equal(t, testcomponents.TickExports{
+			Time: time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC),
+		}, ticker.Exports())
+		require.True(t, ticker.ExportsStale())
+
+		forwarded := l.Graph().GetByID("testcomponents.passthrough.forwarded").(*controller.ComponentNode)
+		require.Equal(t, "2022-07-01T12:00:00Z", forwarded.Arguments().(testcomponents.PassthroughConfig).Input)
+		require.False(t, forwarded.ExportsStale())
+
+		// Components which reported exports have their exports written, and
+		// snapshots of deleted components are removed.
+		require.FileExists(t, filepath.Join(snapshotGlobals.SnapshotPath, "testcomponents.passthrough.forwarded.hcl"))
+		require.NoFileExists(t, filepath.Join(snapshotGlobals.SnapshotPath, "testcomponents.tick.deleted.hcl"))
+	})
+
+	t.Run("Evaluations are traced", func(t *testing.T) {
+		rec := tracetest.NewSpanRecorder()
+
+		tracedGlobals := globals
+		tracedGlobals.TraceProvider = tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(rec))
+
+		l := controller.NewLoader(tracedGlobals)
+		diags := applyFromContent(t, l, []byte(testFile))
+		require.False(t, diags.HasErrors())
+
+		ticker := l.Graph().GetByID("testcomponents.tick.ticker").(*controller.ComponentNode)
+		l.EvaluateDependencies(context.Background(), nil, ticker)
+
+		var (
+			spanCounts = make(map[string]int)
+			chains     = make(map[string][]string)
+		)
+		for _, span := range rec.Ended() {
+			spanCounts[span.Name()]++
+
+			if span.Name() != "EvaluateDependencies" {
+				continue
+			}
+			for _, ev := range span.Events() {
+				var (
+					id    string
+					chain []string
+				)
+				for _, attr := range ev.Attributes {
+					switch attr.Key {
+					case "component_id":
+						id = attr.Value.AsString()
+					case "dependency_chain":
+						chain = attr.Value.AsStringSlice()
+					}
+				}
+				chains[id] = chain
+			}
+		}
+
+		require.Equal(t, map[string]int{
+			"Apply":                1,
+			"BuildComponent":       4,
+			"EvaluateDependencies": 1,
+			"EvaluateComponent":    6, // 4 from Apply, 2 from EvaluateDependencies
+			"UpdateComponent":      2,
+		}, spanCounts)
+
+		require.Equal(t, map[string][]string{
+			"testcomponents.passthrough.ticker": {
+				"testcomponents.tick.ticker",
+				"testcomponents.passthrough.ticker",
+			},
+			"testcomponents.passthrough.forwarded": {
+				"testcomponents.tick.ticker",
+				"testcomponents.passthrough.ticker",
+				"testcomponents.passthrough.forwarded",
+			},
+		}, chains)
+	})
 }
 
 func applyFromContent(t *testing.T, l *controller.Loader, bb []byte) hcl.Diagnostics {
@@ -153,7 +254,7 @@ func applyFromContent(t *testing.T, l *controller.Loader, bb []byte) hcl.Diagnos
 		return diags
 	}
 
-	applyDiags := l.Apply(nil, content.Blocks)
+	applyDiags := l.Apply(context.Background(), nil, content.Blocks)
 	diags = diags.Extend(applyDiags)
 
 	return diags
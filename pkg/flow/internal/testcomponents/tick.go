@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/component"
@@ -36,8 +37,9 @@ type TickExports struct {
 // Tick implements the testcomponents.tick component, where the wallclock time
 // will be emitted on a given frequency.
 type Tick struct {
-	opts component.Options
-	log  log.Logger
+	opts  component.Options
+	log   log.Logger
+	clock clock.Clock
 
 	cfgMut sync.Mutex
 	cfg    TickConfig
@@ -45,7 +47,12 @@ type Tick struct {
 
 // NewTick creates a new testcomponents.tick component.
 func NewTick(o component.Options, cfg TickConfig) (*Tick, error) {
-	t := &Tick{opts: o, log: o.Logger}
+	clk := o.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	t := &Tick{opts: o, log: o.Logger, clock: clk}
 	if err := t.Update(cfg); err != nil {
 		return nil, err
 	}
@@ -62,9 +69,9 @@ func (t *Tick) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.After(t.getNextTick()):
+		case <-t.clock.After(t.getNextTick()):
 			level.Info(t.log).Log("msg", "ticked")
-			t.opts.OnStateChange(TickExports{Time: time.Now()})
+			t.opts.OnStateChange(TickExports{Time: t.clock.Now()})
 		}
 	}
 }
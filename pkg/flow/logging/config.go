@@ -14,9 +14,18 @@ type Options struct {
 	Level  Level  `hcl:"level,optional"`
 	Format Format `hcl:"format,optional"`
 
+	// Components overrides the log level for individual components.
+	Components []ComponentOptions `hcl:"component,block"`
+
 	// TODO: log sink parameter (e.g., to use the Windows Event logger)
 }
 
+// ComponentOptions overrides logging options for a single component.
+type ComponentOptions struct {
+	ID    string `hcl:"id,label"`
+	Level Level  `hcl:"level,attr"`
+}
+
 // DefaultOptions holds defaults for creating a Logger.
 var DefaultOptions = Options{
 	Level:  LevelDefault,
@@ -30,7 +39,22 @@ func (o *Options) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
 	*o = DefaultOptions
 
 	type options Options
-	return gohcl.DecodeBody(body, ctx, (*options)(o))
+	if err := gohcl.DecodeBody(body, ctx, (*options)(o)); err != nil {
+		return err
+	}
+	return o.Validate()
+}
+
+// Validate returns an error if o is invalid.
+func (o *Options) Validate() error {
+	seen := make(map[string]struct{}, len(o.Components))
+	for _, c := range o.Components {
+		if _, exists := seen[c.ID]; exists {
+			return fmt.Errorf("log level for component %q set more than once", c.ID)
+		}
+		seen[c.ID] = struct{}{}
+	}
+	return nil
 }
 
 // Level represents how verbose logging should be.
@@ -69,6 +93,27 @@ func (ll *Level) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Enabled returns true if a log line with level other should be logged when
+// ll is the configured level. Log lines without a level are always enabled.
+func (ll Level) Enabled(other Level) bool {
+	return other == "" || other.rank() >= ll.rank()
+}
+
+func (ll Level) rank() int {
+	switch ll {
+	case LevelDebug:
+		return 0
+	case LevelInfo:
+		return 1
+	case LevelWarn:
+		return 2
+	case LevelError:
+		return 3
+	default:
+		return 0
+	}
+}
+
 // Filter returns a go-kit logging filter from the level.
 func (ll Level) Filter() level.Option {
 	switch ll {
@@ -1,67 +1,304 @@
 package logging
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 )
 
+// BufferSize is the number of recent log lines kept for each component.
+const BufferSize = 1000
+
+// componentKey is the log key which holds the ID of the component which
+// emitted a log line.
+const componentKey = "component"
+
 // Logger implements the github.com/go-kit/log.Logger interface. It supports
 // being dynamically updated at runtime.
+//
+// Logger keeps a bounded buffer of the most recent lines logged by each
+// component, identified by the "component" key in log lines. Recent lines can
+// be retrieved with Entries, and new lines can be followed with Subscribe.
 type Logger struct {
 	w io.Writer
 
-	mut sync.RWMutex
-	l   log.Logger
+	mut       sync.RWMutex
+	opts      Options
+	overrides map[string]Level // Per-component log levels.
+
+	writeMut sync.Mutex // Serializes writes to w.
+
+	buffersMut  sync.Mutex
+	buffers     map[string]*ringBuffer
+	subscribers map[string]map[*subscriber]struct{}
+	lastSeq     uint64 // Sequence number of the most recently recorded entry.
+}
+
+// Entry is a log line emitted by a component.
+type Entry struct {
+	// Seq increases monotonically for every recorded entry, allowing entries
+	// to be told apart even when they share a timestamp.
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"ts"`
+	Component string    `json:"component"`
+	Level     Level     `json:"level,omitempty"`
+	Line      string    `json:"line"` // Line formatted using the logger's format.
 }
 
 // New creates a New logger with the default log level and format.
 func New(w io.Writer, o Options) (*Logger, error) {
-	inner, err := buildLogger(w, o)
-	if err != nil {
+	l := &Logger{
+		w: w,
+
+		buffers:     make(map[string]*ringBuffer),
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+	if err := l.Update(o); err != nil {
 		return nil, err
 	}
-
-	return &Logger{w: w, l: inner}, nil
+	return l, nil
 }
 
 // Log implements log.Logger.
 func (l *Logger) Log(kvps ...interface{}) error {
+	var (
+		now       = time.Now().UTC()
+		component = lookupString(kvps, componentKey)
+		lvl       = lookupLevel(kvps)
+	)
+
 	l.mut.RLock()
-	defer l.mut.RUnlock()
-	return l.l.Log(kvps...)
+	var (
+		format   = l.opts.Format
+		minLevel = l.opts.Level
+	)
+	if override, ok := l.overrides[component]; ok {
+		minLevel = override
+	}
+	l.mut.RUnlock()
+
+	if !minLevel.Enabled(lvl) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	lineKVs := append([]interface{}{"ts", now.Format(time.RFC3339Nano)}, kvps...)
+	if err := newFormatLogger(&buf, format).Log(lineKVs...); err != nil {
+		return err
+	}
+
+	if component != "" {
+		l.record(Entry{
+			Time:      now,
+			Component: component,
+			Level:     lvl,
+			Line:      string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))),
+		})
+	}
+
+	l.writeMut.Lock()
+	defer l.writeMut.Unlock()
+	_, err := l.w.Write(buf.Bytes())
+	return err
 }
 
 // Update re-configures the options used for the logger.
 func (l *Logger) Update(o Options) error {
-	newLogger, err := buildLogger(l.w, o)
-	if err != nil {
+	switch o.Format {
+	case FormatLogfmt, FormatJSON:
+	default:
+		return fmt.Errorf("unrecognized log format %q", o.Format)
+	}
+	if err := o.Validate(); err != nil {
 		return err
 	}
 
+	overrides := make(map[string]Level, len(o.Components))
+	for _, c := range o.Components {
+		overrides[c.ID] = c.Level
+	}
+
 	l.mut.Lock()
 	defer l.mut.Unlock()
-	l.l = newLogger
+	l.opts = o
+	l.overrides = overrides
 	return nil
 }
 
-func buildLogger(w io.Writer, o Options) (log.Logger, error) {
-	var l log.Logger
+// Entries returns the buffered log lines for a component at or above
+// minLevel, oldest first.
+func (l *Logger) Entries(component string, minLevel Level) []Entry {
+	l.buffersMut.Lock()
+	defer l.buffersMut.Unlock()
 
-	switch o.Format {
-	case FormatLogfmt:
-		l = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	rb, ok := l.buffers[component]
+	if !ok {
+		return nil
+	}
+
+	var res []Entry
+	rb.Each(func(e Entry) {
+		if minLevel.Enabled(e.Level) {
+			res = append(res, e)
+		}
+	})
+	return res
+}
+
+// Subscribe returns a channel which receives new log lines for a component
+// as they are logged. The returned function must be called to stop the
+// subscription.
+//
+// Lines are dropped if the channel isn't read from quickly enough. The channel
+// is closed if the component is removed by Prune.
+func (l *Logger) Subscribe(component string) (<-chan Entry, func()) {
+	sub := &subscriber{ch: make(chan Entry, 100)}
+
+	l.buffersMut.Lock()
+	defer l.buffersMut.Unlock()
+
+	subs, ok := l.subscribers[component]
+	if !ok {
+		subs = make(map[*subscriber]struct{})
+		l.subscribers[component] = subs
+	}
+	subs[sub] = struct{}{}
+
+	return sub.ch, func() {
+		l.buffersMut.Lock()
+		defer l.buffersMut.Unlock()
+
+		subs, ok := l.subscribers[component]
+		if !ok {
+			return
+		}
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(l.subscribers, component)
+		}
+	}
+}
+
+// Prune removes the buffered lines and subscriptions of every component which
+// isn't in keep. It should be called whenever components are removed so their
+// lines aren't kept around forever.
+func (l *Logger) Prune(keep []string) {
+	keepSet := make(map[string]struct{}, len(keep))
+	for _, component := range keep {
+		keepSet[component] = struct{}{}
+	}
+
+	l.buffersMut.Lock()
+	defer l.buffersMut.Unlock()
+
+	for component := range l.buffers {
+		if _, ok := keepSet[component]; !ok {
+			delete(l.buffers, component)
+		}
+	}
+	for component, subs := range l.subscribers {
+		if _, ok := keepSet[component]; ok {
+			continue
+		}
+		for sub := range subs {
+			close(sub.ch)
+		}
+		delete(l.subscribers, component)
+	}
+}
+
+func (l *Logger) record(e Entry) {
+	l.buffersMut.Lock()
+	defer l.buffersMut.Unlock()
+
+	rb, ok := l.buffers[e.Component]
+	if !ok {
+		rb = newRingBuffer(BufferSize)
+		l.buffers[e.Component] = rb
+	}
+	l.lastSeq++
+	e.Seq = l.lastSeq
+	rb.Add(e)
+
+	for sub := range l.subscribers[e.Component] {
+		select {
+		case sub.ch <- e:
+		default:
+			// Subscriber isn't keeping up; drop the line.
+		}
+	}
+}
+
+func newFormatLogger(w io.Writer, f Format) log.Logger {
+	switch f {
 	case FormatJSON:
-		l = log.NewJSONLogger(log.NewSyncWriter(w))
+		return log.NewJSONLogger(w)
 	default:
-		return nil, fmt.Errorf("unrecognized log format %q", o.Format)
+		return log.NewLogfmtLogger(w)
+	}
+}
+
+// lookupString returns the value of key in kvps as a string.
+func lookupString(kvps []interface{}, key string) string {
+	for i := 0; i+1 < len(kvps); i += 2 {
+		if k, ok := kvps[i].(string); ok && k == key {
+			return fmt.Sprint(kvps[i+1])
+		}
 	}
+	return ""
+}
 
-	l = level.NewFilter(l, o.Level.Filter())
+// lookupLevel returns the level of a log line, or an empty level if the line
+// doesn't have one.
+func lookupLevel(kvps []interface{}) Level {
+	for i := 0; i+1 < len(kvps); i += 2 {
+		if kvps[i] != level.Key() {
+			continue
+		}
+		if v, ok := kvps[i+1].(level.Value); ok {
+			return Level(v.String())
+		}
+	}
+	return ""
+}
 
-	l = log.With(l, "ts", log.DefaultTimestampUTC)
-	return l, nil
+type subscriber struct {
+	ch chan Entry
+}
+
+// ringBuffer holds the most recent entries up to a fixed size.
+type ringBuffer struct {
+	entries []Entry
+	next    int // Index of the next entry to write.
+	full    bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{entries: make([]Entry, size)}
+}
+
+// Add adds an entry, replacing the oldest entry if the buffer is full.
+func (rb *ringBuffer) Add(e Entry) {
+	rb.entries[rb.next] = e
+	rb.next = (rb.next + 1) % len(rb.entries)
+	if rb.next == 0 {
+		rb.full = true
+	}
+}
+
+// Each calls fn for each entry, oldest first.
+func (rb *ringBuffer) Each(fn func(e Entry)) {
+	if rb.full {
+		for _, e := range rb.entries[rb.next:] {
+			fn(e)
+		}
+	}
+	for _, e := range rb.entries[:rb.next] {
+		fn(e)
+	}
 }
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_ComponentOverrides(t *testing.T) {
+	var buf bytes.Buffer
+
+	opts := DefaultOptions
+	opts.Components = []ComponentOptions{{ID: "metrics.scrape.noisy", Level: LevelDebug}}
+	l, err := New(&buf, opts)
+	require.NoError(t, err)
+
+	var (
+		noisy = log.With(l, "component", "metrics.scrape.noisy")
+		quiet = log.With(l, "component", "metrics.scrape.quiet")
+	)
+	level.Debug(noisy).Log("msg", "noisy debug")
+	level.Debug(quiet).Log("msg", "quiet debug")
+	level.Info(quiet).Log("msg", "quiet info")
+
+	out := buf.String()
+	require.Contains(t, out, `msg="noisy debug"`)
+	require.NotContains(t, out, `msg="quiet debug"`)
+	require.Contains(t, out, `msg="quiet info"`)
+	require.True(t, strings.HasPrefix(out, "ts="), "lines should start with a timestamp")
+
+	// Removing the override should apply the global level again.
+	require.NoError(t, l.Update(DefaultOptions))
+	buf.Reset()
+	level.Debug(noisy).Log("msg", "noisy debug")
+	require.Empty(t, buf.String())
+}
+
+func TestLogger_Entries(t *testing.T) {
+	opts := DefaultOptions
+	opts.Level = LevelDebug
+	l, err := New(&bytes.Buffer{}, opts)
+	require.NoError(t, err)
+
+	cl := log.With(l, "component", "example")
+	for i := 0; i < BufferSize+10; i++ {
+		level.Debug(cl).Log("msg", "debug", "i", i)
+	}
+	level.Warn(cl).Log("msg", "warning")
+	level.Info(l).Log("msg", "not from a component")
+
+	entries := l.Entries("example", LevelDebug)
+	require.Len(t, entries, BufferSize)
+	require.Contains(t, entries[0].Line, "i=11", "oldest lines should be evicted first")
+	require.Contains(t, entries[len(entries)-1].Line, `msg=warning`)
+
+	entries = l.Entries("example", LevelWarn)
+	require.Len(t, entries, 1)
+	require.Equal(t, LevelWarn, entries[0].Level)
+	require.Equal(t, "example", entries[0].Component)
+
+	require.Empty(t, l.Entries("missing", LevelDebug))
+}
+
+func TestLogger_Subscribe(t *testing.T) {
+	l, err := New(&bytes.Buffer{}, DefaultOptions)
+	require.NoError(t, err)
+
+	ch, unsubscribe := l.Subscribe("example")
+	level.Info(log.With(l, "component", "example")).Log("msg", "hello")
+	level.Info(log.With(l, "component", "other")).Log("msg", "ignored")
+
+	e := <-ch
+	require.Contains(t, e.Line, "msg=hello")
+	require.Len(t, ch, 0)
+
+	// Entries are numbered in the order they're recorded, even if they share
+	// a timestamp.
+	level.Info(log.With(l, "component", "example")).Log("msg", "world")
+	next := <-ch
+	require.Greater(t, next.Seq, e.Seq)
+
+	unsubscribe()
+	level.Info(log.With(l, "component", "example")).Log("msg", "after unsubscribe")
+	require.Len(t, ch, 0)
+}
+
+func TestLogger_Prune(t *testing.T) {
+	l, err := New(&bytes.Buffer{}, DefaultOptions)
+	require.NoError(t, err)
+
+	removedCh, _ := l.Subscribe("removed")
+	keptCh, unsubscribe := l.Subscribe("kept")
+	level.Info(log.With(l, "component", "removed")).Log("msg", "hello")
+	level.Info(log.With(l, "component", "kept")).Log("msg", "hello")
+	<-removedCh
+	<-keptCh
+
+	l.Prune([]string{"kept"})
+	require.Empty(t, l.Entries("removed", LevelDebug))
+	require.Len(t, l.Entries("kept", LevelDebug), 1)
+	require.NotContains(t, l.buffers, "removed")
+	require.NotContains(t, l.subscribers, "removed")
+
+	// Subscriptions of removed components are closed.
+	_, ok := <-removedCh
+	require.False(t, ok)
+
+	// Unsubscribing removes the component's subscriber set once it's empty.
+	unsubscribe()
+	require.NotContains(t, l.subscribers, "kept")
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rfratto/gohcl"
+)
+
+// Options is a set of options used to construct and configure a Tracer.
+type Options struct {
+	// Endpoint is the address of an OTLP gRPC endpoint to send spans to. Spans
+	// are not recorded when Endpoint is empty.
+	Endpoint string `hcl:"endpoint,optional"`
+	// Insecure disables TLS when connecting to Endpoint.
+	Insecure bool `hcl:"insecure,optional"`
+	// Headers to send with every export request.
+	Headers map[string]string `hcl:"headers,optional"`
+	// SamplingFraction is the fraction of traces to record, from 0 to 1.
+	SamplingFraction float64 `hcl:"sampling_fraction,optional"`
+}
+
+// DefaultOptions holds defaults for creating a Tracer.
+var DefaultOptions = Options{
+	SamplingFraction: 0.1,
+}
+
+var _ gohcl.Decoder = (*Options)(nil)
+
+// DecodeHCL implements gohcl.Decoder.
+func (o *Options) DecodeHCL(body hcl.Body, ctx *hcl.EvalContext) error {
+	*o = DefaultOptions
+
+	type options Options
+	if err := gohcl.DecodeBody(body, ctx, (*options)(o)); err != nil {
+		return err
+	}
+	return o.Validate()
+}
+
+// Validate returns an error if o is invalid.
+func (o *Options) Validate() error {
+	if o.SamplingFraction < 0 || o.SamplingFraction > 1 {
+		return fmt.Errorf("sampling_fraction must be between 0 and 1, got %v", o.SamplingFraction)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package tracing implements the tracer used by the Flow controller to trace
+// component evaluations.
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/agent/pkg/build"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName is the service name attached to all spans.
+const serviceName = "grafana-agent-flow"
+
+// Tracer implements the trace.TracerProvider interface. It supports being
+// dynamically updated at runtime; tracers retrieved from a Tracer always use
+// the most recent options.
+type Tracer struct {
+	mut sync.RWMutex
+	tp  trace.TracerProvider
+	sdk *tracesdk.TracerProvider // nil when tracing is disabled.
+}
+
+var _ trace.TracerProvider = (*Tracer)(nil)
+
+// New creates a new Tracer with the provided options.
+func New(o Options) (*Tracer, error) {
+	t := &Tracer{tp: trace.NewNoopTracerProvider()}
+	if err := t.Update(o); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Tracer implements trace.TracerProvider.
+func (t *Tracer) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return &tracer{parent: t, name: name, options: options}
+}
+
+// Update re-configures the options used for the tracer. Spans which were
+// started before calling Update are exported using the old options.
+func (t *Tracer) Update(o Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	var (
+		newTP  trace.TracerProvider = trace.NewNoopTracerProvider()
+		newSDK *tracesdk.TracerProvider
+	)
+	if o.Endpoint != "" {
+		var err error
+		newSDK, err = buildProvider(o)
+		if err != nil {
+			return err
+		}
+		newTP = newSDK
+	}
+
+	t.mut.Lock()
+	oldSDK := t.sdk
+	t.tp, t.sdk = newTP, newSDK
+	t.mut.Unlock()
+
+	if oldSDK != nil {
+		// Flush the old provider in the background so Update doesn't block on
+		// a slow or unreachable endpoint.
+		go func() { _ = oldSDK.Shutdown(context.Background()) }()
+	}
+	return nil
+}
+
+// Shutdown flushes any pending spans and stops the Tracer.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.tp = trace.NewNoopTracerProvider()
+	if t.sdk == nil {
+		return nil
+	}
+	err := t.sdk.Shutdown(ctx)
+	t.sdk = nil
+	return err
+}
+
+func (t *Tracer) provider() trace.TracerProvider {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	return t.tp
+}
+
+func buildProvider(o Options) (*tracesdk.TracerProvider, error) {
+	clientOpts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(o.Endpoint),
+		otlptracegrpc.WithHeaders(o.Headers),
+	}
+	if o.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+
+	// The exporter connects lazily, so building it never blocks on the
+	// endpoint being reachable.
+	exporter, err := otlptracegrpc.New(context.Background(), clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(build.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return tracesdk.NewTracerProvider(
+		tracesdk.WithBatcher(exporter),
+		tracesdk.WithResource(res),
+		tracesdk.WithSampler(tracesdk.ParentBased(tracesdk.TraceIDRatioBased(o.SamplingFraction))),
+	), nil
+}
+
+// tracer implements trace.Tracer by delegating to the current provider of
+// its parent Tracer.
+type tracer struct {
+	parent  *Tracer
+	name    string
+	options []trace.TracerOption
+}
+
+func (t *tracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return t.parent.provider().Tracer(t.name, t.options...).Start(ctx, spanName, opts...)
+}
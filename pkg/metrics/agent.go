@@ -12,10 +12,13 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 
+	agentcluster "github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/metrics/cluster"
 	"github.com/grafana/agent/pkg/metrics/cluster/client"
 	"github.com/grafana/agent/pkg/metrics/instance"
@@ -32,6 +35,7 @@ var DefaultConfig = Config{
 	ServiceConfig:          cluster.DefaultConfig,
 	ServiceClientConfig:    client.DefaultConfig,
 	InstanceMode:           instance.DefaultMode,
+	ClusterConfig:          agentcluster.DefaultGossipConfig,
 }
 
 // Config defines the configuration for the entire set of Prometheus client
@@ -47,6 +51,11 @@ type Config struct {
 	InstanceRestartBackoff time.Duration         `yaml:"instance_restart_backoff,omitempty"`
 	InstanceMode           instance.Mode         `yaml:"instance_mode,omitempty"`
 
+	// Flag-only fields used to join other agents in a cluster, which instances
+	// with cluster_sharding enabled split their targets between.
+	ClusterEnabled bool                      `yaml:"-"`
+	ClusterConfig  agentcluster.GossipConfig `yaml:"-"`
+
 	// Unmarshaled is true when the Config was unmarshaled from YAML.
 	Unmarshaled bool `yaml:"-"`
 }
@@ -90,6 +99,9 @@ func (c *Config) ApplyDefaults() error {
 
 			return fmt.Errorf("error validating instance %s: %w", name, err)
 		}
+		if c.Configs[i].ClusterSharding && !c.ClusterEnabled {
+			return fmt.Errorf("error validating instance %s: %w", name, errClusterDisabled)
+		}
 
 		if _, ok := usedNames[name]; ok {
 			return fmt.Errorf(
@@ -103,6 +115,10 @@ func (c *Config) ApplyDefaults() error {
 	return nil
 }
 
+// errClusterDisabled is returned when an instance config enables
+// cluster_sharding while the agent isn't part of a cluster.
+var errClusterDisabled = errors.New("cluster_sharding requires the -metrics.cluster.enabled flag to be set")
+
 // RegisterFlags defines flags corresponding to the Config.
 func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	c.RegisterFlagsWithPrefix("metrics.", f)
@@ -115,6 +131,12 @@ func (c *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	f.DurationVar(&c.WALCleanupPeriod, prefix+"wal-cleanup-period", DefaultConfig.WALCleanupPeriod, "how often to check for abandoned WALs")
 	f.DurationVar(&c.InstanceRestartBackoff, prefix+"instance-restart-backoff", DefaultConfig.InstanceRestartBackoff, "how long to wait before restarting a failed Prometheus instance")
 
+	f.BoolVar(&c.ClusterEnabled, prefix+"cluster.enabled", DefaultConfig.ClusterEnabled, "join other agents in a cluster to split the targets of instances with cluster_sharding enabled")
+	f.StringVar(&c.ClusterConfig.NodeName, prefix+"cluster.node-name", DefaultConfig.ClusterConfig.NodeName, "name of the node within the cluster; defaults to the hostname")
+	f.StringVar(&c.ClusterConfig.AdvertiseAddr, prefix+"cluster.advertise-address", DefaultConfig.ClusterConfig.AdvertiseAddr, "address other nodes use to connect to this node; defaults to an address of the node with the gRPC listen port")
+	f.Var((*flagext.StringSliceCSV)(&c.ClusterConfig.JoinPeers), prefix+"cluster.join-addresses", "comma-separated list of addresses of nodes to join the cluster at")
+	f.StringVar(&c.ClusterConfig.DiscoverPeers, prefix+"cluster.discover-peers", DefaultConfig.ClusterConfig.DiscoverPeers, "go-discover configuration used to find nodes to join the cluster at")
+
 	c.ServiceConfig.RegisterFlagsWithPrefix(prefix+"service.", f)
 	c.ServiceClientConfig.RegisterFlagsWithPrefix(prefix, f)
 }
@@ -140,6 +162,14 @@ type Agent struct {
 
 	cluster *cluster.Cluster
 
+	// clusterer is the cluster of agents which instances with
+	// cluster_sharding enabled split their targets between. It is nil when
+	// the agent isn't part of a cluster.
+	clusterer agentcluster.Node
+
+	// queryEngine evaluates PromQL queries against instance WALs.
+	queryEngine *promql.Engine
+
 	stopped  bool
 	stopOnce sync.Once
 	actor    chan func()
@@ -147,19 +177,33 @@ type Agent struct {
 	initialBootDone atomic.Bool
 }
 
-// New creates and starts a new Agent.
-func New(reg prometheus.Registerer, cfg Config, logger log.Logger) (*Agent, error) {
-	return newAgent(reg, cfg, logger, defaultInstanceFactory)
+// New creates and starts a new Agent. clusterer must be set when
+// cfg.ClusterEnabled is true.
+func New(reg prometheus.Registerer, cfg Config, clusterer agentcluster.Node, logger log.Logger) (*Agent, error) {
+	return newAgent(reg, cfg, clusterer, logger, defaultInstanceFactory)
 }
 
-func newAgent(reg prometheus.Registerer, cfg Config, logger log.Logger, fact instanceFactory) (*Agent, error) {
+func newAgent(reg prometheus.Registerer, cfg Config, clusterer agentcluster.Node, logger log.Logger, fact instanceFactory) (*Agent, error) {
+	if cfg.ClusterEnabled && clusterer == nil {
+		return nil, fmt.Errorf("clustering is enabled but no cluster node was provided")
+	}
+
 	a := &Agent{
 		logger:          log.With(logger, "agent", "prometheus"),
 		instanceFactory: fact,
+		clusterer:       clusterer,
 		reg:             reg,
 		actor:           make(chan func(), 1),
 	}
 
+	a.queryEngine = promql.NewEngine(promql.EngineOpts{
+		Logger:               log.With(a.logger, "component", "query engine"),
+		MaxSamples:           50000000,
+		Timeout:              2 * time.Minute,
+		EnableAtModifier:     true,
+		EnableNegativeOffset: true,
+	})
+
 	a.bm = instance.NewBasicManager(instance.BasicManagerConfig{
 		InstanceRestartBackoff: cfg.InstanceRestartBackoff,
 	}, a.logger, a.newInstance)
@@ -197,7 +241,7 @@ func (a *Agent) newInstance(c instance.Config) (instance.ManagedInstance, error)
 		instanceLabel: c.Name,
 	}, a.reg)
 
-	return a.instanceFactory(reg, c, a.cfg.WALDir, a.logger)
+	return a.instanceFactory(reg, c, a.cfg.WALDir, a.clusterer, a.logger)
 }
 
 // Validate will validate the incoming Config and mutate it to apply defaults.
@@ -212,6 +256,9 @@ func (a *Agent) Validate(c *instance.Config) error {
 	if err := c.ApplyDefaults(a.cfg.Global); err != nil {
 		return fmt.Errorf("failed to apply defaults to %q: %w", c.Name, err)
 	}
+	if c.ClusterSharding && a.clusterer == nil {
+		return fmt.Errorf("failed to validate %q: %w", c.Name, errClusterDisabled)
+	}
 	return nil
 }
 
@@ -365,8 +412,8 @@ func (a *Agent) Stop() {
 	a.stopped = true
 }
 
-type instanceFactory = func(reg prometheus.Registerer, cfg instance.Config, walDir string, logger log.Logger) (instance.ManagedInstance, error)
+type instanceFactory = func(reg prometheus.Registerer, cfg instance.Config, walDir string, clusterer agentcluster.Node, logger log.Logger) (instance.ManagedInstance, error)
 
-func defaultInstanceFactory(reg prometheus.Registerer, cfg instance.Config, walDir string, logger log.Logger) (instance.ManagedInstance, error) {
-	return instance.New(reg, cfg, walDir, logger)
+func defaultInstanceFactory(reg prometheus.Registerer, cfg instance.Config, walDir string, clusterer agentcluster.Node, logger log.Logger) (instance.ManagedInstance, error) {
+	return instance.New(reg, cfg, walDir, clusterer, logger)
 }
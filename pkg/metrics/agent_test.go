@@ -10,6 +10,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/go-kit/log"
+	agentcluster "github.com/grafana/agent/pkg/cluster"
 	"github.com/grafana/agent/pkg/metrics/instance"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/scrape"
@@ -58,6 +59,19 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expect: errors.New("prometheus instance names must be unique. found multiple instances with name instance"),
 		},
+		{
+			name:    "cluster sharding without clustering",
+			mutator: func(c *Config) { c.Configs[0].ClusterSharding = true },
+			expect:  errors.New("error validating instance instance: cluster_sharding requires the -metrics.cluster.enabled flag to be set"),
+		},
+		{
+			name: "cluster sharding with clustering",
+			mutator: func(c *Config) {
+				c.ClusterEnabled = true
+				c.Configs[0].ClusterSharding = true
+			},
+			expect: nil,
+		},
 	}
 
 	for _, tc := range tt {
@@ -126,7 +140,7 @@ func TestAgent(t *testing.T) {
 
 	fact := newFakeInstanceFactory()
 
-	a, err := newAgent(prometheus.NewRegistry(), cfg, log.NewNopLogger(), fact.factory)
+	a, err := newAgent(prometheus.NewRegistry(), cfg, nil, log.NewNopLogger(), fact.factory)
 	require.NoError(t, err)
 
 	test.Poll(t, time.Second*30, true, func() interface{} {
@@ -187,7 +201,7 @@ func TestAgent_NormalInstanceExits(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			fact := newFakeInstanceFactory()
 
-			a, err := newAgent(prometheus.NewRegistry(), cfg, log.NewNopLogger(), fact.factory)
+			a, err := newAgent(prometheus.NewRegistry(), cfg, nil, log.NewNopLogger(), fact.factory)
 			require.NoError(t, err)
 
 			test.Poll(t, time.Second*30, true, func() interface{} {
@@ -231,7 +245,7 @@ func TestAgent_Stop(t *testing.T) {
 
 	fact := newFakeInstanceFactory()
 
-	a, err := newAgent(prometheus.NewRegistry(), cfg, log.NewNopLogger(), fact.factory)
+	a, err := newAgent(prometheus.NewRegistry(), cfg, nil, log.NewNopLogger(), fact.factory)
 	require.NoError(t, err)
 
 	test.Poll(t, time.Second*30, true, func() interface{} {
@@ -310,7 +324,7 @@ func (f *fakeInstanceFactory) Mocks() []*fakeInstance {
 	return f.mocks
 }
 
-func (f *fakeInstanceFactory) factory(_ prometheus.Registerer, cfg instance.Config, _ string, _ log.Logger) (instance.ManagedInstance, error) {
+func (f *fakeInstanceFactory) factory(_ prometheus.Registerer, cfg instance.Config, _ string, _ agentcluster.Node, _ log.Logger) (instance.ManagedInstance, error) {
 	f.created.Add(1)
 
 	f.mut.Lock()
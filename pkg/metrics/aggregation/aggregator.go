@@ -0,0 +1,514 @@
+package aggregation
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// flushFrequency is how often completed windows are written.
+	flushFrequency = time.Second
+
+	// pruneFrequency is how often series which haven't been appended to are
+	// removed from the match cache.
+	pruneFrequency = 10 * time.Minute
+)
+
+// Aggregator is a storage.Appendable which aggregates samples matching its
+// rules into new series. Aggregated series, and samples which aren't dropped
+// by a rule, are appended to the wrapped Appendable.
+type Aggregator struct {
+	logger  log.Logger
+	next    storage.Appendable
+	metrics *metrics
+
+	cacheMtx sync.Mutex
+	cache    map[uint64]*cacheEntry
+	cacheGen int64
+
+	mut   sync.Mutex
+	rules []*rule
+}
+
+// cacheEntry caches which rules match a series.
+type cacheEntry struct {
+	lset  labels.Labels
+	rules []int
+	drop  bool
+	gen   int64
+}
+
+// New creates a new Aggregator. Run must be called to write aggregated
+// series.
+func New(logger log.Logger, reg prometheus.Registerer, next storage.Appendable, rules []*Rule) (*Aggregator, error) {
+	a := &Aggregator{
+		logger:  logger,
+		next:    next,
+		metrics: newMetrics(reg),
+		cache:   make(map[uint64]*cacheEntry),
+	}
+
+	for i, cfg := range rules {
+		r, err := newRule(i, cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// Appender implements storage.Appendable.
+func (a *Aggregator) Appender(ctx context.Context) storage.Appender {
+	return &appender{agg: a, next: a.next.Appender(ctx)}
+}
+
+// Run writes aggregated series as their windows complete, until ctx is
+// canceled.
+func (a *Aggregator) Run(ctx context.Context) {
+	flushTicker := time.NewTicker(flushFrequency)
+	defer flushTicker.Stop()
+	pruneTicker := time.NewTicker(pruneFrequency)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushTicker.C:
+			a.flush(time.Now(), false)
+		case <-pruneTicker.C:
+			a.pruneCache()
+		}
+	}
+}
+
+// Flush writes aggregated series for every window, including windows which
+// haven't completed yet. It should be called once no more samples will be
+// appended.
+func (a *Aggregator) Flush() {
+	a.flush(time.Now(), true)
+}
+
+// match returns the indexes of the rules which match lset, and whether lset
+// should be dropped rather than appended.
+func (a *Aggregator) match(lset labels.Labels) *cacheEntry {
+	hash := lset.Hash()
+
+	a.cacheMtx.Lock()
+	defer a.cacheMtx.Unlock()
+
+	if e, ok := a.cache[hash]; ok && labels.Equal(e.lset, lset) {
+		e.gen = a.cacheGen
+		return e
+	}
+
+	e := &cacheEntry{lset: lset.Copy(), gen: a.cacheGen}
+	for i, r := range a.rules {
+		if r.matches(lset) {
+			e.rules = append(e.rules, i)
+			e.drop = e.drop || r.cfg.DropInput
+		}
+	}
+	a.cache[hash] = e
+	return e
+}
+
+func (a *Aggregator) pruneCache() {
+	a.cacheMtx.Lock()
+	defer a.cacheMtx.Unlock()
+
+	for hash, e := range a.cache {
+		if e.gen < a.cacheGen {
+			delete(a.cache, hash)
+		}
+	}
+	a.cacheGen++
+}
+
+// add records committed samples into the windows of their rules.
+func (a *Aggregator) add(samples []pendingSample) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	for _, s := range samples {
+		r := a.rules[s.rule]
+		a.metrics.inputSamples.WithLabelValues(r.name).Inc()
+		if !r.add(s.lset, s.t, s.v) {
+			a.metrics.lateSamples.WithLabelValues(r.name).Inc()
+		}
+	}
+}
+
+func (a *Aggregator) flush(now time.Time, force bool) {
+	a.mut.Lock()
+	var out []outputSample
+	for _, r := range a.rules {
+		out = append(out, r.flush(timestamp.FromTime(now), force)...)
+	}
+	a.mut.Unlock()
+
+	if len(out) == 0 {
+		return
+	}
+
+	appended := make(map[string]int)
+	app := a.next.Appender(context.Background())
+	for _, s := range out {
+		if _, err := app.Append(0, s.lset, s.t, s.v); err != nil {
+			level.Warn(a.logger).Log("msg", "failed to append aggregated sample", "series", s.lset, "err", err)
+			a.metrics.failedSamples.WithLabelValues(s.rule).Inc()
+			continue
+		}
+		appended[s.rule]++
+	}
+
+	counter := a.metrics.outputSamples
+	if err := app.Commit(); err != nil {
+		level.Error(a.logger).Log("msg", "failed to commit aggregated samples", "err", err)
+		counter = a.metrics.failedSamples
+	}
+	for rule, n := range appended {
+		counter.WithLabelValues(rule).Add(float64(n))
+	}
+}
+
+type pendingSample struct {
+	rule int
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+type outputSample struct {
+	rule string
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+// appender buffers samples matching rules until they're committed.
+type appender struct {
+	agg     *Aggregator
+	next    storage.Appender
+	pending []pendingSample
+}
+
+func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	m := a.agg.match(l)
+	for _, idx := range m.rules {
+		a.pending = append(a.pending, pendingSample{rule: idx, lset: m.lset, t: t, v: v})
+	}
+	if m.drop {
+		return 0, nil
+	}
+	return a.next.Append(ref, l, t, v)
+}
+
+func (a *appender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if a.agg.match(l).drop {
+		return 0, nil
+	}
+	return a.next.AppendExemplar(ref, l, e)
+}
+
+func (a *appender) Commit() error {
+	if err := a.next.Commit(); err != nil {
+		return err
+	}
+	a.agg.add(a.pending)
+	a.pending = nil
+	return nil
+}
+
+func (a *appender) Rollback() error {
+	a.pending = nil
+	return a.next.Rollback()
+}
+
+// rule holds the state of a Rule. rule isn't safe for concurrent use.
+type rule struct {
+	cfg      *Rule
+	name     string
+	matchers []*labels.Matcher
+	by       []string
+	without  []string
+	interval int64
+	delay    int64
+
+	windows     map[int64]map[uint64]*group // Groups by window index.
+	started     bool
+	flushedUpTo int64                    // Windows before this index have been written.
+	lastOutput  map[uint64]labels.Labels // Groups written for the last window.
+}
+
+// group is a set of series aggregated into one output series.
+type group struct {
+	lset   labels.Labels
+	series map[uint64]seriesValue // Newest sample of each series by hash.
+}
+
+type seriesValue struct {
+	t int64
+	v float64
+}
+
+func newRule(idx int, cfg *Rule) (*rule, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	matchers, err := cfg.matchers()
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = strconv.Itoa(idx)
+	}
+
+	r := &rule{
+		cfg:      cfg,
+		name:     name,
+		matchers: matchers,
+		by:       append([]string{}, cfg.By...),
+		without:  append([]string{}, cfg.Without...),
+		interval: time.Duration(cfg.Interval).Milliseconds(),
+		delay:    time.Duration(cfg.Delay).Milliseconds(),
+		windows:  make(map[int64]map[uint64]*group),
+	}
+	sort.Strings(r.by)
+	sort.Strings(r.without)
+	return r, nil
+}
+
+func (r *rule) matches(lset labels.Labels) bool {
+	for _, m := range r.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// outputLabels returns the labels of the series lset is aggregated into.
+func (r *rule) outputLabels(lset labels.Labels) labels.Labels {
+	name := r.cfg.OutputName
+	if name == "" {
+		name = lset.Get(labels.MetricName)
+		if !r.cfg.KeepMetricName {
+			name += ":" + string(r.cfg.Aggregation)
+		}
+	}
+
+	var base labels.Labels
+	switch {
+	case len(r.by) > 0:
+		base = lset.WithLabels(r.by...)
+	default:
+		base = lset.WithoutLabels(r.without...)
+	}
+	return labels.NewBuilder(base).Set(labels.MetricName, name).Labels()
+}
+
+// add adds a sample to its window. Returns false if the sample was dropped
+// because its window was already written.
+func (r *rule) add(lset labels.Labels, t int64, v float64) bool {
+	w := floorDiv(t, r.interval)
+	if r.started && w < r.flushedUpTo {
+		return false
+	}
+
+	groups, ok := r.windows[w]
+	if !ok {
+		groups = make(map[uint64]*group)
+		r.windows[w] = groups
+	}
+
+	out := r.outputLabels(lset)
+	gh := out.Hash()
+	g, ok := groups[gh]
+	if !ok {
+		g = &group{lset: out, series: make(map[uint64]seriesValue)}
+		groups[gh] = g
+	}
+
+	sh := lset.Hash()
+	if value.IsStaleNaN(v) {
+		// The series went away; it doesn't contribute to the window anymore.
+		delete(g.series, sh)
+		return true
+	}
+	if prev, ok := g.series[sh]; !ok || t >= prev.t {
+		g.series[sh] = seriesValue{t: t, v: v}
+	}
+	return true
+}
+
+// flush returns aggregated samples for every window which completed before
+// now. If force is true, every window with samples is returned.
+//
+// Output series which stop receiving samples are written a staleness marker
+// at the end of the first window without samples.
+func (r *rule) flush(now int64, force bool) []outputSample {
+	if !r.started {
+		first, ok := r.nextWindow(math.MinInt64, math.MaxInt64)
+		if !ok {
+			return nil
+		}
+		r.started = true
+		r.flushedUpTo = first
+	}
+
+	upTo := floorDiv(now-r.delay, r.interval)
+	if force {
+		// Write every window with samples, but don't write staleness markers
+		// for the windows after them.
+		upTo = r.flushedUpTo
+		for w := range r.windows {
+			if w+1 > upTo {
+				upTo = w + 1
+			}
+		}
+	}
+
+	var out []outputSample
+	for w := r.flushedUpTo; w < upTo; {
+		groups, ok := r.windows[w]
+		if !ok && len(r.lastOutput) == 0 {
+			// Nothing to write; skip to the next window with samples.
+			next, ok := r.nextWindow(w, upTo)
+			if !ok {
+				break
+			}
+			w = next
+			continue
+		}
+
+		ts := (w + 1) * r.interval
+		current := make(map[uint64]labels.Labels, len(groups))
+		for hash, g := range groups {
+			if len(g.series) == 0 {
+				continue
+			}
+			out = append(out, outputSample{rule: r.name, lset: g.lset, t: ts, v: r.aggregate(g)})
+			current[hash] = g.lset
+		}
+		for hash, lset := range r.lastOutput {
+			if _, ok := current[hash]; !ok {
+				out = append(out, outputSample{rule: r.name, lset: lset, t: ts, v: math.Float64frombits(value.StaleNaN)})
+			}
+		}
+
+		r.lastOutput = current
+		delete(r.windows, w)
+		w++
+	}
+	if upTo > r.flushedUpTo {
+		r.flushedUpTo = upTo
+	}
+	return out
+}
+
+// nextWindow returns the earliest window with samples in [from, to).
+func (r *rule) nextWindow(from, to int64) (int64, bool) {
+	var (
+		next  int64
+		found bool
+	)
+	for w := range r.windows {
+		if w >= from && w < to && (!found || w < next) {
+			next, found = w, true
+		}
+	}
+	return next, found
+}
+
+func (r *rule) aggregate(g *group) float64 {
+	var (
+		res   float64
+		lastT int64 = math.MinInt64
+		first       = true
+	)
+	for _, s := range g.series {
+		switch r.cfg.Aggregation {
+		case AggregationSum, AggregationAvg:
+			res += s.v
+		case AggregationMin:
+			if first || s.v < res {
+				res = s.v
+			}
+		case AggregationMax:
+			if first || s.v > res {
+				res = s.v
+			}
+		case AggregationLast:
+			if s.t > lastT {
+				res, lastT = s.v, s.t
+			}
+		}
+		first = false
+	}
+
+	switch r.cfg.Aggregation {
+	case AggregationAvg:
+		res /= float64(len(g.series))
+	case AggregationCount:
+		res = float64(len(g.series))
+	}
+	return res
+}
+
+// floorDiv divides a by b, rounding towards negative infinity.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+type metrics struct {
+	inputSamples  *prometheus.CounterVec
+	lateSamples   *prometheus.CounterVec
+	outputSamples *prometheus.CounterVec
+	failedSamples *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		inputSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregation_input_samples_total",
+			Help: "Total number of samples matched by an aggregation rule.",
+		}, []string{"rule"}),
+		lateSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregation_late_samples_total",
+			Help: "Total number of samples ignored by an aggregation rule because their window was already written.",
+		}, []string{"rule"}),
+		outputSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregation_output_samples_total",
+			Help: "Total number of aggregated samples written by an aggregation rule.",
+		}, []string{"rule"}),
+		failedSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_aggregation_failed_samples_total",
+			Help: "Total number of aggregated samples which failed to be written.",
+		}, []string{"rule"}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.inputSamples, m.lateSamples, m.outputSamples, m.failedSamples)
+	}
+	return m
+}
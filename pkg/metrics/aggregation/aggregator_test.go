@@ -0,0 +1,233 @@
+package aggregation
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator_SumBy(t *testing.T) {
+	next := &collectingAppendable{}
+	a, err := New(log.NewNopLogger(), nil, next, []*Rule{{
+		Match:       `{__name__="container_cpu"}`,
+		Interval:    model.Duration(time.Minute),
+		Delay:       model.Duration(15 * time.Second),
+		Aggregation: AggregationSum,
+		By:          []string{"namespace"},
+	}})
+	require.NoError(t, err)
+
+	appendSamples(t, a,
+		sample{labels.FromStrings("__name__", "container_cpu", "namespace", "a", "pod", "1"), 1_000, 1},
+		sample{labels.FromStrings("__name__", "container_cpu", "namespace", "a", "pod", "2"), 1_000, 2},
+		// Only the newest sample of a series in a window is aggregated.
+		sample{labels.FromStrings("__name__", "container_cpu", "namespace", "a", "pod", "1"), 30_000, 3},
+		sample{labels.FromStrings("__name__", "container_cpu", "namespace", "b", "pod", "3"), 1_000, 10},
+		sample{labels.FromStrings("__name__", "other"), 1_000, 100},
+	)
+
+	// Input samples are still appended.
+	require.Len(t, next.Samples(), 5)
+	next.Reset()
+
+	// Nothing is written until the window and its delay have passed.
+	a.flush(timestamp.Time(60_000), false)
+	require.Empty(t, next.Samples())
+
+	a.flush(timestamp.Time(75_000), false)
+	require.Equal(t, []sample{
+		{labels.FromStrings("__name__", "container_cpu:sum", "namespace", "a"), 60_000, 5},
+		{labels.FromStrings("__name__", "container_cpu:sum", "namespace", "b"), 60_000, 10},
+	}, next.Samples())
+	require.Equal(t, float64(4), testutil.ToFloat64(a.metrics.inputSamples.WithLabelValues("0")))
+	require.Equal(t, float64(2), testutil.ToFloat64(a.metrics.outputSamples.WithLabelValues("0")))
+}
+
+func TestAggregator_Downsample(t *testing.T) {
+	next := &collectingAppendable{}
+	a, err := New(log.NewNopLogger(), nil, next, []*Rule{{
+		Name:           "downsample",
+		Match:          `{__name__=~"net_.*"}`,
+		Interval:       model.Duration(5 * time.Minute),
+		Aggregation:    AggregationLast,
+		KeepMetricName: true,
+		DropInput:      true,
+	}})
+	require.NoError(t, err)
+
+	series := labels.FromStrings("__name__", "net_bytes", "pod", "1")
+	for ts := int64(0); ts < 10*60_000; ts += 15_000 {
+		appendSamples(t, a, sample{series, ts, float64(ts)})
+	}
+
+	// Input samples are dropped.
+	require.Empty(t, next.Samples())
+
+	a.flush(timestamp.Time(11*60_000), false)
+	require.Equal(t, []sample{
+		{series, 5 * 60_000, 285_000},
+		{series, 10 * 60_000, 585_000},
+	}, next.Samples())
+}
+
+func TestAggregator_Staleness(t *testing.T) {
+	next := &collectingAppendable{}
+	a, err := New(log.NewNopLogger(), nil, next, []*Rule{{
+		Match:       `{__name__="up"}`,
+		Interval:    model.Duration(time.Minute),
+		Aggregation: AggregationCount,
+		Without:     []string{"instance"},
+	}})
+	require.NoError(t, err)
+
+	appendSamples(t, a,
+		sample{labels.FromStrings("__name__", "up", "instance", "a", "job", "x"), 0, 1},
+		sample{labels.FromStrings("__name__", "up", "instance", "b", "job", "x"), 0, 1},
+		sample{labels.FromStrings("__name__", "up", "instance", "a", "job", "y"), 0, 1},
+	)
+	appendSamples(t, a,
+		sample{labels.FromStrings("__name__", "up", "instance", "a", "job", "x"), 60_000, 1},
+		// A staleness marker removes the series from the window.
+		sample{labels.FromStrings("__name__", "up", "instance", "b", "job", "x"), 61_000, math.Float64frombits(value.StaleNaN)},
+	)
+	next.Reset()
+	a.flush(timestamp.Time(2*60_000), false)
+
+	samples := next.Samples()
+	require.Len(t, samples, 4)
+	require.Equal(t, sample{labels.FromStrings("__name__", "up:count", "job", "x"), 60_000, 2}, samples[0])
+	require.Equal(t, sample{labels.FromStrings("__name__", "up:count", "job", "y"), 60_000, 1}, samples[1])
+	require.Equal(t, sample{labels.FromStrings("__name__", "up:count", "job", "x"), 120_000, 1}, samples[2])
+
+	// The job="y" group stopped receiving samples.
+	require.Equal(t, labels.FromStrings("__name__", "up:count", "job", "y"), samples[3].lset)
+	require.Equal(t, int64(120_000), samples[3].t)
+	require.True(t, value.IsStaleNaN(samples[3].v))
+
+	// Samples for windows which have been written are ignored.
+	appendSamples(t, a, sample{labels.FromStrings("__name__", "up", "instance", "a", "job", "x"), 1_000, 1})
+	require.Equal(t, float64(1), testutil.ToFloat64(a.metrics.lateSamples.WithLabelValues("0")))
+}
+
+func TestAggregator_FlushAndRollback(t *testing.T) {
+	next := &collectingAppendable{}
+	a, err := New(log.NewNopLogger(), nil, next, []*Rule{{
+		Match:       `{__name__="temp"}`,
+		Interval:    model.Duration(time.Minute),
+		Aggregation: AggregationAvg,
+		OutputName:  "temp_avg",
+	}})
+	require.NoError(t, err)
+
+	// Rolled back samples aren't aggregated.
+	app := a.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "temp", "room", "a"), 1_000, 100)
+	require.NoError(t, err)
+	require.NoError(t, app.Rollback())
+
+	appendSamples(t, a,
+		sample{labels.FromStrings("__name__", "temp", "room", "a"), 1_000, 20},
+		sample{labels.FromStrings("__name__", "temp", "room", "b"), 1_000, 30},
+	)
+	next.Reset()
+
+	// Flush writes windows which haven't completed yet.
+	a.Flush()
+	require.Equal(t, []sample{
+		{labels.FromStrings("__name__", "temp_avg", "room", "a"), 60_000, 20},
+		{labels.FromStrings("__name__", "temp_avg", "room", "b"), 60_000, 30},
+	}, next.Samples())
+}
+
+func TestFloorDiv(t *testing.T) {
+	require.Equal(t, int64(1), floorDiv(5, 3))
+	require.Equal(t, int64(-2), floorDiv(-5, 3))
+	require.Equal(t, int64(-1), floorDiv(-3, 3))
+}
+
+type sample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+func appendSamples(t *testing.T, a *Aggregator, samples ...sample) {
+	t.Helper()
+
+	app := a.Appender(context.Background())
+	for _, s := range samples {
+		_, err := app.Append(0, s.lset, s.t, s.v)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+}
+
+// collectingAppendable collects committed samples, sorted by timestamp and
+// labels.
+type collectingAppendable struct {
+	mut     sync.Mutex
+	samples []sample
+}
+
+func (c *collectingAppendable) Appender(context.Context) storage.Appender {
+	return &collectingAppender{c: c}
+}
+
+func (c *collectingAppendable) Samples() []sample {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	res := append([]sample(nil), c.samples...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].t != res[j].t {
+			return res[i].t < res[j].t
+		}
+		return labels.Compare(res[i].lset, res[j].lset) < 0
+	})
+	return res
+}
+
+func (c *collectingAppendable) Reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.samples = nil
+}
+
+type collectingAppender struct {
+	c       *collectingAppendable
+	pending []sample
+}
+
+func (a *collectingAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.pending = append(a.pending, sample{l, t, v})
+	return 0, nil
+}
+
+func (a *collectingAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *collectingAppender) Commit() error {
+	a.c.mut.Lock()
+	defer a.c.mut.Unlock()
+	a.c.samples = append(a.c.samples, a.pending...)
+	return nil
+}
+
+func (a *collectingAppender) Rollback() error {
+	a.pending = nil
+	return nil
+}
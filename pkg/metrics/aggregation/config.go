@@ -0,0 +1,138 @@
+// Package aggregation implements aggregating and downsampling scraped samples
+// before they're written to the WAL.
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Aggregation is an operation which combines the values of the series in a
+// group into a single value.
+type Aggregation string
+
+// Supported aggregations.
+const (
+	AggregationSum   Aggregation = "sum"
+	AggregationMin   Aggregation = "min"
+	AggregationMax   Aggregation = "max"
+	AggregationAvg   Aggregation = "avg"
+	AggregationCount Aggregation = "count"
+	AggregationLast  Aggregation = "last"
+)
+
+// Validate returns an error if a isn't a supported aggregation.
+func (a Aggregation) Validate() error {
+	switch a {
+	case AggregationSum, AggregationMin, AggregationMax, AggregationAvg, AggregationCount, AggregationLast:
+		return nil
+	default:
+		return fmt.Errorf("unsupported aggregation %q, must be one of sum, min, max, avg, count or last", a)
+	}
+}
+
+// DefaultRule holds default settings for a Rule.
+var DefaultRule = Rule{
+	Delay: model.Duration(15 * time.Second),
+}
+
+// Rule aggregates matching series into new series every interval.
+type Rule struct {
+	// Name of the rule, used in the rule label of metrics. Defaults to the
+	// index of the rule.
+	Name string `yaml:"name,omitempty"`
+
+	// Match is a series selector, like {__name__=~"container_.*"}, which
+	// selects the series to aggregate.
+	Match string `yaml:"match"`
+
+	// Interval is the length of each aggregation window. One sample is
+	// written for each group per window.
+	Interval model.Duration `yaml:"interval"`
+
+	// Delay is how long to wait for late samples after a window ends before
+	// writing its aggregated samples.
+	Delay model.Duration `yaml:"delay,omitempty"`
+
+	Aggregation Aggregation `yaml:"aggregation"`
+
+	// By and Without determine which labels series are grouped by. Only one
+	// may be set. If neither are set, every series is its own group, which
+	// downsamples series.
+	By      []string `yaml:"by,omitempty"`
+	Without []string `yaml:"without,omitempty"`
+
+	// OutputName is the metric name of aggregated series. Defaults to
+	// <metric>:<aggregation>. When set, series with different metric names
+	// are aggregated together.
+	OutputName string `yaml:"output_name,omitempty"`
+
+	// KeepMetricName uses the metric name of the input series for aggregated
+	// series. It requires DropInput, otherwise aggregated series would
+	// collide with their input.
+	KeepMetricName bool `yaml:"keep_metric_name,omitempty"`
+
+	// DropInput stops matching series from being written to the WAL, so only
+	// the aggregated series are kept.
+	DropInput bool `yaml:"drop_input,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*r = DefaultRule
+
+	type plain Rule
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+	return r.Validate()
+}
+
+// Validate returns an error if r is invalid.
+func (r *Rule) Validate() error {
+	if _, err := r.matchers(); err != nil {
+		return err
+	}
+
+	switch {
+	case r.Interval <= 0:
+		return errors.New("interval must be greater than 0s")
+	case r.Delay < 0:
+		return errors.New("delay must not be negative")
+	case len(r.By) > 0 && len(r.Without) > 0:
+		return errors.New("only one of by and without may be set")
+	case r.OutputName != "" && r.KeepMetricName:
+		return errors.New("only one of output_name and keep_metric_name may be set")
+	case r.KeepMetricName && !r.DropInput:
+		return errors.New("keep_metric_name requires drop_input")
+	}
+
+	if err := r.Aggregation.Validate(); err != nil {
+		return err
+	}
+	for _, name := range append(append([]string{}, r.By...), r.Without...) {
+		if name == labels.MetricName {
+			return fmt.Errorf("%s can't be used in by or without; use output_name to aggregate across metric names", labels.MetricName)
+		}
+	}
+	if r.OutputName != "" && !model.IsValidMetricName(model.LabelValue(r.OutputName)) {
+		return fmt.Errorf("invalid output_name %q", r.OutputName)
+	}
+	return nil
+}
+
+func (r *Rule) matchers() ([]*labels.Matcher, error) {
+	if r.Match == "" {
+		return nil, errors.New("match must be set")
+	}
+	ms, err := parser.ParseMetricSelector(r.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	return ms, nil
+}
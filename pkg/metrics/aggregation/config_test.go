@@ -0,0 +1,88 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRule_Unmarshal(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{
+			name: "valid",
+			in: `match: '{__name__="container_cpu_usage_seconds_total"}'
+interval: 1m
+aggregation: sum
+by: [namespace]`,
+		},
+		{
+			name: "missing match",
+			in: `interval: 1m
+aggregation: sum`,
+			err: "match must be set",
+		},
+		{
+			name: "invalid match",
+			in: `match: '{'
+interval: 1m
+aggregation: sum`,
+			err: `invalid match "{": 1:2: parse error: unexpected end of input inside braces`,
+		},
+		{
+			name: "missing interval",
+			in: `match: '{job="x"}'
+aggregation: sum`,
+			err: "interval must be greater than 0s",
+		},
+		{
+			name: "unsupported aggregation",
+			in: `match: '{job="x"}'
+interval: 1m
+aggregation: quantile`,
+			err: `unsupported aggregation "quantile", must be one of sum, min, max, avg, count or last`,
+		},
+		{
+			name: "by and without",
+			in: `match: '{job="x"}'
+interval: 1m
+aggregation: sum
+by: [a]
+without: [b]`,
+			err: "only one of by and without may be set",
+		},
+		{
+			name: "group by metric name",
+			in: `match: '{job="x"}'
+interval: 1m
+aggregation: sum
+by: [__name__]`,
+			err: "__name__ can't be used in by or without; use output_name to aggregate across metric names",
+		},
+		{
+			name: "keep metric name without dropping input",
+			in: `match: '{job="x"}'
+interval: 5m
+aggregation: last
+keep_metric_name: true`,
+			err: "keep_metric_name requires drop_input",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var r Rule
+			err := yaml.UnmarshalStrict([]byte(tc.in), &r)
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, DefaultRule.Delay, r.Delay)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
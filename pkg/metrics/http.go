@@ -1,19 +1,29 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/go-kit/log/level"
 	"github.com/gorilla/mux"
 	"github.com/grafana/agent/pkg/metrics/cluster/configapi"
+	"github.com/grafana/agent/pkg/metrics/instance"
+	"github.com/grafana/agent/pkg/metrics/push"
+	"github.com/grafana/agent/pkg/metrics/wal"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/scrape"
-	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/storage"
 )
 
 // WireAPI adds API routes to the provided mux router.
@@ -27,6 +37,15 @@ func (a *Agent) WireAPI(r *mux.Router) {
 	r.HandleFunc("/agent/api/v1/metrics/instances", a.ListInstancesHandler).Methods("GET")
 	r.HandleFunc("/agent/api/v1/metrics/targets", a.ListTargetsHandler).Methods("GET")
 	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/write", a.PushMetricsHandler).Methods("POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/influx/write", a.InfluxWriteHandler).Methods("POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/influx/api/v2/write", a.InfluxWriteHandler).Methods("POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/otlp/v1/metrics", a.OTLPWriteHandler).Methods("POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/query", a.QueryHandler).Methods("GET", "POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/query_range", a.QueryRangeHandler).Methods("GET", "POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/remote_write", a.RemoteWriteStatusHandler).Methods("GET")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/remote_write/{remote_name}/rewind", a.RewindRemoteWriteHandler).Methods("POST")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/cardinality", a.CardinalityHandler).Methods("GET")
+	r.HandleFunc("/agent/api/v1/metrics/instance/{instance}/debug_scrape", a.DebugScrapeHandler).Methods("GET", "POST")
 }
 
 // ListInstancesHandler writes the set of currently running instances to the http.ResponseWriter.
@@ -135,8 +154,30 @@ type TargetInfo struct {
 }
 
 // PushMetricsHandler provides a way to POST data directly into
-// an instance's WAL.
+// an instance's WAL. The format of the request is determined by
+// push.DetectFormat.
 func (a *Agent) PushMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.servePush(w, r, "")
+}
+
+// InfluxWriteHandler accepts samples in the InfluxDB line protocol, on the
+// paths used by InfluxDB clients.
+func (a *Agent) InfluxWriteHandler(w http.ResponseWriter, r *http.Request) {
+	a.servePush(w, r, push.FormatInflux)
+}
+
+// OTLPWriteHandler accepts samples from OTLP/HTTP exporters.
+func (a *Agent) OTLPWriteHandler(w http.ResponseWriter, r *http.Request) {
+	a.servePush(w, r, push.FormatOTLP)
+}
+
+// pushConfigProvider is implemented by instances which have settings for
+// pushed samples.
+type pushConfigProvider interface {
+	PushConfig() push.Config
+}
+
+func (a *Agent) servePush(w http.ResponseWriter, r *http.Request, format push.Format) {
 	// Get instance name.
 	instanceName, err := getInstanceName(r)
 	if err != nil {
@@ -151,7 +192,12 @@ func (a *Agent) PushMetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	handler := remote.NewWriteHandler(a.logger, managedInstance)
+	var cfg push.Config
+	if p, ok := managedInstance.(pushConfigProvider); ok {
+		cfg = p.PushConfig()
+	}
+
+	handler := push.NewHandler(a.logger, managedInstance, cfg, format)
 	handler.ServeHTTP(w, r)
 }
 
@@ -166,3 +212,421 @@ func getInstanceName(r *http.Request) (string, error) {
 	}
 	return name, nil
 }
+
+// QueryHandler evaluates an instant PromQL query against the samples which
+// are still held in an instance's WAL. Requests and responses follow the
+// Prometheus HTTP API.
+func (a *Agent) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.queryableInstance(w, r)
+	if !ok {
+		return
+	}
+
+	ts, err := parseTimeParam(r, "time", time.Now())
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+
+	qry, err := a.queryEngine.NewInstantQuery(q, r.FormValue("query"), ts)
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+	a.execQuery(w, r, qry)
+}
+
+// QueryRangeHandler evaluates a range PromQL query against the samples which
+// are still held in an instance's WAL. Requests and responses follow the
+// Prometheus HTTP API.
+func (a *Agent) QueryRangeHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.queryableInstance(w, r)
+	if !ok {
+		return
+	}
+
+	start, err := parseTimeParam(r, "start", time.Time{})
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+	end, err := parseTimeParam(r, "end", time.Time{})
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+	step, err := parseDurationParam(r, "step")
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+
+	switch {
+	case start.IsZero() || end.IsZero():
+		writeQueryError(w, errorBadData, fmt.Errorf("start and end must be provided"))
+		return
+	case end.Before(start):
+		writeQueryError(w, errorBadData, fmt.Errorf("end timestamp must not be before start time"))
+		return
+	case step <= 0:
+		writeQueryError(w, errorBadData, fmt.Errorf("zero or negative query resolution step widths are not accepted. Try a positive integer"))
+		return
+	case end.Sub(start)/step > maxQueryPoints:
+		// Same limit as Prometheus to avoid returning huge responses.
+		writeQueryError(w, errorBadData, fmt.Errorf("exceeded maximum resolution of %d points per timeseries. Try decreasing the query resolution (?step=XX)", maxQueryPoints))
+		return
+	}
+
+	qry, err := a.queryEngine.NewRangeQuery(q, r.FormValue("query"), start, end, step)
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return
+	}
+	a.execQuery(w, r, qry)
+}
+
+// maxQueryPoints is the maximum number of points a range query may return
+// per series.
+const maxQueryPoints = 11000
+
+// queryableInstance looks up the instance named in the request. If the
+// instance doesn't exist or can't be queried, an error is written to w and
+// ok is false.
+func (a *Agent) queryableInstance(w http.ResponseWriter, r *http.Request) (q storage.Queryable, ok bool) {
+	instanceName, err := getInstanceName(r)
+	if err != nil {
+		writeQueryError(w, errorBadData, err)
+		return nil, false
+	}
+
+	managedInstance, err := a.InstanceManager().GetInstance(instanceName)
+	if err != nil {
+		writeQueryError(w, errorNotFound, err)
+		return nil, false
+	}
+
+	q, ok = managedInstance.(storage.Queryable)
+	if !ok {
+		writeQueryError(w, errorUnavailable, fmt.Errorf("instance %s does not support queries", instanceName))
+		return nil, false
+	}
+	return q, true
+}
+
+func (a *Agent) execQuery(w http.ResponseWriter, r *http.Request, qry promql.Query) {
+	defer qry.Close()
+
+	res := qry.Exec(r.Context())
+	if res.Err != nil {
+		switch res.Err.(type) {
+		case promql.ErrQueryCanceled:
+			writeQueryError(w, errorCanceled, res.Err)
+		case promql.ErrQueryTimeout:
+			writeQueryError(w, errorTimeout, res.Err)
+		case promql.ErrStorage:
+			writeQueryError(w, errorInternal, res.Err)
+		default:
+			writeQueryError(w, errorExecution, res.Err)
+		}
+		return
+	}
+
+	resp := queryResponse{
+		Status: "success",
+		Data: &queryData{
+			ResultType: res.Value.Type(),
+			Result:     res.Value,
+		},
+	}
+	for _, warn := range res.Warnings {
+		resp.Warnings = append(resp.Warnings, warn.Error())
+	}
+	writeQueryResponse(w, http.StatusOK, resp)
+}
+
+// queryResponse is the response format of the Prometheus HTTP API.
+type queryResponse struct {
+	Status    string     `json:"status"`
+	Data      *queryData `json:"data,omitempty"`
+	ErrorType errorType  `json:"errorType,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Warnings  []string   `json:"warnings,omitempty"`
+}
+
+type queryData struct {
+	ResultType parser.ValueType `json:"resultType"`
+	Result     parser.Value     `json:"result"`
+}
+
+// errorType is the type of error reported by the Prometheus HTTP API.
+type errorType string
+
+const (
+	errorTimeout     errorType = "timeout"
+	errorCanceled    errorType = "canceled"
+	errorExecution   errorType = "execution"
+	errorBadData     errorType = "bad_data"
+	errorInternal    errorType = "internal"
+	errorUnavailable errorType = "unavailable"
+	errorNotFound    errorType = "not_found"
+)
+
+func writeQueryError(w http.ResponseWriter, typ errorType, err error) {
+	var code int
+	switch typ {
+	case errorBadData:
+		code = http.StatusBadRequest
+	case errorExecution:
+		code = http.StatusUnprocessableEntity
+	case errorCanceled, errorTimeout, errorUnavailable:
+		code = http.StatusServiceUnavailable
+	case errorNotFound:
+		code = http.StatusNotFound
+	default:
+		code = http.StatusInternalServerError
+	}
+
+	writeQueryResponse(w, code, queryResponse{
+		Status:    "error",
+		ErrorType: typ,
+		Error:     err.Error(),
+	})
+}
+
+func writeQueryResponse(w http.ResponseWriter, code int, resp queryResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseTimeParam parses the named form value as either a Unix timestamp in
+// seconds or an RFC3339 timestamp. def is returned if the value is empty.
+func parseTimeParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	val := r.FormValue(name)
+	if val == "" {
+		return def, nil
+	}
+
+	if t, err := strconv.ParseFloat(val, 64); err == nil {
+		s, ns := math.Modf(t)
+		ns = math.Round(ns*1000) / 1000
+		return time.Unix(int64(s), int64(ns*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid parameter %q: cannot parse %q to a valid timestamp", name, val)
+}
+
+// parseDurationParam parses the named form value as either a number of
+// seconds or a Prometheus duration.
+func parseDurationParam(r *http.Request, name string) (time.Duration, error) {
+	val := r.FormValue(name)
+
+	if d, err := strconv.ParseFloat(val, 64); err == nil {
+		ts := d * float64(time.Second)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, fmt.Errorf("invalid parameter %q: cannot parse %q to a valid duration. It overflows int64", name, val)
+		}
+		return time.Duration(ts), nil
+	}
+	if d, err := model.ParseDuration(val); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("invalid parameter %q: cannot parse %q to a valid duration", name, val)
+}
+
+// remoteWriteAdmin is implemented by instances which can report on and
+// rewind their remote_write endpoints.
+type remoteWriteAdmin interface {
+	RemoteWriteStatus() ([]instance.RemoteWriteStatus, error)
+	RewindRemoteWrite(name string, from time.Time) error
+}
+
+// RemoteWriteStatusHandler lists the remote_write endpoints of an instance
+// along with how far each has been sent data from the WAL.
+func (a *Agent) RemoteWriteStatusHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := a.remoteWriteAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := admin.RemoteWriteStatus()
+	if err != nil {
+		a.writeRemoteWriteError(w, err)
+		return
+	}
+	if err := configapi.WriteResponse(w, http.StatusOK, status); err != nil {
+		level.Error(a.logger).Log("msg", "failed to write response", "err", err)
+	}
+}
+
+// RewindRemoteWriteHandler resends samples still in an instance's WAL to a
+// remote_write endpoint, starting from the time given by the from parameter.
+// Samples are resent in the background; progress can be followed with
+// RemoteWriteStatusHandler.
+func (a *Agent) RewindRemoteWriteHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := a.remoteWriteAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	name, err := url.PathUnescape(mux.Vars(r)["remote_name"])
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("could not decode remote_write name: %w", err))
+		return
+	}
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if from.IsZero() {
+		_ = configapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("from must be provided"))
+		return
+	}
+
+	if err := admin.RewindRemoteWrite(name, from); err != nil {
+		a.writeRemoteWriteError(w, err)
+		return
+	}
+	if err := configapi.WriteResponse(w, http.StatusAccepted, nil); err != nil {
+		level.Error(a.logger).Log("msg", "failed to write response", "err", err)
+	}
+}
+
+// remoteWriteAdmin looks up the instance named in the request. If the
+// instance doesn't exist or doesn't support managing remote_write, an error
+// is written to w and ok is false.
+func (a *Agent) remoteWriteAdmin(w http.ResponseWriter, r *http.Request) (admin remoteWriteAdmin, ok bool) {
+	instanceName, err := getInstanceName(r)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	managedInstance, err := a.InstanceManager().GetInstance(instanceName)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	admin, ok = managedInstance.(remoteWriteAdmin)
+	if !ok {
+		_ = configapi.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("instance %s does not support managing remote_write", instanceName))
+		return nil, false
+	}
+	return admin, true
+}
+
+func (a *Agent) writeRemoteWriteError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, instance.ErrRemoteWriteNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, instance.ErrResendRunning):
+		code = http.StatusConflict
+	case errors.Is(err, instance.ErrNotRunning):
+		code = http.StatusServiceUnavailable
+	}
+	if err := configapi.WriteError(w, code, err); err != nil {
+		level.Error(a.logger).Log("msg", "failed to write response", "err", err)
+	}
+}
+
+// cardinalityReporter is implemented by instances which can report on the
+// series held by their WAL.
+type cardinalityReporter interface {
+	Cardinality(limit int) (wal.CardinalityStats, error)
+}
+
+// defaultCardinalityLimit is the number of metric names and label names
+// returned by CardinalityHandler when no limit is given.
+const defaultCardinalityLimit = 10
+
+// CardinalityHandler reports the number of active series in an instance's
+// WAL, along with the metric names with the most series and the label names
+// with the most values. The limit parameter controls how many metric names
+// and label names are returned.
+func (a *Agent) CardinalityHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultCardinalityLimit
+	if val := r.FormValue("limit"); val != "" {
+		var err error
+		limit, err = strconv.Atoi(val)
+		if err != nil || limit <= 0 {
+			_ = configapi.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be a positive integer"))
+			return
+		}
+	}
+
+	instanceName, err := getInstanceName(r)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	managedInstance, err := a.InstanceManager().GetInstance(instanceName)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	reporter, ok := managedInstance.(cardinalityReporter)
+	if !ok {
+		_ = configapi.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("instance %s does not support reporting cardinality", instanceName))
+		return
+	}
+
+	stats, err := reporter.Cardinality(limit)
+	if errors.Is(err, instance.ErrNotRunning) {
+		_ = configapi.WriteError(w, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		_ = configapi.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := configapi.WriteResponse(w, http.StatusOK, stats); err != nil {
+		level.Error(a.logger).Log("msg", "failed to write response", "err", err)
+	}
+}
+
+// targetDebugger is implemented by instances which can scrape a target on
+// demand.
+type targetDebugger interface {
+	DebugScrape(ctx context.Context, job, url string) (*instance.DebugScrapeResult, error)
+}
+
+// DebugScrapeHandler scrapes one of an instance's active targets once and
+// returns what it exposed, which series would be written to the WAL, and
+// which series were dropped by metric_relabel_configs. Nothing is written to
+// the WAL.
+func (a *Agent) DebugScrapeHandler(w http.ResponseWriter, r *http.Request) {
+	instanceName, err := getInstanceName(r)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	managedInstance, err := a.InstanceManager().GetInstance(instanceName)
+	if err != nil {
+		_ = configapi.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	debugger, ok := managedInstance.(targetDebugger)
+	if !ok {
+		_ = configapi.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("instance %s does not support debugging targets", instanceName))
+		return
+	}
+
+	res, err := debugger.DebugScrape(r.Context(), r.FormValue("job"), r.FormValue("url"))
+	if err != nil {
+		code := http.StatusBadRequest
+		switch {
+		case errors.Is(err, instance.ErrTargetNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, instance.ErrNotRunning):
+			code = http.StatusServiceUnavailable
+		}
+		_ = configapi.WriteError(w, code, err)
+		return
+	}
+	if err := configapi.WriteResponse(w, http.StatusOK, res); err != nil {
+		level.Error(a.logger).Log("msg", "failed to write response", "err", err)
+	}
+}
@@ -1,19 +1,29 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
 	"github.com/grafana/agent/pkg/metrics/instance"
+	"github.com/grafana/agent/pkg/metrics/push"
+	"github.com/grafana/agent/pkg/metrics/wal"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/scrape"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -21,7 +31,7 @@ func TestAgent_ListInstancesHandler(t *testing.T) {
 	fact := newFakeInstanceFactory()
 	a, err := newAgent(prometheus.NewRegistry(), Config{
 		WALDir: "/tmp/agent",
-	}, log.NewNopLogger(), fact.factory)
+	}, nil, log.NewNopLogger(), fact.factory)
 	require.NoError(t, err)
 	defer a.Stop()
 
@@ -51,7 +61,7 @@ func TestAgent_ListTargetsHandler(t *testing.T) {
 	fact := newFakeInstanceFactory()
 	a, err := newAgent(prometheus.NewRegistry(), Config{
 		WALDir: "/tmp/agent",
-	}, log.NewNopLogger(), fact.factory)
+	}, nil, log.NewNopLogger(), fact.factory)
 	require.NoError(t, err)
 
 	mockManager := &instance.MockManager{
@@ -140,3 +150,604 @@ type mockInstanceScrape struct {
 func (i *mockInstanceScrape) TargetsActive() map[string][]*scrape.Target {
 	return i.tgts
 }
+
+func TestAgent_QueryHandlers(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, nil, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	s, err := wal.NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	defer s.Close()
+
+	app := s.Appender(context.Background())
+	lbls := labels.FromStrings("__name__", "up", "job", "test")
+	for ts := int64(0); ts <= 60; ts += 15 {
+		_, err := app.Append(0, lbls, ts*1000, float64(ts))
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	mockManager := &instance.MockManager{
+		GetInstanceFunc: func(name string) (instance.ManagedInstance, error) {
+			switch name {
+			case "queryable":
+				return &mockInstanceQuery{q: s}, nil
+			case "unqueryable":
+				return &mockInstanceScrape{}, nil
+			default:
+				return nil, fmt.Errorf("instance %s does not exist", name)
+			}
+		},
+		StopFunc: func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	a.WireAPI(router)
+
+	tt := []struct {
+		name       string
+		method     string
+		path       string
+		form       url.Values
+		expectCode int
+		expectBody string
+	}{
+		{
+			name:       "instant query",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/queryable/query",
+			form:       url.Values{"query": {"up"}, "time": {"45"}},
+			expectCode: http.StatusOK,
+			expectBody: `{
+				"status": "success",
+				"data": {
+					"resultType": "vector",
+					"result": [{"metric": {"__name__": "up", "job": "test"}, "value": [45, "45"]}]
+				}
+			}`,
+		},
+		{
+			name:       "instant query with POST",
+			method:     http.MethodPost,
+			path:       "/agent/api/v1/metrics/instance/queryable/query",
+			form:       url.Values{"query": {"up * 2"}, "time": {"1970-01-01T00:00:30Z"}},
+			expectCode: http.StatusOK,
+			expectBody: `{
+				"status": "success",
+				"data": {
+					"resultType": "vector",
+					"result": [{"metric": {"job": "test"}, "value": [30, "60"]}]
+				}
+			}`,
+		},
+		{
+			name:       "range query",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/queryable/query_range",
+			form:       url.Values{"query": {"up"}, "start": {"0"}, "end": {"60"}, "step": {"30s"}},
+			expectCode: http.StatusOK,
+			expectBody: `{
+				"status": "success",
+				"data": {
+					"resultType": "matrix",
+					"result": [{"metric": {"__name__": "up", "job": "test"}, "values": [[0, "0"], [30, "30"], [60, "60"]]}]
+				}
+			}`,
+		},
+		{
+			name:       "invalid query",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/queryable/query",
+			form:       url.Values{"query": {"up{"}},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid step",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/queryable/query_range",
+			form:       url.Values{"query": {"up"}, "start": {"0"}, "end": {"60"}, "step": {"0"}},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "missing instance",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/missing/query",
+			form:       url.Values{"query": {"up"}},
+			expectCode: http.StatusNotFound,
+		},
+		{
+			name:       "unqueryable instance",
+			method:     http.MethodGet,
+			path:       "/agent/api/v1/metrics/instance/unqueryable/query",
+			form:       url.Values{"query": {"up"}},
+			expectCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var r *http.Request
+			if tc.method == http.MethodPost {
+				r = httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tc.method, tc.path+"?"+tc.form.Encode(), nil)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			require.Equal(t, tc.expectCode, rr.Result().StatusCode, rr.Body.String())
+
+			if tc.expectBody != "" {
+				require.JSONEq(t, tc.expectBody, rr.Body.String())
+			} else {
+				var resp struct {
+					Status    string `json:"status"`
+					ErrorType string `json:"errorType"`
+					Error     string `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				require.Equal(t, "error", resp.Status)
+				require.NotEmpty(t, resp.ErrorType)
+				require.NotEmpty(t, resp.Error)
+			}
+		})
+	}
+}
+
+type mockInstanceQuery struct {
+	instance.NoOpInstance
+	q storage.Queryable
+}
+
+func (i *mockInstanceQuery) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	return i.q.Querier(ctx, mint, maxt)
+}
+
+func TestAgent_RemoteWriteHandlers(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, nil, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	offset := time.Unix(60, 0).UTC()
+	inst := &mockInstanceRemoteWrite{
+		status: []instance.RemoteWriteStatus{{
+			Name:   "default",
+			URL:    "http://localhost:9009/api/prom/push",
+			Offset: &offset,
+		}},
+	}
+
+	mockManager := &instance.MockManager{
+		GetInstanceFunc: func(name string) (instance.ManagedInstance, error) {
+			switch name {
+			case "test":
+				return inst, nil
+			case "unsupported":
+				return &mockInstanceScrape{}, nil
+			default:
+				return nil, fmt.Errorf("instance %s does not exist", name)
+			}
+		},
+		StopFunc: func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	a.WireAPI(router)
+
+	t.Run("status", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/agent/api/v1/metrics/instance/test/remote_write", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode)
+		require.JSONEq(t, `{
+			"status": "success",
+			"data": [{
+				"name": "default",
+				"url": "http://localhost:9009/api/prom/push",
+				"best_effort": false,
+				"offset": "1970-01-01T00:01:00Z"
+			}]
+		}`, rr.Body.String())
+	})
+
+	t.Run("rewind", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/agent/api/v1/metrics/instance/test/remote_write/default/rewind?from=30", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		require.Equal(t, http.StatusAccepted, rr.Result().StatusCode, rr.Body.String())
+		require.Equal(t, []string{"default"}, inst.rewound)
+		require.Equal(t, time.Unix(30, 0).UTC(), inst.rewoundFrom.UTC())
+	})
+
+	tt := []struct {
+		name       string
+		path       string
+		expectCode int
+	}{
+		{"missing from", "/agent/api/v1/metrics/instance/test/remote_write/default/rewind", http.StatusBadRequest},
+		{"unknown endpoint", "/agent/api/v1/metrics/instance/test/remote_write/missing/rewind?from=30", http.StatusNotFound},
+		{"already resending", "/agent/api/v1/metrics/instance/test/remote_write/busy/rewind?from=30", http.StatusConflict},
+		{"missing instance", "/agent/api/v1/metrics/instance/missing/remote_write/default/rewind?from=30", http.StatusNotFound},
+		{"unsupported instance", "/agent/api/v1/metrics/instance/unsupported/remote_write/default/rewind?from=30", http.StatusServiceUnavailable},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			require.Equal(t, tc.expectCode, rr.Result().StatusCode, rr.Body.String())
+		})
+	}
+}
+
+type mockInstanceRemoteWrite struct {
+	instance.NoOpInstance
+
+	status      []instance.RemoteWriteStatus
+	rewound     []string
+	rewoundFrom time.Time
+}
+
+func (i *mockInstanceRemoteWrite) RemoteWriteStatus() ([]instance.RemoteWriteStatus, error) {
+	return i.status, nil
+}
+
+func (i *mockInstanceRemoteWrite) RewindRemoteWrite(name string, from time.Time) error {
+	switch name {
+	case "default":
+		i.rewound = append(i.rewound, name)
+		i.rewoundFrom = from
+		return nil
+	case "busy":
+		return instance.ErrResendRunning
+	default:
+		return instance.ErrRemoteWriteNotFound
+	}
+}
+
+func TestAgent_PushHandlers(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, nil, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	inst := &mockInstancePush{
+		cfg: push.Config{BearerToken: "token"},
+	}
+	mockManager := &instance.MockManager{
+		GetInstanceFunc: func(name string) (instance.ManagedInstance, error) {
+			if name != "test" {
+				return nil, fmt.Errorf("instance %s does not exist", name)
+			}
+			return inst, nil
+		},
+		StopFunc: func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	a.WireAPI(router)
+
+	tt := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		token       string
+		expectCode  int
+		expectName  string
+	}{
+		{
+			name:        "prometheus text",
+			path:        "/agent/api/v1/metrics/instance/test/write",
+			contentType: "text/plain",
+			body:        "up 1 1000\n",
+			token:       "token",
+			expectCode:  http.StatusNoContent,
+			expectName:  "up",
+		},
+		{
+			name:       "influx v1",
+			path:       "/agent/api/v1/metrics/instance/test/influx/write?precision=ms",
+			body:       "cpu usage=1 1000",
+			token:      "token",
+			expectCode: http.StatusNoContent,
+			expectName: "cpu_usage",
+		},
+		{
+			name:       "influx v2",
+			path:       "/agent/api/v1/metrics/instance/test/influx/api/v2/write?precision=ms",
+			body:       "mem used=1 1000",
+			token:      "token",
+			expectCode: http.StatusNoContent,
+			expectName: "mem_used",
+		},
+		{
+			name:        "otlp",
+			path:        "/agent/api/v1/metrics/instance/test/otlp/v1/metrics",
+			contentType: "application/json",
+			body:        "{}",
+			token:       "token",
+			expectCode:  http.StatusOK,
+		},
+		{
+			name:        "unauthorized",
+			path:        "/agent/api/v1/metrics/instance/test/write",
+			contentType: "text/plain",
+			body:        "up 1 1000\n",
+			expectCode:  http.StatusUnauthorized,
+		},
+		{
+			name:        "unsupported content type",
+			path:        "/agent/api/v1/metrics/instance/test/write",
+			contentType: "application/xml",
+			token:       "token",
+			expectCode:  http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			inst.samples = nil
+
+			r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			require.Equal(t, tc.expectCode, rr.Result().StatusCode, rr.Body.String())
+
+			if tc.expectName != "" {
+				require.Len(t, inst.samples, 1)
+				require.Equal(t, tc.expectName, inst.samples[0].Get(labels.MetricName))
+			}
+		})
+	}
+}
+
+type mockInstancePush struct {
+	instance.NoOpInstance
+
+	cfg     push.Config
+	samples []labels.Labels
+}
+
+func (i *mockInstancePush) PushConfig() push.Config { return i.cfg }
+
+func (i *mockInstancePush) Appender(_ context.Context) storage.Appender {
+	return &mockPushAppender{i: i}
+}
+
+type mockPushAppender struct {
+	i       *mockInstancePush
+	pending []labels.Labels
+}
+
+func (a *mockPushAppender) Append(_ storage.SeriesRef, l labels.Labels, _ int64, _ float64) (storage.SeriesRef, error) {
+	a.pending = append(a.pending, l)
+	return 0, nil
+}
+
+func (a *mockPushAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *mockPushAppender) Commit() error {
+	a.i.samples = append(a.i.samples, a.pending...)
+	return nil
+}
+
+func (a *mockPushAppender) Rollback() error { return nil }
+
+func TestAgent_CardinalityHandler(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, nil, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	inst := &mockInstanceCardinality{}
+	mockManager := &instance.MockManager{
+		GetInstanceFunc: func(name string) (instance.ManagedInstance, error) {
+			switch name {
+			case "test":
+				return inst, nil
+			case "unsupported":
+				return &mockInstanceScrape{}, nil
+			default:
+				return nil, fmt.Errorf("instance %s does not exist", name)
+			}
+		},
+		StopFunc: func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	a.WireAPI(router)
+
+	t.Run("stats", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/agent/api/v1/metrics/instance/test/cardinality?limit=1", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		require.Equal(t, 1, inst.limit)
+		require.JSONEq(t, `{
+			"status": "success",
+			"data": {
+				"active_series": 150,
+				"max_active_series": 1000,
+				"series_count_by_metric_name": [{"name": "container_cpu", "series": 100, "limit": 100}],
+				"label_value_count_by_label_name": [{"name": "pod", "values": 50}]
+			}
+		}`, rr.Body.String())
+	})
+
+	tt := []struct {
+		name       string
+		path       string
+		expectCode int
+	}{
+		{"invalid limit", "/agent/api/v1/metrics/instance/test/cardinality?limit=-1", http.StatusBadRequest},
+		{"missing instance", "/agent/api/v1/metrics/instance/missing/cardinality", http.StatusNotFound},
+		{"unsupported instance", "/agent/api/v1/metrics/instance/unsupported/cardinality", http.StatusServiceUnavailable},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			require.Equal(t, tc.expectCode, rr.Result().StatusCode, rr.Body.String())
+		})
+	}
+}
+
+type mockInstanceCardinality struct {
+	instance.NoOpInstance
+
+	limit int
+}
+
+func (i *mockInstanceCardinality) Cardinality(limit int) (wal.CardinalityStats, error) {
+	i.limit = limit
+	return wal.CardinalityStats{
+		ActiveSeries:               150,
+		MaxActiveSeries:            1000,
+		SeriesCountByMetricName:    []wal.MetricSeriesCount{{Name: "container_cpu", Series: 100, Limit: 100}},
+		LabelValueCountByLabelName: []wal.LabelValueCount{{Name: "pod", Values: 50}},
+	}, nil
+}
+
+func TestAgent_DebugScrapeHandler(t *testing.T) {
+	fact := newFakeInstanceFactory()
+	a, err := newAgent(prometheus.NewRegistry(), Config{
+		WALDir: "/tmp/agent",
+	}, nil, log.NewNopLogger(), fact.factory)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	inst := &mockInstanceDebugScrape{}
+	mockManager := &instance.MockManager{
+		GetInstanceFunc: func(name string) (instance.ManagedInstance, error) {
+			switch name {
+			case "test":
+				return inst, nil
+			case "unsupported":
+				return &mockInstanceScrape{}, nil
+			default:
+				return nil, fmt.Errorf("instance %s does not exist", name)
+			}
+		},
+		StopFunc: func() {},
+	}
+	a.mm, err = instance.NewModalManager(prometheus.NewRegistry(), a.logger, mockManager, instance.ModeDistinct)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	a.WireAPI(router)
+
+	t.Run("scrape", func(t *testing.T) {
+		path := "/agent/api/v1/metrics/instance/test/debug_scrape?job=node&url=" + url.QueryEscape("http://localhost:9100/metrics")
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, rr.Body.String())
+		require.JSONEq(t, `{
+			"status": "success",
+			"data": {
+				"job": "node",
+				"url": "http://localhost:9100/metrics",
+				"labels": {"job": "node"},
+				"content_type": "text/plain",
+				"scrape_duration_ms": 5,
+				"raw": "up 1\nnode_load1 0.5\n",
+				"series": [{"labels": {"__name__": "up", "job": "node"}, "value": "1"}],
+				"dropped": [{
+					"labels": {"__name__": "node_load1", "job": "node"},
+					"value": "0.5",
+					"rule": 0,
+					"action": "drop",
+					"reason": "source_labels [__name__] matched regex \"node_load.*\""
+				}]
+			}
+		}`, rr.Body.String())
+	})
+
+	tt := []struct {
+		name       string
+		path       string
+		expectCode int
+	}{
+		{"missing url", "/agent/api/v1/metrics/instance/test/debug_scrape", http.StatusBadRequest},
+		{"unknown target", "/agent/api/v1/metrics/instance/test/debug_scrape?url=http%3A%2F%2Fmissing", http.StatusNotFound},
+		{"missing instance", "/agent/api/v1/metrics/instance/missing/debug_scrape?url=http%3A%2F%2Fmissing", http.StatusNotFound},
+		{"unsupported instance", "/agent/api/v1/metrics/instance/unsupported/debug_scrape?url=http%3A%2F%2Fmissing", http.StatusServiceUnavailable},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+			require.Equal(t, tc.expectCode, rr.Result().StatusCode, rr.Body.String())
+		})
+	}
+}
+
+type mockInstanceDebugScrape struct {
+	instance.NoOpInstance
+}
+
+func (i *mockInstanceDebugScrape) DebugScrape(_ context.Context, job, targetURL string) (*instance.DebugScrapeResult, error) {
+	switch {
+	case targetURL == "":
+		return nil, fmt.Errorf("target URL must be provided")
+	case targetURL != "http://localhost:9100/metrics":
+		return nil, instance.ErrTargetNotFound
+	}
+
+	return &instance.DebugScrapeResult{
+		Job:            job,
+		URL:            targetURL,
+		Labels:         labels.FromStrings("job", job),
+		ContentType:    "text/plain",
+		ScrapeDuration: 5,
+		Raw:            "up 1\nnode_load1 0.5\n",
+		Series: []instance.DebugSeries{{
+			Labels: labels.FromStrings("__name__", "up", "job", job),
+			Value:  "1",
+		}},
+		Dropped: []instance.DroppedSeries{{
+			DebugSeries: instance.DebugSeries{
+				Labels: labels.FromStrings("__name__", "node_load1", "job", job),
+				Value:  "0.5",
+			},
+			Rule:   0,
+			Action: relabel.Drop,
+			Reason: `source_labels [__name__] matched regex "node_load.*"`,
+		}},
+	}, nil
+}
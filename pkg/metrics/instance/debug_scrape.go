@@ -0,0 +1,330 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/scrape"
+)
+
+// ErrTargetNotFound is returned by DebugScrape when no active target matches
+// the requested job and URL.
+var ErrTargetNotFound = errors.New("target not found")
+
+// DebugScrapeResult is the result of a one-off scrape of a target.
+type DebugScrapeResult struct {
+	Job    string        `json:"job"`
+	URL    string        `json:"url"`
+	Labels labels.Labels `json:"labels"`
+
+	ContentType    string `json:"content_type"`
+	ScrapeDuration int64  `json:"scrape_duration_ms"`
+
+	// ScrapeError is set if the target couldn't be scraped or its response
+	// couldn't be parsed. Series parsed before the error are still returned.
+	ScrapeError string `json:"scrape_error,omitempty"`
+
+	// Raw is the body returned by the target.
+	Raw string `json:"raw"`
+
+	// Series holds the series which would be written to the WAL, after target
+	// labels and metric_relabel_configs have been applied.
+	Series []DebugSeries `json:"series"`
+
+	// Dropped holds the series which were dropped by metric_relabel_configs.
+	Dropped []DroppedSeries `json:"dropped"`
+}
+
+// DebugSeries is a sample returned by a target.
+type DebugSeries struct {
+	Labels labels.Labels `json:"labels"`
+
+	// Value is formatted as a string so special values like NaN can be
+	// represented in JSON.
+	Value string `json:"value"`
+
+	// Timestamp in milliseconds, only set if the target exposed one and the
+	// scrape config honors timestamps.
+	Timestamp *int64 `json:"timestamp,omitempty"`
+}
+
+// DroppedSeries is a sample which was dropped by metric_relabel_configs.
+type DroppedSeries struct {
+	DebugSeries
+
+	// Rule is the index of the metric_relabel_configs rule which dropped the
+	// series. Labels are the labels of the series before that rule was
+	// applied.
+	Rule   int            `json:"rule"`
+	Action relabel.Action `json:"action"`
+	Reason string         `json:"reason"`
+}
+
+// DebugScrape scrapes an active target once using the settings of its
+// scrape config, including authentication, TLS and relabeling, and returns
+// what the target exposed. Nothing is written to the WAL.
+//
+// The target is identified by its URL, as reported by the targets API. job
+// may be empty if only one job has a target with that URL.
+func (i *Instance) DebugScrape(ctx context.Context, job, url string) (*DebugScrapeResult, error) {
+	target, err := i.findTarget(job, url)
+	if err != nil {
+		return nil, err
+	}
+	job = target.job
+
+	i.mut.Lock()
+	var sc *config.ScrapeConfig
+	for _, c := range i.cfg.ScrapeConfigs {
+		if c.JobName == job {
+			sc = c
+			break
+		}
+	}
+	i.mut.Unlock()
+
+	if sc == nil {
+		return nil, fmt.Errorf("%w: job %q no longer exists", ErrTargetNotFound, job)
+	}
+	return debugScrape(ctx, sc, target.Target)
+}
+
+type jobTarget struct {
+	*scrape.Target
+	job string
+}
+
+func (i *Instance) findTarget(job, url string) (jobTarget, error) {
+	if url == "" {
+		return jobTarget{}, errors.New("target URL must be provided")
+	}
+
+	active := i.TargetsActive()
+	if active == nil {
+		return jobTarget{}, ErrNotRunning
+	}
+
+	var found []jobTarget
+	for name, targets := range active {
+		if job != "" && name != job {
+			continue
+		}
+		for _, t := range targets {
+			if t.URL().String() == url {
+				found = append(found, jobTarget{Target: t, job: name})
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return jobTarget{}, fmt.Errorf("%w: no active target with URL %q", ErrTargetNotFound, url)
+	case 1:
+		return found[0], nil
+	default:
+		jobs := make([]string, 0, len(found))
+		for _, t := range found {
+			jobs = append(jobs, t.job)
+		}
+		sort.Strings(jobs)
+		return jobTarget{}, fmt.Errorf("multiple jobs have a target with URL %q, a job must be provided: %v", url, jobs)
+	}
+}
+
+// debugAcceptHeader matches the Accept header sent by Prometheus scrapes.
+const debugAcceptHeader = `application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1`
+
+func debugScrape(ctx context.Context, sc *config.ScrapeConfig, target *scrape.Target) (*DebugScrapeResult, error) {
+	res := &DebugScrapeResult{
+		Job:     sc.JobName,
+		URL:     target.URL().String(),
+		Labels:  target.Labels(),
+		Series:  []DebugSeries{},
+		Dropped: []DroppedSeries{},
+	}
+
+	client, err := config_util.NewClientFromConfig(sc.HTTPClientConfig, sc.JobName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP client: %w", err)
+	}
+
+	timeout := time.Duration(sc.ScrapeTimeout)
+	if v := target.GetValue(model.ScrapeTimeoutLabel); v != "" {
+		if d, err := model.ParseDuration(v); err == nil {
+			timeout = time.Duration(d)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, res.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", debugAcceptHeader)
+	req.Header.Set("User-Agent", scrape.UserAgent)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
+
+	start := time.Now()
+	body, contentType, err := doDebugScrape(client, req, int64(sc.BodySizeLimit))
+	res.ScrapeDuration = time.Since(start).Milliseconds()
+	res.ContentType = contentType
+	res.Raw = string(body)
+	if err != nil {
+		res.ScrapeError = err.Error()
+		return res, nil
+	}
+
+	// As with regular scrapes, an invalid content type falls back to the
+	// Prometheus text format.
+	p, _ := textparse.New(body, contentType)
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			res.ScrapeError = fmt.Sprintf("error parsing response: %s", err)
+			break
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+
+		_, ts, v := p.Series()
+		if !sc.HonorTimestamps {
+			ts = nil
+		}
+		var lset labels.Labels
+		p.Metric(&lset)
+
+		series := DebugSeries{
+			Labels:    applyTargetLabels(lset, target.Labels(), sc.HonorLabels),
+			Value:     strconv.FormatFloat(v, 'f', -1, 64),
+			Timestamp: ts,
+		}
+		if dropped := applyMetricRelabel(&series, sc.MetricRelabelConfigs); dropped != nil {
+			res.Dropped = append(res.Dropped, *dropped)
+			continue
+		}
+		res.Series = append(res.Series, series)
+	}
+	return res, nil
+}
+
+// doDebugScrape performs req and returns the response body and content type.
+// The body is returned even if the target responded with an error.
+func doDebugScrape(client *http.Client, req *http.Request, bodySizeLimit int64) ([]byte, string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if bodySizeLimit <= 0 {
+		bodySizeLimit = math.MaxInt64
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, bodySizeLimit))
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case err != nil:
+		return body, contentType, err
+	case resp.StatusCode != http.StatusOK:
+		return body, contentType, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	case int64(len(body)) >= bodySizeLimit:
+		return body, contentType, fmt.Errorf("body size limit of %d bytes exceeded", bodySizeLimit)
+	}
+	return body, contentType, nil
+}
+
+// applyTargetLabels adds target labels to the labels of a scraped series in
+// the same way as Prometheus scrapes: with honor_labels, labels exposed by the
+// target win; otherwise conflicting exposed labels are renamed with an
+// exported_ prefix.
+func applyTargetLabels(lset, targetLabels labels.Labels, honor bool) labels.Labels {
+	lb := labels.NewBuilder(lset)
+
+	if honor {
+		for _, l := range targetLabels {
+			if !lset.Has(l.Name) {
+				lb.Set(l.Name, l.Value)
+			}
+		}
+		return lb.Labels()
+	}
+
+	var conflicting labels.Labels
+	for _, l := range targetLabels {
+		if v := lset.Get(l.Name); v != "" {
+			conflicting = append(conflicting, labels.Label{Name: l.Name, Value: v})
+		}
+		lb.Set(l.Name, l.Value)
+	}
+
+	sort.SliceStable(conflicting, func(i, j int) bool {
+		return len(conflicting[i].Name) < len(conflicting[j].Name)
+	})
+	for i, l := range conflicting {
+		name := l.Name
+		for {
+			name = model.ExportedLabelPrefix + name
+			if !lset.Has(name) && !targetLabels.Has(name) && !conflicting[:i].Has(name) {
+				conflicting[i].Name = name
+				break
+			}
+		}
+	}
+	for _, l := range conflicting {
+		lb.Set(l.Name, l.Value)
+	}
+	return lb.Labels()
+}
+
+// applyMetricRelabel applies rules to the labels of series one at a time. If
+// a rule drops the series, the rule which dropped it is returned.
+func applyMetricRelabel(series *DebugSeries, rules []*relabel.Config) *DroppedSeries {
+	for idx, rule := range rules {
+		next := relabel.Process(series.Labels, rule)
+		if next == nil {
+			return &DroppedSeries{
+				DebugSeries: *series,
+				Rule:        idx,
+				Action:      rule.Action,
+				Reason:      dropReason(rule),
+			}
+		}
+		series.Labels = next
+	}
+	return nil
+}
+
+func dropReason(rule *relabel.Config) string {
+	// Regexes are stored anchored; report them as they were configured.
+	regex := strings.TrimSuffix(strings.TrimPrefix(rule.Regex.String(), "^(?:"), ")$")
+
+	switch rule.Action {
+	case relabel.Keep:
+		return fmt.Sprintf("source_labels [%s] didn't match regex %q", rule.SourceLabels, regex)
+	case relabel.Drop:
+		return fmt.Sprintf("source_labels [%s] matched regex %q", rule.SourceLabels, regex)
+	default:
+		return fmt.Sprintf("%s rule removed all labels", rule.Action)
+	}
+}
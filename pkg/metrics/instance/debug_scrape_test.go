@@ -0,0 +1,119 @@
+package instance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugScrape(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(`# TYPE requests_total counter
+requests_total{code="200",job="exposed"} 10
+requests_total{code="500",job="exposed"} 2
+go_goroutines 5 1000
+`))
+	}))
+	defer srv.Close()
+
+	sc := config.DefaultScrapeConfig
+	sc.JobName = "test"
+	sc.ScrapeTimeout = model.Duration(time.Second)
+	sc.MetricRelabelConfigs = []*relabel.Config{
+		{
+			SourceLabels: model.LabelNames{"__name__"},
+			Regex:        relabel.MustNewRegexp("requests_total"),
+			Action:       relabel.Keep,
+		},
+		{
+			SourceLabels: model.LabelNames{"code"},
+			Regex:        relabel.MustNewRegexp("5.."),
+			Action:       relabel.Drop,
+		},
+	}
+
+	res, err := debugScrape(context.Background(), &sc, newDebugTarget(t, srv.URL))
+	require.NoError(t, err)
+
+	require.Empty(t, res.ScrapeError)
+	require.Equal(t, "text/plain; version=0.0.4", res.ContentType)
+	require.Contains(t, res.Raw, "go_goroutines 5 1000")
+
+	// Conflicting exposed labels are renamed.
+	require.Equal(t, []DebugSeries{{
+		Labels: labels.FromStrings("__name__", "requests_total", "code", "200", "exported_job", "exposed", "instance", "target", "job", "test"),
+		Value:  "10",
+	}}, res.Series)
+
+	require.Len(t, res.Dropped, 2)
+	require.Equal(t, 1, res.Dropped[0].Rule)
+	require.Equal(t, relabel.Drop, res.Dropped[0].Action)
+	require.Equal(t, "500", res.Dropped[0].Labels.Get("code"))
+
+	require.Equal(t, 0, res.Dropped[1].Rule)
+	require.Equal(t, relabel.Keep, res.Dropped[1].Action)
+	require.Equal(t, `source_labels [__name__] didn't match regex "requests_total"`, res.Dropped[1].Reason)
+	require.Equal(t, int64(1000), *res.Dropped[1].Timestamp)
+}
+
+func TestDebugScrape_HonorLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("up{job=\"exposed\"} 1\n"))
+	}))
+	defer srv.Close()
+
+	sc := config.DefaultScrapeConfig
+	sc.JobName = "test"
+	sc.HonorLabels = true
+	sc.ScrapeTimeout = model.Duration(time.Second)
+
+	res, err := debugScrape(context.Background(), &sc, newDebugTarget(t, srv.URL))
+	require.NoError(t, err)
+	require.Equal(t, []DebugSeries{{
+		Labels: labels.FromStrings("__name__", "up", "instance", "target", "job", "exposed"),
+		Value:  "1",
+	}}, res.Series)
+}
+
+func TestDebugScrape_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sc := config.DefaultScrapeConfig
+	sc.JobName = "test"
+	sc.ScrapeTimeout = model.Duration(time.Second)
+
+	res, err := debugScrape(context.Background(), &sc, newDebugTarget(t, srv.URL))
+	require.NoError(t, err)
+	require.Equal(t, "server returned HTTP status 500 Internal Server Error", res.ScrapeError)
+	require.Equal(t, "something went wrong\n", res.Raw)
+	require.Empty(t, res.Series)
+}
+
+func newDebugTarget(t *testing.T, rawURL string) *scrape.Target {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	return scrape.NewTarget(labels.FromStrings(
+		model.AddressLabel, u.Host,
+		model.SchemeLabel, u.Scheme,
+		model.MetricsPathLabel, "/metrics",
+		model.JobLabel, "test",
+		model.InstanceLabel, "target",
+	), nil, nil)
+}
@@ -270,11 +270,13 @@ func hashConfig(c Config) (string, error) {
 	// Assign names to remote_write configs if they're not present already.
 	// This is also done in AssignDefaults but is duplicated here for the sake
 	// of simplifying responsibility of GroupManager.
+	renamed := make(map[string]string, len(groupable.RemoteWrite))
 	for _, cfg := range groupable.RemoteWrite {
 		if cfg != nil {
 			// We don't care if the names are different, just that the other settings
 			// are the same. Blank out the name here before hashing the remote
 			// write config.
+			oldName := cfg.Name
 			cfg.Name = ""
 
 			hash, err := getHash(cfg)
@@ -282,9 +284,19 @@ func hashConfig(c Config) (string, error) {
 				return "", err
 			}
 			cfg.Name = hash[:6]
+			renamed[oldName] = cfg.Name
 		}
 	}
 
+	// best_effort_remote_write refers to remote_writes by name, so it must
+	// refer to them by their hashed names too.
+	for i, name := range groupable.BestEffortRemoteWrite {
+		if newName, ok := renamed[name]; ok {
+			groupable.BestEffortRemoteWrite[i] = newName
+		}
+	}
+	sort.Strings(groupable.BestEffortRemoteWrite)
+
 	// Now sort remote_writes by name and nil-ness.
 	sort.Slice(groupable.RemoteWrite, func(i, j int) bool {
 		switch {
@@ -331,16 +343,39 @@ func groupConfigs(groupName string, grouped groupedConfigs) (Config, error) {
 	// If the grouped configs are coming from the scraping service, defaults will have
 	// been applied and the remote names will be prefixed with the old instance config name.
 	for _, rwc := range combined.RemoteWrite {
-		// Blank out the existing name before getting the hash so it is doesn't take into
-		// account any existing name.
-		rwc.Name = ""
-
-		hash, err := getHash(rwc)
+		name, err := groupedRemoteWriteName(groupName, rwc)
 		if err != nil {
 			return Config{}, err
 		}
+		rwc.Name = name
+	}
+
+	// Remember the names the ungrouped configs used for their remote_writes so
+	// they can still be referred to by those names, such as when rewinding
+	// them.
+	for _, cfg := range cfgs {
+		for _, rwc := range cfg.RemoteWrite {
+			if rwc.Name == "" {
+				continue
+			}
+			name, err := groupedRemoteWriteName(groupName, rwc)
+			if err != nil {
+				return Config{}, err
+			}
+			if _, exists := combined.remoteWriteAliases[rwc.Name]; exists {
+				continue
+			}
+			if combined.remoteWriteAliases == nil {
+				combined.remoteWriteAliases = make(map[string]string)
+			}
+			combined.remoteWriteAliases[rwc.Name] = name
+		}
+	}
 
-		rwc.Name = groupName[:6] + "-" + hash[:6]
+	// best_effort_remote_write is the same across the group, but its names
+	// have to be changed to match the renamed remote_writes.
+	for i, name := range combined.BestEffortRemoteWrite {
+		combined.BestEffortRemoteWrite[i] = combined.remoteWriteName(name)
 	}
 
 	// Combine all the scrape configs. It's possible that two different ungrouped
@@ -356,3 +391,18 @@ func groupConfigs(groupName string, grouped groupedConfigs) (Config, error) {
 
 	return combined, nil
 }
+
+// groupedRemoteWriteName returns the name of rwc within the group named
+// groupName. The existing name of rwc is ignored.
+func groupedRemoteWriteName(groupName string, rwc *config.RemoteWriteConfig) (string, error) {
+	// Copy rwc to blank out the existing name before getting the hash so it
+	// doesn't take into account any existing name.
+	unnamed := *rwc
+	unnamed.Name = ""
+
+	hash, err := getHash(&unnamed)
+	if err != nil {
+		return "", err
+	}
+	return groupName[:6] + "-" + hash[:6], nil
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/stretchr/testify/require"
 )
 
@@ -196,6 +198,64 @@ remote_write:
 	require.NotEqual(t, "rw-cfg-a", cfg.RemoteWrite[0].Name)
 }
 
+func TestGroupManager_ApplyConfig_RemoteWriteReferences(t *testing.T) {
+	inner := newFakeManager()
+	gm := NewGroupManager(inner)
+
+	// Both configs have the same remote_writes under different names, so
+	// they're grouped together.
+	configs := []string{`
+name: configA
+scrape_configs: []
+remote_write:
+- name: slow
+  url: http://localhost:9009/api/prom/push1
+- name: fast
+  url: http://localhost:9009/api/prom/push2
+best_effort_remote_write: [slow]`, `
+name: configB
+scrape_configs: []
+remote_write:
+- name: fast-b
+  url: http://localhost:9009/api/prom/push2
+- name: slow-b
+  url: http://localhost:9009/api/prom/push1
+best_effort_remote_write: [slow-b]`,
+	}
+	for _, cfg := range configs {
+		c := testUnmarshalConfig(t, cfg)
+		require.NoError(t, c.ApplyDefaults(DefaultGlobalConfig))
+		require.NoError(t, gm.ApplyConfig(c))
+	}
+	require.Len(t, gm.groups, 1)
+
+	cfg := inner.ListConfigs()[gm.groupLookup["configA"]]
+	slowName := cfg.remoteWriteName("slow")
+	require.NotEqual(t, "slow", slowName)
+	require.Equal(t, slowName, cfg.remoteWriteName("slow-b"))
+
+	// best_effort_remote_write must refer to the renamed remote_write.
+	require.Equal(t, []string{slowName}, cfg.BestEffortRemoteWrite)
+	require.True(t, cfg.isBestEffort(slowName))
+	require.False(t, cfg.isBestEffort(cfg.remoteWriteName("fast")))
+
+	validated, err := cfg.Clone()
+	require.NoError(t, err)
+	require.NoError(t, validated.ApplyDefaults(DefaultGlobalConfig))
+
+	// Remote writes can be rewound by the names used in the ungrouped configs.
+	// Start a resend for the renamed remote_write up front so rewinding it
+	// reports a conflict rather than reading from the WAL.
+	o, err := loadRemoteOffsets(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, o.StartResend(newResend(slowName, 0, 1)))
+
+	inst := &Instance{cfg: cfg, logger: log.NewNopLogger(), remoteOffsets: o}
+	require.ErrorIs(t, inst.RewindRemoteWrite("slow", time.Now().Add(-time.Hour)), ErrResendRunning)
+	require.ErrorIs(t, inst.RewindRemoteWrite("slow-b", time.Now().Add(-time.Hour)), ErrResendRunning)
+	require.ErrorIs(t, inst.RewindRemoteWrite("missing", time.Now().Add(-time.Hour)), ErrRemoteWriteNotFound)
+}
+
 func TestGroupManager_DeleteConfig(t *testing.T) {
 	t.Run("partial delete", func(t *testing.T) {
 		inner := newFakeManager()
@@ -12,12 +12,18 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/agent/pkg/build"
+	"github.com/grafana/agent/pkg/cluster"
+	"github.com/grafana/agent/pkg/metrics/aggregation"
+	"github.com/grafana/agent/pkg/metrics/otlp"
+	"github.com/grafana/agent/pkg/metrics/push"
 	"github.com/grafana/agent/pkg/metrics/wal"
 	"github.com/grafana/agent/pkg/util"
 	"github.com/oklog/run"
@@ -63,6 +69,20 @@ type Config struct {
 	ScrapeConfigs            []*config.ScrapeConfig      `yaml:"scrape_configs,omitempty"`
 	RemoteWrite              []*config.RemoteWriteConfig `yaml:"remote_write,omitempty"`
 
+	// Splits targets between agents running the same config. Each agent only
+	// scrapes the targets which hash to its Shard, out of TotalShards.
+	// Sharding is disabled when TotalShards is 0.
+	//
+	// Shards are static: agents don't know about each other, so targets of an
+	// agent which goes down aren't scraped by any other agent.
+	Shard       int `yaml:"shard,omitempty"`
+	TotalShards int `yaml:"total_shards,omitempty"`
+
+	// Splits targets between the agents of the cluster the agent is a member
+	// of, rebalancing them when agents join or leave. Mutually exclusive with
+	// TotalShards.
+	ClusterSharding bool `yaml:"cluster_sharding,omitempty"`
+
 	// How frequently the WAL should be truncated.
 	WALTruncateFrequency time.Duration `yaml:"wal_truncate_frequency,omitempty"`
 
@@ -70,10 +90,42 @@ type Config struct {
 	MinWALTime time.Duration `yaml:"min_wal_time,omitempty"`
 	MaxWALTime time.Duration `yaml:"max_wal_time,omitempty"`
 
+	// Maximum size of the WAL on disk, and what to do when it's exceeded. The
+	// size is unlimited if MaxWALSize is 0. MaxWALSizePolicy defaults to
+	// wal.SizeLimitDropOldest.
+	MaxWALSize       units.Base2Bytes    `yaml:"max_wal_size,omitempty"`
+	MaxWALSizePolicy wal.SizeLimitPolicy `yaml:"max_wal_size_policy,omitempty"`
+
+	// Compression applied to WAL records. Defaults to wal.CompressionSnappy.
+	WALCompression wal.Compression `yaml:"wal_compression,omitempty"`
+
+	// Maximum number of active series in the WAL, overall and for individual
+	// metric names. Samples which would create a series past a limit are
+	// rejected. 0 means unlimited.
+	MaxActiveSeries          int            `yaml:"max_active_series,omitempty"`
+	MaxActiveSeriesPerMetric map[string]int `yaml:"max_active_series_per_metric,omitempty"`
+
 	RemoteFlushDeadline  time.Duration `yaml:"remote_flush_deadline,omitempty"`
 	WriteStaleOnShutdown bool          `yaml:"write_stale_on_shutdown,omitempty"`
 
+	// Names of remote_write endpoints which don't hold back WAL truncation.
+	BestEffortRemoteWrite []string `yaml:"best_effort_remote_write,omitempty"`
+
+	// OTLP endpoints to export metrics to, alongside remote_write.
+	OTLPExport []*otlp.Config `yaml:"otlp_export,omitempty"`
+
+	// Rules which aggregate scraped samples before they're written to the WAL.
+	AggregationRules []*aggregation.Rule `yaml:"aggregation_rules,omitempty"`
+
+	// Limits and credentials for samples pushed to the instance through the
+	// HTTP API.
+	Push push.Config `yaml:"push_config,omitempty"`
+
 	global GlobalConfig `yaml:"-"`
+
+	// remoteWriteAliases maps names of remote_write endpoints in configs
+	// combined by a GroupManager to their name in this config.
+	remoteWriteAliases map[string]string `yaml:"-"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -120,6 +172,39 @@ func (c *Config) ApplyDefaults(global GlobalConfig) error {
 		return errors.New("remote_flush_deadline must be greater than 0s")
 	case c.MinWALTime > c.MaxWALTime:
 		return errors.New("min_wal_time must be less than max_wal_time")
+	case c.MaxWALSize < 0:
+		return errors.New("max_wal_size must not be negative")
+	case c.MaxActiveSeries < 0:
+		return errors.New("max_active_series must not be negative")
+	case c.TotalShards < 0:
+		return errors.New("total_shards must not be negative")
+	case c.TotalShards == 0 && c.Shard != 0:
+		return errors.New("shard requires total_shards to be set")
+	case c.TotalShards > 0 && (c.Shard < 0 || c.Shard >= c.TotalShards):
+		return fmt.Errorf("shard must be between 0 and %d", c.TotalShards-1)
+	case c.ClusterSharding && c.TotalShards > 0:
+		return errors.New("cluster_sharding and total_shards are mutually exclusive")
+	}
+
+	for name, limit := range c.MaxActiveSeriesPerMetric {
+		if limit <= 0 {
+			return fmt.Errorf("max_active_series_per_metric for %q must be greater than 0", name)
+		}
+	}
+
+	if c.MaxWALSize > 0 {
+		if c.MaxWALSizePolicy == "" {
+			c.MaxWALSizePolicy = wal.SizeLimitDropOldest
+		}
+		if err := c.MaxWALSizePolicy.Validate(); err != nil {
+			return fmt.Errorf("invalid max_wal_size_policy: %w", err)
+		}
+	}
+
+	if c.WALCompression != "" {
+		if err := c.WALCompression.Validate(); err != nil {
+			return fmt.Errorf("invalid wal_compression: %w", err)
+		}
 	}
 
 	jobNames := map[string]struct{}{}
@@ -190,9 +275,85 @@ func (c *Config) ApplyDefaults(global GlobalConfig) error {
 		rwNames[cfg.Name] = struct{}{}
 	}
 
+	for _, name := range c.BestEffortRemoteWrite {
+		if _, exists := rwNames[name]; !exists {
+			return fmt.Errorf("best_effort_remote_write references unknown remote_write %q", name)
+		}
+	}
+
+	otlpNames := map[string]struct{}{}
+	for _, cfg := range c.OTLPExport {
+		if cfg == nil {
+			return fmt.Errorf("empty or null otlp_export config section")
+		}
+
+		// Like with remote_write, names are used to identify the metrics of
+		// each exporter and must be unique.
+		var generatedName bool
+		if cfg.Name == "" {
+			hash, err := getHash(cfg)
+			if err != nil {
+				return err
+			}
+			cfg.Name = c.Name + "-otlp-" + hash[:6]
+			generatedName = true
+		}
+
+		if _, exists := otlpNames[cfg.Name]; exists {
+			if generatedName {
+				return fmt.Errorf("found two identical otlp_export configs")
+			}
+			return fmt.Errorf("found duplicate otlp_export configs with name %q", cfg.Name)
+		}
+		otlpNames[cfg.Name] = struct{}{}
+	}
+
+	for _, rule := range c.AggregationRules {
+		if rule == nil {
+			return fmt.Errorf("empty or null aggregation_rules section")
+		}
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid aggregation rule: %w", err)
+		}
+	}
+
+	if err := c.Push.Validate(); err != nil {
+		return fmt.Errorf("invalid push_config: %w", err)
+	}
+
 	return nil
 }
 
+// remoteWriteNames returns the names of every remote_write endpoint.
+func (c *Config) remoteWriteNames() []string {
+	names := make([]string, 0, len(c.RemoteWrite))
+	for _, rw := range c.RemoteWrite {
+		names = append(names, rw.Name)
+	}
+	return names
+}
+
+// remoteWriteName returns the name of the remote_write endpoint referred to
+// as name. Endpoints may be referred to by the name they had before their
+// config was grouped with others.
+func (c *Config) remoteWriteName(name string) string {
+	if alias, ok := c.remoteWriteAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// isBestEffort returns true if the named remote_write endpoint doesn't hold
+// back WAL truncation.
+func (c *Config) isBestEffort(name string) bool {
+	for _, n := range c.BestEffortRemoteWrite {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Clone makes a deep copy of the config along with global settings.
 func (c *Config) Clone() (Config, error) {
 	bb, err := MarshalConfig(c, false)
@@ -204,6 +365,12 @@ func (c *Config) Clone() (Config, error) {
 		return Config{}, err
 	}
 	cp.global = c.global
+	if c.remoteWriteAliases != nil {
+		cp.remoteWriteAliases = make(map[string]string, len(c.remoteWriteAliases))
+		for k, v := range c.remoteWriteAliases {
+			cp.remoteWriteAliases[k] = v
+		}
+	}
 
 	// Some tests will trip up on this; the marshal/unmarshal cycle might set
 	// an empty slice to nil. Set it back to an empty slice if we detect this
@@ -233,12 +400,27 @@ type Instance struct {
 	discovery          *discoveryService
 	readyScrapeManager *readyScrapeManager
 	remoteStore        *remote.Storage
+	remoteOffsets      *remoteOffsets
+	otlpExporters      []*otlp.Exporter
+	aggregator         *aggregation.Aggregator
 	storage            storage.Storage
 
+	// resendCtx is canceled to stop samples from being resent to remote_write
+	// endpoints.
+	resendCtx     context.Context
+	cancelResends context.CancelFunc
+	resendMetrics *resendMetrics
+	resendWg      sync.WaitGroup
+
 	// ready is set to true after the initialization process finishes
 	ready atomic.Bool
 
-	hostFilter *HostFilter
+	hostFilter  *HostFilter
+	shardFilter *ShardFilter
+
+	// clusterer is used to split targets between agents when ClusterSharding
+	// is enabled.
+	clusterer cluster.Node
 
 	logger log.Logger
 
@@ -248,16 +430,38 @@ type Instance struct {
 
 // New creates a new Instance with a directory for storing the WAL. The instance
 // will not start until Run is called on the instance.
-func New(reg prometheus.Registerer, cfg Config, walDir string, logger log.Logger) (*Instance, error) {
+//
+// clusterer is the cluster the agent is a member of, and must be set for
+// configs which enable ClusterSharding.
+func New(reg prometheus.Registerer, cfg Config, walDir string, clusterer cluster.Node, logger log.Logger) (*Instance, error) {
 	logger = log.With(logger, "instance", cfg.Name)
 
 	instWALDir := filepath.Join(walDir, cfg.Name)
 
 	newWal := func(reg prometheus.Registerer) (walStorage, error) {
-		return wal.NewStorage(logger, reg, instWALDir)
+		opts := wal.DefaultOptions
+		if cfg.WALCompression != "" {
+			opts.Compression = cfg.WALCompression
+		}
+
+		s, err := wal.NewStorageWithOptions(logger, reg, instWALDir, opts)
+		if err != nil {
+			return nil, err
+		}
+		s.SetSizeLimit(int64(cfg.MaxWALSize), cfg.MaxWALSizePolicy)
+		s.SetSeriesLimits(wal.SeriesLimits{
+			MaxActiveSeries: cfg.MaxActiveSeries,
+			PerMetric:       cfg.MaxActiveSeriesPerMetric,
+		})
+		return s, nil
 	}
 
-	return newInstance(cfg, reg, logger, newWal)
+	inst, err := newInstance(cfg, reg, logger, newWal)
+	if err != nil {
+		return nil, err
+	}
+	inst.clusterer = clusterer
+	return inst, nil
 }
 
 func newInstance(cfg Config, reg prometheus.Registerer, logger log.Logger, newWal walStorageFactory) (*Instance, error) {
@@ -338,6 +542,41 @@ func (i *Instance) Run(ctx context.Context) error {
 			},
 		)
 	}
+	{
+		// remote_write offsets and resends
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.saveOffsetsLoop(ctx)
+				level.Info(i.logger).Log("msg", "remote_write offsets loop stopped")
+				return nil
+			},
+			func(err error) {
+				// Resends read from the WAL, so they must stop before it's closed.
+				level.Info(i.logger).Log("msg", "stopping remote_write resends...")
+				i.cancelResends()
+				i.resendWg.Wait()
+				contextCancel()
+			},
+		)
+	}
+	if i.aggregator != nil {
+		// Aggregation loop
+		ctx, contextCancel := context.WithCancel(context.Background())
+		defer contextCancel()
+		rg.Add(
+			func() error {
+				i.aggregator.Run(ctx)
+				level.Info(i.logger).Log("msg", "aggregation loop stopped")
+				return nil
+			},
+			func(err error) {
+				level.Info(i.logger).Log("msg", "stopping aggregation loop...")
+				contextCancel()
+			},
+		)
+	}
 	{
 		sm, err := i.readyScrapeManager.Get()
 		if err != nil {
@@ -358,6 +597,12 @@ func (i *Instance) Run(ctx context.Context) error {
 				level.Info(i.logger).Log("msg", "stopping scrape manager...")
 				sm.Stop()
 
+				// Write aggregated samples for windows which haven't completed
+				// yet now that no more samples will be scraped.
+				if i.aggregator != nil {
+					i.aggregator.Flush()
+				}
+
 				// On a graceful shutdown, write staleness markers. If something went
 				// wrong, then the instance will be relaunched.
 				if err == nil && cfg.WriteStaleOnShutdown {
@@ -374,6 +619,10 @@ func (i *Instance) Run(ctx context.Context) error {
 				if err := i.storage.Close(); err != nil {
 					level.Error(i.logger).Log("msg", "error stopping storage", "err", err)
 				}
+				for _, e := range i.otlpExporters {
+					e.Stop()
+				}
+				i.saveRemoteOffsets()
 			},
 		)
 	}
@@ -413,9 +662,16 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 
 	i.readyScrapeManager = &readyScrapeManager{}
 
+	i.remoteOffsets, err = loadRemoteOffsets(i.wal.Directory())
+	if err != nil {
+		return err
+	}
+	i.resendCtx, i.cancelResends = context.WithCancel(context.Background())
+	i.resendMetrics = newResendMetrics(reg)
+
 	// Setup the remote storage
 	remoteLogger := log.With(i.logger, "component", "remote")
-	i.remoteStore = remote.NewStorage(remoteLogger, reg, i.wal.StartTime, i.wal.Directory(), cfg.RemoteFlushDeadline, i.readyScrapeManager)
+	i.remoteStore = remote.NewStorage(remoteLogger, i.remoteOffsets.Registerer(reg), i.wal.StartTime, i.wal.Directory(), cfg.RemoteFlushDeadline, i.readyScrapeManager)
 	err = i.remoteStore.ApplyConfig(&config.Config{
 		GlobalConfig:       cfg.global.Prometheus,
 		RemoteWriteConfigs: cfg.RemoteWrite,
@@ -424,12 +680,46 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 		return fmt.Errorf("failed applying config to remote storage: %w", err)
 	}
 
+	// remote_write queues only send samples appended after they start.
+	// Samples which were appended before the instance restarted but hadn't
+	// been sent yet are resent in the background.
+	resumeTs := timestamp.FromTime(time.Now())
+	for _, rw := range cfg.RemoteWrite {
+		from, ok := i.remoteOffsets.Persisted(rw.Name)
+		if !ok || from >= resumeTs {
+			continue
+		}
+		if err := i.startResendLocked(cfg, rw, from, resumeTs); err != nil {
+			level.Warn(i.logger).Log("msg", "failed to resume remote_write from its offset", "remote_name", rw.Name, "err", err)
+		}
+	}
+
+	// OTLP exporters read the WAL independently of remote_write.
+	i.otlpExporters, err = i.newOTLPExporters(reg, cfg)
+	if err != nil {
+		return err
+	}
+
 	i.storage = storage.NewFanout(i.logger, i.wal, i.remoteStore)
 
+	// Scraped samples go through the aggregator, if there is one, before
+	// they're written to storage.
+	var scrapeAppendable storage.Appendable = i.storage
+	i.aggregator = nil
+	if len(cfg.AggregationRules) > 0 {
+		i.aggregator, err = aggregation.New(log.With(i.logger, "component", "aggregation"), reg, i.storage, cfg.AggregationRules)
+		if err != nil {
+			return fmt.Errorf("error creating aggregator: %w", err)
+		}
+		scrapeAppendable = i.aggregator
+	}
+
 	opts := &scrape.Options{
 		ExtraMetrics: cfg.global.ExtraMetrics,
 	}
-	scrapeManager := newScrapeManager(opts, log.With(i.logger, "component", "scrape manager"), i.storage)
+	scrapeAppendable = seriesLimitAppendable{Appendable: scrapeAppendable}
+
+	scrapeManager := newScrapeManager(opts, log.With(i.logger, "component", "scrape manager"), scrapeAppendable)
 	err = scrapeManager.ApplyConfig(&config.Config{
 		GlobalConfig:  cfg.global.Prometheus,
 		ScrapeConfigs: cfg.ScrapeConfigs,
@@ -443,6 +733,38 @@ func (i *Instance) initialize(ctx context.Context, reg prometheus.Registerer, cf
 	return nil
 }
 
+// newOTLPExporters creates and starts an exporter for each otlp_export
+// config. Metric types are taken from the metadata of the scrape targets.
+func (i *Instance) newOTLPExporters(reg prometheus.Registerer, cfg *Config) ([]*otlp.Exporter, error) {
+	rsm := i.readyScrapeManager
+	metadata := otlp.NewTargetMetadata(func() map[string][]*scrape.Target {
+		sm, err := rsm.Get()
+		if err != nil {
+			return nil
+		}
+		return sm.TargetsActive()
+	})
+
+	exporters := make([]*otlp.Exporter, 0, len(cfg.OTLPExport))
+	for _, oc := range cfg.OTLPExport {
+		e, err := otlp.NewExporter(log.With(i.logger, "component", "otlp"), reg, *oc, otlp.Options{
+			WALDir:         i.wal.Directory(),
+			ExternalLabels: cfg.global.Prometheus.ExternalLabels,
+			Metadata:       metadata,
+			FlushDeadline:  cfg.RemoteFlushDeadline,
+		})
+		if err != nil {
+			for _, e := range exporters {
+				e.Stop()
+			}
+			return nil, fmt.Errorf("failed to create OTLP exporter %q: %w", oc.Name, err)
+		}
+		e.Start()
+		exporters = append(exporters, e)
+	}
+	return exporters, nil
+}
+
 // Ready returns true if the Instance has been initialized and is ready
 // to start scraping and delivering metrics.
 func (i *Instance) Ready() bool {
@@ -465,12 +787,28 @@ func (i *Instance) Update(c Config) (err error) {
 		err = errImmutableField{Field: "name"}
 	case i.cfg.HostFilter != c.HostFilter:
 		err = errImmutableField{Field: "host_filter"}
+	case (i.cfg.TotalShards > 0) != (c.TotalShards > 0):
+		// Changing the shard is allowed, but enabling or disabling sharding
+		// changes how discovered targets reach the scrape manager.
+		err = errImmutableField{Field: "total_shards"}
+	case i.cfg.ClusterSharding != c.ClusterSharding:
+		err = errImmutableField{Field: "cluster_sharding"}
 	case i.cfg.WALTruncateFrequency != c.WALTruncateFrequency:
 		err = errImmutableField{Field: "wal_truncate_frequency"}
+	case i.cfg.MaxWALSize != c.MaxWALSize:
+		err = errImmutableField{Field: "max_wal_size"}
+	case i.cfg.MaxWALSizePolicy != c.MaxWALSizePolicy:
+		err = errImmutableField{Field: "max_wal_size_policy"}
+	case i.cfg.WALCompression != c.WALCompression:
+		err = errImmutableField{Field: "wal_compression"}
 	case i.cfg.RemoteFlushDeadline != c.RemoteFlushDeadline:
 		err = errImmutableField{Field: "remote_flush_deadline"}
 	case i.cfg.WriteStaleOnShutdown != c.WriteStaleOnShutdown:
 		err = errImmutableField{Field: "write_stale_on_shutdown"}
+	case !reflect.DeepEqual(i.cfg.OTLPExport, c.OTLPExport):
+		err = errImmutableField{Field: "otlp_export"}
+	case !reflect.DeepEqual(i.cfg.AggregationRules, c.AggregationRules):
+		err = errImmutableField{Field: "aggregation_rules"}
 	}
 	if err != nil {
 		return ErrInvalidUpdate{Inner: err}
@@ -507,6 +845,15 @@ func (i *Instance) Update(c Config) (err error) {
 		// mutates what targets will be discovered.
 		i.hostFilter.PatchSD(c.ScrapeConfigs)
 	}
+	if i.shardFilter != nil {
+		i.shardFilter.SetShard(c.Shard, c.TotalShards)
+	}
+	if i.wal != nil {
+		i.wal.SetSeriesLimits(wal.SeriesLimits{
+			MaxActiveSeries: c.MaxActiveSeries,
+			PerMetric:       c.MaxActiveSeriesPerMetric,
+		})
+	}
 
 	err = i.remoteStore.ApplyConfig(&config.Config{
 		GlobalConfig:       c.global.Prometheus,
@@ -571,6 +918,40 @@ func (i *Instance) Appender(ctx context.Context) storage.Appender {
 	return i.wal.Appender(ctx)
 }
 
+// Querier implements storage.Queryable, querying samples which are still in
+// the instance's WAL. Returns an error if the instance hasn't initialized its
+// WAL yet.
+func (i *Instance) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	i.mut.Lock()
+	wal := i.wal
+	i.mut.Unlock()
+
+	if wal == nil {
+		return nil, errors.New("instance WAL has not been initialized yet")
+	}
+	return wal.Querier(ctx, mint, maxt)
+}
+
+// Cardinality reports the active series held by the instance's WAL, including
+// the top limit metric names and label names by number of series.
+func (i *Instance) Cardinality(limit int) (wal.CardinalityStats, error) {
+	i.mut.Lock()
+	s := i.wal
+	i.mut.Unlock()
+
+	if s == nil {
+		return wal.CardinalityStats{}, ErrNotRunning
+	}
+	return s.Cardinality(limit), nil
+}
+
+// PushConfig returns the settings for samples pushed to the instance.
+func (i *Instance) PushConfig() push.Config {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+	return i.cfg.Push
+}
+
 type discoveryService struct {
 	Manager *discovery.Manager
 
@@ -586,7 +967,7 @@ func (s *discoveryService) SyncCh() GroupChannel { return s.SyncChFunc() }
 // newDiscoveryManager returns an implementation of a runnable service
 // that outputs discovered targets to a channel. The implementation
 // uses the Prometheus Discovery Manager. Targets will be filtered
-// if the instance is configured to perform host filtering.
+// if the instance is configured to perform host filtering or sharding.
 func (i *Instance) newDiscoveryManager(ctx context.Context, cfg *Config) (*discoveryService, error) {
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -635,6 +1016,33 @@ func (i *Instance) newDiscoveryManager(ctx context.Context, cfg *Config) (*disco
 		syncChFunc = i.hostFilter.SyncCh
 	}
 
+	// If sharding is enabled, run the shard filter after the host filter.
+	// Unlike the host filter, a new shard filter is created for each run.
+	i.shardFilter = nil
+	switch {
+	case cfg.TotalShards > 0:
+		i.shardFilter = NewShardFilter(log.With(i.logger, "component", "shard filter"), cfg.Shard, cfg.TotalShards)
+	case cfg.ClusterSharding && i.clusterer == nil:
+		cancel()
+		return nil, fmt.Errorf("cluster_sharding requires clustering to be enabled")
+	case cfg.ClusterSharding:
+		i.shardFilter = NewClusterShardFilter(log.With(i.logger, "component", "shard filter"), i.clusterer)
+	}
+	if i.shardFilter != nil {
+
+		shardFilter, inputCh := i.shardFilter, syncChFunc()
+		rg.Add(func() error {
+			shardFilter.Run(inputCh)
+			level.Info(i.logger).Log("msg", "shard filter stopped")
+			return nil
+		}, func(_ error) {
+			level.Info(i.logger).Log("msg", "stopping shard filter...")
+			shardFilter.Stop()
+		})
+
+		syncChFunc = shardFilter.SyncCh
+	}
+
 	return &discoveryService{
 		Manager: manager,
 
@@ -692,13 +1100,14 @@ func (i *Instance) truncateLoop(ctx context.Context, wal walStorage, cfg *Config
 }
 
 // getRemoteWriteTimestamp looks up the last successful remote write timestamp.
-// This is passed to wal.Storage for its truncation. If no remote write sections
-// are configured, getRemoteWriteTimestamp returns the current time.
+// This is passed to wal.Storage for its truncation. If no remote write or OTLP
+// export sections are configured, getRemoteWriteTimestamp returns the current
+// time.
 func (i *Instance) getRemoteWriteTimestamp() int64 {
 	i.mut.Lock()
 	defer i.mut.Unlock()
 
-	if len(i.cfg.RemoteWrite) == 0 {
+	if len(i.cfg.RemoteWrite) == 0 && len(i.cfg.OTLPExport) == 0 {
 		return timestamp.FromTime(time.Now())
 	}
 
@@ -706,12 +1115,200 @@ func (i *Instance) getRemoteWriteTimestamp() int64 {
 		// Instance still being initialized; start at 0.
 		return 0
 	}
-	return i.remoteStore.LowestSentTimestamp()
+
+	// Best effort endpoints don't hold back truncation.
+	var names []string
+	for _, rw := range i.cfg.RemoteWrite {
+		if !i.cfg.isBestEffort(rw.Name) {
+			names = append(names, rw.Name)
+		}
+	}
+
+	var lowest int64 = math.MaxInt64
+	if len(names) > 0 {
+		offsets, err := i.remoteOffsets.Offsets(names)
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "could not determine remote_write offsets", "err", err)
+		}
+		for _, ts := range offsets {
+			if ts < lowest {
+				lowest = ts
+			}
+		}
+	}
+	for _, e := range i.otlpExporters {
+		if ts := e.HighestSentTimestamp(); ts < lowest {
+			lowest = ts
+		}
+	}
+
+	if lowest == math.MaxInt64 {
+		return timestamp.FromTime(time.Now())
+	}
+	return lowest
+}
+
+// remoteOffsetsSaveFrequency is how often remote_write offsets are saved to
+// disk.
+const remoteOffsetsSaveFrequency = 30 * time.Second
+
+func (i *Instance) saveOffsetsLoop(ctx context.Context) {
+	ticker := time.NewTicker(remoteOffsetsSaveFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.saveRemoteOffsets()
+		}
+	}
+}
+
+// saveRemoteOffsets persists how far each remote_write endpoint has been sent
+// data so sending can resume from there after a restart.
+func (i *Instance) saveRemoteOffsets() {
+	i.mut.Lock()
+	offsets := i.remoteOffsets
+	names := i.cfg.remoteWriteNames()
+	i.mut.Unlock()
+
+	if offsets == nil {
+		return
+	}
+	if err := offsets.Save(names); err != nil {
+		level.Warn(i.logger).Log("msg", "could not save remote_write offsets", "err", err)
+	}
+}
+
+// startResendLocked starts resending samples in (from, to] to rw in the
+// background. i.mut must be held.
+func (i *Instance) startResendLocked(cfg *Config, rw *config.RemoteWriteConfig, from, to int64) error {
+	rs, err := newResender(i.logger, i.wal, rw, cfg.global.Prometheus.ExternalLabels, i.resendMetrics)
+	if err != nil {
+		return err
+	}
+
+	r := newResend(rw.Name, from, to)
+	if err := i.remoteOffsets.StartResend(r); err != nil {
+		return err
+	}
+
+	ctx := i.resendCtx
+	i.resendWg.Add(1)
+	go func() {
+		defer i.resendWg.Done()
+
+		err := rs.Run(ctx, r)
+		if err != nil && ctx.Err() == nil {
+			level.Error(i.logger).Log("msg", "failed to resend samples from the WAL", "remote_name", rw.Name, "err", err)
+		}
+		i.remoteOffsets.FinishResend(r, err == nil)
+	}()
+	return nil
+}
+
+// RemoteWriteStatus describes how far a remote_write endpoint has been sent
+// data from the WAL.
+type RemoteWriteStatus struct {
+	Name       string        `json:"name"`
+	URL        string        `json:"url"`
+	BestEffort bool          `json:"best_effort"`
+	Offset     *time.Time    `json:"offset,omitempty"`
+	Resend     *ResendStatus `json:"resend,omitempty"`
+}
+
+// ResendStatus describes samples being resent from the WAL to a remote_write
+// endpoint.
+type ResendStatus struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Progress time.Time `json:"progress"`
+	Samples  int64     `json:"samples"`
+}
+
+// RemoteWriteStatus returns the status of every remote_write endpoint of the
+// instance.
+func (i *Instance) RemoteWriteStatus() ([]RemoteWriteStatus, error) {
+	i.mut.Lock()
+	cfg := i.cfg
+	offsets := i.remoteOffsets
+	i.mut.Unlock()
+
+	if offsets == nil {
+		return nil, ErrNotRunning
+	}
+
+	current, err := offsets.Offsets(cfg.remoteWriteNames())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]RemoteWriteStatus, 0, len(cfg.RemoteWrite))
+	for _, rw := range cfg.RemoteWrite {
+		status := RemoteWriteStatus{
+			Name:       rw.Name,
+			URL:        rw.URL.Redacted(),
+			BestEffort: cfg.isBestEffort(rw.Name),
+		}
+		if ts := current[rw.Name]; ts > 0 {
+			offset := timestamp.Time(ts)
+			status.Offset = &offset
+		}
+		if r := offsets.Resend(rw.Name); r != nil {
+			status.Resend = &ResendStatus{
+				From:     timestamp.Time(r.from),
+				To:       timestamp.Time(r.to),
+				Progress: timestamp.Time(r.Progress()),
+				Samples:  r.samples.Load(),
+			}
+		}
+		res = append(res, status)
+	}
+	return res, nil
+}
+
+// RewindRemoteWrite resends samples in the WAL newer than from to the named
+// remote_write endpoint, in the background. Samples which have already been
+// truncated from the WAL can't be resent. The endpoint may be named by the
+// name it had before its config was grouped with others.
+func (i *Instance) RewindRemoteWrite(name string, from time.Time) error {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.remoteOffsets == nil {
+		return ErrNotRunning
+	}
+
+	name = i.cfg.remoteWriteName(name)
+	for _, rw := range i.cfg.RemoteWrite {
+		if rw.Name != name {
+			continue
+		}
+
+		to := time.Now()
+		if !from.Before(to) {
+			return fmt.Errorf("cannot rewind to %s, which is in the future", from.Format(time.RFC3339))
+		}
+		level.Info(i.logger).Log("msg", "rewinding remote_write", "remote_name", name, "from", from)
+		return i.startResendLocked(&i.cfg, rw, timestamp.FromTime(from), timestamp.FromTime(to))
+	}
+	return ErrRemoteWriteNotFound
 }
 
+// ErrRemoteWriteNotFound is returned when referencing a remote_write endpoint
+// which doesn't exist.
+var ErrRemoteWriteNotFound = errors.New("remote_write endpoint not found")
+
+// ErrNotRunning is returned when an operation requires the instance to be
+// running.
+var ErrNotRunning = errors.New("instance is not running")
+
 // walStorage is an interface satisfied by wal.Storage, and created for testing.
 type walStorage interface {
-	// walStorage implements Queryable/ChunkQueryable for compatibility, but is unused.
+	// walStorage implements ChunkQueryable for compatibility, but it is
+	// unused. Queryable is used to serve local queries.
 	storage.Queryable
 	storage.ChunkQueryable
 
@@ -721,6 +1318,9 @@ type walStorage interface {
 	WriteStalenessMarkers(remoteTsFunc func() int64) error
 	Appender(context.Context) storage.Appender
 	Truncate(mint int64) error
+	ReadSamples(ctx context.Context, mint, maxt int64, fn func([]wal.Sample) error) error
+	Cardinality(limit int) wal.CardinalityStats
+	SetSeriesLimits(limits wal.SeriesLimits)
 
 	Close() error
 }
@@ -65,7 +65,7 @@ name: integration_test
 scrape_configs: []
 remote_write: []
 `)
-	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, logger)
+	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, nil, logger)
 	require.NoError(t, err)
 
 	instCtx, cancel := context.WithCancel(context.Background())
@@ -131,7 +131,7 @@ name: integration_test
 scrape_configs: []
 remote_write: []
 `)
-	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, logger)
+	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, nil, logger)
 	require.NoError(t, err)
 
 	instCtx, cancel := context.WithCancel(context.Background())
@@ -184,7 +184,7 @@ name: integration_test
 scrape_configs: []
 remote_write: []
 `)
-	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, logger)
+	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, nil, logger)
 	require.NoError(t, err)
 
 	instCtx, cancel := context.WithCancel(context.Background())
@@ -218,6 +218,16 @@ remote_write: []
 			mut:    func(c *Config) { c.HostFilter = true },
 			expect: "host_filter cannot be changed dynamically",
 		},
+		{
+			name:   "sharding enabled",
+			mut:    func(c *Config) { c.TotalShards = 2 },
+			expect: "total_shards cannot be changed dynamically",
+		},
+		{
+			name:   "cluster_sharding enabled",
+			mut:    func(c *Config) { c.ClusterSharding = true },
+			expect: "cluster_sharding cannot be changed dynamically",
+		},
 		{
 			name:   "wal_truncate_frequency changed",
 			mut:    func(c *Config) { c.WALTruncateFrequency *= 2 },
@@ -246,6 +256,46 @@ remote_write: []
 	}
 }
 
+func TestInstance_Update_SeriesLimits(t *testing.T) {
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	walDir := t.TempDir()
+
+	initialConfig := loadConfig(t, `
+name: integration_test
+scrape_configs: []
+remote_write: []
+max_active_series: 100
+`)
+	inst, err := New(prometheus.NewRegistry(), initialConfig, walDir, nil, logger)
+	require.NoError(t, err)
+
+	instCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := inst.Run(instCtx)
+		require.NoError(t, err)
+	}()
+
+	// Do a no-op update that succeeds to ensure that the instance is running.
+	test.Poll(t, time.Second*15, nil, func() interface{} {
+		return inst.Update(initialConfig)
+	})
+
+	stats, err := inst.Cardinality(0)
+	require.NoError(t, err)
+	require.Equal(t, 100, stats.MaxActiveSeries)
+
+	// Series limits can be changed without restarting the instance.
+	updatedConfig := initialConfig
+	updatedConfig.MaxActiveSeries = 50
+	updatedConfig.MaxActiveSeriesPerMetric = map[string]int{"up": 10}
+	require.NoError(t, inst.Update(updatedConfig))
+
+	stats, err = inst.Cardinality(0)
+	require.NoError(t, err)
+	require.Equal(t, 50, stats.MaxActiveSeries)
+}
+
 func loadConfig(t *testing.T, s string) Config {
 	cfg, err := UnmarshalConfig(strings.NewReader(s))
 	require.NoError(t, err)
@@ -12,8 +12,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/metrics/aggregation"
+	"github.com/grafana/agent/pkg/metrics/otlp"
+	"github.com/grafana/agent/pkg/metrics/push"
+	"github.com/grafana/agent/pkg/metrics/wal"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/model"
@@ -47,6 +52,7 @@ remote_write:
 	require.Equal(t, DefaultConfig.WALTruncateFrequency, cfg.WALTruncateFrequency)
 	require.Equal(t, DefaultConfig.RemoteFlushDeadline, cfg.RemoteFlushDeadline)
 	require.Equal(t, DefaultConfig.WriteStaleOnShutdown, cfg.WriteStaleOnShutdown)
+	require.Equal(t, DefaultConfig.MaxWALSize, cfg.MaxWALSize)
 
 	for _, sc := range cfg.ScrapeConfigs {
 		require.Equal(t, sc.ScrapeInterval, global.Prometheus.ScrapeInterval)
@@ -54,6 +60,28 @@ remote_write:
 	}
 }
 
+func TestConfig_Unmarshal_MaxWALSize(t *testing.T) {
+	cfgText := `name: test
+max_wal_size: 2GiB
+max_wal_size_policy: reject_appends`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ApplyDefaults(DefaultGlobalConfig))
+
+	require.Equal(t, 2*units.GiB, cfg.MaxWALSize)
+	require.Equal(t, wal.SizeLimitRejectAppends, cfg.MaxWALSizePolicy)
+}
+
+func TestConfig_ApplyDefaults_MaxWALSizePolicy(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Name = "test"
+	cfg.MaxWALSize = units.GiB
+
+	require.NoError(t, cfg.ApplyDefaults(DefaultGlobalConfig))
+	require.Equal(t, wal.SizeLimitDropOldest, cfg.MaxWALSizePolicy)
+}
+
 func TestConfig_ApplyDefaults_Validations(t *testing.T) {
 	global := DefaultGlobalConfig
 	cfg := DefaultConfig
@@ -101,6 +129,39 @@ func TestConfig_ApplyDefaults_Validations(t *testing.T) {
 			func(c *Config) { c.RemoteFlushDeadline = 0 },
 			fmt.Errorf("remote_flush_deadline must be greater than 0s"),
 		},
+		{
+			"negative max wal size",
+			func(c *Config) { c.MaxWALSize = -1 },
+			fmt.Errorf("max_wal_size must not be negative"),
+		},
+		{
+			"negative max active series",
+			func(c *Config) { c.MaxActiveSeries = -1 },
+			fmt.Errorf("max_active_series must not be negative"),
+		},
+		{
+			"zero max active series per metric",
+			func(c *Config) { c.MaxActiveSeriesPerMetric = map[string]int{"up": 0} },
+			fmt.Errorf("max_active_series_per_metric for \"up\" must be greater than 0"),
+		},
+		{
+			"invalid max wal size policy",
+			func(c *Config) {
+				c.MaxWALSize = units.GiB
+				c.MaxWALSizePolicy = "drop_newest"
+			},
+			fmt.Errorf(`invalid max_wal_size_policy: unknown WAL size limit policy "drop_newest", must be "drop_oldest" or "reject_appends"`),
+		},
+		{
+			"unknown best effort remote_write",
+			func(c *Config) { c.BestEffortRemoteWrite = []string{"missing"} },
+			fmt.Errorf(`best_effort_remote_write references unknown remote_write "missing"`),
+		},
+		{
+			"unsupported wal compression",
+			func(c *Config) { c.WALCompression = "zstd" },
+			fmt.Errorf(`invalid wal_compression: unsupported WAL compression "zstd", must be "none" or "snappy"`),
+		},
 		{
 			"scrape timeout too high",
 			func(c *Config) { c.ScrapeConfigs[0].ScrapeTimeout = global.Prometheus.ScrapeInterval + 1 },
@@ -135,6 +196,60 @@ func TestConfig_ApplyDefaults_Validations(t *testing.T) {
 			},
 			fmt.Errorf("found duplicate remote write configs with name \"foo\""),
 		},
+		{
+			"empty otlp export",
+			func(c *Config) { c.OTLPExport = []*otlp.Config{nil} },
+			fmt.Errorf("empty or null otlp_export config section"),
+		},
+		{
+			"multiple otlp exports with same name",
+			func(c *Config) {
+				c.OTLPExport = []*otlp.Config{
+					{Name: "foo", Endpoint: "a:4317"},
+					{Name: "foo", Endpoint: "b:4317"},
+				}
+			},
+			fmt.Errorf("found duplicate otlp_export configs with name \"foo\""),
+		},
+		{
+			"empty aggregation rule",
+			func(c *Config) { c.AggregationRules = []*aggregation.Rule{nil} },
+			fmt.Errorf("empty or null aggregation_rules section"),
+		},
+		{
+			"invalid aggregation rule",
+			func(c *Config) {
+				c.AggregationRules = []*aggregation.Rule{{Match: `{job="x"}`, Aggregation: aggregation.AggregationSum}}
+			},
+			fmt.Errorf("invalid aggregation rule: interval must be greater than 0s"),
+		},
+		{
+			"negative total shards",
+			func(c *Config) { c.TotalShards = -1 },
+			fmt.Errorf("total_shards must not be negative"),
+		},
+		{
+			"shard without total shards",
+			func(c *Config) { c.Shard = 1 },
+			fmt.Errorf("shard requires total_shards to be set"),
+		},
+		{
+			"shard out of range",
+			func(c *Config) { c.Shard, c.TotalShards = 3, 3 },
+			fmt.Errorf("shard must be between 0 and 2"),
+		},
+		{
+			"cluster sharding with total shards",
+			func(c *Config) { c.ClusterSharding, c.TotalShards = true, 3 },
+			fmt.Errorf("cluster_sharding and total_shards are mutually exclusive"),
+		},
+		{
+			"push config with two kinds of auth",
+			func(c *Config) {
+				c.Push = push.Config{BasicAuth: &push.BasicAuth{Username: "user"}, BearerToken: "token"}
+			},
+			fmt.Errorf("invalid push_config: only one of basic_auth and bearer_token may be set"),
+		},
 	}
 
 	for _, tc := range tt {
@@ -184,6 +299,28 @@ remote_write:
 	require.NotEmpty(t, cfg.RemoteWrite[0].Name)
 }
 
+func TestConfig_Unmarshal_OTLPExport(t *testing.T) {
+	cfgText := `
+name: default
+otlp_export:
+- endpoint: localhost:4317
+  insecure: true
+- name: http
+  endpoint: http://localhost:4318
+  protocol: http`
+
+	cfg, err := UnmarshalConfig(strings.NewReader(cfgText))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ApplyDefaults(DefaultGlobalConfig))
+
+	require.Len(t, cfg.OTLPExport, 2)
+	require.True(t, strings.HasPrefix(cfg.OTLPExport[0].Name, "default-otlp-"))
+	require.Equal(t, otlp.ProtocolGRPC, cfg.OTLPExport[0].Protocol)
+	require.Equal(t, otlp.DefaultConfig.QueueConfig, cfg.OTLPExport[0].QueueConfig)
+	require.Equal(t, "http", cfg.OTLPExport[1].Name)
+	require.Equal(t, otlp.ProtocolHTTP, cfg.OTLPExport[1].Protocol)
+}
+
 func TestInstance_Path(t *testing.T) {
 	scrapeAddr, closeSrv := getTestServer(t)
 	defer closeSrv()
@@ -199,7 +336,7 @@ func TestInstance_Path(t *testing.T) {
 	cfg.RemoteFlushDeadline = time.Hour
 
 	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-	inst, err := New(prometheus.NewRegistry(), cfg, walDir, logger)
+	inst, err := New(prometheus.NewRegistry(), cfg, walDir, nil, logger)
 	require.NoError(t, err)
 	runInstance(t, inst)
 
@@ -263,7 +400,7 @@ func TestInstance_Recreate(t *testing.T) {
 	cfg.RemoteFlushDeadline = time.Hour
 
 	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
-	inst, err := New(prometheus.NewRegistry(), cfg, walDir, logger)
+	inst, err := New(prometheus.NewRegistry(), cfg, walDir, nil, logger)
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -283,7 +420,7 @@ func TestInstance_Recreate(t *testing.T) {
 
 	// Recreate the instance, no panic should happen.
 	require.NotPanics(t, func() {
-		inst, err := New(prometheus.NewRegistry(), cfg, walDir, logger)
+		inst, err := New(prometheus.NewRegistry(), cfg, walDir, nil, logger)
 		require.NoError(t, err)
 		runInstance(t, inst)
 
@@ -358,6 +495,16 @@ func (s *mockWalStorage) WriteStalenessMarkers(f func() int64) error { return ni
 func (s *mockWalStorage) Close() error                               { return nil }
 func (s *mockWalStorage) Truncate(mint int64) error                  { return nil }
 
+func (s *mockWalStorage) ReadSamples(context.Context, int64, int64, func([]wal.Sample) error) error {
+	return nil
+}
+
+func (s *mockWalStorage) Cardinality(int) wal.CardinalityStats {
+	return wal.CardinalityStats{}
+}
+
+func (s *mockWalStorage) SetSeriesLimits(wal.SeriesLimits) {}
+
 func (s *mockWalStorage) Appender(context.Context) storage.Appender {
 	return &mockAppender{s: s}
 }
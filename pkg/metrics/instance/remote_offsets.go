@@ -0,0 +1,261 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// remoteWriteOffsetsFile is the file in an instance's WAL directory which
+// holds how far each remote_write endpoint has sent data.
+const remoteWriteOffsetsFile = "remote_write_offsets.json"
+
+// highestSentMetric is exposed by each remote_write queue and holds the
+// timestamp of the newest sample the queue sent, in seconds.
+const highestSentMetric = "prometheus_remote_storage_queue_highest_sent_timestamp_seconds"
+
+// remoteOffsets tracks how far each remote_write endpoint has sent data from
+// the WAL, and persists it to disk so it survives restarts.
+//
+// Prometheus' remote_write queues don't expose their progress directly.
+// Instead, queues must be created with the Registerer returned by
+// remoteOffsets, which mirrors their metrics into a private registry that
+// sent timestamps are read back from.
+type remoteOffsets struct {
+	path   string
+	mirror *prometheus.Registry
+
+	mut       sync.Mutex
+	persisted map[string]int64   // Offsets loaded from or saved to disk.
+	sent      map[string]int64   // Highest timestamp sent by each queue.
+	resends   map[string]*resend // Active resends by endpoint name.
+}
+
+// offsetsFile is the format of remoteWriteOffsetsFile.
+type offsetsFile struct {
+	// Offsets holds the timestamp, in milliseconds, up to which each
+	// remote_write endpoint has been sent data.
+	Offsets map[string]int64 `json:"offsets"`
+}
+
+// loadRemoteOffsets loads offsets persisted in dir. It's not an error if
+// no offsets have been persisted yet.
+func loadRemoteOffsets(dir string) (*remoteOffsets, error) {
+	o := &remoteOffsets{
+		path:      filepath.Join(dir, remoteWriteOffsetsFile),
+		mirror:    prometheus.NewRegistry(),
+		persisted: make(map[string]int64),
+		sent:      make(map[string]int64),
+		resends:   make(map[string]*resend),
+	}
+
+	bb, err := os.ReadFile(o.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read remote_write offsets: %w", err)
+	}
+
+	var f offsetsFile
+	if err := json.Unmarshal(bb, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse remote_write offsets %s: %w", o.path, err)
+	}
+	for name, ts := range f.Offsets {
+		o.persisted[name] = ts
+	}
+	return o, nil
+}
+
+// Registerer returns a Registerer which registers collectors against reg and
+// tracks remote_write queue metrics. reg may be nil.
+func (o *remoteOffsets) Registerer(reg prometheus.Registerer) prometheus.Registerer {
+	return &mirrorRegisterer{wrap: reg, mirror: o.mirror}
+}
+
+// Persisted returns the offset of the named endpoint as it was last saved to
+// disk, and whether there was one.
+func (o *remoteOffsets) Persisted(name string) (int64, bool) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	ts, ok := o.persisted[name]
+	return ts, ok
+}
+
+// Offsets returns the current offset of every named endpoint. Samples newer
+// than an endpoint's offset may not have been sent to it yet.
+func (o *remoteOffsets) Offsets(names []string) (map[string]int64, error) {
+	err := o.update()
+
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	res := make(map[string]int64, len(names))
+	for _, name := range names {
+		res[name] = o.offsetLocked(name)
+	}
+	return res, err
+}
+
+// offsetLocked returns the offset of the named endpoint. An endpoint is
+// caught up to the newest sample its queue sent, unless older samples are
+// being resent to it. o.mut must be held.
+func (o *remoteOffsets) offsetLocked(name string) int64 {
+	off := o.persisted[name]
+	if ts := o.sent[name]; ts > off {
+		off = ts
+	}
+	if r, ok := o.resends[name]; ok {
+		if progress := r.Progress(); progress < off {
+			off = progress
+		}
+	}
+	return off
+}
+
+// update refreshes the sent timestamps from the queue metrics. Sent
+// timestamps are kept after their queue stops so they can still be saved.
+func (o *remoteOffsets) update() error {
+	mfs, err := o.mirror.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather remote_write metrics: %w", err)
+	}
+
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	for _, mf := range mfs {
+		if mf.GetName() != highestSentMetric {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var name string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "remote_name" {
+					name = l.GetValue()
+				}
+			}
+
+			ts := int64(m.GetGauge().GetValue() * 1000)
+			if name != "" && ts > o.sent[name] {
+				o.sent[name] = ts
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the current offsets of every named endpoint to disk. Offsets
+// of endpoints which aren't named are removed.
+func (o *remoteOffsets) Save(names []string) error {
+	updateErr := o.update()
+
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	f := offsetsFile{Offsets: make(map[string]int64, len(names))}
+	for _, name := range names {
+		f.Offsets[name] = o.offsetLocked(name)
+	}
+
+	bb, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't leave a partially
+	// written file behind.
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, bb, 0644); err != nil {
+		return fmt.Errorf("failed to write remote_write offsets: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("failed to write remote_write offsets: %w", err)
+	}
+
+	o.persisted = f.Offsets
+	return updateErr
+}
+
+// ErrResendRunning is returned when starting a resend for an endpoint which
+// already has one running.
+var ErrResendRunning = errors.New("samples are already being resent to this remote_write endpoint")
+
+// StartResend registers r as the active resend for its endpoint. The offset
+// of the endpoint is held back to the progress of r until FinishResend is
+// called.
+func (o *remoteOffsets) StartResend(r *resend) error {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	if _, ok := o.resends[r.name]; ok {
+		return ErrResendRunning
+	}
+	o.resends[r.name] = r
+	return nil
+}
+
+// FinishResend unregisters r. If r completed, the endpoint is considered to
+// have been sent every sample up to the end of r.
+func (o *remoteOffsets) FinishResend(r *resend, completed bool) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	if o.resends[r.name] == r {
+		delete(o.resends, r.name)
+	}
+	if completed && r.to > o.persisted[r.name] {
+		o.persisted[r.name] = r.to
+	}
+}
+
+// Resend returns the active resend for the named endpoint, if any.
+func (o *remoteOffsets) Resend(name string) *resend {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.resends[name]
+}
+
+// mirrorRegisterer registers collectors against a wrapped Registerer and a
+// mirror registry.
+type mirrorRegisterer struct {
+	wrap   prometheus.Registerer
+	mirror *prometheus.Registry
+}
+
+// Register implements prometheus.Registerer.
+func (r *mirrorRegisterer) Register(c prometheus.Collector) error {
+	if r.wrap != nil {
+		if err := r.wrap.Register(c); err != nil {
+			return err
+		}
+	}
+	// Collectors are only mirrored to read their values back; failing to do
+	// so must not prevent them from being registered.
+	_ = r.mirror.Register(c)
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (r *mirrorRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements prometheus.Registerer.
+func (r *mirrorRegisterer) Unregister(c prometheus.Collector) bool {
+	mirrored := r.mirror.Unregister(c)
+	if r.wrap == nil {
+		return mirrored
+	}
+	return r.wrap.Unregister(c)
+}
@@ -0,0 +1,125 @@
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteOffsets(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := loadRemoteOffsets(dir)
+	require.NoError(t, err)
+
+	_, ok := o.Persisted("a")
+	require.False(t, ok)
+
+	// Queues register their sent timestamps through the mirroring registerer.
+	reg := prometheus.NewRegistry()
+	sentA := newSentGauge("a")
+	sentB := newSentGauge("b")
+	o.Registerer(reg).MustRegister(sentA, sentB)
+	sentA.Set(20)
+	sentB.Set(10)
+
+	offsets, err := o.Offsets([]string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"a": 20_000, "b": 10_000}, offsets)
+
+	// The real registry must still receive the collectors.
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 1)
+
+	// Offsets of endpoints which are no longer configured are dropped when
+	// saving.
+	require.NoError(t, o.Save([]string{"a"}))
+
+	o, err = loadRemoteOffsets(dir)
+	require.NoError(t, err)
+	ts, ok := o.Persisted("a")
+	require.True(t, ok)
+	require.Equal(t, int64(20_000), ts)
+	_, ok = o.Persisted("b")
+	require.False(t, ok)
+}
+
+func TestRemoteOffsets_Resend(t *testing.T) {
+	o, err := loadRemoteOffsets(t.TempDir())
+	require.NoError(t, err)
+
+	sent := newSentGauge("a")
+	o.Registerer(nil).MustRegister(sent)
+	sent.Set(10)
+
+	r := newResend("a", 5_000, 50_000)
+	require.NoError(t, o.StartResend(r))
+	require.ErrorIs(t, o.StartResend(newResend("a", 0, 1)), ErrResendRunning)
+
+	// A running resend holds back the offset to its progress.
+	offsets, err := o.Offsets([]string{"a"})
+	require.NoError(t, err)
+	require.Equal(t, int64(5_000), offsets["a"])
+
+	r.progress.Store(7_000)
+	offsets, err = o.Offsets([]string{"a"})
+	require.NoError(t, err)
+	require.Equal(t, int64(7_000), offsets["a"])
+
+	// Once completed, the endpoint is caught up to at least the end of the
+	// resend.
+	o.FinishResend(r, true)
+	require.Nil(t, o.Resend("a"))
+
+	offsets, err = o.Offsets([]string{"a"})
+	require.NoError(t, err)
+	require.Equal(t, int64(50_000), offsets["a"])
+}
+
+func TestRemoteOffsets_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, remoteWriteOffsetsFile), []byte("{"), 0644))
+
+	_, err := loadRemoteOffsets(dir)
+	require.Error(t, err)
+}
+
+func newSentGauge(name string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        highestSentMetric,
+		Help:        "Timestamp from a WAL sample, the highest timestamp successfully sent by this queue, in seconds since epoch.",
+		ConstLabels: prometheus.Labels{"remote_name": name, "url": "http://" + name},
+	})
+}
+
+func TestInstance_getRemoteWriteTimestamp(t *testing.T) {
+	o, err := loadRemoteOffsets(t.TempDir())
+	require.NoError(t, err)
+
+	sentA, sentB := newSentGauge("a"), newSentGauge("b")
+	o.Registerer(nil).MustRegister(sentA, sentB)
+	sentA.Set(20)
+	sentB.Set(10)
+
+	i := &Instance{
+		cfg: Config{
+			RemoteWrite: []*config.RemoteWriteConfig{{Name: "a"}, {Name: "b"}},
+		},
+		remoteStore:   &remote.Storage{},
+		remoteOffsets: o,
+	}
+	require.Equal(t, int64(10_000), i.getRemoteWriteTimestamp())
+
+	// Best effort endpoints don't hold back truncation.
+	i.cfg.BestEffortRemoteWrite = []string{"b"}
+	require.Equal(t, int64(20_000), i.getRemoteWriteTimestamp())
+
+	i.cfg.BestEffortRemoteWrite = []string{"a", "b"}
+	require.Greater(t, i.getRemoteWriteTimestamp(), int64(20_000))
+}
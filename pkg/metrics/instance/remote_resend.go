@@ -0,0 +1,253 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"go.uber.org/atomic"
+)
+
+// resend is a request to send samples from the WAL to a remote_write
+// endpoint again.
+type resend struct {
+	name     string
+	from, to int64 // Samples in (from, to] are sent.
+
+	progress atomic.Int64 // Newest timestamp sent so far.
+	samples  atomic.Int64 // Number of samples sent so far.
+}
+
+func newResend(name string, from, to int64) *resend {
+	r := &resend{name: name, from: from, to: to}
+	r.progress.Store(from)
+	return r
+}
+
+// Progress returns the newest timestamp which has been resent. Samples in
+// the WAL are roughly ordered by time, so most samples older than Progress
+// have been resent too.
+func (r *resend) Progress() int64 { return r.progress.Load() }
+
+type resendMetrics struct {
+	sentSamples   *prometheus.CounterVec
+	failedSamples *prometheus.CounterVec
+}
+
+func newResendMetrics(reg prometheus.Registerer) *resendMetrics {
+	m := &resendMetrics{
+		sentSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_remote_write_resent_samples_total",
+			Help: "Total number of samples from the WAL resent to a remote_write endpoint.",
+		}, []string{"remote_name"}),
+		failedSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agent_metrics_remote_write_resend_failed_samples_total",
+			Help: "Total number of samples from the WAL which failed to be resent to a remote_write endpoint and were dropped.",
+		}, []string{"remote_name"}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.sentSamples, m.failedSamples)
+	}
+	return m
+}
+
+// resender sends samples read back from the WAL to a remote_write endpoint.
+// It runs independently of the endpoint's queue, which only sends samples
+// appended after it started.
+type resender struct {
+	logger         log.Logger
+	wal            walStorage
+	cfg            *config.RemoteWriteConfig
+	externalLabels labels.Labels
+	client         remote.WriteClient
+	metrics        *resendMetrics
+
+	// Series labels after applying external labels and write_relabel_configs,
+	// by hash of the original labels. Dropped series are cached as nil.
+	lsets map[uint64]labels.Labels
+}
+
+func newResender(logger log.Logger, w walStorage, cfg *config.RemoteWriteConfig, externalLabels labels.Labels, metrics *resendMetrics) (*resender, error) {
+	client, err := remote.NewWriteClient(cfg.Name, &remote.ClientConfig{
+		URL:              cfg.URL,
+		Timeout:          cfg.RemoteTimeout,
+		HTTPClientConfig: cfg.HTTPClientConfig,
+		SigV4Config:      cfg.SigV4Config,
+		Headers:          cfg.Headers,
+		RetryOnRateLimit: cfg.QueueConfig.RetryOnRateLimit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote_write client: %w", err)
+	}
+
+	return &resender{
+		logger:         log.With(logger, "remote_name", cfg.Name),
+		wal:            w,
+		cfg:            cfg,
+		externalLabels: externalLabels,
+		client:         client,
+		metrics:        metrics,
+		lsets:          make(map[uint64]labels.Labels),
+	}, nil
+}
+
+// Run sends every sample in the WAL within the range of r. Failed requests
+// are retried until ctx is canceled, unless the endpoint rejects them.
+func (rs *resender) Run(ctx context.Context, r *resend) error {
+	level.Info(rs.logger).Log("msg", "resending samples from the WAL", "from", r.from, "to", r.to)
+	start := time.Now()
+
+	var (
+		maxSamples = rs.cfg.QueueConfig.MaxSamplesPerSend
+		newest     int64
+
+		// Samples of the same series are grouped into one TimeSeries per
+		// batch. index maps the hash of a series to its position in batch.
+		batch      []prompb.TimeSeries
+		index      = make(map[uint64]int)
+		numSamples int
+	)
+
+	flush := func() error {
+		if numSamples == 0 {
+			return nil
+		}
+		if err := rs.send(ctx, batch, numSamples); err != nil {
+			return err
+		}
+		r.samples.Add(int64(numSamples))
+		if newest > r.progress.Load() {
+			r.progress.Store(newest)
+		}
+		batch = batch[:0]
+		index = make(map[uint64]int)
+		numSamples = 0
+		return nil
+	}
+
+	err := rs.wal.ReadSamples(ctx, r.from, r.to, func(samples []wal.Sample) error {
+		for _, s := range samples {
+			hash := s.Labels.Hash()
+			lset := rs.seriesLabels(hash, s.Labels)
+			if lset == nil {
+				continue
+			}
+
+			sample := prompb.Sample{Value: s.V, Timestamp: s.T}
+			if i, ok := index[hash]; ok {
+				batch[i].Samples = append(batch[i].Samples, sample)
+			} else {
+				index[hash] = len(batch)
+				batch = append(batch, prompb.TimeSeries{
+					Labels:  labelsToProto(lset),
+					Samples: []prompb.Sample{sample},
+				})
+			}
+			numSamples++
+			if s.T > newest {
+				newest = s.T
+			}
+
+			if numSamples >= maxSamples {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	level.Info(rs.logger).Log("msg", "finished resending samples from the WAL", "samples", r.samples.Load(), "duration", time.Since(start))
+	return nil
+}
+
+// seriesLabels returns the labels to send for a series with the given hash,
+// or nil if the series is dropped by write_relabel_configs.
+func (rs *resender) seriesLabels(hash uint64, lset labels.Labels) labels.Labels {
+	if res, ok := rs.lsets[hash]; ok {
+		return res
+	}
+
+	res := relabel.Process(withExternalLabels(lset, rs.externalLabels), rs.cfg.WriteRelabelConfigs...)
+	rs.lsets[hash] = res
+	return res
+}
+
+// send writes series holding numSamples samples to the endpoint, retrying
+// recoverable errors with backoff. Series rejected by the endpoint are
+// dropped.
+func (rs *resender) send(ctx context.Context, series []prompb.TimeSeries, numSamples int) error {
+	req, err := proto.Marshal(&prompb.WriteRequest{Timeseries: series})
+	if err != nil {
+		return err
+	}
+	req = snappy.Encode(nil, req)
+
+	b := backoff.New(ctx, backoff.Config{
+		MinBackoff: time.Duration(rs.cfg.QueueConfig.MinBackoff),
+		MaxBackoff: time.Duration(rs.cfg.QueueConfig.MaxBackoff),
+	})
+	for b.Ongoing() {
+		err := rs.client.Store(ctx, req)
+		if err == nil {
+			rs.metrics.sentSamples.WithLabelValues(rs.cfg.Name).Add(float64(numSamples))
+			return nil
+		}
+
+		var recoverable remote.RecoverableError
+		if !errors.As(err, &recoverable) {
+			// Retrying won't help; endpoints commonly reject samples which are
+			// older than what they've already been sent.
+			level.Warn(rs.logger).Log("msg", "remote_write endpoint rejected resent samples, dropping them", "samples", numSamples, "err", err)
+			rs.metrics.failedSamples.WithLabelValues(rs.cfg.Name).Add(float64(numSamples))
+			return nil
+		}
+
+		level.Warn(rs.logger).Log("msg", "failed to resend samples, retrying", "err", err)
+		b.Wait()
+	}
+	return b.Err()
+}
+
+// withExternalLabels adds external labels to lset. Labels already set on lset
+// take precedence, matching what remote_write queues do.
+func withExternalLabels(lset, external labels.Labels) labels.Labels {
+	if len(external) == 0 {
+		return lset
+	}
+
+	b := labels.NewBuilder(lset)
+	for _, l := range external {
+		if !lset.Has(l.Name) {
+			b.Set(l.Name, l.Value)
+		}
+	}
+	return b.Labels()
+}
+
+func labelsToProto(lset labels.Labels) []prompb.Label {
+	res := make([]prompb.Label, 0, len(lset))
+	for _, l := range lset {
+		res = append(res, prompb.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
@@ -0,0 +1,195 @@
+package instance
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResender(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		requests int
+		received []prompb.TimeSeries
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+
+		// Fail the first request to make sure it's retried.
+		requests++
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bb, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		var req prompb.WriteRequest
+		require.NoError(t, proto.Unmarshal(bb, &req))
+		received = append(received, req.Timeseries...)
+	}))
+	defer srv.Close()
+
+	storage := &samplesWalStorage{samples: []wal.Sample{
+		{Labels: labels.FromStrings("__name__", "old"), T: 10, V: 1},
+		{Labels: labels.FromStrings("__name__", "foo"), T: 20, V: 2},
+		{Labels: labels.FromStrings("__name__", "drop_me"), T: 30, V: 3},
+		{Labels: labels.FromStrings("__name__", "foo", "cluster", "local"), T: 40, V: 4},
+		{Labels: labels.FromStrings("__name__", "foo"), T: 50, V: 5},
+		{Labels: labels.FromStrings("__name__", "new"), T: 60, V: 6},
+	}}
+
+	rw := newTestRemoteWriteConfig(t, srv.URL)
+	rw.WriteRelabelConfigs = []*relabel.Config{{
+		SourceLabels: model.LabelNames{"__name__"},
+		Regex:        relabel.MustNewRegexp("drop_me"),
+		Action:       relabel.Drop,
+	}}
+
+	metrics := newResendMetrics(nil)
+	rs, err := newResender(log.NewNopLogger(), storage, rw, labels.FromStrings("cluster", "global"), metrics)
+	require.NoError(t, err)
+
+	r := newResend("test", 10, 50)
+	require.NoError(t, rs.Run(context.Background(), r))
+
+	series := func(value float64, ts int64, lbls ...string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  labelsToProto(labels.FromStrings(lbls...)),
+			Samples: []prompb.Sample{{Value: value, Timestamp: ts}},
+		}
+	}
+	require.Equal(t, []prompb.TimeSeries{
+		series(2, 20, "__name__", "foo", "cluster", "global"),
+		series(4, 40, "__name__", "foo", "cluster", "local"),
+		series(5, 50, "__name__", "foo", "cluster", "global"),
+	}, received)
+
+	require.Equal(t, int64(50), r.Progress())
+	require.Equal(t, int64(3), r.samples.Load())
+	require.Equal(t, float64(3), testutil.ToFloat64(metrics.sentSamples.WithLabelValues("test")))
+}
+
+func TestResender_GroupsSeries(t *testing.T) {
+	var received []prompb.TimeSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bb, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		var req prompb.WriteRequest
+		require.NoError(t, proto.Unmarshal(bb, &req))
+		received = append(received, req.Timeseries...)
+	}))
+	defer srv.Close()
+
+	storage := &samplesWalStorage{samples: []wal.Sample{
+		{Labels: labels.FromStrings("__name__", "foo"), T: 10, V: 1},
+		{Labels: labels.FromStrings("__name__", "bar"), T: 10, V: 2},
+		{Labels: labels.FromStrings("__name__", "foo"), T: 20, V: 3},
+		{Labels: labels.FromStrings("__name__", "bar"), T: 20, V: 4},
+		{Labels: labels.FromStrings("__name__", "foo"), T: 30, V: 5},
+	}}
+
+	rw := newTestRemoteWriteConfig(t, srv.URL)
+	rw.QueueConfig.MaxSamplesPerSend = 4
+
+	rs, err := newResender(log.NewNopLogger(), storage, rw, nil, newResendMetrics(nil))
+	require.NoError(t, err)
+	require.NoError(t, rs.Run(context.Background(), newResend("test", 0, 100)))
+
+	// The first batch holds 4 samples from 2 series; the second batch holds
+	// the remaining sample.
+	require.Equal(t, []prompb.TimeSeries{
+		{
+			Labels:  labelsToProto(labels.FromStrings("__name__", "foo")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 3, Timestamp: 20}},
+		},
+		{
+			Labels:  labelsToProto(labels.FromStrings("__name__", "bar")),
+			Samples: []prompb.Sample{{Value: 2, Timestamp: 10}, {Value: 4, Timestamp: 20}},
+		},
+		{
+			Labels:  labelsToProto(labels.FromStrings("__name__", "foo")),
+			Samples: []prompb.Sample{{Value: 5, Timestamp: 30}},
+		},
+	}, received)
+}
+
+func TestResender_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	storage := &samplesWalStorage{samples: []wal.Sample{
+		{Labels: labels.FromStrings("__name__", "foo"), T: 20, V: 2},
+	}}
+
+	metrics := newResendMetrics(nil)
+	rs, err := newResender(log.NewNopLogger(), storage, newTestRemoteWriteConfig(t, srv.URL), nil, metrics)
+	require.NoError(t, err)
+
+	// Rejected samples are dropped rather than retried forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, rs.Run(ctx, newResend("test", 0, 100)))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.failedSamples.WithLabelValues("test")))
+}
+
+func newTestRemoteWriteConfig(t *testing.T, rawURL string) *config.RemoteWriteConfig {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	rw := config.DefaultRemoteWriteConfig
+	rw.Name = "test"
+	rw.URL = &config_util.URL{URL: u}
+	rw.QueueConfig.MaxSamplesPerSend = 2
+	rw.QueueConfig.MinBackoff = model.Duration(time.Millisecond)
+	rw.QueueConfig.MaxBackoff = model.Duration(10 * time.Millisecond)
+	return &rw
+}
+
+// samplesWalStorage is a walStorage which returns a fixed set of samples from
+// ReadSamples.
+type samplesWalStorage struct {
+	mockWalStorage
+	samples []wal.Sample
+}
+
+func (s *samplesWalStorage) ReadSamples(_ context.Context, mint, maxt int64, fn func([]wal.Sample) error) error {
+	for _, sample := range s.samples {
+		if sample.T <= mint || sample.T > maxt {
+			continue
+		}
+		if err := fn([]wal.Sample{sample}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package instance
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// seriesLimitAppendable wraps the storage used by the scrape manager so that
+// samples rejected by the WAL's series limits are dropped individually.
+//
+// The Prometheus scrape loop fails the entire scrape for most append errors,
+// which would prevent a target from reporting any samples once a limit is
+// reached. Rejected samples are already counted by the WAL, so they can be
+// dropped silently here.
+type seriesLimitAppendable struct {
+	storage.Appendable
+}
+
+func (a seriesLimitAppendable) Appender(ctx context.Context) storage.Appender {
+	return seriesLimitAppender{Appender: a.Appendable.Appender(ctx)}
+}
+
+type seriesLimitAppender struct {
+	storage.Appender
+}
+
+func (a seriesLimitAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	ref, err := a.Appender.Append(ref, l, t, v)
+	if errors.Is(err, wal.ErrSeriesLimit) {
+		return 0, nil
+	}
+	return ref, err
+}
+
+func (a seriesLimitAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	ref, err := a.Appender.AppendExemplar(ref, l, e)
+	if errors.Is(err, wal.ErrSeriesLimit) {
+		return 0, nil
+	}
+	return ref, err
+}
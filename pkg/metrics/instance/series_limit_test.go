@@ -0,0 +1,48 @@
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesLimitAppendable(t *testing.T) {
+	errOther := errors.New("other error")
+
+	tt := []struct {
+		err       error
+		expectErr error
+	}{
+		{err: nil, expectErr: nil},
+		{err: fmt.Errorf("rejected: %w", wal.ErrSeriesLimit), expectErr: nil},
+		{err: errOther, expectErr: errOther},
+	}
+
+	for _, tc := range tt {
+		app := seriesLimitAppendable{Appendable: errAppendable{err: tc.err}}.Appender(context.Background())
+		_, err := app.Append(0, labels.FromStrings("__name__", "test"), 0, 1)
+		require.Equal(t, tc.expectErr, err)
+	}
+}
+
+// errAppendable returns err for every appended sample.
+type errAppendable struct {
+	err error
+}
+
+func (a errAppendable) Appender(context.Context) storage.Appender { return errAppender{err: a.err} }
+
+type errAppender struct {
+	storage.Appender
+	err error
+}
+
+func (a errAppender) Append(storage.SeriesRef, labels.Labels, int64, float64) (storage.SeriesRef, error) {
+	return 0, a.err
+}
@@ -0,0 +1,276 @@
+package instance
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/rfratto/ckit"
+	"github.com/rfratto/ckit/peer"
+	"github.com/rfratto/ckit/shard"
+
+	"github.com/grafana/agent/pkg/cluster"
+)
+
+// ShardFilter acts as a MITM between the discovery manager and the scrape
+// manager, filtering out discovered targets which hash to a different shard
+// than the agent's own. Running the same config on total shards agents, each
+// with a different shard, splits targets between them.
+//
+// When created with NewClusterShardFilter, targets are instead split between
+// the peers of a cluster, and are redistributed whenever peers join or leave.
+type ShardFilter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger log.Logger
+
+	inputCh  GroupChannel
+	outputCh chan map[string][]*targetgroup.Group
+
+	// reshardCh is signaled when the shard or the cluster changes so the last
+	// discovered groups can be filtered again.
+	reshardCh chan struct{}
+
+	// node is set when targets are split between the peers of a cluster
+	// instead of static shards.
+	node cluster.Node
+
+	mut         sync.Mutex
+	shard       int
+	totalShards int
+}
+
+// NewShardFilter creates a new ShardFilter which keeps the targets belonging
+// to shard out of totalShards.
+func NewShardFilter(logger log.Logger, shard, totalShards int) *ShardFilter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ShardFilter{
+		ctx:    ctx,
+		cancel: cancel,
+		logger: logger,
+
+		shard:       shard,
+		totalShards: totalShards,
+
+		outputCh:  make(chan map[string][]*targetgroup.Group),
+		reshardCh: make(chan struct{}, 1),
+	}
+}
+
+// NewClusterShardFilter creates a new ShardFilter which keeps the targets
+// owned by the local peer of node.
+func NewClusterShardFilter(logger log.Logger, node cluster.Node) *ShardFilter {
+	f := NewShardFilter(logger, 0, 0)
+	f.node = node
+	return f
+}
+
+// SetShard updates the shard used by the ShardFilter. Targets are
+// redistributed immediately, without waiting for service discovery to report
+// changes.
+func (f *ShardFilter) SetShard(shard, totalShards int) {
+	f.mut.Lock()
+	changed := f.shard != shard || f.totalShards != totalShards
+	f.shard, f.totalShards = shard, totalShards
+	f.mut.Unlock()
+
+	if !changed {
+		return
+	}
+	select {
+	case f.reshardCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the ShardFilter. It only exits when the ShardFilter is stopped.
+// Run will continually read from syncCh and filter groups discovered down to
+// the targets belonging to the shard.
+func (f *ShardFilter) Run(syncCh GroupChannel) {
+	f.inputCh = syncCh
+
+	if f.node != nil {
+		f.node.Observe(ckit.FuncObserver(func(_ []peer.Peer) (reregister bool) {
+			select {
+			case f.reshardCh <- struct{}{}:
+			default:
+			}
+			return f.ctx.Err() == nil
+		}))
+	}
+
+	var last DiscoveredGroups
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case last = <-f.inputCh:
+		case <-f.reshardCh:
+			if last == nil {
+				continue
+			}
+		}
+
+		f.mut.Lock()
+		shard, totalShards := f.shard, f.totalShards
+		f.mut.Unlock()
+
+		select {
+		case <-f.ctx.Done():
+			return
+		case f.outputCh <- f.filter(last, shard, totalShards):
+		}
+	}
+}
+
+func (f *ShardFilter) filter(in DiscoveredGroups, shard, totalShards int) DiscoveredGroups {
+	if f.node != nil {
+		return f.filterCluster(in)
+	}
+
+	out := ShardGroups(in, shard, totalShards)
+
+	var owned, total int
+	for name, groups := range in {
+		for i, group := range groups {
+			total += len(group.Targets)
+			owned += len(out[name][i].Targets)
+		}
+	}
+	level.Debug(f.logger).Log("msg", "determined owned targets", "shard", shard, "total_shards", totalShards, "owned", owned, "total", total)
+	return out
+}
+
+func (f *ShardFilter) filterCluster(in DiscoveredGroups) DiscoveredGroups {
+	out, err := ClusterGroups(in, f.node)
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "failed to look up owner of targets, scraping them locally", "err", err)
+	}
+
+	var owned, total int
+	for name, groups := range in {
+		for i, group := range groups {
+			total += len(group.Targets)
+			owned += len(out[name][i].Targets)
+		}
+	}
+	level.Debug(f.logger).Log("msg", "determined owned targets", "peers", len(f.node.Peers()), "owned", owned, "total", total)
+	return out
+}
+
+// Stop stops the shard filter from processing more target updates.
+func (f *ShardFilter) Stop() {
+	f.cancel()
+}
+
+// SyncCh returns a read only channel used by all the clients to receive
+// target updates.
+func (f *ShardFilter) SyncCh() GroupChannel {
+	return f.outputCh
+}
+
+// ShardGroups takes a set of DiscoveredGroups as input and filters out any
+// Target which doesn't belong to shard out of totalShards. Groups are never
+// removed, so targets which moved to another shard stop being scraped.
+//
+// Targets are assigned to shards by hashing the name of their job and their
+// discovered labels, so every agent assigns targets the same way as long as
+// they discover the same targets.
+func ShardGroups(in DiscoveredGroups, shard, totalShards int) DiscoveredGroups {
+	if totalShards <= 1 {
+		return in
+	}
+
+	out := make(DiscoveredGroups, len(in))
+
+	for name, groups := range in {
+		groupList := make([]*targetgroup.Group, 0, len(groups))
+
+		for _, group := range groups {
+			newGroup := &targetgroup.Group{
+				Targets: make([]model.LabelSet, 0, len(group.Targets)/totalShards+1),
+				Labels:  group.Labels,
+				Source:  group.Source,
+			}
+
+			for _, target := range group.Targets {
+				if targetShard(name, mergeSets(target, group.Labels), totalShards) == shard {
+					newGroup.Targets = append(newGroup.Targets, target)
+				}
+			}
+
+			groupList = append(groupList, newGroup)
+		}
+
+		out[name] = groupList
+	}
+
+	return out
+}
+
+// ClusterGroups takes a set of DiscoveredGroups as input and filters out any
+// Target which isn't owned by the local peer of node. Like ShardGroups, groups
+// are never removed.
+//
+// Targets whose owner can't be looked up, such as when node hasn't joined a
+// cluster yet, are kept so they are still scraped by at least one agent. The
+// last lookup error is returned alongside the filtered groups.
+func ClusterGroups(in DiscoveredGroups, node cluster.Node) (DiscoveredGroups, error) {
+	var lastErr error
+
+	out := make(DiscoveredGroups, len(in))
+
+	for name, groups := range in {
+		groupList := make([]*targetgroup.Group, 0, len(groups))
+
+		for _, group := range groups {
+			newGroup := &targetgroup.Group{
+				Targets: make([]model.LabelSet, 0, len(group.Targets)),
+				Labels:  group.Labels,
+				Source:  group.Source,
+			}
+
+			for _, target := range group.Targets {
+				peers, err := node.Lookup(targetKey(name, mergeSets(target, group.Labels)), 1, shard.OpReadWrite)
+				if err != nil {
+					lastErr = err
+					newGroup.Targets = append(newGroup.Targets, target)
+					continue
+				}
+				if len(peers) == 0 || peers[0].Self {
+					newGroup.Targets = append(newGroup.Targets, target)
+				}
+			}
+
+			groupList = append(groupList, newGroup)
+		}
+
+		out[name] = groupList
+	}
+
+	return out, lastErr
+}
+
+// targetKey returns the key used to find the peer which owns a target with the
+// discovered labels lset.
+func targetKey(job string, lset model.LabelSet) shard.Key {
+	kb := shard.NewKeyBuilder()
+	_, _ = kb.Write([]byte(job))
+	_, _ = kb.Write([]byte{0xff})
+	_, _ = kb.Write([]byte(lset.String()))
+	return kb.Key()
+}
+
+// targetShard returns the shard a target with the discovered labels lset
+// belongs to.
+func targetShard(job string, lset model.LabelSet, totalShards int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(job))
+	_, _ = h.Write([]byte{0xff})
+	_, _ = h.Write([]byte(lset.String()))
+	return int(h.Sum64() % uint64(totalShards))
+}
@@ -0,0 +1,237 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/rfratto/ckit"
+	"github.com/rfratto/ckit/peer"
+	"github.com/rfratto/ckit/shard"
+	"github.com/stretchr/testify/require"
+)
+
+func makeShardTestGroups(n int) DiscoveredGroups {
+	targets := make([]model.LabelSet, 0, n)
+	for i := 0; i < n; i++ {
+		targets = append(targets, model.LabelSet{
+			model.AddressLabel: model.LabelValue(fmt.Sprintf("10.0.0.%d:9100", i)),
+		})
+	}
+	return DiscoveredGroups{
+		"node": {{Source: "static", Targets: targets, Labels: model.LabelSet{"env": "prod"}}},
+	}
+}
+
+func TestShardGroups(t *testing.T) {
+	const (
+		numTargets  = 100
+		totalShards = 3
+	)
+	in := makeShardTestGroups(numTargets)
+
+	// Every target should belong to exactly one shard, and targets should be
+	// spread across all shards.
+	seen := map[model.LabelValue]int{}
+	for shard := 0; shard < totalShards; shard++ {
+		out := ShardGroups(in, shard, totalShards)
+
+		require.Len(t, out["node"], 1, "groups should never be removed")
+		group := out["node"][0]
+		require.Equal(t, "static", group.Source)
+		require.Equal(t, model.LabelSet{"env": "prod"}, group.Labels)
+		require.NotEmpty(t, group.Targets, "shard %d has no targets", shard)
+
+		for _, target := range group.Targets {
+			seen[target[model.AddressLabel]]++
+		}
+	}
+
+	require.Len(t, seen, numTargets)
+	for addr, count := range seen {
+		require.Equal(t, 1, count, "target %s belongs to more than one shard", addr)
+	}
+
+	// Assignments must be stable so that all agents agree on them.
+	require.Equal(t, ShardGroups(in, 1, totalShards), ShardGroups(in, 1, totalShards))
+}
+
+func TestShardGroups_Disabled(t *testing.T) {
+	in := makeShardTestGroups(10)
+	require.Equal(t, in, ShardGroups(in, 0, 0))
+	require.Equal(t, in, ShardGroups(in, 0, 1))
+}
+
+func TestShardFilter_SetShard(t *testing.T) {
+	in := makeShardTestGroups(50)
+
+	inputCh := make(chan DiscoveredGroups)
+	f := NewShardFilter(log.NewNopLogger(), 0, 2)
+	go f.Run(inputCh)
+	defer f.Stop()
+
+	inputCh <- in
+	require.Equal(t, ShardGroups(in, 0, 2), receiveGroups(t, f))
+
+	// Changing the shard should redistribute the last discovered targets
+	// without waiting for discovery.
+	f.SetShard(1, 2)
+	require.Equal(t, ShardGroups(in, 1, 2), receiveGroups(t, f))
+
+	f.SetShard(2, 4)
+	require.Equal(t, ShardGroups(in, 2, 4), receiveGroups(t, f))
+}
+
+func TestClusterGroups(t *testing.T) {
+	const numTargets = 100
+	in := makeShardTestGroups(numTargets)
+
+	names := []string{"a", "b", "c"}
+
+	// Every target should be owned by exactly one peer, and targets should be
+	// spread across all peers.
+	seen := map[model.LabelValue]int{}
+	for _, self := range names {
+		node := newFakeNode(self, names...)
+		out, err := ClusterGroups(in, node)
+		require.NoError(t, err)
+
+		require.Len(t, out["node"], 1, "groups should never be removed")
+		group := out["node"][0]
+		require.Equal(t, "static", group.Source)
+		require.Equal(t, model.LabelSet{"env": "prod"}, group.Labels)
+		require.NotEmpty(t, group.Targets, "peer %s owns no targets", self)
+
+		for _, target := range group.Targets {
+			seen[target[model.AddressLabel]]++
+		}
+	}
+
+	require.Len(t, seen, numTargets)
+	for addr, count := range seen {
+		require.Equal(t, 1, count, "target %s is owned by more than one peer", addr)
+	}
+}
+
+func TestClusterGroups_LookupError(t *testing.T) {
+	in := makeShardTestGroups(10)
+
+	node := newFakeNode("a", "a", "b")
+	node.lookupErr = errors.New("node not started")
+
+	// Targets should still be scraped when their owner is unknown.
+	out, err := ClusterGroups(in, node)
+	require.Error(t, err)
+	require.Equal(t, in, out)
+}
+
+func TestShardFilter_ClusterMembership(t *testing.T) {
+	in := makeShardTestGroups(50)
+
+	node := newFakeNode("a", "a")
+
+	inputCh := make(chan DiscoveredGroups)
+	f := NewClusterShardFilter(log.NewNopLogger(), node)
+	go f.Run(inputCh)
+	defer f.Stop()
+
+	// A single-node cluster owns every target.
+	inputCh <- in
+	require.Equal(t, in, receiveGroups(t, f))
+
+	// Peers joining should redistribute the last discovered targets without
+	// waiting for discovery.
+	node.SetPeers("a", "b", "c")
+	out := receiveGroups(t, f)
+	expect, err := ClusterGroups(in, node)
+	require.NoError(t, err)
+	require.Equal(t, expect, out)
+	require.Less(t, len(out["node"][0].Targets), len(in["node"][0].Targets))
+
+	// Peers leaving should move their targets back.
+	node.SetPeers("a")
+	require.Equal(t, in, receiveGroups(t, f))
+}
+
+// fakeNode is a cluster.Node whose peers are set by tests.
+type fakeNode struct {
+	self      string
+	sharder   shard.Sharder
+	lookupErr error
+
+	mut       sync.Mutex
+	peers     []peer.Peer
+	observers []ckit.Observer
+}
+
+func newFakeNode(self string, peers ...string) *fakeNode {
+	n := &fakeNode{self: self, sharder: shard.Ring(256)}
+	n.SetPeers(peers...)
+	return n
+}
+
+// SetPeers changes the peers of n and notifies observers.
+func (n *fakeNode) SetPeers(names ...string) {
+	peers := make([]peer.Peer, 0, len(names))
+	for _, name := range names {
+		peers = append(peers, peer.Peer{
+			Name:  name,
+			Addr:  name + ":12345",
+			Self:  name == n.self,
+			State: peer.StateParticipant,
+		})
+	}
+	n.sharder.SetPeers(peers)
+
+	n.mut.Lock()
+	n.peers = peers
+	observers := n.observers
+	n.observers = nil
+	n.mut.Unlock()
+
+	var keep []ckit.Observer
+	for _, o := range observers {
+		if o.NotifyPeersChanged(peers) {
+			keep = append(keep, o)
+		}
+	}
+
+	n.mut.Lock()
+	n.observers = append(n.observers, keep...)
+	n.mut.Unlock()
+}
+
+func (n *fakeNode) Lookup(key shard.Key, replicationFactor int, op shard.Op) ([]peer.Peer, error) {
+	if n.lookupErr != nil {
+		return nil, n.lookupErr
+	}
+	return n.sharder.Lookup(key, replicationFactor, op)
+}
+
+func (n *fakeNode) Observe(o ckit.Observer) {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	n.observers = append(n.observers, o)
+}
+
+func (n *fakeNode) Peers() []peer.Peer {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	return n.peers
+}
+
+func receiveGroups(t *testing.T, f *ShardFilter) DiscoveredGroups {
+	t.Helper()
+
+	select {
+	case out := <-f.SyncCh():
+		return out
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for targets")
+		return nil
+	}
+}
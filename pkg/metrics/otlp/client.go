@@ -0,0 +1,178 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	config_util "github.com/prometheus/common/config"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// client sends metrics to an OTLP endpoint.
+type client interface {
+	Export(ctx context.Context, md pmetric.Metrics) error
+	Close() error
+}
+
+// recoverableError is returned by clients when sending failed but may
+// succeed if retried.
+type recoverableError struct{ error }
+
+func (e recoverableError) Unwrap() error { return e.error }
+
+func newClient(cfg Config) (client, error) {
+	switch cfg.Protocol {
+	case ProtocolGRPC:
+		return newGRPCClient(cfg)
+	case ProtocolHTTP:
+		return newHTTPClient(cfg)
+	default:
+		return nil, cfg.Protocol.Validate()
+	}
+}
+
+type grpcClient struct {
+	cfg    Config
+	conn   *grpc.ClientConn
+	client pmetricotlp.Client
+	md     metadata.MD
+}
+
+func newGRPCClient(cfg Config) (*grpcClient, error) {
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		tlsConfig, err := config_util.NewTLSConfig(&cfg.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	// Dialing doesn't block; connection errors are returned when exporting.
+	conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	md := metadata.New(nil)
+	for k, v := range cfg.Headers {
+		md.Set(k, string(v))
+	}
+
+	return &grpcClient{
+		cfg:    cfg,
+		conn:   conn,
+		client: pmetricotlp.NewClient(conn),
+		md:     md,
+	}, nil
+}
+
+func (c *grpcClient) Export(ctx context.Context, md pmetric.Metrics) error {
+	ctx = metadata.NewOutgoingContext(ctx, c.md)
+	_, err := c.client.Export(ctx, pmetricotlp.NewRequestFromMetrics(md))
+	if err == nil {
+		return nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.DataLoss:
+		return recoverableError{err}
+	case codes.ResourceExhausted:
+		if c.cfg.QueueConfig.RetryOnRateLimit {
+			return recoverableError{err}
+		}
+	}
+	return err
+}
+
+func (c *grpcClient) Close() error { return c.conn.Close() }
+
+// maxErrMsgLen is the maximum length of a response body included in errors.
+const maxErrMsgLen = 256
+
+type httpClient struct {
+	cfg    Config
+	url    string
+	client *http.Client
+}
+
+func newHTTPClient(cfg Config) (*httpClient, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/v1/metrics")
+
+	tlsConfig, err := config_util.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpClient{
+		cfg: cfg,
+		url: u.String(),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}, nil
+}
+
+func (c *httpClient) Export(ctx context.Context, md pmetric.Metrics) error {
+	body, err := pmetricotlp.NewRequestFromMetrics(md).MarshalProto()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, string(v))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Network errors are assumed to be temporary.
+		return recoverableError{err}
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrMsgLen))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	switch {
+	case resp.StatusCode/100 == 5:
+		return recoverableError{err}
+	case resp.StatusCode == http.StatusTooManyRequests && c.cfg.QueueConfig.RetryOnRateLimit:
+		return recoverableError{err}
+	}
+	return err
+}
+
+func (c *httpClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package otlp implements exporting metrics from an instance's WAL to an OTLP
+// endpoint.
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// Protocol is the protocol used to send metrics to an OTLP endpoint.
+type Protocol string
+
+// Supported protocols.
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http"
+)
+
+// Validate returns an error if p isn't a supported protocol.
+func (p Protocol) Validate() error {
+	switch p {
+	case ProtocolGRPC, ProtocolHTTP:
+		return nil
+	default:
+		return fmt.Errorf("unsupported OTLP protocol %q, must be %q or %q", p, ProtocolGRPC, ProtocolHTTP)
+	}
+}
+
+// DefaultConfig holds default settings for an OTLP exporter.
+var DefaultConfig = Config{
+	Protocol:    ProtocolGRPC,
+	Timeout:     30 * time.Second,
+	QueueConfig: config.DefaultQueueConfig,
+}
+
+// Config configures an OTLP exporter.
+type Config struct {
+	// Name of the exporter. Generated by the instance if empty.
+	Name string `yaml:"name,omitempty"`
+
+	// Endpoint to send metrics to. For gRPC, this is a host:port pair. For
+	// HTTP, this is a base URL which /v1/metrics is appended to.
+	Endpoint string                        `yaml:"endpoint"`
+	Protocol Protocol                      `yaml:"protocol,omitempty"`
+	Headers  map[string]config_util.Secret `yaml:"headers,omitempty"`
+	Timeout  time.Duration                 `yaml:"timeout,omitempty"`
+
+	// Insecure disables TLS for gRPC connections. HTTP endpoints use TLS
+	// based on the scheme of Endpoint.
+	Insecure  bool                  `yaml:"insecure,omitempty"`
+	TLSConfig config_util.TLSConfig `yaml:"tls_config,omitempty"`
+
+	WriteRelabelConfigs []*relabel.Config `yaml:"write_relabel_configs,omitempty"`
+
+	// QueueConfig uses the same settings as remote_write queues. Samples are
+	// sent by a single shard, so min_shards and max_shards are ignored.
+	QueueConfig config.QueueConfig `yaml:"queue_config,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate returns an error if c is invalid.
+func (c *Config) Validate() error {
+	if c.Endpoint == "" {
+		return errors.New("endpoint must be set")
+	}
+	if err := c.Protocol.Validate(); err != nil {
+		return err
+	}
+	if c.Protocol == ProtocolHTTP {
+		if _, err := url.Parse(c.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint: %w", err)
+		}
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be greater than 0s")
+	}
+	if c.QueueConfig.MaxSamplesPerSend <= 0 {
+		return errors.New("queue_config.max_samples_per_send must be greater than 0")
+	}
+	if c.QueueConfig.Capacity < c.QueueConfig.MaxSamplesPerSend {
+		return errors.New("queue_config.capacity must not be less than queue_config.max_samples_per_send")
+	}
+	for _, rlcfg := range c.WriteRelabelConfigs {
+		if rlcfg == nil {
+			return errors.New("empty or null relabeling rule in OTLP export config")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig_Unmarshal(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{
+			name: "valid",
+			in:   `endpoint: localhost:4317`,
+		},
+		{
+			name: "missing endpoint",
+			in:   `protocol: http`,
+			err:  "endpoint must be set",
+		},
+		{
+			name: "unsupported protocol",
+			in: `endpoint: localhost:4317
+protocol: websocket`,
+			err: `unsupported OTLP protocol "websocket", must be "grpc" or "http"`,
+		},
+		{
+			name: "batch larger than capacity",
+			in: `endpoint: localhost:4317
+queue_config:
+  capacity: 10
+  max_samples_per_send: 100`,
+			err: "queue_config.capacity must not be less than queue_config.max_samples_per_send",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg Config
+			err := yaml.UnmarshalStrict([]byte(tc.in), &cfg)
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, DefaultConfig.Timeout, cfg.Timeout)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/scrape"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// scopeName is the name of the instrumentation scope of exported metrics.
+const scopeName = "github.com/grafana/agent/pkg/metrics/otlp"
+
+// MetadataStore looks up metadata for metric families.
+type MetadataStore interface {
+	GetMetadata(metric string) (scrape.MetricMetadata, bool)
+}
+
+// sample is a sample read from the WAL along with the labels of its series.
+type sample struct {
+	labels labels.Labels
+	t      int64
+	v      float64
+}
+
+type pointKind int
+
+const (
+	kindGauge pointKind = iota
+	kindSum
+	kindHistogram
+	kindSummary
+)
+
+// point is a single OTLP data point. Histogram and summary points are built
+// from several Prometheus series.
+type point struct {
+	kind       pointKind
+	name       string
+	help, unit string
+	attrs      labels.Labels
+	t          int64
+	stale      bool
+
+	// value is set for gauge and sum points.
+	value float64
+
+	// The fields below are set for histogram and summary points. Bucket
+	// counts are cumulative, like in Prometheus.
+	buckets   []bucket
+	quantiles []quantile
+	sum       float64
+	count     float64
+	hasCount  bool
+}
+
+type bucket struct{ le, count float64 }
+
+type quantile struct{ q, value float64 }
+
+// groupKey identifies the point a sample of a histogram or summary belongs
+// to.
+type groupKey struct {
+	family string
+	hash   uint64
+	t      int64
+}
+
+// convertSamples converts samples into OTLP points. The type of each point
+// is taken from md, which may be nil. Series without metadata are converted
+// into gauges.
+//
+// All series of a histogram or summary must be passed in the same call to be
+// combined into a single point. Samples appended together, like those from a
+// scrape, are stored in the same WAL record so this holds when samples are
+// converted one record at a time.
+func convertSamples(md MetadataStore, samples []sample) []point {
+	var (
+		points  []point
+		grouped = make(map[groupKey]int)
+	)
+
+	for _, s := range samples {
+		name := s.labels.Get(labels.MetricName)
+		family, meta := lookupMetadata(md, name)
+
+		var (
+			kind     pointKind
+			dropName string
+		)
+		switch meta.Type {
+		case textparse.MetricTypeCounter:
+			points = append(points, newPoint(kindSum, name, meta, s))
+			continue
+		case textparse.MetricTypeHistogram, textparse.MetricTypeGaugeHistogram:
+			kind, dropName = kindHistogram, "le"
+		case textparse.MetricTypeSummary:
+			kind, dropName = kindSummary, "quantile"
+		default:
+			points = append(points, newPoint(kindGauge, name, meta, s))
+			continue
+		}
+
+		attrs := s.labels.WithoutLabels(dropName)
+		key := groupKey{family: family, hash: attrs.Hash(), t: s.t}
+		idx, ok := grouped[key]
+		if !ok {
+			points = append(points, point{
+				kind:  kind,
+				name:  family,
+				help:  meta.Help,
+				unit:  meta.Unit,
+				attrs: attrs,
+				t:     s.t,
+			})
+			idx = len(points) - 1
+			grouped[key] = idx
+		}
+
+		p := &points[idx]
+		if value.IsStaleNaN(s.v) {
+			p.stale = true
+		}
+
+		switch {
+		case name == family+"_sum":
+			p.sum = s.v
+		case name == family+"_count":
+			p.count, p.hasCount = s.v, true
+		case kind == kindHistogram && name == family+"_bucket":
+			le, err := strconv.ParseFloat(s.labels.Get("le"), 64)
+			if err != nil {
+				// Keep the sample rather than silently dropping it.
+				points = append(points, newPoint(kindGauge, name, scrape.MetricMetadata{}, s))
+				continue
+			}
+			p.buckets = append(p.buckets, bucket{le: le, count: s.v})
+		case kind == kindSummary && name == family:
+			q, err := strconv.ParseFloat(s.labels.Get("quantile"), 64)
+			if err != nil {
+				points = append(points, newPoint(kindGauge, name, scrape.MetricMetadata{}, s))
+				continue
+			}
+			p.quantiles = append(p.quantiles, quantile{q: q, value: s.v})
+		default:
+			points = append(points, newPoint(kindGauge, name, scrape.MetricMetadata{}, s))
+		}
+	}
+
+	return points
+}
+
+func newPoint(kind pointKind, name string, meta scrape.MetricMetadata, s sample) point {
+	return point{
+		kind:  kind,
+		name:  name,
+		help:  meta.Help,
+		unit:  meta.Unit,
+		attrs: s.labels.WithoutLabels(),
+		t:     s.t,
+		stale: value.IsStaleNaN(s.v),
+		value: s.v,
+	}
+}
+
+// lookupMetadata returns the metric family name belongs to along with its
+// metadata. Families of histograms, summaries and OpenMetrics counters are
+// found by trimming the suffix of their series.
+func lookupMetadata(md MetadataStore, name string) (string, scrape.MetricMetadata) {
+	if md == nil {
+		return name, scrape.MetricMetadata{Type: textparse.MetricTypeUnknown}
+	}
+	if meta, ok := md.GetMetadata(name); ok {
+		return name, meta
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family := strings.TrimSuffix(name, suffix)
+		if meta, ok := md.GetMetadata(family); ok {
+			return family, meta
+		}
+	}
+	return name, scrape.MetricMetadata{Type: textparse.MetricTypeUnknown}
+}
+
+// buildMetrics builds OTLP metrics from points. resource is used as the
+// attributes of the resource all metrics belong to.
+func buildMetrics(resource labels.Labels, points []point) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	for _, l := range resource {
+		rm.Resource().Attributes().UpsertString(l.Name, l.Value)
+	}
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(scopeName)
+
+	type metricKey struct {
+		name string
+		kind pointKind
+	}
+	metrics := make(map[metricKey]pmetric.Metric)
+
+	for _, p := range points {
+		key := metricKey{name: p.name, kind: p.kind}
+		m, ok := metrics[key]
+		if !ok {
+			m = newMetric(sm.Metrics(), p)
+			metrics[key] = m
+		}
+
+		switch p.kind {
+		case kindGauge:
+			setNumberPoint(m.Gauge().DataPoints().AppendEmpty(), p)
+		case kindSum:
+			setNumberPoint(m.Sum().DataPoints().AppendEmpty(), p)
+		case kindHistogram:
+			setHistogramPoint(m.Histogram().DataPoints().AppendEmpty(), p)
+		case kindSummary:
+			setSummaryPoint(m.Summary().DataPoints().AppendEmpty(), p)
+		}
+	}
+
+	return md
+}
+
+func newMetric(ms pmetric.MetricSlice, p point) pmetric.Metric {
+	m := ms.AppendEmpty()
+	m.SetName(p.name)
+	m.SetDescription(p.help)
+	m.SetUnit(p.unit)
+
+	switch p.kind {
+	case kindGauge:
+		m.SetDataType(pmetric.MetricDataTypeGauge)
+	case kindSum:
+		m.SetDataType(pmetric.MetricDataTypeSum)
+		m.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+		m.Sum().SetIsMonotonic(true)
+	case kindHistogram:
+		m.SetDataType(pmetric.MetricDataTypeHistogram)
+		m.Histogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+	case kindSummary:
+		m.SetDataType(pmetric.MetricDataTypeSummary)
+	}
+	return m
+}
+
+// staleFlags marks points of series which went stale.
+var staleFlags = pmetric.NewMetricDataPointFlags(pmetric.MetricDataPointFlagNoRecordedValue)
+
+func setNumberPoint(dp pmetric.NumberDataPoint, p point) {
+	setAttributes(dp.Attributes(), p.attrs)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(timestamp.Time(p.t)))
+	if p.stale {
+		dp.SetFlags(staleFlags)
+		return
+	}
+	dp.SetDoubleVal(p.value)
+}
+
+func setHistogramPoint(dp pmetric.HistogramDataPoint, p point) {
+	setAttributes(dp.Attributes(), p.attrs)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(timestamp.Time(p.t)))
+	if p.stale {
+		dp.SetFlags(staleFlags)
+		return
+	}
+
+	sort.Slice(p.buckets, func(i, j int) bool { return p.buckets[i].le < p.buckets[j].le })
+
+	var (
+		bounds []float64
+		counts []uint64
+		prev   float64
+		total  = math.NaN()
+	)
+	for _, b := range p.buckets {
+		if math.IsInf(b.le, +1) {
+			total = b.count
+			continue
+		}
+		bounds = append(bounds, b.le)
+		counts = append(counts, toCount(b.count-prev))
+		prev = b.count
+	}
+	switch {
+	case p.hasCount:
+		total = p.count
+	case math.IsNaN(total):
+		total = prev
+	}
+	// OTLP bucket counts aren't cumulative and include an implicit +Inf
+	// bucket after the last bound.
+	counts = append(counts, toCount(total-prev))
+
+	dp.SetExplicitBounds(pcommon.NewImmutableFloat64Slice(bounds))
+	dp.SetBucketCounts(pcommon.NewImmutableUInt64Slice(counts))
+	dp.SetCount(toCount(total))
+	dp.SetSum(p.sum)
+}
+
+func setSummaryPoint(dp pmetric.SummaryDataPoint, p point) {
+	setAttributes(dp.Attributes(), p.attrs)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(timestamp.Time(p.t)))
+	if p.stale {
+		dp.SetFlags(staleFlags)
+		return
+	}
+
+	sort.Slice(p.quantiles, func(i, j int) bool { return p.quantiles[i].q < p.quantiles[j].q })
+	for _, q := range p.quantiles {
+		qv := dp.QuantileValues().AppendEmpty()
+		qv.SetQuantile(q.q)
+		qv.SetValue(q.value)
+	}
+	dp.SetCount(toCount(p.count))
+	dp.SetSum(p.sum)
+}
+
+func setAttributes(m pcommon.Map, lset labels.Labels) {
+	for _, l := range lset {
+		m.UpsertString(l.Name, l.Value)
+	}
+}
+
+// toCount converts a Prometheus count into an OTLP count. Counts can be
+// negative when buckets are inconsistent; they are clamped to 0.
+func toCount(v float64) uint64 {
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	return uint64(math.Round(v))
+}
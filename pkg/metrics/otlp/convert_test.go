@@ -0,0 +1,136 @@
+package otlp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// mapMetadata is a MetadataStore backed by a map.
+type mapMetadata map[string]scrape.MetricMetadata
+
+func (m mapMetadata) GetMetadata(metric string) (scrape.MetricMetadata, bool) {
+	md, ok := m[metric]
+	return md, ok
+}
+
+func TestConvert(t *testing.T) {
+	md := mapMetadata{
+		"requests": {Metric: "requests", Type: textparse.MetricTypeCounter, Help: "Total requests."},
+		"latency":  {Metric: "latency", Type: textparse.MetricTypeHistogram, Unit: "seconds"},
+		"rpc":      {Metric: "rpc", Type: textparse.MetricTypeSummary},
+		"temp":     {Metric: "temp", Type: textparse.MetricTypeGauge},
+	}
+
+	s := func(v float64, lbls ...string) sample {
+		return sample{labels: labels.FromStrings(lbls...), t: 1000, v: v}
+	}
+	points := convertSamples(md, []sample{
+		s(5, "__name__", "requests_total", "code", "200"),
+		s(2, "__name__", "latency_bucket", "le", "1", "path", "/"),
+		s(5, "__name__", "latency_bucket", "le", "5", "path", "/"),
+		s(7, "__name__", "latency_bucket", "le", "+Inf", "path", "/"),
+		s(10, "__name__", "latency_sum", "path", "/"),
+		s(7, "__name__", "latency_count", "path", "/"),
+		s(0.1, "__name__", "rpc", "quantile", "0.5"),
+		s(0.9, "__name__", "rpc", "quantile", "0.99"),
+		s(3, "__name__", "rpc_sum"),
+		s(20, "__name__", "rpc_count"),
+		s(math.Float64frombits(value.StaleNaN), "__name__", "temp"),
+		s(1, "__name__", "no_metadata"),
+	})
+	metrics := buildMetrics(labels.FromStrings("cluster", "local"), points)
+
+	require.Equal(t, 1, metrics.ResourceMetrics().Len())
+	rm := metrics.ResourceMetrics().At(0)
+	cluster, ok := rm.Resource().Attributes().Get("cluster")
+	require.True(t, ok)
+	require.Equal(t, "local", cluster.StringVal())
+
+	byName := make(map[string]pmetric.Metric)
+	ms := rm.ScopeMetrics().At(0).Metrics()
+	for i := 0; i < ms.Len(); i++ {
+		byName[ms.At(i).Name()] = ms.At(i)
+	}
+	require.Len(t, byName, 5)
+
+	t.Run("counter", func(t *testing.T) {
+		m := byName["requests_total"]
+		require.Equal(t, pmetric.MetricDataTypeSum, m.DataType())
+		require.Equal(t, "Total requests.", m.Description())
+		require.True(t, m.Sum().IsMonotonic())
+		require.Equal(t, pmetric.MetricAggregationTemporalityCumulative, m.Sum().AggregationTemporality())
+
+		dp := m.Sum().DataPoints().At(0)
+		require.Equal(t, 5.0, dp.DoubleVal())
+		require.Equal(t, int64(1000), dp.Timestamp().AsTime().UnixMilli())
+		code, _ := dp.Attributes().Get("code")
+		require.Equal(t, "200", code.StringVal())
+		_, ok := dp.Attributes().Get("__name__")
+		require.False(t, ok)
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		m := byName["latency"]
+		require.Equal(t, pmetric.MetricDataTypeHistogram, m.DataType())
+		require.Equal(t, "seconds", m.Unit())
+		require.Equal(t, 1, m.Histogram().DataPoints().Len())
+
+		dp := m.Histogram().DataPoints().At(0)
+		require.Equal(t, []float64{1, 5}, dp.ExplicitBounds().AsRaw())
+		require.Equal(t, []uint64{2, 3, 2}, dp.BucketCounts().AsRaw())
+		require.Equal(t, uint64(7), dp.Count())
+		require.Equal(t, 10.0, dp.Sum())
+		require.Equal(t, 1, dp.Attributes().Len())
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		m := byName["rpc"]
+		require.Equal(t, pmetric.MetricDataTypeSummary, m.DataType())
+
+		dp := m.Summary().DataPoints().At(0)
+		require.Equal(t, uint64(20), dp.Count())
+		require.Equal(t, 3.0, dp.Sum())
+		require.Equal(t, 2, dp.QuantileValues().Len())
+		require.Equal(t, 0.99, dp.QuantileValues().At(1).Quantile())
+		require.Equal(t, 0.9, dp.QuantileValues().At(1).Value())
+	})
+
+	t.Run("stale gauge", func(t *testing.T) {
+		m := byName["temp"]
+		require.Equal(t, pmetric.MetricDataTypeGauge, m.DataType())
+		dp := m.Gauge().DataPoints().At(0)
+		require.True(t, dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue))
+	})
+
+	t.Run("no metadata", func(t *testing.T) {
+		m := byName["no_metadata"]
+		require.Equal(t, pmetric.MetricDataTypeGauge, m.DataType())
+		require.Equal(t, 1.0, m.Gauge().DataPoints().At(0).DoubleVal())
+	})
+}
+
+func TestConvert_HistogramWithoutInfBucket(t *testing.T) {
+	md := mapMetadata{"latency": {Metric: "latency", Type: textparse.MetricTypeHistogram}}
+
+	points := convertSamples(md, []sample{
+		{labels: labels.FromStrings("__name__", "latency_bucket", "le", "1"), t: 1, v: 4},
+		{labels: labels.FromStrings("__name__", "latency_count"), t: 1, v: 6},
+		// A different timestamp belongs to a different point.
+		{labels: labels.FromStrings("__name__", "latency_count"), t: 2, v: 8},
+	})
+	require.Len(t, points, 2)
+
+	metrics := buildMetrics(nil, points)
+	dps := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Histogram().DataPoints()
+	require.Equal(t, 2, dps.Len())
+	require.Equal(t, []uint64{4, 2}, dps.At(0).BucketCounts().AsRaw())
+	require.Equal(t, uint64(6), dps.At(0).Count())
+	require.Equal(t, []uint64{8}, dps.At(1).BucketCounts().AsRaw())
+}
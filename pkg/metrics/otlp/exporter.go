@@ -0,0 +1,408 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"go.uber.org/atomic"
+)
+
+// Options configure how an Exporter reads from the WAL.
+type Options struct {
+	// WALDir is the directory of the WAL to read samples from.
+	WALDir string
+
+	// ExternalLabels are sent as resource attributes.
+	ExternalLabels labels.Labels
+
+	// Metadata is used to determine the type of exported metrics. May be nil,
+	// in which case every metric is exported as a gauge.
+	Metadata MetadataStore
+
+	// FlushDeadline is how long Stop waits for pending samples to be sent.
+	FlushDeadline time.Duration
+}
+
+// Exporter exports samples from a WAL to an OTLP endpoint. Like remote_write
+// queues, only samples appended after the Exporter starts are exported.
+type Exporter struct {
+	logger  log.Logger
+	cfg     Config
+	opts    Options
+	client  client
+	metrics *exporterMetrics
+	watcher *wal.Watcher
+
+	seriesMtx     sync.Mutex
+	series        map[chunks.HeadSeriesRef]labels.Labels
+	seriesSegment map[chunks.HeadSeriesRef]int
+
+	mut      sync.Mutex
+	cond     *sync.Cond // Signaled when points are taken from pending.
+	pending  []point
+	stopping bool
+
+	notify chan struct{} // Signaled when points are added to pending.
+	quit   chan struct{}
+	done   chan struct{}
+
+	// ctx is canceled to abort sending once the flush deadline passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	highestSent atomic.Int64
+}
+
+// NewExporter creates a new Exporter. reg may be nil. Call Start to begin
+// exporting samples.
+func NewExporter(logger log.Logger, reg prometheus.Registerer, cfg Config, opts Options) (*Exporter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newExporterMetrics(reg, cfg.Name)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	logger = log.With(logger, "otlp_name", cfg.Name)
+	e := &Exporter{
+		logger:  logger,
+		cfg:     cfg,
+		opts:    opts,
+		client:  c,
+		metrics: metrics,
+
+		series:        make(map[chunks.HeadSeriesRef]labels.Labels),
+		seriesSegment: make(map[chunks.HeadSeriesRef]int),
+
+		notify: make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	e.cond = sync.NewCond(&e.mut)
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	// Watcher metrics aren't registered; they would collide with the
+	// metrics of the remote_write watchers reading the same WAL.
+	e.watcher = wal.NewWatcher(wal.NewWatcherMetrics(nil), wal.NewLiveReaderMetrics(nil), logger, cfg.Name, e, opts.WALDir, false)
+	return e, nil
+}
+
+// Start starts reading from the WAL and sending samples.
+func (e *Exporter) Start() {
+	go e.run()
+	e.watcher.Start()
+}
+
+// Stop stops reading from the WAL and waits up to the flush deadline for
+// pending samples to be sent. Samples which couldn't be sent in time are
+// dropped.
+func (e *Exporter) Stop() {
+	// Unblock the watcher if it's waiting for room in the queue so it can
+	// stop.
+	e.mut.Lock()
+	e.stopping = true
+	e.cond.Broadcast()
+	e.mut.Unlock()
+
+	e.watcher.Stop()
+	close(e.quit)
+
+	select {
+	case <-e.done:
+	case <-time.After(e.opts.FlushDeadline):
+		level.Warn(e.logger).Log("msg", "failed to flush all samples to OTLP endpoint before the flush deadline")
+		e.cancel()
+		<-e.done
+	}
+	e.cancel()
+
+	if err := e.client.Close(); err != nil {
+		level.Warn(e.logger).Log("msg", "failed to close OTLP client", "err", err)
+	}
+	e.metrics.unregister()
+}
+
+// HighestSentTimestamp returns the timestamp, in milliseconds, of the newest
+// sample which has been sent.
+func (e *Exporter) HighestSentTimestamp() int64 {
+	return e.highestSent.Load()
+}
+
+// Append implements wal.WriteTo. It blocks until samples are queued, or the
+// Exporter is stopping.
+func (e *Exporter) Append(refs []record.RefSample) bool {
+	samples := make([]sample, 0, len(refs))
+
+	e.seriesMtx.Lock()
+	for _, ref := range refs {
+		lset, ok := e.series[ref.Ref]
+		if !ok {
+			// The series was dropped by relabeling.
+			continue
+		}
+		samples = append(samples, sample{labels: lset, t: ref.T, v: ref.V})
+	}
+	e.seriesMtx.Unlock()
+
+	if len(samples) == 0 {
+		return true
+	}
+	return e.enqueue(convertSamples(e.opts.Metadata, samples))
+}
+
+// AppendExemplars implements wal.WriteTo. Exemplars aren't exported.
+func (e *Exporter) AppendExemplars([]record.RefExemplar) bool { return true }
+
+// StoreSeries implements wal.WriteTo.
+func (e *Exporter) StoreSeries(series []record.RefSeries, index int) {
+	e.seriesMtx.Lock()
+	defer e.seriesMtx.Unlock()
+
+	for _, s := range series {
+		lset := relabel.Process(s.Labels, e.cfg.WriteRelabelConfigs...)
+		if lset == nil {
+			continue
+		}
+		e.series[s.Ref] = lset
+		e.seriesSegment[s.Ref] = index
+	}
+}
+
+// UpdateSeriesSegment implements wal.WriteTo.
+func (e *Exporter) UpdateSeriesSegment(series []record.RefSeries, index int) {
+	e.seriesMtx.Lock()
+	defer e.seriesMtx.Unlock()
+
+	for _, s := range series {
+		if _, ok := e.series[s.Ref]; ok {
+			e.seriesSegment[s.Ref] = index
+		}
+	}
+}
+
+// SeriesReset implements wal.WriteTo, removing series last seen in segments
+// older than index.
+func (e *Exporter) SeriesReset(index int) {
+	e.seriesMtx.Lock()
+	defer e.seriesMtx.Unlock()
+
+	for ref, segment := range e.seriesSegment {
+		if segment < index {
+			delete(e.series, ref)
+			delete(e.seriesSegment, ref)
+		}
+	}
+}
+
+// enqueue adds points to the queue, blocking while the queue is full. Points
+// converted from a single WAL record are queued together, so a record larger
+// than the capacity is accepted once the queue is empty.
+func (e *Exporter) enqueue(points []point) bool {
+	if len(points) == 0 {
+		return true
+	}
+
+	e.mut.Lock()
+	for !e.stopping && len(e.pending) > 0 && len(e.pending)+len(points) > e.cfg.QueueConfig.Capacity {
+		e.cond.Wait()
+	}
+	if e.stopping {
+		e.mut.Unlock()
+		return false
+	}
+	e.pending = append(e.pending, points...)
+	e.metrics.pending.Set(float64(len(e.pending)))
+	e.mut.Unlock()
+
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// take removes up to max_samples_per_send points from the queue. If full is
+// true, points are only taken if there are enough of them to fill a batch.
+func (e *Exporter) take(full bool) []point {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	n := e.cfg.QueueConfig.MaxSamplesPerSend
+	if len(e.pending) < n {
+		if full {
+			return nil
+		}
+		n = len(e.pending)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	batch := make([]point, n)
+	copy(batch, e.pending)
+	e.pending = append(e.pending[:0], e.pending[n:]...)
+	e.metrics.pending.Set(float64(len(e.pending)))
+	e.cond.Broadcast()
+	return batch
+}
+
+// run sends batches of points until the Exporter stops. A batch is sent once
+// it's full or batch_send_deadline has passed.
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(time.Duration(e.cfg.QueueConfig.BatchSendDeadline))
+	defer ticker.Stop()
+
+	sendBatches := func(full bool) {
+		for {
+			batch := e.take(full)
+			if len(batch) == 0 {
+				return
+			}
+			e.send(batch)
+		}
+	}
+
+	for {
+		select {
+		case <-e.quit:
+			sendBatches(false)
+			return
+		case <-e.notify:
+			sendBatches(true)
+		case <-ticker.C:
+			sendBatches(false)
+		}
+	}
+}
+
+// send sends a batch of points, retrying with backoff on recoverable
+// errors. Points rejected by the endpoint are dropped.
+func (e *Exporter) send(points []point) {
+	md := buildMetrics(e.opts.ExternalLabels, points)
+
+	b := backoff.New(e.ctx, backoff.Config{
+		MinBackoff: time.Duration(e.cfg.QueueConfig.MinBackoff),
+		MaxBackoff: time.Duration(e.cfg.QueueConfig.MaxBackoff),
+	})
+	for b.Ongoing() {
+		ctx, cancel := context.WithTimeout(e.ctx, e.cfg.Timeout)
+		err := e.client.Export(ctx, md)
+		cancel()
+		if err == nil {
+			e.metrics.sentPoints.Add(float64(len(points)))
+			e.updateHighestSent(points)
+			return
+		}
+
+		var recoverable recoverableError
+		if !errors.As(err, &recoverable) {
+			level.Error(e.logger).Log("msg", "OTLP endpoint rejected points, dropping them", "points", len(points), "err", err)
+			e.metrics.failedPoints.Add(float64(len(points)))
+			return
+		}
+
+		level.Warn(e.logger).Log("msg", "failed to send points to OTLP endpoint, retrying", "err", err)
+		e.metrics.retriedPoints.Add(float64(len(points)))
+		b.Wait()
+	}
+
+	level.Error(e.logger).Log("msg", "stopped sending points to OTLP endpoint before they were sent", "points", len(points), "err", b.Err())
+	e.metrics.failedPoints.Add(float64(len(points)))
+}
+
+func (e *Exporter) updateHighestSent(points []point) {
+	highest := e.highestSent.Load()
+	for _, p := range points {
+		if p.t > highest {
+			highest = p.t
+		}
+	}
+	e.highestSent.Store(highest)
+	e.metrics.highestSent.Set(float64(highest) / 1000)
+}
+
+type exporterMetrics struct {
+	reg prometheus.Registerer
+
+	sentPoints    prometheus.Counter
+	failedPoints  prometheus.Counter
+	retriedPoints prometheus.Counter
+	pending       prometheus.Gauge
+	highestSent   prometheus.Gauge
+}
+
+func newExporterMetrics(reg prometheus.Registerer, name string) (*exporterMetrics, error) {
+	constLabels := prometheus.Labels{"otlp_name": name}
+
+	m := &exporterMetrics{
+		reg: reg,
+
+		sentPoints: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "agent_metrics_otlp_sent_points_total",
+			Help:        "Total number of data points sent to an OTLP endpoint.",
+			ConstLabels: constLabels,
+		}),
+		failedPoints: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "agent_metrics_otlp_failed_points_total",
+			Help:        "Total number of data points which failed to be sent to an OTLP endpoint and were dropped.",
+			ConstLabels: constLabels,
+		}),
+		retriedPoints: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "agent_metrics_otlp_retried_points_total",
+			Help:        "Total number of data points which failed to be sent to an OTLP endpoint and were retried.",
+			ConstLabels: constLabels,
+		}),
+		pending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "agent_metrics_otlp_pending_points",
+			Help:        "Number of data points waiting to be sent to an OTLP endpoint.",
+			ConstLabels: constLabels,
+		}),
+		highestSent: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "agent_metrics_otlp_highest_sent_timestamp_seconds",
+			Help:        "Timestamp of the newest sample sent to an OTLP endpoint, in seconds since epoch.",
+			ConstLabels: constLabels,
+		}),
+	}
+
+	if reg != nil {
+		for _, c := range m.collectors() {
+			if err := reg.Register(c); err != nil {
+				m.unregister()
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *exporterMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.sentPoints, m.failedPoints, m.retriedPoints, m.pending, m.highestSent}
+}
+
+func (m *exporterMetrics) unregister() {
+	if m.reg == nil {
+		return
+	}
+	for _, c := range m.collectors() {
+		m.reg.Unregister(c)
+	}
+}
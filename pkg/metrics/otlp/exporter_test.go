@@ -0,0 +1,195 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/scrape"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+)
+
+func TestExporter_GRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	recv := &receiver{}
+	srv := grpc.NewServer()
+	pmetricotlp.RegisterServer(srv, recv)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	cfg := newTestConfig(ProtocolGRPC, lis.Addr().String())
+	cfg.Insecure = true
+	testExporter(t, cfg, recv)
+}
+
+func TestExporter_HTTP(t *testing.T) {
+	recv := &receiver{}
+
+	var (
+		mut      sync.Mutex
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/otlp/v1/metrics" || r.Header.Get("X-Scope-OrgID") != "tenant" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		// Fail the first request to make sure it's retried.
+		mut.Lock()
+		requests++
+		first := requests == 1
+		mut.Unlock()
+		if first {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		bb, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := pmetricotlp.NewRequest()
+		require.NoError(t, req.UnmarshalProto(bb))
+		_, _ = recv.Export(r.Context(), req)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(ProtocolHTTP, srv.URL+"/otlp")
+	cfg.Headers = map[string]config_util.Secret{"X-Scope-OrgID": "tenant"}
+	testExporter(t, cfg, recv)
+}
+
+func testExporter(t *testing.T, cfg Config, recv *receiver) {
+	t.Helper()
+
+	storage, err := wal.NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	defer storage.Close()
+
+	reg := prometheus.NewRegistry()
+	md := mapMetadata{
+		"requests": {Metric: "requests", Type: textparse.MetricTypeCounter},
+	}
+	e, err := NewExporter(log.NewNopLogger(), reg, cfg, Options{
+		WALDir:         storage.Directory(),
+		ExternalLabels: labels.FromStrings("cluster", "local"),
+		Metadata:       md,
+		FlushDeadline:  time.Second,
+	})
+	require.NoError(t, err)
+	e.Start()
+	defer e.Stop()
+
+	// The exporter only sends samples newer than when it started.
+	ts := timestamp.FromTime(time.Now().Add(time.Minute))
+
+	app := storage.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "requests_total", "code", "200"), ts, 5)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "drop_me"), ts, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	require.Eventually(t, func() bool {
+		return len(recv.Metrics()) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	metrics := recv.Metrics()
+	require.Len(t, metrics, 1)
+	m := metrics[0]
+	require.Equal(t, "requests_total", m.Name())
+	require.Equal(t, pmetric.MetricDataTypeSum, m.DataType())
+	require.Equal(t, 5.0, m.Sum().DataPoints().At(0).DoubleVal())
+
+	require.Eventually(t, func() bool {
+		return e.HighestSentTimestamp() == ts
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(1), testutil.ToFloat64(e.metrics.sentPoints))
+}
+
+func newTestConfig(protocol Protocol, endpoint string) Config {
+	cfg := DefaultConfig
+	cfg.Name = "test"
+	cfg.Protocol = protocol
+	cfg.Endpoint = endpoint
+	cfg.QueueConfig.BatchSendDeadline = model.Duration(10 * time.Millisecond)
+	cfg.QueueConfig.MinBackoff = model.Duration(time.Millisecond)
+	cfg.QueueConfig.MaxBackoff = model.Duration(10 * time.Millisecond)
+	cfg.WriteRelabelConfigs = []*relabel.Config{{
+		SourceLabels: model.LabelNames{"__name__"},
+		Regex:        relabel.MustNewRegexp("drop_me"),
+		Action:       relabel.Drop,
+	}}
+	return cfg
+}
+
+// receiver is an in-process OTLP receiver which records the metrics it
+// receives and checks their resource attributes.
+type receiver struct {
+	mut     sync.Mutex
+	metrics []pmetric.Metric
+}
+
+func (r *receiver) Export(_ context.Context, req pmetricotlp.Request) (pmetricotlp.Response, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	rms := req.Metrics().ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		if v, ok := rm.Resource().Attributes().Get("cluster"); !ok || v.StringVal() != "local" {
+			continue
+		}
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			ms := sms.At(j).Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				m := pmetric.NewMetric()
+				ms.At(k).CopyTo(m)
+				r.metrics = append(r.metrics, m)
+			}
+		}
+	}
+	return pmetricotlp.NewResponse(), nil
+}
+
+func (r *receiver) Metrics() []pmetric.Metric {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]pmetric.Metric(nil), r.metrics...)
+}
+
+func TestTargetMetadata(t *testing.T) {
+	calls := 0
+	tm := NewTargetMetadata(func() map[string][]*scrape.Target {
+		calls++
+		return nil
+	})
+
+	_, ok := tm.GetMetadata("foo")
+	require.False(t, ok)
+	_, ok = tm.GetMetadata("bar")
+	require.False(t, ok)
+
+	// Targets are only loaded again after the cache expires.
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,52 @@
+package otlp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/scrape"
+)
+
+// metadataRefreshPeriod is how often TargetMetadata rebuilds its cache.
+const metadataRefreshPeriod = time.Minute
+
+// TargetMetadata is a MetadataStore which looks up metadata from active
+// scrape targets. Metadata is cached and refreshed periodically.
+type TargetMetadata struct {
+	targets func() map[string][]*scrape.Target
+
+	mut      sync.Mutex
+	cache    map[string]scrape.MetricMetadata
+	lastLoad time.Time
+}
+
+// NewTargetMetadata creates a new TargetMetadata. targets returns the active
+// scrape targets, like scrape.Manager.TargetsActive.
+func NewTargetMetadata(targets func() map[string][]*scrape.Target) *TargetMetadata {
+	return &TargetMetadata{targets: targets}
+}
+
+// GetMetadata implements MetadataStore.
+func (tm *TargetMetadata) GetMetadata(metric string) (scrape.MetricMetadata, bool) {
+	tm.mut.Lock()
+	defer tm.mut.Unlock()
+
+	if tm.cache == nil || time.Since(tm.lastLoad) > metadataRefreshPeriod {
+		tm.loadLocked()
+	}
+	md, ok := tm.cache[metric]
+	return md, ok
+}
+
+func (tm *TargetMetadata) loadLocked() {
+	tm.cache = make(map[string]scrape.MetricMetadata)
+	tm.lastLoad = time.Now()
+
+	for _, targets := range tm.targets() {
+		for _, t := range targets {
+			for _, md := range t.MetadataList() {
+				tm.cache[md.Metric] = md
+			}
+		}
+	}
+}
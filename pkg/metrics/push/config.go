@@ -0,0 +1,66 @@
+package push
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alecthomas/units"
+	config_util "github.com/prometheus/common/config"
+)
+
+// Config controls which push requests an instance accepts.
+type Config struct {
+	// MaxRequestSize limits the size of request bodies, both as sent and once
+	// decompressed. 0 means unlimited.
+	MaxRequestSize units.Base2Bytes `yaml:"max_request_size,omitempty"`
+
+	// Credentials requests must provide. Only one of BasicAuth and
+	// BearerToken may be set. If neither are set, requests aren't
+	// authenticated.
+	BasicAuth   *BasicAuth         `yaml:"basic_auth,omitempty"`
+	BearerToken config_util.Secret `yaml:"bearer_token,omitempty"`
+}
+
+// BasicAuth holds the credentials for HTTP basic authentication.
+type BasicAuth struct {
+	Username string             `yaml:"username"`
+	Password config_util.Secret `yaml:"password"`
+}
+
+// Validate returns an error if c is invalid.
+func (c *Config) Validate() error {
+	switch {
+	case c.MaxRequestSize < 0:
+		return errors.New("max_request_size must not be negative")
+	case c.BasicAuth != nil && c.BearerToken != "":
+		return errors.New("only one of basic_auth and bearer_token may be set")
+	case c.BasicAuth != nil && c.BasicAuth.Username == "":
+		return errors.New("basic_auth requires a username")
+	}
+	return nil
+}
+
+// authorized returns true if r provides the credentials required by c.
+func (c *Config) authorized(r *http.Request) bool {
+	switch {
+	case c.BasicAuth != nil:
+		username, password, ok := r.BasicAuth()
+		return ok &&
+			secureCompare(username, c.BasicAuth.Username) &&
+			secureCompare(password, string(c.BasicAuth.Password))
+	case c.BearerToken != "":
+		token := r.Header.Get("Authorization")
+		if !strings.HasPrefix(token, "Bearer ") {
+			return false
+		}
+		return secureCompare(strings.TrimPrefix(token, "Bearer "), string(c.BearerToken))
+	default:
+		return true
+	}
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
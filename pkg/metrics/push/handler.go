@@ -0,0 +1,283 @@
+// Package push implements accepting samples pushed to an instance in a
+// number of formats.
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// Format is a format samples can be pushed in.
+type Format string
+
+// Supported formats.
+const (
+	// FormatRemoteWrite is the Prometheus remote_write protocol.
+	FormatRemoteWrite Format = "remote_write"
+
+	// FormatPrometheus is the Prometheus text exposition format, including
+	// OpenMetrics.
+	FormatPrometheus Format = "prometheus"
+
+	// FormatInflux is the InfluxDB line protocol.
+	FormatInflux Format = "influx"
+
+	// FormatOTLP is OTLP over HTTP, encoded as either protobuf or JSON.
+	FormatOTLP Format = "otlp"
+)
+
+// Validate returns an error if f isn't a supported format.
+func (f Format) Validate() error {
+	switch f {
+	case FormatRemoteWrite, FormatPrometheus, FormatInflux, FormatOTLP:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of remote_write, prometheus, influx or otlp", f)
+	}
+}
+
+// DetectFormat determines the format of a push request. The format query
+// parameter takes precedence over the Content-Type header. Requests without
+// a Content-Type are assumed to be remote_write requests.
+func DetectFormat(r *http.Request) (Format, error) {
+	if f := Format(r.URL.Query().Get("format")); f != "" {
+		return f, f.Validate()
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return FormatRemoteWrite, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+	}
+
+	switch mediaType {
+	case "application/x-protobuf":
+		// remote_write and OTLP share a content type, but remote_write
+		// requests are always snappy-compressed.
+		if r.Header.Get("Content-Encoding") == "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "" {
+			return FormatRemoteWrite, nil
+		}
+		return FormatOTLP, nil
+	case "application/json":
+		return FormatOTLP, nil
+	case "text/plain", "application/openmetrics-text", "application/x-www-form-urlencoded":
+		// curl sends application/x-www-form-urlencoded by default, which is
+		// commonly used to push to the Pushgateway.
+		return FormatPrometheus, nil
+	default:
+		return "", fmt.Errorf("unsupported Content-Type %q, use the format parameter to choose a format", contentType)
+	}
+}
+
+// errTooLarge is returned when a request body is larger than the
+// configured limit.
+var errTooLarge = errors.New("request body too large")
+
+// Handler accepts push requests and appends the pushed samples to an
+// appendable.
+type Handler struct {
+	logger     log.Logger
+	appendable storage.Appendable
+	cfg        Config
+	format     Format
+}
+
+// NewHandler creates a Handler which appends samples to appendable. If format
+// is empty, the format of each request is determined with DetectFormat.
+func NewHandler(logger log.Logger, appendable storage.Appendable, cfg Config, format Format) *Handler {
+	return &Handler{
+		logger:     logger,
+		appendable: appendable,
+		cfg:        cfg,
+		format:     format,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.authorized(r) {
+		if h.cfg.BasicAuth != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="grafana-agent"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := h.format
+	if format == "" {
+		var err error
+		format, err = DetectFormat(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	body, err := h.readBody(r, format)
+	if errors.Is(err, errTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == FormatRemoteWrite {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		remote.NewWriteHandler(h.logger, h.appendable).ServeHTTP(w, r)
+		return
+	}
+
+	now := timestamp.FromTime(time.Now())
+
+	var samples []sample
+	switch format {
+	case FormatPrometheus:
+		samples, err = parsePrometheus(body, r.Header.Get("Content-Type"), now)
+	case FormatInflux:
+		samples, err = parseInflux(body, r.URL.Query().Get("precision"), now)
+	case FormatOTLP:
+		samples, err = parseOTLP(h.logger, body, isJSON(r))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.append(r, samples); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrOutOfOrderSample),
+			errors.Is(err, storage.ErrOutOfBounds),
+			errors.Is(err, storage.ErrDuplicateSampleForTimestamp),
+			errors.Is(err, wal.ErrSeriesLimit):
+			// Bad requests aren't retried by clients.
+			code = http.StatusBadRequest
+		case errors.Is(err, wal.ErrWALFull):
+			code = http.StatusServiceUnavailable
+		default:
+			level.Error(h.logger).Log("msg", "error appending pushed samples", "format", format, "err", err)
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if format == FormatOTLP {
+		writeOTLPResponse(w, isJSON(r))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readBody reads the request body, enforcing the configured size limit. Gzip
+// bodies are decompressed; remote_write bodies are left snappy-compressed for
+// the remote_write handler to decode.
+func (h *Handler) readBody(r *http.Request, format Format) ([]byte, error) {
+	limit := int64(h.cfg.MaxRequestSize)
+	if limit <= 0 {
+		limit = math.MaxInt64 - 1
+	}
+
+	body, err := readLimited(r.Body, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatRemoteWrite {
+		if n, err := snappy.DecodedLen(body); err == nil && int64(n) > limit {
+			return nil, errTooLarge
+		}
+		return body, nil
+	}
+
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gr.Close()
+		return readLimited(gr, limit)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(body)) > limit {
+		return nil, errTooLarge
+	}
+	return body, nil
+}
+
+func (h *Handler) append(r *http.Request, samples []sample) error {
+	app := h.appendable.Appender(r.Context())
+	for _, s := range samples {
+		if _, err := app.Append(0, s.lset, s.t, s.v); err != nil {
+			_ = app.Rollback()
+			return err
+		}
+	}
+	return app.Commit()
+}
+
+// sample is a decoded sample ready to be appended.
+type sample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// sanitizeName replaces characters which aren't allowed in metric names (or
+// label names if metric is false) with underscores.
+func sanitizeName(name string, metric bool) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		case r == ':' && metric:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,346 @@
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tt := []struct {
+		name        string
+		query       string
+		headers     map[string]string
+		expect      Format
+		expectError bool
+	}{
+		{name: "no content type", expect: FormatRemoteWrite},
+		{
+			name:    "remote_write",
+			headers: map[string]string{"Content-Type": "application/x-protobuf", "Content-Encoding": "snappy"},
+			expect:  FormatRemoteWrite,
+		},
+		{
+			name:    "remote_write version header",
+			headers: map[string]string{"Content-Type": "application/x-protobuf", "X-Prometheus-Remote-Write-Version": "0.1.0"},
+			expect:  FormatRemoteWrite,
+		},
+		{
+			name:    "otlp protobuf",
+			headers: map[string]string{"Content-Type": "application/x-protobuf"},
+			expect:  FormatOTLP,
+		},
+		{
+			name:    "otlp json",
+			headers: map[string]string{"Content-Type": "application/json"},
+			expect:  FormatOTLP,
+		},
+		{
+			name:    "prometheus text",
+			headers: map[string]string{"Content-Type": "text/plain; version=0.0.4"},
+			expect:  FormatPrometheus,
+		},
+		{
+			name:    "openmetrics",
+			headers: map[string]string{"Content-Type": "application/openmetrics-text; version=1.0.0"},
+			expect:  FormatPrometheus,
+		},
+		{
+			name:    "format parameter",
+			query:   "?format=influx",
+			headers: map[string]string{"Content-Type": "text/plain"},
+			expect:  FormatInflux,
+		},
+		{name: "invalid format parameter", query: "?format=graphite", expectError: true},
+		{
+			name:        "unsupported content type",
+			headers:     map[string]string{"Content-Type": "application/xml"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/write"+tc.query, nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			f, err := DetectFormat(r)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, f)
+		})
+	}
+}
+
+func TestHandler_Prometheus(t *testing.T) {
+	app := &collectingAppendable{}
+	h := NewHandler(log.NewNopLogger(), app, Config{}, "")
+
+	body := strings.Join([]string{
+		`# TYPE jobs_processed_total counter`,
+		`jobs_processed_total{queue="default"} 15 1000`,
+		`jobs_processed_total{queue="urgent"} 3`,
+		``,
+	}, "\n")
+
+	rr := serve(h, "text/plain", "", strings.NewReader(body))
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+	samples := app.Samples()
+	require.Len(t, samples, 2)
+	require.Equal(t, sample{
+		lset: labels.FromStrings("__name__", "jobs_processed_total", "queue", "default"),
+		t:    1000,
+		v:    15,
+	}, samples[0])
+	require.Equal(t, labels.FromStrings("__name__", "jobs_processed_total", "queue", "urgent"), samples[1].lset)
+	require.NotZero(t, samples[1].t, "samples without a timestamp should be given the current time")
+}
+
+func TestHandler_Influx(t *testing.T) {
+	app := &collectingAppendable{}
+	h := NewHandler(log.NewNopLogger(), app, Config{}, FormatInflux)
+
+	body := strings.Join([]string{
+		`cpu,host=server-01,region=us-west usage_idle=98.5,usage_user=1i 1600000000`,
+		`temperature,sensor.id=a1 value=21.5,ok=true,comment="fine" 1600000001`,
+	}, "\n")
+
+	r := httptest.NewRequest(http.MethodPost, "/write?precision=s", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+	require.Equal(t, []sample{
+		{labels.FromStrings("__name__", "cpu_usage_idle", "host", "server-01", "region", "us-west"), 1600000000000, 98.5},
+		{labels.FromStrings("__name__", "cpu_usage_user", "host", "server-01", "region", "us-west"), 1600000000000, 1},
+		{labels.FromStrings("__name__", "temperature", "sensor_id", "a1"), 1600000001000, 21.5},
+		{labels.FromStrings("__name__", "temperature_ok", "sensor_id", "a1"), 1600000001000, 1},
+	}, app.Samples())
+
+	t.Run("invalid precision", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/write?precision=d", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("cpu,host="))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestHandler_RemoteWrite(t *testing.T) {
+	app := &collectingAppendable{}
+	h := NewHandler(log.NewNopLogger(), app, Config{}, "")
+
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "test"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		}},
+	}
+	buf, err := req.Marshal()
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(snappy.Encode(nil, buf)))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set("Content-Encoding", "snappy")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+
+	require.Equal(t, []sample{
+		{labels.FromStrings("__name__", "up", "job", "test"), 1000, 1},
+	}, app.Samples())
+}
+
+func TestHandler_Auth(t *testing.T) {
+	body := "up 1 1000\n"
+
+	t.Run("basic auth", func(t *testing.T) {
+		h := NewHandler(log.NewNopLogger(), &collectingAppendable{}, Config{
+			BasicAuth: &BasicAuth{Username: "user", Password: "secret"},
+		}, FormatPrometheus)
+
+		r := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+
+		r = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		r.SetBasicAuth("user", "wrong")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		r = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		r.SetBasicAuth("user", "secret")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		h := NewHandler(log.NewNopLogger(), &collectingAppendable{}, Config{
+			BearerToken: "token",
+		}, FormatPrometheus)
+
+		r := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer wrong")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		r = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer token")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	})
+}
+
+func TestHandler_MaxRequestSize(t *testing.T) {
+	app := &collectingAppendable{}
+	h := NewHandler(log.NewNopLogger(), app, Config{MaxRequestSize: 64}, FormatPrometheus)
+
+	small := "up 1 1000\n"
+	large := strings.Repeat("# padding\n", 10) + small
+
+	rr := serve(h, "", "", strings.NewReader(large))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	// The limit also applies once the body is decompressed.
+	rr = serve(h, "", "gzip", bytes.NewReader(gzipBytes(t, large)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	rr = serve(h, "", "gzip", bytes.NewReader(gzipBytes(t, small)))
+	require.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	require.Len(t, app.Samples(), 1)
+}
+
+func TestHandler_AppendErrors(t *testing.T) {
+	tt := []struct {
+		name       string
+		err        error
+		expectCode int
+	}{
+		{"out of order", storage.ErrOutOfOrderSample, http.StatusBadRequest},
+		{"series limit", wal.ErrSeriesLimit, http.StatusBadRequest},
+		{"wal full", wal.ErrWALFull, http.StatusServiceUnavailable},
+		{"other", context.Canceled, http.StatusInternalServerError},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app := &collectingAppendable{err: tc.err}
+			h := NewHandler(log.NewNopLogger(), app, Config{}, FormatPrometheus)
+
+			rr := serve(h, "", "", strings.NewReader("up 1 1000\n"))
+			require.Equal(t, tc.expectCode, rr.Code)
+			require.Empty(t, app.Samples())
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	require.Equal(t, "http_server_duration", sanitizeName("http.server.duration", true))
+	require.Equal(t, "namespace:rate5m", sanitizeName("namespace:rate5m", true))
+	require.Equal(t, "namespace_rate5m", sanitizeName("namespace:rate5m", false))
+	require.Equal(t, "_5xx_total", sanitizeName("5xx_total", true))
+}
+
+func serve(h http.Handler, contentType, encoding string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/write", body)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+// collectingAppendable collects committed samples. If err is set, every
+// append fails with it.
+type collectingAppendable struct {
+	mut     sync.Mutex
+	samples []sample
+	err     error
+}
+
+func (c *collectingAppendable) Appender(_ context.Context) storage.Appender {
+	return &collectingAppender{c: c}
+}
+
+func (c *collectingAppendable) Samples() []sample {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]sample(nil), c.samples...)
+}
+
+type collectingAppender struct {
+	c       *collectingAppendable
+	pending []sample
+}
+
+func (a *collectingAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	if a.c.err != nil {
+		return 0, a.c.err
+	}
+	a.pending = append(a.pending, sample{l, t, v})
+	return 0, nil
+}
+
+func (a *collectingAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+func (a *collectingAppender) Commit() error {
+	a.c.mut.Lock()
+	defer a.c.mut.Unlock()
+	a.c.samples = append(a.c.samples, a.pending...)
+	return nil
+}
+
+func (a *collectingAppender) Rollback() error {
+	a.pending = nil
+	return nil
+}
@@ -0,0 +1,87 @@
+package push
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+)
+
+// parseInflux parses samples in the InfluxDB line protocol. Each numeric or
+// boolean field becomes a series named <measurement>_<field>, or just
+// <measurement> for fields named value. Tags become labels. String fields
+// are ignored.
+//
+// precision is the unit of timestamps in the body, using the values of the
+// InfluxDB v1 and v2 APIs. Points without a timestamp are given now.
+func parseInflux(body []byte, precision string, now int64) ([]sample, error) {
+	unit, err := influxPrecision(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := influx.NewMetricHandler()
+	handler.SetTimePrecision(unit)
+	handler.SetTimeFunc(func() time.Time { return timestamp.Time(now) })
+
+	metrics, err := influx.NewParser(handler).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []sample
+	for _, m := range metrics {
+		lb := labels.NewBuilder(nil)
+		for _, tag := range m.TagList() {
+			lb.Set(sanitizeName(tag.Key, false), tag.Value)
+		}
+		t := timestamp.FromTime(m.Time())
+
+		for _, field := range m.FieldList() {
+			var v float64
+			switch fv := field.Value.(type) {
+			case float64:
+				v = fv
+			case int64:
+				v = float64(fv)
+			case uint64:
+				v = float64(fv)
+			case bool:
+				if fv {
+					v = 1
+				}
+			default:
+				continue
+			}
+
+			name := m.Name()
+			if field.Key != "value" {
+				name += "_" + field.Key
+			}
+			lb.Set(labels.MetricName, sanitizeName(name, true))
+			samples = append(samples, sample{lset: lb.Labels(), t: t, v: v})
+		}
+	}
+	return samples, nil
+}
+
+func influxPrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unsupported precision %q", precision)
+	}
+}
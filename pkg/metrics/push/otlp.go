@@ -0,0 +1,239 @@
+package push
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+// parseOTLP parses samples from an OTLP export request.
+//
+// Gauges and cumulative sums become a series with the name of the metric.
+// Cumulative histograms and summaries become the _bucket, _sum and _count
+// series used by Prometheus. Data points with delta temporality and
+// exponential histograms can't be represented and are dropped.
+//
+// Data point attributes become labels. The job and instance labels are set
+// from the service.name, service.namespace and service.instance.id resource
+// attributes; other resource attributes are ignored.
+func parseOTLP(logger log.Logger, body []byte, json bool) ([]sample, error) {
+	req := pmetricotlp.NewRequest()
+	var err error
+	if json {
+		err = req.UnmarshalJSON(body)
+	} else {
+		err = req.UnmarshalProto(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding OTLP request: %w", err)
+	}
+
+	c := otlpConverter{}
+	rms := req.Metrics().ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		resourceLabels := otlpResourceLabels(rm.Resource().Attributes())
+
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			ms := sms.At(j).Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				c.convertMetric(ms.At(k), resourceLabels)
+			}
+		}
+	}
+
+	if c.dropped > 0 {
+		level.Warn(logger).Log("msg", "dropped OTLP data points which can't be converted to Prometheus samples", "count", c.dropped)
+	}
+	return c.samples, nil
+}
+
+// otlpResourceLabels returns the job and instance labels for a resource.
+func otlpResourceLabels(attrs pcommon.Map) labels.Labels {
+	var lset labels.Labels
+
+	if name, ok := attrs.Get("service.name"); ok {
+		job := name.AsString()
+		if ns, ok := attrs.Get("service.namespace"); ok {
+			job = ns.AsString() + "/" + job
+		}
+		lset = append(lset, labels.Label{Name: model.JobLabel, Value: job})
+	}
+	if id, ok := attrs.Get("service.instance.id"); ok {
+		lset = append(lset, labels.Label{Name: model.InstanceLabel, Value: id.AsString()})
+	}
+	return lset
+}
+
+type otlpConverter struct {
+	samples []sample
+	dropped int
+}
+
+func (c *otlpConverter) convertMetric(m pmetric.Metric, resourceLabels labels.Labels) {
+	name := sanitizeName(m.Name(), true)
+
+	switch m.DataType() {
+	case pmetric.MetricDataTypeGauge:
+		c.convertNumbers(name, m.Gauge().DataPoints(), resourceLabels)
+
+	case pmetric.MetricDataTypeSum:
+		sum := m.Sum()
+		if sum.AggregationTemporality() != pmetric.MetricAggregationTemporalityCumulative {
+			c.dropped += sum.DataPoints().Len()
+			return
+		}
+		c.convertNumbers(name, sum.DataPoints(), resourceLabels)
+
+	case pmetric.MetricDataTypeHistogram:
+		hist := m.Histogram()
+		if hist.AggregationTemporality() != pmetric.MetricAggregationTemporalityCumulative {
+			c.dropped += hist.DataPoints().Len()
+			return
+		}
+		dps := hist.DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			c.convertHistogram(name, dps.At(i), resourceLabels)
+		}
+
+	case pmetric.MetricDataTypeSummary:
+		dps := m.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			c.convertSummary(name, dps.At(i), resourceLabels)
+		}
+
+	case pmetric.MetricDataTypeExponentialHistogram:
+		c.dropped += m.ExponentialHistogram().DataPoints().Len()
+	}
+}
+
+func (c *otlpConverter) convertNumbers(name string, dps pmetric.NumberDataPointSlice, resourceLabels labels.Labels) {
+	for i := 0; i < dps.Len(); i++ {
+		dp := dps.At(i)
+
+		// Data points without a recorded value usually don't have a value
+		// set either, so check for them first.
+		var v float64
+		switch {
+		case dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue):
+			v = math.Float64frombits(value.StaleNaN)
+		case dp.ValueType() == pmetric.NumberDataPointValueTypeInt:
+			v = float64(dp.IntVal())
+		case dp.ValueType() == pmetric.NumberDataPointValueTypeDouble:
+			v = dp.DoubleVal()
+		default:
+			c.dropped++
+			continue
+		}
+
+		lb := otlpLabels(dp.Attributes(), resourceLabels)
+		c.add(lb, name, dp.Timestamp(), v)
+	}
+}
+
+func (c *otlpConverter) convertHistogram(name string, dp pmetric.HistogramDataPoint, resourceLabels labels.Labels) {
+	stale := dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue)
+	val := func(v float64) float64 {
+		if stale {
+			return math.Float64frombits(value.StaleNaN)
+		}
+		return v
+	}
+
+	lb := otlpLabels(dp.Attributes(), resourceLabels)
+	if dp.HasSum() {
+		c.add(lb, name+"_sum", dp.Timestamp(), val(dp.Sum()))
+	}
+	c.add(lb, name+"_count", dp.Timestamp(), val(float64(dp.Count())))
+
+	// OTLP bucket counts aren't cumulative, and the +Inf bucket is implied
+	// by the count of the histogram.
+	bounds := dp.ExplicitBounds().AsRaw()
+	counts := dp.BucketCounts().AsRaw()
+	var cumulative uint64
+	for i, bound := range bounds {
+		if i < len(counts) {
+			cumulative += counts[i]
+		}
+		lb.Set(labels.BucketLabel, strconv.FormatFloat(bound, 'f', -1, 64))
+		c.add(lb, name+"_bucket", dp.Timestamp(), val(float64(cumulative)))
+	}
+	lb.Set(labels.BucketLabel, "+Inf")
+	c.add(lb, name+"_bucket", dp.Timestamp(), val(float64(dp.Count())))
+}
+
+func (c *otlpConverter) convertSummary(name string, dp pmetric.SummaryDataPoint, resourceLabels labels.Labels) {
+	stale := dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue)
+	val := func(v float64) float64 {
+		if stale {
+			return math.Float64frombits(value.StaleNaN)
+		}
+		return v
+	}
+
+	lb := otlpLabels(dp.Attributes(), resourceLabels)
+	c.add(lb, name+"_sum", dp.Timestamp(), val(dp.Sum()))
+	c.add(lb, name+"_count", dp.Timestamp(), val(float64(dp.Count())))
+
+	qs := dp.QuantileValues()
+	for i := 0; i < qs.Len(); i++ {
+		q := qs.At(i)
+		lb.Set(model.QuantileLabel, strconv.FormatFloat(q.Quantile(), 'f', -1, 64))
+		c.add(lb, name, dp.Timestamp(), val(q.Value()))
+	}
+}
+
+func (c *otlpConverter) add(lb *labels.Builder, name string, ts pcommon.Timestamp, v float64) {
+	lb.Set(labels.MetricName, name)
+	c.samples = append(c.samples, sample{
+		lset: lb.Labels(),
+		t:    int64(ts) / 1e6,
+		v:    v,
+	})
+}
+
+// otlpLabels returns a builder for labels from data point attributes and
+// resource labels. Attributes take precedence.
+func otlpLabels(attrs pcommon.Map, resourceLabels labels.Labels) *labels.Builder {
+	lb := labels.NewBuilder(resourceLabels)
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		lb.Set(sanitizeName(k, false), v.AsString())
+		return true
+	})
+	return lb
+}
+
+func writeOTLPResponse(w http.ResponseWriter, json bool) {
+	resp := pmetricotlp.NewResponse()
+
+	var (
+		buf         []byte
+		err         error
+		contentType = "application/x-protobuf"
+	)
+	if json {
+		buf, err = resp.MarshalJSON()
+		contentType = "application/json"
+	} else {
+		buf, err = resp.MarshalProto()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf)
+}
@@ -0,0 +1,162 @@
+package push
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+)
+
+func TestHandler_OTLP(t *testing.T) {
+	ts := pcommon.NewTimestampFromTime(time.UnixMilli(1000))
+
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().InsertString("service.name", "checkout")
+	rm.Resource().Attributes().InsertString("service.namespace", "shop")
+	rm.Resource().Attributes().InsertString("service.instance.id", "pod-1")
+	ms := rm.ScopeMetrics().AppendEmpty().Metrics()
+
+	gauge := ms.AppendEmpty()
+	gauge.SetName("queue.length")
+	gauge.SetDataType(pmetric.MetricDataTypeGauge)
+	dp := gauge.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(ts)
+	dp.SetIntVal(5)
+	dp.Attributes().InsertString("queue.name", "orders")
+
+	sum := ms.AppendEmpty()
+	sum.SetName("requests_total")
+	sum.SetDataType(pmetric.MetricDataTypeSum)
+	sum.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+	dp = sum.Sum().DataPoints().AppendEmpty()
+	dp.SetTimestamp(ts)
+	dp.SetDoubleVal(10)
+	dp = sum.Sum().DataPoints().AppendEmpty()
+	dp.SetTimestamp(ts)
+	dp.SetFlags(pmetric.NewMetricDataPointFlags(pmetric.MetricDataPointFlagNoRecordedValue))
+	dp.Attributes().InsertString("job", "override")
+
+	delta := ms.AppendEmpty()
+	delta.SetName("delta_total")
+	delta.SetDataType(pmetric.MetricDataTypeSum)
+	delta.Sum().SetAggregationTemporality(pmetric.MetricAggregationTemporalityDelta)
+	delta.Sum().DataPoints().AppendEmpty().SetIntVal(1)
+
+	hist := ms.AppendEmpty()
+	hist.SetName("latency_seconds")
+	hist.SetDataType(pmetric.MetricDataTypeHistogram)
+	hist.Histogram().SetAggregationTemporality(pmetric.MetricAggregationTemporalityCumulative)
+	hdp := hist.Histogram().DataPoints().AppendEmpty()
+	hdp.SetTimestamp(ts)
+	hdp.SetCount(6)
+	hdp.SetSum(1.5)
+	hdp.SetExplicitBounds(pcommon.NewImmutableFloat64Slice([]float64{0.1, 1}))
+	hdp.SetBucketCounts(pcommon.NewImmutableUInt64Slice([]uint64{2, 3, 1}))
+
+	summary := ms.AppendEmpty()
+	summary.SetName("rpc_seconds")
+	summary.SetDataType(pmetric.MetricDataTypeSummary)
+	sdp := summary.Summary().DataPoints().AppendEmpty()
+	sdp.SetTimestamp(ts)
+	sdp.SetCount(4)
+	sdp.SetSum(2)
+	q := sdp.QuantileValues().AppendEmpty()
+	q.SetQuantile(0.99)
+	q.SetValue(0.75)
+
+	resourceLabels := []string{"instance", "pod-1", "job", "shop/checkout"}
+	lbls := func(name string, extra ...string) labels.Labels {
+		return labels.FromStrings(append(append([]string{"__name__", name}, resourceLabels...), extra...)...)
+	}
+	expect := []sample{
+		{lbls("queue_length", "queue_name", "orders"), 1000, 5},
+		{lbls("requests_total"), 1000, 10},
+		{labels.FromStrings("__name__", "requests_total", "instance", "pod-1", "job", "override"), 1000, math.Float64frombits(value.StaleNaN)},
+		{lbls("latency_seconds_sum"), 1000, 1.5},
+		{lbls("latency_seconds_count"), 1000, 6},
+		{lbls("latency_seconds_bucket", "le", "0.1"), 1000, 2},
+		{lbls("latency_seconds_bucket", "le", "1"), 1000, 5},
+		{lbls("latency_seconds_bucket", "le", "+Inf"), 1000, 6},
+		{lbls("rpc_seconds_sum"), 1000, 2},
+		{lbls("rpc_seconds_count"), 1000, 4},
+		{lbls("rpc_seconds", "quantile", "0.99"), 1000, 0.75},
+	}
+
+	req := pmetricotlp.NewRequestFromMetrics(md)
+
+	t.Run("protobuf", func(t *testing.T) {
+		body, err := req.MarshalProto()
+		require.NoError(t, err)
+
+		app := &collectingAppendable{}
+		rr := serveOTLP(t, app, "application/x-protobuf", body)
+
+		require.Equal(t, "application/x-protobuf", rr.Header().Get("Content-Type"))
+		resp := pmetricotlp.NewResponse()
+		require.NoError(t, resp.UnmarshalProto(rr.Body.Bytes()))
+		requireSamples(t, expect, app.Samples())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		body, err := req.MarshalJSON()
+		require.NoError(t, err)
+
+		app := &collectingAppendable{}
+		rr := serveOTLP(t, app, "application/json", body)
+
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		resp := pmetricotlp.NewResponse()
+		require.NoError(t, resp.UnmarshalJSON(rr.Body.Bytes()))
+		requireSamples(t, expect, app.Samples())
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		h := NewHandler(log.NewNopLogger(), &collectingAppendable{}, Config{}, FormatOTLP)
+
+		r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader([]byte("{")))
+		r.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func serveOTLP(t *testing.T, app *collectingAppendable, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	h := NewHandler(log.NewNopLogger(), app, Config{}, "")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	return rr
+}
+
+// requireSamples compares samples, treating stale markers as equal.
+func requireSamples(t *testing.T, expect, actual []sample) {
+	t.Helper()
+
+	require.Len(t, actual, len(expect))
+	for i := range expect {
+		require.Equal(t, expect[i].lset, actual[i].lset)
+		require.Equal(t, expect[i].t, actual[i].t)
+		if value.IsStaleNaN(expect[i].v) {
+			require.True(t, value.IsStaleNaN(actual[i].v), "expected stale marker for %s", actual[i].lset)
+			continue
+		}
+		require.Equal(t, expect[i].v, actual[i].v)
+	}
+}
@@ -0,0 +1,42 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+// parsePrometheus parses samples in the Prometheus text or OpenMetrics
+// exposition formats. Samples without a timestamp are given now.
+func parsePrometheus(body []byte, contentType string, now int64) ([]sample, error) {
+	// As with scrapes, unknown content types fall back to the Prometheus text
+	// format.
+	p, _ := textparse.New(body, contentType)
+
+	var samples []sample
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error parsing exposition: %w", err)
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+
+		_, ts, v := p.Series()
+		var lset labels.Labels
+		p.Metric(&lset)
+
+		t := now
+		if ts != nil {
+			t = *ts
+		}
+		samples = append(samples, sample{lset: lset, t: t, v: v})
+	}
+	return samples, nil
+}
@@ -0,0 +1,238 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+// Querier implements storage.Queryable. Samples aren't kept in memory, so
+// they're read back from the WAL on disk; only samples which haven't been
+// truncated from the WAL yet can be queried.
+//
+// Every call to Select scans the WAL, which makes queries expensive. The
+// querier is meant for debugging what the agent is collecting rather than
+// serving dashboards.
+func (w *Storage) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &querier{w: w, ctx: ctx, mint: mint, maxt: maxt}, nil
+}
+
+type querier struct {
+	w          *Storage
+	ctx        context.Context
+	mint, maxt int64
+}
+
+var _ storage.Querier = (*querier)(nil)
+
+func (q *querier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		if hints.Start > mint {
+			mint = hints.Start
+		}
+		if hints.End < maxt {
+			maxt = hints.End
+		}
+	}
+
+	res, err := q.w.readSeries(q.ctx, mint, maxt, matchers)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	// Series are always sorted; the WAL doesn't give us any useful order to
+	// return them in otherwise.
+	sort.Slice(res, func(i, j int) bool {
+		return labels.Compare(res[i].Labels(), res[j].Labels()) < 0
+	})
+	return &seriesSet{series: res, idx: -1}
+}
+
+// LabelValues implements storage.LabelQuerier. Only series which are active
+// in memory are considered.
+func (q *querier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	set := make(map[string]struct{})
+	for _, lset := range q.w.activeSeries(matchers) {
+		if v := lset.Get(name); v != "" {
+			set[v] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil, nil
+}
+
+// LabelNames implements storage.LabelQuerier. Only series which are active in
+// memory are considered.
+func (q *querier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	set := make(map[string]struct{})
+	for _, lset := range q.w.activeSeries(matchers) {
+		for _, l := range lset {
+			set[l.Name] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil, nil
+}
+
+func (q *querier) Close() error { return nil }
+
+// activeSeries returns the labels of all in-memory series which match every
+// matcher.
+func (w *Storage) activeSeries(matchers []*labels.Matcher) []labels.Labels {
+	var res []labels.Labels
+	for s := range w.series.iterator().Channel() {
+		if matchesAll(s.lset, matchers) {
+			res = append(res, s.lset)
+		}
+	}
+	return res
+}
+
+// readSeries scans the most recent checkpoint and all WAL segments after it,
+// returning series matching every matcher with their samples in [mint, maxt].
+func (w *Storage) readSeries(ctx context.Context, mint, maxt int64, matchers []*labels.Matcher) ([]storage.Series, error) {
+	sc := seriesCollector{
+		mint:     mint,
+		maxt:     maxt,
+		matchers: matchers,
+		lsets:    make(map[chunks.HeadSeriesRef]labels.Labels),
+		matched:  make(map[chunks.HeadSeriesRef]bool),
+		samples:  make(map[chunks.HeadSeriesRef][]tsdbutil.Sample),
+	}
+
+	err := w.scanWAL(ctx, func(r *wal.Reader) error {
+		return sc.read(ctx, r)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]storage.Series, 0, len(sc.samples))
+	for ref, samples := range sc.samples {
+		lset, ok := sc.lsets[ref]
+		if !ok {
+			continue
+		}
+		res = append(res, storage.NewListSeries(lset, sortSamples(samples)))
+	}
+	return res, nil
+}
+
+// seriesCollector collects samples for matching series from WAL records.
+type seriesCollector struct {
+	mint, maxt int64
+	matchers   []*labels.Matcher
+
+	lsets   map[chunks.HeadSeriesRef]labels.Labels
+	matched map[chunks.HeadSeriesRef]bool
+	samples map[chunks.HeadSeriesRef][]tsdbutil.Sample
+
+	dec        record.Decoder
+	seriesBuf  []record.RefSeries
+	samplesBuf []record.RefSample
+}
+
+func (sc *seriesCollector) read(ctx context.Context, r *wal.Reader) error {
+	for r.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rec := r.Record()
+		switch sc.dec.Type(rec) {
+		case record.Series:
+			series, err := sc.dec.Series(rec, sc.seriesBuf[:0])
+			if err != nil {
+				return fmt.Errorf("decode series: %w", err)
+			}
+			for _, s := range series {
+				if _, seen := sc.matched[s.Ref]; seen {
+					continue
+				}
+				matched := matchesAll(s.Labels, sc.matchers)
+				sc.matched[s.Ref] = matched
+				if matched {
+					sc.lsets[s.Ref] = s.Labels
+				}
+			}
+			sc.seriesBuf = series
+
+		case record.Samples:
+			samples, err := sc.dec.Samples(rec, sc.samplesBuf[:0])
+			if err != nil {
+				return fmt.Errorf("decode samples: %w", err)
+			}
+			for _, s := range samples {
+				if s.T < sc.mint || s.T > sc.maxt || !sc.matched[s.Ref] {
+					continue
+				}
+				sc.samples[s.Ref] = append(sc.samples[s.Ref], querySample{t: s.T, v: s.V})
+			}
+			sc.samplesBuf = samples
+		}
+	}
+	return r.Err()
+}
+
+// sortSamples sorts samples by timestamp. When there are several samples for
+// the same timestamp, the one which was written last is kept.
+func sortSamples(samples []tsdbutil.Sample) []tsdbutil.Sample {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].T() < samples[j].T() })
+
+	res := samples[:0]
+	for _, s := range samples {
+		if n := len(res); n > 0 && res[n-1].T() == s.T() {
+			res[n-1] = s
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func matchesAll(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	res := make([]string, 0, len(set))
+	for k := range set {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type querySample struct {
+	t int64
+	v float64
+}
+
+func (s querySample) T() int64   { return s.t }
+func (s querySample) V() float64 { return s.v }
+
+// seriesSet implements storage.SeriesSet over a slice of series.
+type seriesSet struct {
+	series []storage.Series
+	idx    int
+}
+
+func (ss *seriesSet) Next() bool {
+	ss.idx++
+	return ss.idx < len(ss.series)
+}
+
+func (ss *seriesSet) At() storage.Series         { return ss.series[ss.idx] }
+func (ss *seriesSet) Err() error                 { return nil }
+func (ss *seriesSet) Warnings() storage.Warnings { return nil }
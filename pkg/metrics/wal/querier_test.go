@@ -0,0 +1,125 @@
+package wal
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Querier(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	app := s.Appender(context.Background())
+	payload := buildSeries([]string{"foo", "bar", "baz"})
+	for _, metric := range payload {
+		metric.Write(t, app)
+	}
+	require.NoError(t, app.Commit())
+
+	t.Run("all samples", func(t *testing.T) {
+		actual := querySeries(t, s, math.MinInt64, math.MaxInt64, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+"))
+
+		expect := map[string][]sample{}
+		for _, series := range payload {
+			expect[labels.FromStrings("__name__", series.name).String()] = series.samples
+		}
+		require.Equal(t, expect, actual)
+	})
+
+	t.Run("matchers", func(t *testing.T) {
+		actual := querySeries(t, s, math.MinInt64, math.MaxInt64, labels.MustNewMatcher(labels.MatchEqual, "__name__", "bar"))
+		require.Equal(t, map[string][]sample{
+			`{__name__="bar"}`: payload[1].samples,
+		}, actual)
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		// Only the second sample of each series is in range.
+		mint := payload[len(payload)-1].samples[0].ts + 1
+
+		actual := querySeries(t, s, mint, math.MaxInt64, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+"))
+		require.Len(t, actual, len(payload))
+		for _, series := range payload {
+			require.Equal(t, series.samples[1:], actual[labels.FromStrings("__name__", series.name).String()])
+		}
+	})
+
+	t.Run("after truncation", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, s.wal.NextSegment())
+		}
+
+		keepTs := payload[len(payload)-1].samples[0].ts + 1
+		require.NoError(t, s.Truncate(keepTs))
+
+		// Samples before keepTs are gone from the WAL. Series are still known
+		// from the checkpoint.
+		actual := querySeries(t, s, math.MinInt64, math.MaxInt64, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+"))
+		require.Len(t, actual, len(payload))
+		for _, series := range payload {
+			require.Equal(t, series.samples[1:], actual[labels.FromStrings("__name__", series.name).String()])
+		}
+	})
+
+	t.Run("label names and values", func(t *testing.T) {
+		q, err := s.Querier(context.Background(), math.MinInt64, math.MaxInt64)
+		require.NoError(t, err)
+		defer q.Close()
+
+		names, _, err := q.LabelNames()
+		require.NoError(t, err)
+		require.Equal(t, []string{"__name__"}, names)
+
+		values, _, err := q.LabelValues("__name__", labels.MustNewMatcher(labels.MatchNotEqual, "__name__", "foo"))
+		require.NoError(t, err)
+		require.Equal(t, []string{"bar", "baz"}, values)
+	})
+}
+
+func TestStorage_Querier_Closed(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	q, err := s.Querier(context.Background(), math.MinInt64, math.MaxInt64)
+	require.NoError(t, err)
+
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "foo"))
+	require.False(t, ss.Next())
+	require.ErrorIs(t, ss.Err(), ErrWALClosed)
+}
+
+// querySeries selects series from s, returning the samples of each series
+// keyed by its labels.
+func querySeries(t *testing.T, s storage.Queryable, mint, maxt int64, matchers ...*labels.Matcher) map[string][]sample {
+	t.Helper()
+
+	q, err := s.Querier(context.Background(), mint, maxt)
+	require.NoError(t, err)
+	defer q.Close()
+
+	res := make(map[string][]sample)
+
+	ss := q.Select(true, nil, matchers...)
+	for ss.Next() {
+		var samples []sample
+		it := ss.At().Iterator()
+		for it.Next() {
+			ts, val := it.At()
+			samples = append(samples, sample{ts: ts, val: val})
+		}
+		require.NoError(t, it.Err())
+		res[ss.At().Labels().String()] = samples
+	}
+	require.NoError(t, ss.Err())
+	return res
+}
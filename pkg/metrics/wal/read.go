@@ -0,0 +1,204 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+// Sample is a sample read back from the WAL.
+type Sample struct {
+	Labels labels.Labels
+	T      int64
+	V      float64
+}
+
+// ReadSamples reads samples with timestamps in (mint, maxt] back from the WAL
+// in the order they were written. fn is called with the samples from each
+// WAL record. Reading stops at the first error returned by fn.
+//
+// Each segment is decoded into memory while the WAL is locked, and fn is
+// only called after the lock is released, so fn may block for a long time
+// without preventing the WAL from being truncated or closed.
+//
+// Only samples which haven't been truncated from the WAL yet can be read.
+// Segments created after ReadSamples is called are not read.
+func (w *Storage) ReadSamples(ctx context.Context, mint, maxt int64, fn func([]Sample) error) error {
+	var (
+		dec        record.Decoder
+		lsets      = make(map[chunks.HeadSeriesRef]labels.Labels)
+		seriesBuf  []record.RefSeries
+		samplesBuf []record.RefSample
+
+		// Batches of samples read from the current segment which haven't been
+		// passed to fn yet.
+		pending [][]Sample
+	)
+
+	read := func(r *wal.Reader) error {
+		for r.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rec := r.Record()
+			switch dec.Type(rec) {
+			case record.Series:
+				series, err := dec.Series(rec, seriesBuf[:0])
+				if err != nil {
+					return fmt.Errorf("decode series: %w", err)
+				}
+				for _, s := range series {
+					lsets[s.Ref] = s.Labels
+				}
+				seriesBuf = series
+
+			case record.Samples:
+				samples, err := dec.Samples(rec, samplesBuf[:0])
+				if err != nil {
+					return fmt.Errorf("decode samples: %w", err)
+				}
+				samplesBuf = samples
+
+				var batch []Sample
+				for _, s := range samples {
+					lset, ok := lsets[chunks.HeadSeriesRef(s.Ref)]
+					if !ok || s.T <= mint || s.T > maxt {
+						continue
+					}
+					batch = append(batch, Sample{Labels: lset, T: s.T, V: s.V})
+				}
+				if len(batch) > 0 {
+					pending = append(pending, batch)
+				}
+			}
+		}
+		return r.Err()
+	}
+
+	flush := func() error {
+		for _, batch := range pending {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	return w.scanWAL(ctx, read, flush)
+}
+
+// scanWAL calls read for the most recent checkpoint and every WAL segment
+// after it, in order. The WAL is only locked while a segment is being read, so
+// long scans don't prevent the storage from being closed. Segments removed by
+// a truncation running concurrently with the scan are skipped.
+//
+// If flush is non-nil, it is called after the checkpoint and each segment
+// have been read, once the WAL is unlocked again.
+func (w *Storage) scanWAL(ctx context.Context, read func(r *wal.Reader) error, flush func() error) error {
+	if flush == nil {
+		flush = func() error { return nil }
+	}
+
+	first, last, err := w.scanCheckpoint(read)
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	for i := first; i <= last; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.scanSegment(ctx, i, i == last, read); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanCheckpoint reads the most recent checkpoint, if any, and returns the
+// range of segments to read after it.
+func (w *Storage) scanCheckpoint(read func(r *wal.Reader) error) (first, last int, err error) {
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		return 0, 0, ErrWALClosed
+	}
+
+	first, last, err = wal.Segments(w.wal.Dir())
+	if err != nil {
+		return 0, 0, fmt.Errorf("finding WAL segments: %w", err)
+	}
+
+	dir, idx, err := wal.LastCheckpoint(w.wal.Dir())
+	if errors.Is(err, record.ErrNotFound) {
+		return first, last, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("find last checkpoint: %w", err)
+	}
+
+	sr, err := wal.NewSegmentsReader(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open checkpoint: %w", err)
+	}
+	err = read(wal.NewReader(sr))
+	if err := sr.Close(); err != nil {
+		level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("read checkpoint: %w", err)
+	}
+	return idx + 1, last, nil
+}
+
+// scanSegment reads the WAL segment with index i. active must be true if the
+// segment may still be written to.
+func (w *Storage) scanSegment(ctx context.Context, i int, active bool, read func(r *wal.Reader) error) error {
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		return ErrWALClosed
+	}
+
+	s, err := wal.OpenReadSegment(wal.SegmentName(w.wal.Dir(), i))
+	if errors.Is(err, os.ErrNotExist) {
+		// The segment was removed by a concurrent truncation. Its samples are
+		// gone, but newer segments are still readable.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open WAL segment %d: %w", i, err)
+	}
+
+	sr := wal.NewSegmentBufReader(s)
+	err = read(wal.NewReader(sr))
+	if err := sr.Close(); err != nil {
+		level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case active && ctx.Err() == nil:
+		// The active segment may end in a partially written record. Keep what
+		// could be read so far.
+		level.Debug(w.logger).Log("msg", "stopped reading active WAL segment early", "segment", i, "err", err)
+		return nil
+	default:
+		return fmt.Errorf("read WAL segment %d: %w", i, err)
+	}
+}
@@ -0,0 +1,109 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_ReadSamples(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	// Commit each series separately, moving to a new segment in between so
+	// samples are read across segments and a checkpoint.
+	payload := buildSeries([]string{"foo", "bar", "baz"})
+	for _, metric := range payload {
+		app := s.Appender(context.Background())
+		metric.Write(t, app)
+		require.NoError(t, app.Commit())
+		require.NoError(t, s.wal.NextSegment())
+	}
+	require.NoError(t, s.Truncate(0))
+
+	readAll := func(mint, maxt int64) []Sample {
+		var res []Sample
+		err := s.ReadSamples(context.Background(), mint, maxt, func(samples []Sample) error {
+			res = append(res, samples...)
+			return nil
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("all samples", func(t *testing.T) {
+		var expect []Sample
+		for _, series := range payload {
+			for _, sample := range series.samples {
+				expect = append(expect, Sample{
+					Labels: labels.FromStrings("__name__", series.name),
+					T:      sample.ts,
+					V:      sample.val,
+				})
+			}
+		}
+		require.Equal(t, expect, readAll(math.MinInt64, math.MaxInt64))
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		// mint is exclusive and maxt is inclusive.
+		require.Equal(t, []Sample{
+			{Labels: labels.FromStrings("__name__", "foo"), T: 10, V: 100},
+			{Labels: labels.FromStrings("__name__", "bar"), T: 2, V: 20},
+			{Labels: labels.FromStrings("__name__", "bar"), T: 20, V: 200},
+			{Labels: labels.FromStrings("__name__", "baz"), T: 3, V: 30},
+		}, readAll(1, 20))
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		var (
+			calls int
+			stop  = errors.New("stop")
+		)
+		err := s.ReadSamples(context.Background(), math.MinInt64, math.MaxInt64, func(samples []Sample) error {
+			calls++
+			return stop
+		})
+		require.ErrorIs(t, err, stop)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("unlocked callback", func(t *testing.T) {
+		// fn must not be called while the WAL is locked, since callers may
+		// block in it for a long time.
+		err := s.ReadSamples(context.Background(), math.MinInt64, math.MaxInt64, func(samples []Sample) error {
+			locked := make(chan struct{})
+			go func() {
+				s.walMtx.Lock()
+				defer s.walMtx.Unlock()
+				close(locked)
+			}()
+
+			select {
+			case <-locked:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("WAL is locked while calling fn")
+			}
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestStorage_ReadSamples_Closed(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	err = s.ReadSamples(context.Background(), math.MinInt64, math.MaxInt64, func([]Sample) error { return nil })
+	require.ErrorIs(t, err, ErrWALClosed)
+}
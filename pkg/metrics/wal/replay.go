@@ -0,0 +1,386 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"go.uber.org/atomic"
+)
+
+// errReplayStopped is returned when the sample replay is interrupted by
+// closing the storage.
+var errReplayStopped = errors.New("WAL replay stopped")
+
+// walRange is the set of WAL data to replay: the most recent checkpoint, if
+// any, and the segments after it.
+type walRange struct {
+	checkpoint  string // Empty if there is no checkpoint.
+	first, last int
+}
+
+// segments returns the number of segments in r, counting the checkpoint as a
+// segment.
+func (r walRange) segments() int {
+	n := r.last - r.first + 1
+	if r.checkpoint != "" {
+		n++
+	}
+	return n
+}
+
+// replayWAL restores in-memory state from the WAL. Series records are loaded
+// before replayWAL returns so the storage can accept appends straight away.
+// Samples, which are only used to restore the last timestamp of each series,
+// are replayed in the background; replayDone is closed once they're loaded.
+func (w *Storage) replayWAL() error {
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		close(w.replayDone)
+		return ErrWALClosed
+	}
+
+	level.Info(w.logger).Log("msg", "replaying WAL, this may take a while", "dir", w.wal.Dir())
+	start := time.Now()
+
+	rng, err := w.replayRange()
+	if err != nil {
+		close(w.replayDone)
+		return err
+	}
+
+	if err := w.readWAL(rng, w.loadSeries, nil); err != nil {
+		close(w.replayDone)
+		return err
+	}
+	level.Info(w.logger).Log("msg", "WAL series loaded, storage is ready", "duration", time.Since(start))
+
+	if rng.segments() == 0 {
+		w.metrics.replayProgress.Set(1)
+		close(w.replayDone)
+		return nil
+	}
+	go w.replaySamples(rng)
+	return nil
+}
+
+// replayRange returns the range of the WAL to replay.
+func (w *Storage) replayRange() (walRange, error) {
+	var rng walRange
+
+	dir, startFrom, err := wal.LastCheckpoint(w.wal.Dir())
+	if err != nil && err != record.ErrNotFound {
+		return rng, fmt.Errorf("find last checkpoint: %w", err)
+	} else if err == nil {
+		rng.checkpoint = dir
+		startFrom++
+	}
+
+	_, last, err := wal.Segments(w.wal.Dir())
+	if err != nil {
+		return rng, fmt.Errorf("finding WAL segments: %w", err)
+	}
+
+	// The last segment is created empty when the WAL is opened, so it only
+	// holds data appended since. It doesn't need to be replayed, and reading
+	// it in the background would race with appends.
+	rng.first, rng.last = startFrom, last-1
+	return rng, nil
+}
+
+// readWAL calls load for the checkpoint and every segment in rng, in order.
+// done, if non-nil, is called after each is loaded.
+func (w *Storage) readWAL(rng walRange, load func(r *wal.Reader) error, done func(segment int)) error {
+	if rng.checkpoint != "" {
+		sr, err := wal.NewSegmentsReader(rng.checkpoint)
+		if err != nil {
+			return fmt.Errorf("open checkpoint: %w", err)
+		}
+
+		// A corrupted checkpoint is a hard error for now and requires user
+		// intervention. There's likely little data that can be recovered anyway.
+		err = load(wal.NewReader(sr))
+		if err := sr.Close(); err != nil {
+			level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
+		}
+		if err != nil {
+			return fmt.Errorf("backfill checkpoint: %w", err)
+		}
+		if done != nil {
+			done(rng.first - 1)
+		}
+	}
+
+	for i := rng.first; i <= rng.last; i++ {
+		s, err := wal.OpenReadSegment(wal.SegmentName(w.wal.Dir(), i))
+		if err != nil {
+			return fmt.Errorf("open WAL segment %d: %w", i, err)
+		}
+
+		sr := wal.NewSegmentBufReader(s)
+		err = load(wal.NewReader(sr))
+		if err := sr.Close(); err != nil {
+			level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
+		}
+		if err != nil {
+			return err
+		}
+		if done != nil {
+			done(i)
+		}
+	}
+
+	return nil
+}
+
+// loadSeries creates in-memory series for every series record read from r.
+// Other records are skipped.
+func (w *Storage) loadSeries(r *wal.Reader) error {
+	var (
+		dec        record.Decoder
+		series     []record.RefSeries
+		biggestRef = w.ref.Load()
+	)
+
+	for r.Next() {
+		rec := r.Record()
+		switch dec.Type(rec) {
+		case record.Series:
+			var err error
+			series, err = dec.Series(rec, series[:0])
+			if err != nil {
+				return &wal.CorruptionErr{
+					Err:     fmt.Errorf("decode series: %w", err),
+					Segment: r.Segment(),
+					Offset:  r.Offset(),
+				}
+			}
+
+			for _, s := range series {
+				// If this is a new series, create it in memory without a timestamp.
+				// The timestamp of its latest sample is restored once samples are
+				// replayed. Otherwise, the series is stale and will be deleted once
+				// the truncation is performed.
+				if w.series.getByID(s.Ref) == nil {
+					series := &memSeries{ref: s.Ref, lset: s.Labels, lastTs: 0}
+					w.series.set(s.Labels.Hash(), series)
+					w.seriesLimiter.add(s.Labels)
+
+					w.metrics.numActiveSeries.Inc()
+					w.metrics.totalCreatedSeries.Inc()
+
+					if biggestRef <= uint64(s.Ref) {
+						biggestRef = uint64(s.Ref)
+					}
+				}
+			}
+		case record.Samples, record.Tombstones, record.Exemplars:
+			// Samples are loaded by replaySamples. We don't care about tombstones
+			// or exemplars.
+			// TODO: If decide to decode exemplars, we should make sure to prepopulate
+			// stripeSeries.exemplars in the next block by using setLatestExemplar.
+			continue
+		default:
+			return &wal.CorruptionErr{
+				Err:     fmt.Errorf("invalid record type %v", dec.Type(rec)),
+				Segment: r.Segment(),
+				Offset:  r.Offset(),
+			}
+		}
+	}
+
+	w.ref.Store(biggestRef)
+
+	if r.Err() != nil {
+		return fmt.Errorf("read records: %w", r.Err())
+	}
+	return nil
+}
+
+// replaySamples replays sample records in rng, restoring the last timestamp
+// of each series. Samples are spread across shards by series ref so they can
+// be applied in parallel.
+func (w *Storage) replaySamples(rng walRange) {
+	defer close(w.replayDone)
+
+	var (
+		start   = time.Now()
+		total   = rng.segments()
+		shards  = newReplayShards(w, runtime.GOMAXPROCS(0))
+		decoded int
+	)
+
+	err := w.readWAL(rng, func(r *wal.Reader) error {
+		return w.loadSamples(r, shards)
+	}, func(segment int) {
+		decoded++
+		w.metrics.replayProgress.Set(float64(decoded) / float64(total))
+		level.Info(w.logger).Log("msg", "WAL segment samples loaded", "segment", segment, "maxSegment", rng.last, "progress", fmt.Sprintf("%d/%d", decoded, total))
+	})
+	shards.stop()
+
+	if unknown := shards.unknownRefs.Load(); unknown > 0 {
+		level.Warn(w.logger).Log("msg", "found samples referencing non-existing series, skipped them", "samples", unknown)
+	}
+
+	switch {
+	case errors.Is(err, errReplayStopped):
+		level.Info(w.logger).Log("msg", "WAL sample replay stopped before completion", "duration", time.Since(start))
+	case err != nil:
+		// Series are already loaded, so the storage keeps working. Series whose
+		// last timestamp couldn't be restored will be garbage collected at the
+		// next truncation unless they receive new samples.
+		level.Error(w.logger).Log("msg", "failed to replay WAL samples", "err", err, "duration", time.Since(start))
+	default:
+		w.metrics.replayProgress.Set(1)
+		level.Info(w.logger).Log("msg", "WAL replay complete", "duration", time.Since(start))
+	}
+}
+
+// loadSamples decodes sample records read from r and hands them to shards.
+func (w *Storage) loadSamples(r *wal.Reader, shards *replayShards) error {
+	var dec record.Decoder
+
+	for r.Next() {
+		select {
+		case <-w.replayStop:
+			return errReplayStopped
+		default:
+		}
+
+		rec := r.Record()
+		if dec.Type(rec) != record.Samples {
+			continue
+		}
+
+		samples, err := dec.Samples(rec, shards.getBuffer())
+		if err != nil {
+			return &wal.CorruptionErr{
+				Err:     fmt.Errorf("decode samples: %w", err),
+				Segment: r.Segment(),
+				Offset:  r.Offset(),
+			}
+		}
+		shards.dispatch(samples)
+	}
+
+	if r.Err() != nil {
+		return fmt.Errorf("read records: %w", r.Err())
+	}
+	return nil
+}
+
+// replayShards applies replayed samples to in-memory series. Each series
+// is always handled by the same shard.
+type replayShards struct {
+	w      *Storage
+	inputs []chan []record.RefSample
+	wg     sync.WaitGroup
+	pool   sync.Pool
+
+	unknownRefs atomic.Int64
+}
+
+func newReplayShards(w *Storage, n int) *replayShards {
+	s := &replayShards{
+		w:      w,
+		inputs: make([]chan []record.RefSample, n),
+		pool: sync.Pool{
+			New: func() interface{} {
+				return []record.RefSample{}
+			},
+		},
+	}
+
+	s.wg.Add(n)
+	for i := range s.inputs {
+		s.inputs[i] = make(chan []record.RefSample, 10)
+		go s.run(s.inputs[i])
+	}
+	return s
+}
+
+func (s *replayShards) getBuffer() []record.RefSample {
+	return s.pool.Get().([]record.RefSample)[:0]
+}
+
+func (s *replayShards) putBuffer(buf []record.RefSample) {
+	//nolint:staticcheck
+	s.pool.Put(buf)
+}
+
+// dispatch splits samples across shards. samples must not be used after
+// calling dispatch.
+func (s *replayShards) dispatch(samples []record.RefSample) {
+	if len(s.inputs) == 1 {
+		s.inputs[0] <- samples
+		return
+	}
+
+	bufs := make([][]record.RefSample, len(s.inputs))
+	for _, sample := range samples {
+		shard := uint64(sample.Ref) % uint64(len(s.inputs))
+		if bufs[shard] == nil {
+			bufs[shard] = s.getBuffer()
+		}
+		bufs[shard] = append(bufs[shard], sample)
+	}
+	s.putBuffer(samples)
+
+	for i, buf := range bufs {
+		if buf != nil {
+			s.inputs[i] <- buf
+		}
+	}
+}
+
+func (s *replayShards) run(input <-chan []record.RefSample) {
+	defer s.wg.Done()
+
+	for samples := range input {
+		for _, sample := range samples {
+			series := s.w.series.getByID(sample.Ref)
+			if series == nil {
+				s.unknownRefs.Inc()
+				continue
+			}
+
+			series.Lock()
+			if sample.T > series.lastTs {
+				series.lastTs = sample.T
+			}
+			series.Unlock()
+		}
+		s.putBuffer(samples)
+	}
+}
+
+// stop waits for all dispatched samples to be applied.
+func (s *replayShards) stop() {
+	for _, input := range s.inputs {
+		close(input)
+	}
+	s.wg.Wait()
+}
+
+// waitReplay blocks until samples have been replayed.
+func (w *Storage) waitReplay() {
+	<-w.replayDone
+}
+
+// replayComplete returns true if samples have been replayed.
+func (w *Storage) replayComplete() bool {
+	select {
+	case <-w.replayDone:
+		return true
+	default:
+		return false
+	}
+}
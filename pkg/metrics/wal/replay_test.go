@@ -0,0 +1,122 @@
+package wal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Replay(t *testing.T) {
+	walDir := t.TempDir()
+
+	s, err := NewStorage(log.NewNopLogger(), nil, walDir)
+	require.NoError(t, err)
+
+	// Spread the payload over a few segments and a checkpoint.
+	payload := buildSeries([]string{"foo", "bar", "baz", "blerg"})
+	for _, metric := range payload {
+		app := s.Appender(context.Background())
+		metric.Write(t, app)
+		require.NoError(t, app.Commit())
+		require.NoError(t, s.wal.NextSegment())
+	}
+	require.NoError(t, s.Truncate(0))
+	require.NoError(t, s.Close())
+
+	s, err = NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), walDir)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	// Series are available as soon as the storage is created, so appends for
+	// existing series reuse their refs.
+	app := s.Appender(context.Background())
+	ref, err := app.Append(0, labels.FromStrings("__name__", "foo"), 1000, 1)
+	require.NoError(t, err)
+	require.Equal(t, *payload[0].ref, ref)
+	require.NoError(t, app.Commit())
+
+	s.waitReplay()
+	require.Equal(t, float64(1), testutil.ToFloat64(s.metrics.replayProgress))
+
+	for series := range s.series.iterator().Channel() {
+		var expect int64
+		for _, metric := range payload {
+			if metric.name == series.lset.Get("__name__") {
+				expect = metric.samples[len(metric.samples)-1].ts
+			}
+		}
+		if series.lset.Get("__name__") == "foo" {
+			// The sample appended after the restart is newer than the replayed
+			// ones.
+			expect = 1000
+		}
+		require.Equal(t, expect, series.lastTs, "unexpected timestamp for %s", series.lset)
+	}
+}
+
+func TestStorage_Replay_CloseDuringReplay(t *testing.T) {
+	walDir := t.TempDir()
+
+	s, err := NewStorage(log.NewNopLogger(), nil, walDir)
+	require.NoError(t, err)
+
+	app := s.Appender(context.Background())
+	for _, metric := range buildSeries([]string{"foo", "bar"}) {
+		metric.Write(t, app)
+	}
+	require.NoError(t, app.Commit())
+	require.NoError(t, s.Close())
+
+	s, err = NewStorage(log.NewNopLogger(), nil, walDir)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	require.True(t, s.replayComplete())
+}
+
+func TestStorage_Compression(t *testing.T) {
+	walDir := t.TempDir()
+	payload := buildSeries([]string{"foo", "bar", "baz", "blerg"})
+
+	// Switching compression between restarts is safe since every record is
+	// flagged with whether it's compressed.
+	compressions := []Compression{CompressionNone, CompressionSnappy}
+	for i, compression := range compressions {
+		s, err := NewStorageWithOptions(log.NewNopLogger(), nil, walDir, Options{Compression: compression})
+		require.NoError(t, err)
+		require.Equal(t, compression == CompressionSnappy, s.wal.CompressionEnabled())
+
+		app := s.Appender(context.Background())
+		for _, metric := range payload[i*2 : i*2+2] {
+			metric.Write(t, app)
+		}
+		require.NoError(t, app.Commit())
+		require.NoError(t, s.Close())
+	}
+
+	collector := walDataCollector{}
+	replayer := walReplayer{w: &collector}
+	require.NoError(t, replayer.Replay(SubDirectory(walDir)))
+
+	names := []string{}
+	for _, series := range collector.series {
+		names = append(names, series.Labels.Get("__name__"))
+	}
+	require.Equal(t, payload.SeriesNames(), names)
+	require.Len(t, collector.samples, len(payload.ExpectedSamples()))
+}
+
+func TestCompression_Validate(t *testing.T) {
+	require.NoError(t, CompressionNone.Validate())
+	require.NoError(t, CompressionSnappy.Validate())
+	require.EqualError(t, Compression("zstd").Validate(), `unsupported WAL compression "zstd", must be "none" or "snappy"`)
+
+	_, err := NewStorageWithOptions(log.NewNopLogger(), nil, t.TempDir(), Options{Compression: "zstd"})
+	require.Error(t, err)
+}
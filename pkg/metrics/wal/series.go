@@ -135,10 +135,11 @@ func newStripeSeries() *stripeSeries {
 }
 
 // gc garbage collects old chunks that are strictly before mint and removes
-// series entirely that have no chunks left.
-func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]struct{} {
+// series entirely that have no chunks left. The labels of removed series are
+// returned by their ID.
+func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]labels.Labels {
 	var (
-		deleted = map[chunks.HeadSeriesRef]struct{}{}
+		deleted = map[chunks.HeadSeriesRef]labels.Labels{}
 	)
 
 	// Run through all series and find series that haven't been written to
@@ -174,7 +175,7 @@ func (s *stripeSeries) gc(mint int64) map[chunks.HeadSeriesRef]struct{} {
 				s.locks[j].Lock()
 			}
 
-			deleted[series.ref] = struct{}{}
+			deleted[series.ref] = series.lset
 			delete(s.series[i], series.ref)
 			s.hashes[j].del(seriesHash, series.ref)
 
@@ -227,6 +228,27 @@ func (s *stripeSeries) set(hash uint64, series *memSeries) {
 	s.locks[i].Unlock()
 }
 
+// getOrSet returns the series with the labels of series if one exists.
+// Otherwise, series is stored and returned. created is true if series was
+// stored.
+func (s *stripeSeries) getOrSet(hash uint64, series *memSeries) (actual *memSeries, created bool) {
+	i := hash & uint64(s.size-1)
+	s.locks[i].Lock()
+	if prev := s.hashes[i].get(hash, series.lset); prev != nil {
+		s.locks[i].Unlock()
+		return prev, false
+	}
+	s.hashes[i].set(hash, series)
+	s.locks[i].Unlock()
+
+	i = uint64(series.ref) & uint64(s.size-1)
+	s.locks[i].Lock()
+	s.series[i][series.ref] = series
+	s.locks[i].Unlock()
+
+	return series, true
+}
+
 func (s *stripeSeries) getLatestExemplar(id chunks.HeadSeriesRef) *exemplar.Exemplar {
 	i := id & chunks.HeadSeriesRef(s.size-1)
 
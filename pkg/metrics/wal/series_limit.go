@@ -0,0 +1,240 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// ErrSeriesLimit is returned when appending a sample for a new series which
+// would exceed a series limit.
+var ErrSeriesLimit = errors.New("series limit exceeded")
+
+// seriesLimitError is returned by Append when a series is rejected.
+type seriesLimitError struct {
+	metric string
+	limit  int
+	global bool
+}
+
+func (e seriesLimitError) Error() string {
+	if e.global {
+		return fmt.Sprintf("%s: creating a series for %q would exceed max_active_series of %d", ErrSeriesLimit, e.metric, e.limit)
+	}
+	return fmt.Sprintf("%s: creating a series for %q would exceed its limit of %d", ErrSeriesLimit, e.metric, e.limit)
+}
+
+func (e seriesLimitError) Is(target error) bool { return target == ErrSeriesLimit }
+
+// SeriesLimits limits the number of active series held by the WAL.
+type SeriesLimits struct {
+	// MaxActiveSeries is the maximum number of active series. 0 means
+	// unlimited.
+	MaxActiveSeries int
+
+	// PerMetric holds the maximum number of active series for individual
+	// metric names.
+	PerMetric map[string]int
+}
+
+// seriesLimiter tracks the number of active series and enforces
+// SeriesLimits when series are created.
+type seriesLimiter struct {
+	mut       sync.Mutex
+	limits    SeriesLimits
+	active    int
+	perMetric map[string]int // Active series for metrics in limits.PerMetric.
+}
+
+func newSeriesLimiter() *seriesLimiter {
+	return &seriesLimiter{perMetric: map[string]int{}}
+}
+
+// reserve reserves room for a new series. An error is returned if the series
+// would exceed a limit.
+func (l *seriesLimiter) reserve(lset labels.Labels) error {
+	name := lset.Get(labels.MetricName)
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	limit, hasLimit := l.limits.PerMetric[name]
+	switch {
+	case l.limits.MaxActiveSeries > 0 && l.active >= l.limits.MaxActiveSeries:
+		return seriesLimitError{metric: name, limit: l.limits.MaxActiveSeries, global: true}
+	case hasLimit && l.perMetric[name] >= limit:
+		return seriesLimitError{metric: name, limit: limit}
+	}
+
+	l.active++
+	if hasLimit {
+		l.perMetric[name]++
+	}
+	return nil
+}
+
+// add tracks a new series without enforcing limits. It's used for series
+// loaded from an existing WAL.
+func (l *seriesLimiter) add(lset labels.Labels) {
+	name := lset.Get(labels.MetricName)
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.active++
+	if _, ok := l.limits.PerMetric[name]; ok {
+		l.perMetric[name]++
+	}
+}
+
+// release stops tracking a deleted series.
+func (l *seriesLimiter) release(lset labels.Labels) {
+	name := lset.Get(labels.MetricName)
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.active--
+	if _, ok := l.perMetric[name]; ok {
+		l.perMetric[name]--
+	}
+}
+
+// SetSeriesLimits limits the number of active series. Existing series are
+// never removed to satisfy the limits; new series are rejected until enough
+// series have been garbage collected by truncation.
+//
+// Samples for rejected series return an error which wraps ErrSeriesLimit.
+// Callers which should only drop the rejected samples, such as the scrape
+// loop, must check for ErrSeriesLimit themselves.
+func (w *Storage) SetSeriesLimits(limits SeriesLimits) {
+	// Count existing series of metrics with their own limit. This is done
+	// before taking the lock, since iterating blocks series from being
+	// created.
+	perMetric := make(map[string]int, len(limits.PerMetric))
+	for name := range limits.PerMetric {
+		perMetric[name] = 0
+	}
+	if len(perMetric) > 0 {
+		for series := range w.series.iterator().Channel() {
+			name := series.lset.Get(labels.MetricName)
+			if _, ok := perMetric[name]; ok {
+				perMetric[name]++
+			}
+		}
+	}
+
+	w.seriesLimiter.mut.Lock()
+	defer w.seriesLimiter.mut.Unlock()
+
+	w.seriesLimiter.limits = limits
+	w.seriesLimiter.perMetric = perMetric
+	w.metrics.seriesLimit.Set(float64(limits.MaxActiveSeries))
+}
+
+// CardinalityStats describes the active series held by the WAL.
+type CardinalityStats struct {
+	ActiveSeries    int `json:"active_series"`
+	MaxActiveSeries int `json:"max_active_series"`
+
+	// Metric names with the most active series.
+	SeriesCountByMetricName []MetricSeriesCount `json:"series_count_by_metric_name"`
+
+	// Label names with the most distinct values.
+	LabelValueCountByLabelName []LabelValueCount `json:"label_value_count_by_label_name"`
+}
+
+// MetricSeriesCount is the number of active series for a metric name.
+type MetricSeriesCount struct {
+	Name   string `json:"name"`
+	Series int    `json:"series"`
+
+	// Limit is the series limit for the metric name. 0 if the metric has no
+	// limit of its own.
+	Limit int `json:"limit,omitempty"`
+}
+
+// LabelValueCount is the number of distinct values of a label name across
+// active series.
+type LabelValueCount struct {
+	Name   string `json:"name"`
+	Values int    `json:"values"`
+}
+
+// Cardinality returns statistics about the active series held by the WAL,
+// including the top limit metric names and label names. If limit is 0, every
+// metric name and label name is returned.
+func (w *Storage) Cardinality(limit int) CardinalityStats {
+	var (
+		seriesByMetric = map[string]int{}
+		labelValues    = map[string]map[string]struct{}{}
+		active         int
+	)
+	for series := range w.series.iterator().Channel() {
+		active++
+		for _, l := range series.lset {
+			if l.Name == labels.MetricName {
+				seriesByMetric[l.Value]++
+				continue
+			}
+			values, ok := labelValues[l.Name]
+			if !ok {
+				values = map[string]struct{}{}
+				labelValues[l.Name] = values
+			}
+			values[l.Value] = struct{}{}
+		}
+	}
+
+	w.seriesLimiter.mut.Lock()
+	limits := w.seriesLimiter.limits
+	w.seriesLimiter.mut.Unlock()
+
+	stats := CardinalityStats{
+		ActiveSeries:               active,
+		MaxActiveSeries:            limits.MaxActiveSeries,
+		SeriesCountByMetricName:    make([]MetricSeriesCount, 0, len(seriesByMetric)),
+		LabelValueCountByLabelName: make([]LabelValueCount, 0, len(labelValues)),
+	}
+	for name, count := range seriesByMetric {
+		stats.SeriesCountByMetricName = append(stats.SeriesCountByMetricName, MetricSeriesCount{
+			Name:   name,
+			Series: count,
+			Limit:  limits.PerMetric[name],
+		})
+	}
+	for name, values := range labelValues {
+		stats.LabelValueCountByLabelName = append(stats.LabelValueCountByLabelName, LabelValueCount{
+			Name:   name,
+			Values: len(values),
+		})
+	}
+
+	sort.Slice(stats.SeriesCountByMetricName, func(i, j int) bool {
+		a, b := stats.SeriesCountByMetricName[i], stats.SeriesCountByMetricName[j]
+		if a.Series != b.Series {
+			return a.Series > b.Series
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(stats.LabelValueCountByLabelName, func(i, j int) bool {
+		a, b := stats.LabelValueCountByLabelName[i], stats.LabelValueCountByLabelName[j]
+		if a.Values != b.Values {
+			return a.Values > b.Values
+		}
+		return a.Name < b.Name
+	})
+
+	if limit > 0 {
+		if len(stats.SeriesCountByMetricName) > limit {
+			stats.SeriesCountByMetricName = stats.SeriesCountByMetricName[:limit]
+		}
+		if len(stats.LabelValueCountByLabelName) > limit {
+			stats.LabelValueCountByLabelName = stats.LabelValueCountByLabelName[:limit]
+		}
+	}
+	return stats
+}
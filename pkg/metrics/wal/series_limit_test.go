@@ -0,0 +1,140 @@
+package wal
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_SeriesLimits(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	app := s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "existing", "pod", "1"), 100, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	s.SetSeriesLimits(SeriesLimits{
+		MaxActiveSeries: 4,
+		PerMetric:       map[string]int{"existing": 1, "noisy": 2},
+	})
+
+	app = s.Appender(context.Background())
+	for _, tc := range []struct {
+		lset labels.Labels
+		err  bool
+	}{
+		// Existing series keep being accepted.
+		{lset: labels.FromStrings("__name__", "existing", "pod", "1")},
+		{lset: labels.FromStrings("__name__", "existing", "pod", "2"), err: true},
+		{lset: labels.FromStrings("__name__", "noisy", "pod", "1")},
+		{lset: labels.FromStrings("__name__", "noisy", "pod", "2")},
+		{lset: labels.FromStrings("__name__", "noisy", "pod", "3"), err: true},
+		{lset: labels.FromStrings("__name__", "other", "pod", "1")},
+		{lset: labels.FromStrings("__name__", "other", "pod", "2"), err: true},
+	} {
+		_, err := app.Append(0, tc.lset, 200, 1)
+		if !tc.err {
+			require.NoError(t, err, tc.lset.String())
+			continue
+		}
+		require.ErrorIs(t, err, ErrSeriesLimit, tc.lset.String())
+	}
+	require.NoError(t, app.Commit())
+
+	require.Equal(t, float64(1), testutil.ToFloat64(s.metrics.rejectedSeries.WithLabelValues("existing")))
+	require.Equal(t, float64(1), testutil.ToFloat64(s.metrics.rejectedSeries.WithLabelValues("noisy")))
+	require.Equal(t, float64(1), testutil.ToFloat64(s.metrics.rejectedSeries.WithLabelValues("other")))
+
+	// Garbage collected series make room for new series.
+	s.gc(300)
+	s.gc(300)
+
+	app = s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "noisy", "pod", "3"), 400, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+}
+
+func TestStorage_SeriesLimits_ConcurrentCreation(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	const numSeries = 1000
+	s.SetSeriesLimits(SeriesLimits{MaxActiveSeries: numSeries})
+
+	// Appenders racing to create the same series must only count each series
+	// once against the limit.
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			app := s.Appender(context.Background())
+			for j := 0; j < numSeries; j++ {
+				_, err := app.Append(0, labels.FromStrings("__name__", "metric", "series", strconv.Itoa(j)), 100, 1)
+				require.NoError(t, err)
+			}
+			require.NoError(t, app.Commit())
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	s.seriesLimiter.mut.Lock()
+	defer s.seriesLimiter.mut.Unlock()
+	require.Equal(t, numSeries, s.seriesLimiter.active)
+}
+
+func TestStorage_Cardinality(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), nil, t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+	s.SetSeriesLimits(SeriesLimits{PerMetric: map[string]int{"b": 10}})
+
+	app := s.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "a", "pod", "1"),
+		labels.FromStrings("__name__", "b", "pod", "1"),
+		labels.FromStrings("__name__", "b", "pod", "2"),
+		labels.FromStrings("__name__", "b", "pod", "3", "container", "x"),
+		labels.FromStrings("__name__", "c", "pod", "1"),
+	} {
+		_, err := app.Append(0, lset, 100, 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	require.Equal(t, CardinalityStats{
+		ActiveSeries: 5,
+		SeriesCountByMetricName: []MetricSeriesCount{
+			{Name: "b", Series: 3, Limit: 10},
+			{Name: "a", Series: 1},
+		},
+		LabelValueCountByLabelName: []LabelValueCount{
+			{Name: "pod", Values: 3},
+			{Name: "container", Values: 1},
+		},
+	}, s.Cardinality(2))
+}
@@ -0,0 +1,205 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/tsdb/wal"
+)
+
+// SizeLimitPolicy determines what happens when the WAL grows past its size
+// limit.
+type SizeLimitPolicy string
+
+const (
+	// SizeLimitDropOldest removes the oldest segments from the WAL until it
+	// fits within the size limit again. Samples in removed segments are lost,
+	// even if they haven't been sent over remote_write yet. Series records are
+	// kept in a checkpoint.
+	SizeLimitDropOldest SizeLimitPolicy = "drop_oldest"
+
+	// SizeLimitRejectAppends rejects new samples until truncation brings the
+	// WAL back under its size limit. Series records are still written so
+	// series references stay valid.
+	SizeLimitRejectAppends SizeLimitPolicy = "reject_appends"
+)
+
+// Validate returns an error if p isn't a known policy.
+func (p SizeLimitPolicy) Validate() error {
+	switch p {
+	case SizeLimitDropOldest, SizeLimitRejectAppends:
+		return nil
+	default:
+		return fmt.Errorf("unknown WAL size limit policy %q, must be %q or %q", p, SizeLimitDropOldest, SizeLimitRejectAppends)
+	}
+}
+
+// ErrWALFull is returned when committing samples which were rejected because
+// the WAL is over its size limit.
+var ErrWALFull = errors.New("WAL is over its size limit")
+
+// SetSizeLimit bounds the size of the WAL on disk to maxBytes. policy
+// determines what happens once the limit is exceeded. A maxBytes of 0
+// disables the limit.
+func (w *Storage) SetSizeLimit(maxBytes int64, policy SizeLimitPolicy) {
+	w.sizeLimitMtx.Lock()
+	defer w.sizeLimitMtx.Unlock()
+
+	w.maxBytes = maxBytes
+	w.sizePolicy = policy
+	w.metrics.sizeLimitBytes.Set(float64(maxBytes))
+}
+
+// overSizeLimit returns true if the WAL is over its size limit and the limit
+// is enforced with policy.
+func (w *Storage) overSizeLimit(policy SizeLimitPolicy) bool {
+	w.sizeLimitMtx.RLock()
+	defer w.sizeLimitMtx.RUnlock()
+
+	return w.maxBytes > 0 && w.sizePolicy == policy && w.size.Load() > w.maxBytes
+}
+
+// logRecord writes rec to the WAL, tracking the number of bytes written.
+func (w *Storage) logRecord(rec []byte) error {
+	if err := w.wal.Log(rec); err != nil {
+		return err
+	}
+	w.metrics.sizeBytes.Set(float64(w.size.Add(int64(len(rec)))))
+	return nil
+}
+
+// refreshSize sets the tracked size of the WAL to its size on disk. The size
+// tracked by logRecord is approximate and drifts as segments are padded, so it
+// is refreshed whenever segments are removed.
+func (w *Storage) refreshSize() {
+	size, err := dirSize(w.wal.Dir())
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to calculate size of WAL", "err", err)
+		return
+	}
+	w.size.Store(size)
+	w.metrics.sizeBytes.Set(float64(size))
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed by a concurrent truncation.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// enforceSizeLimit removes the oldest segments from the WAL until it fits
+// within its size limit. It is a no-op if another call is already in
+// progress.
+func (w *Storage) enforceSizeLimit() {
+	if !w.enforcingSize.CAS(false, true) {
+		return
+	}
+	defer w.enforcingSize.Store(false)
+
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		return
+	}
+
+	// Segments can't be removed while they're still being replayed. The limit
+	// is enforced on a later commit instead.
+	if !w.replayComplete() {
+		return
+	}
+
+	if err := w.truncateToSize(); err != nil {
+		level.Warn(w.logger).Log("msg", "could not truncate WAL to its size limit", "err", err)
+	}
+}
+
+// truncateToSize checkpoints and removes the oldest segments until the WAL
+// is under its size limit. walMtx must be held for reading.
+func (w *Storage) truncateToSize() error {
+	w.truncateMtx.Lock()
+	defer w.truncateMtx.Unlock()
+
+	w.sizeLimitMtx.RLock()
+	maxBytes := w.maxBytes
+	w.sizeLimitMtx.RUnlock()
+
+	// Start a new segment so every segment written to so far may be removed.
+	if err := w.wal.NextSegment(); err != nil {
+		return fmt.Errorf("next segment: %w", err)
+	}
+
+	start := time.Now()
+	w.refreshSize()
+
+	first, last, err := wal.Segments(w.wal.Dir())
+	if err != nil {
+		return fmt.Errorf("get segment range: %w", err)
+	}
+	last-- // Never remove the segment being written to.
+
+	var (
+		size = w.size.Load()
+		cut  = first - 1
+	)
+	for size > maxBytes && cut < last {
+		cut++
+		fi, err := os.Stat(wal.SegmentName(w.wal.Dir(), cut))
+		if err != nil {
+			return fmt.Errorf("stat segment %d: %w", cut, err)
+		}
+		size -= fi.Size()
+	}
+	if cut < first {
+		return nil
+	}
+
+	// Samples in the removed segments are dropped by checkpointing with a
+	// mint nothing can be newer than. Series records are kept.
+	stats, err := wal.Checkpoint(w.logger, w.wal, first, cut, w.keepSeries, math.MaxInt64)
+	if err != nil {
+		return fmt.Errorf("create checkpoint: %w", err)
+	}
+	w.metrics.droppedSamples.WithLabelValues(droppedReasonTruncated).Add(float64(stats.DroppedSamples))
+
+	if err := w.wal.Truncate(cut + 1); err != nil {
+		// Leftover segments are ignored once a checkpoint supersedes them, and
+		// will be removed by the next truncation.
+		level.Error(w.logger).Log("msg", "truncating segments failed", "err", err)
+	}
+	w.forgetDeletedSeries(cut)
+	if err := wal.DeleteCheckpoints(w.wal.Dir(), cut); err != nil {
+		level.Error(w.logger).Log("msg", "delete old checkpoints", "err", err)
+	}
+	w.refreshSize()
+	w.metrics.sizeTruncations.Inc()
+
+	level.Warn(w.logger).Log("msg", "WAL exceeded its size limit, dropped oldest segments",
+		"first", first, "last", cut, "dropped_samples", stats.DroppedSamples,
+		"size", w.size.Load(), "max_size", maxBytes, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,122 @@
+package wal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/wal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_SizeLimit_DropOldest(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	// Spread the payload over a few segments.
+	payload := buildSeries([]string{"foo", "bar", "baz", "blerg"})
+	for _, metric := range payload {
+		app := s.Appender(context.Background())
+		metric.Write(t, app)
+		require.NoError(t, app.Commit())
+		require.NoError(t, s.wal.NextSegment())
+	}
+
+	// Segments aren't removed while samples are being replayed.
+	s.waitReplay()
+
+	first, _, err := wal.Segments(s.wal.Dir())
+	require.NoError(t, err)
+	require.Greater(t, s.size.Load(), int64(0))
+
+	// Setting a limit of 1 byte forces every segment written so far to be
+	// removed on the next commit.
+	s.SetSizeLimit(1, SizeLimitDropOldest)
+
+	app := s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "new"), 100, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(s.metrics.sizeTruncations) >= 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	newFirst, _, err := wal.Segments(s.wal.Dir())
+	require.NoError(t, err)
+	require.Greater(t, newFirst, first)
+	require.Equal(t, float64(len(payload.ExpectedSamples())+1), testutil.ToFloat64(s.metrics.droppedSamples.WithLabelValues(droppedReasonTruncated)))
+
+	// Series records must survive in the checkpoint, even though all of their
+	// samples were dropped.
+	collector := walDataCollector{}
+	replayer := walReplayer{w: &collector}
+	require.NoError(t, replayer.Replay(s.wal.Dir()))
+
+	names := map[string]struct{}{}
+	for _, series := range collector.series {
+		names[series.Labels.Get("__name__")] = struct{}{}
+	}
+	for _, name := range append(payload.SeriesNames(), "new") {
+		require.Contains(t, names, name)
+	}
+	require.Empty(t, collector.samples)
+}
+
+func TestStorage_SizeLimit_RejectAppends(t *testing.T) {
+	s, err := NewStorage(log.NewNopLogger(), prometheus.NewRegistry(), t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Close())
+	}()
+
+	app := s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "foo"), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	s.SetSizeLimit(1, SizeLimitRejectAppends)
+
+	app = s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "foo"), 2, 2)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "bar"), 2, 2)
+	require.NoError(t, err)
+	require.ErrorIs(t, app.Commit(), ErrWALFull)
+	require.Equal(t, float64(2), testutil.ToFloat64(s.metrics.droppedSamples.WithLabelValues(droppedReasonRejected)))
+
+	// The series record for bar was written even though its sample was
+	// rejected.
+	collector := walDataCollector{}
+	replayer := walReplayer{w: &collector}
+	require.NoError(t, replayer.Replay(s.wal.Dir()))
+
+	var names []string
+	for _, series := range collector.series {
+		names = append(names, series.Labels.Get("__name__"))
+	}
+	require.ElementsMatch(t, []string{"foo", "bar"}, names)
+	require.Len(t, collector.samples, 1)
+
+	// Lifting the limit accepts samples again.
+	s.SetSizeLimit(0, SizeLimitRejectAppends)
+
+	app = s.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "foo"), 3, 3)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+}
+
+func TestSizeLimitPolicy_Validate(t *testing.T) {
+	require.NoError(t, SizeLimitDropOldest.Validate())
+	require.NoError(t, SizeLimitRejectAppends.Validate())
+	require.Error(t, SizeLimitPolicy("").Validate())
+	require.Error(t, SizeLimitPolicy("drop_newest").Validate())
+}
@@ -37,8 +37,21 @@ type storageMetrics struct {
 	totalRemovedSeries     prometheus.Counter
 	totalAppendedSamples   prometheus.Counter
 	totalAppendedExemplars prometheus.Counter
+	replayProgress         prometheus.Gauge
+	sizeBytes              prometheus.Gauge
+	sizeLimitBytes         prometheus.Gauge
+	sizeTruncations        prometheus.Counter
+	droppedSamples         *prometheus.CounterVec
+	seriesLimit            prometheus.Gauge
+	rejectedSeries         *prometheus.CounterVec
 }
 
+// Reasons samples are dropped because of the WAL size limit.
+const (
+	droppedReasonTruncated = "truncated"
+	droppedReasonRejected  = "rejected"
+)
+
 func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
 	m := storageMetrics{r: r}
 	m.numActiveSeries = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -71,6 +84,41 @@ func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
 		Help: "Total number of exemplars appended to the WAL",
 	})
 
+	m.replayProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_replay_progress",
+		Help: "Progress of replaying WAL samples at startup, from 0 to 1. The WAL accepts appends once series have been replayed, before samples are",
+	})
+
+	m.sizeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_size_bytes",
+		Help: "Approximate size of the WAL on disk in bytes",
+	})
+
+	m.sizeLimitBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_size_limit_bytes",
+		Help: "Maximum size of the WAL on disk in bytes. 0 if unlimited.",
+	})
+
+	m.sizeTruncations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agent_wal_storage_size_truncations_total",
+		Help: "Total number of times the oldest segments were removed because the WAL exceeded its size limit",
+	})
+
+	m.droppedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agent_wal_samples_dropped_total",
+		Help: "Total number of samples dropped because the WAL exceeded its size limit",
+	}, []string{"reason"})
+
+	m.seriesLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_wal_storage_series_limit",
+		Help: "Maximum number of active series in the WAL storage. 0 if unlimited.",
+	})
+
+	m.rejectedSeries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agent_wal_storage_rejected_series_total",
+		Help: "Total number of samples rejected because creating their series would exceed a series limit, by metric name",
+	}, []string{"metric"})
+
 	if r != nil {
 		r.MustRegister(
 			m.numActiveSeries,
@@ -79,6 +127,13 @@ func newStorageMetrics(r prometheus.Registerer) *storageMetrics {
 			m.totalRemovedSeries,
 			m.totalAppendedSamples,
 			m.totalAppendedExemplars,
+			m.replayProgress,
+			m.sizeBytes,
+			m.sizeLimitBytes,
+			m.sizeTruncations,
+			m.droppedSamples,
+			m.seriesLimit,
+			m.rejectedSeries,
 		)
 	}
 
@@ -96,6 +151,13 @@ func (m *storageMetrics) Unregister() {
 		m.totalRemovedSeries,
 		m.totalAppendedSamples,
 		m.totalAppendedExemplars,
+		m.replayProgress,
+		m.sizeBytes,
+		m.sizeLimitBytes,
+		m.sizeTruncations,
+		m.droppedSamples,
+		m.seriesLimit,
+		m.rejectedSeries,
 	}
 	for _, c := range cs {
 		m.r.Unregister(c)
@@ -104,8 +166,8 @@ func (m *storageMetrics) Unregister() {
 
 // Storage implements storage.Storage, and just writes to the WAL.
 type Storage struct {
-	// Embed Queryable/ChunkQueryable for compatibility, but don't actually implement it.
-	storage.Queryable
+	// Embed ChunkQueryable for compatibility, but don't actually implement it.
+	// Queryable is implemented in querier.go.
 	storage.ChunkQueryable
 
 	// Operations against the WAL must be protected by a mutex so it doesn't get
@@ -115,6 +177,10 @@ type Storage struct {
 	walMtx    sync.RWMutex
 	walClosed bool
 
+	// truncateMtx prevents time-based and size-based truncations from running
+	// at the same time.
+	truncateMtx sync.Mutex
+
 	path   string
 	wal    *wal.WAL
 	logger log.Logger
@@ -125,27 +191,89 @@ type Storage struct {
 	ref    *atomic.Uint64
 	series *stripeSeries
 
+	seriesLimiter *seriesLimiter
+
 	deletedMtx sync.Mutex
 	deleted    map[chunks.HeadSeriesRef]int // Deleted series, and what WAL segment they must be kept until.
 
+	size          *atomic.Int64 // Approximate size of the WAL on disk.
+	enforcingSize atomic.Bool
+
+	sizeLimitMtx sync.RWMutex
+	maxBytes     int64
+	sizePolicy   SizeLimitPolicy
+
+	// replayDone is closed once samples have been replayed in the background.
+	// Closing replayStop interrupts the replay.
+	replayDone     chan struct{}
+	replayStop     chan struct{}
+	replayStopOnce sync.Once
+
 	metrics *storageMetrics
 }
 
-// NewStorage makes a new Storage.
+// Options configures a Storage.
+type Options struct {
+	// Compression applied to WAL records.
+	Compression Compression
+}
+
+// DefaultOptions holds the default settings for a Storage.
+var DefaultOptions = Options{
+	Compression: CompressionSnappy,
+}
+
+// Compression is a compression algorithm for WAL records.
+type Compression string
+
+// Supported compression algorithms.
+const (
+	CompressionNone   Compression = "none"
+	CompressionSnappy Compression = "snappy"
+)
+
+// Validate returns an error if c isn't supported.
+func (c Compression) Validate() error {
+	switch c {
+	case CompressionNone, CompressionSnappy:
+		return nil
+	default:
+		// Other algorithms, like zstd, can't be supported: remote_write reads
+		// the WAL with the Prometheus WAL reader, which only understands snappy.
+		return fmt.Errorf("unsupported WAL compression %q, must be %q or %q", c, CompressionNone, CompressionSnappy)
+	}
+}
+
+// NewStorage makes a new Storage with DefaultOptions.
 func NewStorage(logger log.Logger, registerer prometheus.Registerer, path string) (*Storage, error) {
-	w, err := wal.NewSize(logger, registerer, SubDirectory(path), wal.DefaultSegmentSize, true)
+	return NewStorageWithOptions(logger, registerer, path, DefaultOptions)
+}
+
+// NewStorageWithOptions makes a new Storage. It returns once series have been
+// loaded from an existing WAL; samples continue to be replayed in the
+// background.
+func NewStorageWithOptions(logger log.Logger, registerer prometheus.Registerer, path string, opts Options) (*Storage, error) {
+	if err := opts.Compression.Validate(); err != nil {
+		return nil, err
+	}
+
+	w, err := wal.NewSize(logger, registerer, SubDirectory(path), wal.DefaultSegmentSize, opts.Compression == CompressionSnappy)
 	if err != nil {
 		return nil, err
 	}
 
 	storage := &Storage{
-		path:    path,
-		wal:     w,
-		logger:  logger,
-		deleted: map[chunks.HeadSeriesRef]int{},
-		series:  newStripeSeries(),
-		metrics: newStorageMetrics(registerer),
-		ref:     atomic.NewUint64(0),
+		path:          path,
+		wal:           w,
+		logger:        logger,
+		deleted:       map[chunks.HeadSeriesRef]int{},
+		series:        newStripeSeries(),
+		seriesLimiter: newSeriesLimiter(),
+		metrics:       newStorageMetrics(registerer),
+		ref:           atomic.NewUint64(0),
+		size:          atomic.NewInt64(0),
+		replayDone:    make(chan struct{}),
+		replayStop:    make(chan struct{}),
 	}
 
 	storage.bufPool.New = func() interface{} {
@@ -183,197 +311,10 @@ func NewStorage(logger log.Logger, registerer prometheus.Registerer, path string
 		}
 	}
 
+	storage.refreshSize()
 	return storage, nil
 }
 
-func (w *Storage) replayWAL() error {
-	w.walMtx.RLock()
-	defer w.walMtx.RUnlock()
-
-	if w.walClosed {
-		return ErrWALClosed
-	}
-
-	level.Info(w.logger).Log("msg", "replaying WAL, this may take a while", "dir", w.wal.Dir())
-	dir, startFrom, err := wal.LastCheckpoint(w.wal.Dir())
-	if err != nil && err != record.ErrNotFound {
-		return fmt.Errorf("find last checkpoint: %w", err)
-	}
-
-	if err == nil {
-		sr, err := wal.NewSegmentsReader(dir)
-		if err != nil {
-			return fmt.Errorf("open checkpoint: %w", err)
-		}
-		defer func() {
-			if err := sr.Close(); err != nil {
-				level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
-			}
-		}()
-
-		// A corrupted checkpoint is a hard error for now and requires user
-		// intervention. There's likely little data that can be recovered anyway.
-		if err := w.loadWAL(wal.NewReader(sr)); err != nil {
-			return fmt.Errorf("backfill checkpoint: %w", err)
-		}
-		startFrom++
-		level.Info(w.logger).Log("msg", "WAL checkpoint loaded")
-	}
-
-	// Find the last segment.
-	_, last, err := wal.Segments(w.wal.Dir())
-	if err != nil {
-		return fmt.Errorf("finding WAL segments: %w", err)
-	}
-
-	// Backfill segments from the most recent checkpoint onwards.
-	for i := startFrom; i <= last; i++ {
-		s, err := wal.OpenReadSegment(wal.SegmentName(w.wal.Dir(), i))
-		if err != nil {
-			return fmt.Errorf("open WAL segment %d: %w", i, err)
-		}
-
-		sr := wal.NewSegmentBufReader(s)
-		err = w.loadWAL(wal.NewReader(sr))
-		if err := sr.Close(); err != nil {
-			level.Warn(w.logger).Log("msg", "error while closing the wal segments reader", "err", err)
-		}
-		if err != nil {
-			return err
-		}
-		level.Info(w.logger).Log("msg", "WAL segment loaded", "segment", i, "maxSegment", last)
-	}
-
-	return nil
-}
-
-func (w *Storage) loadWAL(r *wal.Reader) (err error) {
-	var (
-		dec record.Decoder
-	)
-
-	var (
-		decoded    = make(chan interface{}, 10)
-		errCh      = make(chan error, 1)
-		seriesPool = sync.Pool{
-			New: func() interface{} {
-				return []record.RefSeries{}
-			},
-		}
-		samplesPool = sync.Pool{
-			New: func() interface{} {
-				return []record.RefSample{}
-			},
-		}
-	)
-
-	go func() {
-		defer close(decoded)
-		for r.Next() {
-			rec := r.Record()
-			switch dec.Type(rec) {
-			case record.Series:
-				series := seriesPool.Get().([]record.RefSeries)[:0]
-				series, err = dec.Series(rec, series)
-				if err != nil {
-					errCh <- &wal.CorruptionErr{
-						Err:     fmt.Errorf("decode series: %w", err),
-						Segment: r.Segment(),
-						Offset:  r.Offset(),
-					}
-					return
-				}
-				decoded <- series
-			case record.Samples:
-				samples := samplesPool.Get().([]record.RefSample)[:0]
-				samples, err = dec.Samples(rec, samples)
-				if err != nil {
-					errCh <- &wal.CorruptionErr{
-						Err:     fmt.Errorf("decode samples: %w", err),
-						Segment: r.Segment(),
-						Offset:  r.Offset(),
-					}
-				}
-				decoded <- samples
-			case record.Tombstones, record.Exemplars:
-				// We don't care about decoding tombstones or exemplars
-				// TODO: If decide to decode exemplars, we should make sure to prepopulate
-				// stripeSeries.exemplars in the next block by using setLatestExemplar.
-				continue
-			default:
-				errCh <- &wal.CorruptionErr{
-					Err:     fmt.Errorf("invalid record type %v", dec.Type(rec)),
-					Segment: r.Segment(),
-					Offset:  r.Offset(),
-				}
-				return
-			}
-		}
-	}()
-
-	var biggestRef uint64 = w.ref.Load()
-
-	for d := range decoded {
-		switch v := d.(type) {
-		case []record.RefSeries:
-			for _, s := range v {
-				// If this is a new series, create it in memory without a timestamp.
-				// If we read in a sample for it, we'll use the timestamp of the latest
-				// sample. Otherwise, the series is stale and will be deleted once
-				// the truncation is performed.
-				if w.series.getByID(s.Ref) == nil {
-					series := &memSeries{ref: s.Ref, lset: s.Labels, lastTs: 0}
-					w.series.set(s.Labels.Hash(), series)
-
-					w.metrics.numActiveSeries.Inc()
-					w.metrics.totalCreatedSeries.Inc()
-
-					if biggestRef <= uint64(s.Ref) {
-						biggestRef = uint64(s.Ref)
-					}
-				}
-			}
-
-			//nolint:staticcheck
-			seriesPool.Put(v)
-		case []record.RefSample:
-			for _, s := range v {
-				// Update the lastTs for the series based
-				series := w.series.getByID(s.Ref)
-				if series == nil {
-					level.Warn(w.logger).Log("msg", "found sample referencing non-existing series, skipping")
-					continue
-				}
-
-				series.Lock()
-				if s.T > series.lastTs {
-					series.lastTs = s.T
-				}
-				series.Unlock()
-			}
-
-			//nolint:staticcheck
-			samplesPool.Put(v)
-		default:
-			panic(fmt.Errorf("unexpected decoded type: %T", d))
-		}
-	}
-
-	w.ref.Store(biggestRef)
-
-	select {
-	case err := <-errCh:
-		return err
-	default:
-	}
-
-	if r.Err() != nil {
-		return fmt.Errorf("read records: %w", r.Err())
-	}
-
-	return nil
-}
-
 // Directory returns the path where the WAL storage is held.
 func (w *Storage) Directory() string {
 	return w.path
@@ -400,6 +341,13 @@ func (w *Storage) Truncate(mint int64) error {
 		return ErrWALClosed
 	}
 
+	w.truncateMtx.Lock()
+	defer w.truncateMtx.Unlock()
+
+	// Series which haven't had their last timestamp restored yet would be
+	// garbage collected.
+	w.waitReplay()
+
 	start := time.Now()
 
 	// Garbage collect series that haven't received an update since mint.
@@ -430,17 +378,7 @@ func (w *Storage) Truncate(mint int64) error {
 		return nil
 	}
 
-	keep := func(id chunks.HeadSeriesRef) bool {
-		if w.series.getByID(id) != nil {
-			return true
-		}
-
-		w.deletedMtx.Lock()
-		_, ok := w.deleted[id]
-		w.deletedMtx.Unlock()
-		return ok
-	}
-	if _, err = wal.Checkpoint(w.logger, w.wal, first, last, keep, mint); err != nil {
+	if _, err = wal.Checkpoint(w.logger, w.wal, first, last, w.keepSeries, mint); err != nil {
 		return fmt.Errorf("create checkpoint: %w", err)
 	}
 	if err := w.wal.Truncate(last + 1); err != nil {
@@ -452,15 +390,7 @@ func (w *Storage) Truncate(mint int64) error {
 
 	// The checkpoint is written and segments before it is truncated, so we no
 	// longer need to track deleted series that are before it.
-	w.deletedMtx.Lock()
-	for ref, segment := range w.deleted {
-		if segment < first {
-			delete(w.deleted, ref)
-			w.metrics.totalRemovedSeries.Inc()
-		}
-	}
-	w.metrics.numDeletedSeries.Set(float64(len(w.deleted)))
-	w.deletedMtx.Unlock()
+	w.forgetDeletedSeries(first - 1)
 
 	if err := wal.DeleteCheckpoints(w.wal.Dir(), last); err != nil {
 		// Leftover old checkpoints do not cause problems down the line beyond
@@ -468,16 +398,48 @@ func (w *Storage) Truncate(mint int64) error {
 		// They will just be ignored since a higher checkpoint exists.
 		level.Error(w.logger).Log("msg", "delete old checkpoints", "err", err)
 	}
+	w.refreshSize()
 
 	level.Info(w.logger).Log("msg", "WAL checkpoint complete",
 		"first", first, "last", last, "duration", time.Since(start))
 	return nil
 }
 
+// keepSeries returns true if series records for id must be kept when
+// checkpointing.
+func (w *Storage) keepSeries(id chunks.HeadSeriesRef) bool {
+	if w.series.getByID(id) != nil {
+		return true
+	}
+
+	w.deletedMtx.Lock()
+	_, ok := w.deleted[id]
+	w.deletedMtx.Unlock()
+	return ok
+}
+
+// forgetDeletedSeries stops tracking deleted series which only had to be
+// kept until segment or earlier.
+func (w *Storage) forgetDeletedSeries(segment int) {
+	w.deletedMtx.Lock()
+	defer w.deletedMtx.Unlock()
+
+	for ref, keepUntil := range w.deleted {
+		if keepUntil <= segment {
+			delete(w.deleted, ref)
+			w.metrics.totalRemovedSeries.Inc()
+		}
+	}
+	w.metrics.numDeletedSeries.Set(float64(len(w.deleted)))
+}
+
 // gc removes data before the minimum timestamp from the head.
 func (w *Storage) gc(mint int64) {
 	deleted := w.series.gc(mint)
 	w.metrics.numActiveSeries.Sub(float64(len(deleted)))
+	for _, lset := range deleted {
+		w.seriesLimiter.release(lset)
+	}
 
 	_, last, _ := wal.Segments(w.wal.Dir())
 	w.deletedMtx.Lock()
@@ -560,6 +522,11 @@ func (w *Storage) WriteStalenessMarkers(remoteTsFunc func() int64) error {
 
 // Close closes the storage and all its underlying resources.
 func (w *Storage) Close() error {
+	// Stop replaying samples first; other operations may be waiting on it
+	// while holding walMtx.
+	w.replayStopOnce.Do(func() { close(w.replayStop) })
+	w.waitReplay()
+
 	w.walMtx.Lock()
 	defer w.walMtx.Unlock()
 
@@ -595,8 +562,15 @@ func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v flo
 			return 0, fmt.Errorf("label name %q is not unique: %w", lbl, tsdb.ErrInvalidSample)
 		}
 
-		var created bool
-		series, created = a.getOrCreate(l)
+		var (
+			created bool
+			err     error
+		)
+		series, created, err = a.getOrCreate(l)
+		if err != nil {
+			a.w.metrics.rejectedSeries.WithLabelValues(l.Get(labels.MetricName)).Inc()
+			return 0, err
+		}
 		if created {
 			a.series = append(a.series, record.RefSeries{
 				Ref:    series.ref,
@@ -625,18 +599,26 @@ func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v flo
 	return storage.SeriesRef(series.ref), nil
 }
 
-func (a *appender) getOrCreate(l labels.Labels) (series *memSeries, created bool) {
+func (a *appender) getOrCreate(l labels.Labels) (series *memSeries, created bool, err error) {
 	hash := l.Hash()
 
 	series = a.w.series.getByHash(hash, l)
 	if series != nil {
-		return series, false
+		return series, false, nil
+	}
+
+	if err := a.w.seriesLimiter.reserve(l); err != nil {
+		return nil, false, err
 	}
 
+	// Another appender may have created the series since it was looked up,
+	// in which case the reservation isn't needed.
 	ref := chunks.HeadSeriesRef(a.w.ref.Inc())
-	series = &memSeries{ref: ref, lset: l}
-	a.w.series.set(l.Hash(), series)
-	return series, true
+	series, created = a.w.series.getOrSet(hash, &memSeries{ref: ref, lset: l})
+	if !created {
+		a.w.seriesLimiter.release(l)
+	}
+	return series, created, nil
 }
 
 func (a *appender) AppendExemplar(ref storage.SeriesRef, _ labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
@@ -698,25 +680,33 @@ func (a *appender) Commit() error {
 	var encoder record.Encoder
 	buf := a.w.bufPool.Get().([]byte)
 
+	// Series records are always written, even when samples are rejected, so
+	// references handed out by Append stay valid.
 	if len(a.series) > 0 {
 		buf = encoder.Series(a.series, buf)
-		if err := a.w.wal.Log(buf); err != nil {
+		if err := a.w.logRecord(buf); err != nil {
 			return err
 		}
 		buf = buf[:0]
 	}
 
-	if len(a.samples) > 0 {
+	var rejectErr error
+	if len(a.samples) > 0 && a.w.overSizeLimit(SizeLimitRejectAppends) {
+		a.w.metrics.droppedSamples.WithLabelValues(droppedReasonRejected).Add(float64(len(a.samples)))
+		rejectErr = fmt.Errorf("rejected %d samples: %w", len(a.samples), ErrWALFull)
+	}
+
+	if len(a.samples) > 0 && rejectErr == nil {
 		buf = encoder.Samples(a.samples, buf)
-		if err := a.w.wal.Log(buf); err != nil {
+		if err := a.w.logRecord(buf); err != nil {
 			return err
 		}
 		buf = buf[:0]
 	}
 
-	if len(a.exemplars) > 0 {
+	if len(a.exemplars) > 0 && rejectErr == nil {
 		buf = encoder.Exemplars(a.exemplars, buf)
-		if err := a.w.wal.Log(buf); err != nil {
+		if err := a.w.logRecord(buf); err != nil {
 			return err
 		}
 		buf = buf[:0]
@@ -734,7 +724,12 @@ func (a *appender) Commit() error {
 		}
 	}
 
-	return a.Rollback()
+	if a.w.overSizeLimit(SizeLimitDropOldest) {
+		go a.w.enforceSizeLimit()
+	}
+
+	_ = a.Rollback()
+	return rejectErr
 }
 
 func (a *appender) Rollback() error {
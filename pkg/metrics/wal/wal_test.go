@@ -177,7 +177,8 @@ func TestStorage_ExistingWAL(t *testing.T) {
 	}()
 
 	// Verify that the storage picked up existing series when it
-	// replayed the WAL.
+	// replayed the WAL. Samples are replayed in the background.
+	s.waitReplay()
 	for series := range s.series.iterator().Channel() {
 		require.Greater(t, series.lastTs, int64(0), "series timestamp not updated")
 	}
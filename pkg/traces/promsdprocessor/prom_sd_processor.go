@@ -259,29 +259,40 @@ func (p *promServiceDiscoProcessor) syncTargets(jobName string, group *targetgro
 			labels[model.LabelName(k)] = model.LabelValue(v)
 		}
 
-		address, ok := labels[model.AddressLabel]
+		host, ok := p.targetHost(labels)
 		if !ok {
-			level.Warn(p.logger).Log("msg", "ignoring target, unable to find address", "labels", labels.String())
 			continue
 		}
 
-		host := string(address)
-		if strings.Contains(host, ":") {
-			var err error
-			host, _, err = net.SplitHostPort(host)
-			if err != nil {
-				level.Warn(p.logger).Log("msg", "unable to split host port", "address", address, "err", err)
-				continue
-			}
-		}
+		level.Debug(p.logger).Log("msg", "adding host to hostLabels", "host", host)
+		hostLabels[host] = labels
+	}
+}
 
-		for k := range labels {
-			if strings.HasPrefix(string(k), "__") {
-				delete(labels, k)
-			}
+// targetHost returns the host of the target's address. Labels starting with a
+// double underscore are removed from labels. ok is false if the target should
+// be ignored.
+func (p *promServiceDiscoProcessor) targetHost(labels model.LabelSet) (host string, ok bool) {
+	address, ok := labels[model.AddressLabel]
+	if !ok {
+		level.Warn(p.logger).Log("msg", "ignoring target, unable to find address", "labels", labels.String())
+		return "", false
+	}
+
+	host = string(address)
+	if strings.Contains(host, ":") {
+		var err error
+		host, _, err = net.SplitHostPort(host)
+		if err != nil {
+			level.Warn(p.logger).Log("msg", "unable to split host port", "address", address, "err", err)
+			return "", false
 		}
+	}
 
-		level.Debug(p.logger).Log("msg", "adding host to hostLabels", "host", host)
-		hostLabels[host] = labels
+	for k := range labels {
+		if strings.HasPrefix(string(k), "__") {
+			delete(labels, k)
+		}
 	}
+	return host, true
 }
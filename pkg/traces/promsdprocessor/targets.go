@@ -0,0 +1,53 @@
+package promsdprocessor
+
+import (
+	"context"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+)
+
+// TargetsProcessor adds the labels of targets to spans coming from the same
+// IP address. Unlike the processor created by the factory, it doesn't run
+// service discovery itself; targets are provided through SetTargets.
+type TargetsProcessor struct {
+	*promServiceDiscoProcessor
+}
+
+var _ component.TracesProcessor = (*TargetsProcessor)(nil)
+
+// NewTargetsProcessor creates a new TargetsProcessor. It doesn't have any
+// targets until SetTargets is called.
+func NewTargetsProcessor(nextConsumer consumer.Traces, operationType string, podAssociations []string) (*TargetsProcessor, error) {
+	p, err := newTraceProcessor(nextConsumer, operationType, podAssociations, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TargetsProcessor{promServiceDiscoProcessor: p.(*promServiceDiscoProcessor)}, nil
+}
+
+// Start implements component.Component. There is no service discovery to
+// start.
+func (p *TargetsProcessor) Start(context.Context, component.Host) error {
+	return nil
+}
+
+// SetTargets replaces the set of targets used to find labels for spans.
+// Targets must have an __address__ label; labels starting with a double
+// underscore are not added to spans.
+func (p *TargetsProcessor) SetTargets(targets []model.LabelSet) {
+	hostLabels := make(map[string]model.LabelSet, len(targets))
+	for _, t := range targets {
+		labels := t.Clone()
+		host, ok := p.targetHost(labels)
+		if !ok {
+			continue
+		}
+		hostLabels[host] = labels
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.hostLabels = hostLabels
+}
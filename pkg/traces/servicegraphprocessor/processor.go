@@ -222,6 +222,7 @@ func (p *processor) unregisterMetrics() {
 		p.serviceGraphRequestServerHistogram,
 		p.serviceGraphRequestClientHistogram,
 		p.serviceGraphUnpairedSpansTotal,
+		p.serviceGraphDroppedSpansTotal,
 	}
 
 	for _, c := range cs {
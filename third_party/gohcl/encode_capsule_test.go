@@ -0,0 +1,67 @@
+package gohcl_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/rfratto/gohcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type testSecret string
+
+var testSecretType = cty.CapsuleWithOps("test secret", reflect.TypeOf(testSecret("")), &cty.CapsuleOps{
+	ExtensionData: func(key interface{}) interface{} {
+		if key != gohcl.CapsuleTokenExtensionKey {
+			return nil
+		}
+		return gohcl.CapsuleTokenExtension(func(cty.Value) hclwrite.Tokens {
+			return hclwrite.Tokens{
+				{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+				{Type: hclsyntax.TokenIdent, Bytes: []byte("secret")},
+				{Type: hclsyntax.TokenCParen, Bytes: []byte(")")},
+			}
+		})
+	},
+})
+
+func init() {
+	gohcl.RegisterCapsuleType(testSecretType)
+}
+
+func TestEncodeIntoBody_Capsules(t *testing.T) {
+	type inner struct {
+		Name  string     `hcl:"name,label"`
+		Token testSecret `hcl:"token,attr"`
+	}
+	type body struct {
+		Secrets map[string]*testSecret `hcl:"secrets,attr"`
+		List    []*testSecret          `hcl:"list,attr"`
+		Blocks  []inner                `hcl:"inner,block"`
+	}
+
+	secret := testSecret("hunter2")
+
+	f := hclwrite.NewEmptyFile()
+	gohcl.EncodeIntoBody(body{
+		Secrets: map[string]*testSecret{"password": &secret},
+		List:    []*testSecret{&secret, &secret},
+		Blocks:  []inner{{Name: "a", Token: secret}},
+	}, f.Body())
+
+	expect := strings.TrimSpace(`
+secrets = {
+  password = (secret)
+}
+list = [(secret), (secret)]
+
+inner "a" {
+  token = (secret)
+}`)
+	if actual := strings.TrimSpace(string(f.Bytes())); actual != expect {
+		t.Fatalf("unexpected output:\n%s", actual)
+	}
+}